@@ -10,11 +10,10 @@ import (
 	"fmt"
 	"os"
 
-	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
-	"github.com/rs/zerolog/log"
+	"github.com/konstructio/kubefirst/internal/gitShim"
 )
 
-func ValidateProvidedFlags(gitProvider, dnsProvider string) error {
+func ValidateProvidedFlags(gitHost, dnsProvider string) error {
 	if os.Getenv("LINODE_TOKEN") == "" {
 		return fmt.Errorf("your LINODE_TOKEN is not set - please set and re-run your last command")
 	}
@@ -25,19 +24,8 @@ func ValidateProvidedFlags(gitProvider, dnsProvider string) error {
 		}
 	}
 
-	switch gitProvider {
-	case "github":
-		key, err := internalssh.GetHostKey("github.com")
-		if err != nil {
-			return fmt.Errorf("failed to fetch github host key: %w", err)
-		}
-		log.Info().Msgf("%q %s", "github.com", key.Type())
-	case "gitlab":
-		key, err := internalssh.GetHostKey("gitlab.com")
-		if err != nil {
-			return fmt.Errorf("failed to fetch gitlab host key: %w", err)
-		}
-		log.Info().Msgf("%q %s", "gitlab.com", key.Type())
+	if err := gitShim.CheckKnownHost(gitHost); err != nil {
+		return err
 	}
 
 	return nil
@@ -14,6 +14,7 @@ import (
 	"github.com/konstructio/kubefirst/internal/catalog"
 	"github.com/konstructio/kubefirst/internal/cluster"
 	"github.com/konstructio/kubefirst/internal/common"
+	"github.com/konstructio/kubefirst/internal/credentials"
 	"github.com/konstructio/kubefirst/internal/provision"
 	"github.com/konstructio/kubefirst/internal/step"
 	"github.com/konstructio/kubefirst/internal/utilities"
@@ -112,7 +113,7 @@ func Create() *cobra.Command {
 				return wrerr
 			}
 
-			err = ValidateProvidedFlags(ctx, cfg, cliFlags.GitProvider, cliFlags.AMIType, cliFlags.NodeType)
+			err = ValidateProvidedFlags(ctx, cfg, cliFlags.GitHost, cliFlags.AMIType, cliFlags.NodeType)
 			if err != nil {
 				wrerr := fmt.Errorf("failed to validate provided flags: %w", err)
 				stepper.FailCurrentStep(wrerr)
@@ -219,5 +220,7 @@ func RootCredentials() *cobra.Command {
 		RunE:  common.GetRootCredentials,
 	}
 
+	credentials.AddFlags(authCmd)
+
 	return authCmd
 }
@@ -16,11 +16,10 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2Types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
-	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
-	"github.com/rs/zerolog/log"
+	"github.com/konstructio/kubefirst/internal/gitShim"
 )
 
-func ValidateProvidedFlags(ctx context.Context, cfg aws.Config, gitProvider, amiType, nodeType string) error {
+func ValidateProvidedFlags(ctx context.Context, cfg aws.Config, gitHost, amiType, nodeType string) error {
 	// Validate required environment variables for dns provider
 	if dnsProviderFlag == "cloudflare" {
 		if os.Getenv("CF_API_TOKEN") == "" {
@@ -28,19 +27,8 @@ func ValidateProvidedFlags(ctx context.Context, cfg aws.Config, gitProvider, ami
 		}
 	}
 
-	switch gitProvider {
-	case "github":
-		key, err := internalssh.GetHostKey("github.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan github.com >> ~/.ssh/known_hosts` to remedy: %w", err)
-		}
-		log.Info().Msgf("%q %s", "github.com", key.Type())
-	case "gitlab":
-		key, err := internalssh.GetHostKey("gitlab.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan gitlab.com >> ~/.ssh/known_hosts` to remedy: %w", err)
-		}
-		log.Info().Msgf("%q %s", "gitlab.com", key.Type())
+	if err := gitShim.CheckKnownHost(gitHost); err != nil {
+		return err
 	}
 
 	ssmClient := ssm.NewFromConfig(cfg)
@@ -14,6 +14,7 @@ import (
 	"github.com/konstructio/kubefirst/internal/catalog"
 	"github.com/konstructio/kubefirst/internal/cluster"
 	"github.com/konstructio/kubefirst/internal/common"
+	"github.com/konstructio/kubefirst/internal/credentials"
 	"github.com/konstructio/kubefirst/internal/provision"
 	"github.com/konstructio/kubefirst/internal/step"
 	"github.com/konstructio/kubefirst/internal/utilities"
@@ -76,7 +77,7 @@ func Create() *cobra.Command {
 				return wrerr
 			}
 
-			err = ValidateProvidedFlags(cliFlags.GitProvider)
+			err = ValidateProvidedFlags(cliFlags.GitHost)
 			if err != nil {
 				wrerr := fmt.Errorf("failed to validate provided flags: %w", err)
 				stepper.FailCurrentStep(wrerr)
@@ -149,5 +150,7 @@ func RootCredentials() *cobra.Command {
 	authCmd.Flags().Bool("kbot", false, "copy the kbot password to the clipboard (optional)")
 	authCmd.Flags().Bool("vault", false, "copy the vault password to the clipboard (optional)")
 
+	credentials.AddFlags(authCmd)
+
 	return authCmd
 }
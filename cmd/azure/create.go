@@ -10,8 +10,7 @@ import (
 	"fmt"
 	"os"
 
-	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
-	"github.com/rs/zerolog/log"
+	"github.com/konstructio/kubefirst/internal/gitShim"
 )
 
 // Environment variables required for authentication. This should be a
@@ -25,28 +24,15 @@ var envvarSecrets = []string{
 	"ARM_SUBSCRIPTION_ID",
 }
 
-func ValidateProvidedFlags(gitProvider string) error {
+func ValidateProvidedFlags(gitHost string) error {
 	for _, env := range envvarSecrets {
 		if os.Getenv(env) == "" {
 			return fmt.Errorf("your %s is not set - please set and re-run your last command", env)
 		}
 	}
 
-	switch gitProvider {
-	case "github":
-		key, err := internalssh.GetHostKey("github.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan github.com >> ~/.ssh/known_hosts` to remedy")
-		} else {
-			log.Info().Msgf("%s %s\n", "github.com", key.Type())
-		}
-	case "gitlab":
-		key, err := internalssh.GetHostKey("gitlab.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan gitlab.com >> ~/.ssh/known_hosts` to remedy")
-		} else {
-			log.Info().Msgf("%s %s\n", "gitlab.com", key.Type())
-		}
+	if err := gitShim.CheckKnownHost(gitHost); err != nil {
+		return err
 	}
 
 	return nil
@@ -0,0 +1,85 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package cmd
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/konstructio/kubefirst-api/pkg/configs"
+	"github.com/konstructio/kubefirst/internal/bundle"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
+	"github.com/konstructio/kubefirst/internal/launch"
+	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/spf13/cobra"
+)
+
+var bundleOptions bundle.CreateOptions
+
+func BundleCommand() *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "create installation bundles for air-gapped environments",
+		Long: `Create installation bundles containing every tool binary, helm chart, container
+image, template and Argo CD and vault-handler manifest needed by ` + "`launch up --bundle`" + ` and ` + "`k3d create --bundle`" + `.
+The git provider hosting the new gitops repositories must still be reachable.`,
+	}
+
+	bundleCmd.AddCommand(bundleCreate())
+
+	return bundleCmd
+}
+
+func bundleCreate() *cobra.Command {
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "collect the artifacts of this kubefirst release into a tarball",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			if bundleOptions.GitopsTemplateBranch == "" {
+				bundleOptions.GitopsTemplateBranch = configs.K1Version
+				if configs.K1Version == configs.DefaultK1Version {
+					bundleOptions.GitopsTemplateBranch = "main"
+				}
+			}
+			if bundleOptions.Output == "" {
+				bundleOptions.Output = fmt.Sprintf("kubefirst-bundle-%s-%s-%s.tar.gz", configs.K1Version, bundleOptions.OS, bundleOptions.Arch)
+			}
+			bundleOptions.Charts = []bundle.Chart{launch.ConsoleChart}
+			bundleOptions.Kustomizations = nil
+			for _, name := range []string{internalk3d.ArgoCDKustomization, internalk3d.VaultHandlerKustomization} {
+				bundleOptions.Kustomizations = append(bundleOptions.Kustomizations, bundle.Kustomization{Name: name, Path: internalk3d.KustomizationPaths[name]})
+			}
+
+			stepper.NewProgressStep("Creating bundle")
+			manifest, err := bundle.Create(cmd.Context(), bundleOptions)
+			if err != nil {
+				wrerr := fmt.Errorf("failed to create bundle: %w", err)
+				stepper.FailCurrentStep(wrerr)
+				return wrerr
+			}
+			stepper.CompleteCurrentStep()
+
+			stepper.InfoStep(step.EmojiCheck, fmt.Sprintf(
+				"bundle written to %q with %d tools, %d charts and %d images",
+				bundleOptions.Output, len(manifest.Tools), len(manifest.Charts), len(manifest.Images),
+			))
+			return nil
+		},
+	}
+
+	createCmd.Flags().StringVar(&bundleOptions.Output, "output", "", "the bundle archive to write (defaults to kubefirst-bundle-<version>-<os>-<arch>.tar.gz)")
+	createCmd.Flags().StringVar(&bundleOptions.OS, "os", runtime.GOOS, "the operating system the bundle is used on")
+	createCmd.Flags().StringVar(&bundleOptions.Arch, "arch", runtime.GOARCH, "the architecture the bundle is used on")
+	createCmd.Flags().StringVar(&bundleOptions.GitopsTemplateURL, "gitops-template-url", "https://github.com/konstructio/gitops-template.git", "the fully qualified url to the gitops-template repository to bundle")
+	createCmd.Flags().StringVar(&bundleOptions.GitopsTemplateBranch, "gitops-template-branch", "", "the branch or tag of the gitops-template repository to bundle (defaults to this kubefirst release)")
+	createCmd.Flags().StringSliceVar(&bundleOptions.ExtraImages, "image", []string{}, "an additional container image to bundle - can be used any number of times")
+	createCmd.Flags().BoolVar(&bundleOptions.SkipImages, "skip-images", false, "do not bundle container images")
+
+	return createCmd
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/konstructio/kubefirst/internal/catalog"
 	"github.com/konstructio/kubefirst/internal/cluster"
 	"github.com/konstructio/kubefirst/internal/common"
+	"github.com/konstructio/kubefirst/internal/credentials"
 	"github.com/konstructio/kubefirst/internal/provision"
 	"github.com/konstructio/kubefirst/internal/step"
 	"github.com/konstructio/kubefirst/internal/utilities"
@@ -83,7 +84,7 @@ func Create() *cobra.Command {
 
 			stepper.NewProgressStep("Validate Provided Flags")
 
-			err = ValidateProvidedFlags(cliFlags.GitProvider, cliFlags.DNSProvider)
+			err = ValidateProvidedFlags(cliFlags.GitHost, cliFlags.DNSProvider)
 			if err != nil {
 				wrerr := fmt.Errorf("error during flag validation: %w", err)
 				stepper.FailCurrentStep(wrerr)
@@ -170,5 +171,7 @@ func RootCredentials() *cobra.Command {
 	authCmd.Flags().Bool("kbot", false, "Copy the Kbot password to the clipboard (optional)")
 	authCmd.Flags().Bool("vault", false, "Copy the Vault password to the clipboard (optional)")
 
+	credentials.AddFlags(authCmd)
+
 	return authCmd
 }
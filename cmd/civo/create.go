@@ -10,11 +10,10 @@ import (
 	"fmt"
 	"os"
 
-	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
-	"github.com/rs/zerolog/log"
+	"github.com/konstructio/kubefirst/internal/gitShim"
 )
 
-func ValidateProvidedFlags(gitProvider, dnsProvider string) error {
+func ValidateProvidedFlags(gitHost, dnsProvider string) error {
 	if os.Getenv("CIVO_TOKEN") == "" {
 		return fmt.Errorf("your CIVO_TOKEN is not set - please set and re-run your last command")
 	}
@@ -26,19 +25,8 @@ func ValidateProvidedFlags(gitProvider, dnsProvider string) error {
 		}
 	}
 
-	switch gitProvider {
-	case "github":
-		key, err := internalssh.GetHostKey("github.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan github.com >> ~/.ssh/known_hosts` to remedy")
-		}
-		log.Info().Msgf("github.com %q", key.Type())
-	case "gitlab":
-		key, err := internalssh.GetHostKey("gitlab.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan gitlab.com >> ~/.ssh/known_hosts` to remedy")
-		}
-		log.Info().Msgf("gitlab.com %q", key.Type())
+	if err := gitShim.CheckKnownHost(gitHost); err != nil {
+		return err
 	}
 
 	return nil
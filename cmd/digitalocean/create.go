@@ -10,11 +10,10 @@ import (
 	"fmt"
 	"os"
 
-	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
-	"github.com/rs/zerolog/log"
+	"github.com/konstructio/kubefirst/internal/gitShim"
 )
 
-func ValidateProvidedFlags(gitProvider, dnsProvider string) error {
+func ValidateProvidedFlags(gitHost, dnsProvider string) error {
 	// Validate required environment variables for dns provider
 	if dnsProvider == "cloudflare" {
 		if os.Getenv("CF_API_TOKEN") == "" {
@@ -28,19 +27,8 @@ func ValidateProvidedFlags(gitProvider, dnsProvider string) error {
 		}
 	}
 
-	switch gitProvider {
-	case "github":
-		key, err := internalssh.GetHostKey("github.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan github.com >> ~/.ssh/known_hosts` to remedy")
-		}
-		log.Info().Msgf("%q %s", "github.com", key.Type())
-	case "gitlab":
-		key, err := internalssh.GetHostKey("gitlab.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan gitlab.com >> ~/.ssh/known_hosts` to remedy")
-		}
-		log.Info().Msgf("%q %s", "gitlab.com", key.Type())
+	if err := gitShim.CheckKnownHost(gitHost); err != nil {
+		return err
 	}
 
 	return nil
@@ -7,12 +7,14 @@ See the LICENSE file for more details.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 
 	"github.com/konstructio/kubefirst/internal/generate"
 	"github.com/konstructio/kubefirst/internal/step"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 func GenerateCommand() *cobra.Command {
@@ -31,6 +33,8 @@ func generateApp() *cobra.Command {
 	var name string
 	var environments []string
 	var outputPath string
+	var values []string
+	opts := generate.ScaffoldOptions{}
 
 	appScaffoldCmd := &cobra.Command{
 		Use:              "app-scaffold",
@@ -39,9 +43,43 @@ func generateApp() *cobra.Command {
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			stepper := step.NewStepFactory(cmd.ErrOrStderr())
 
+			if opts.TemplateRef != "" && opts.TemplateRepo == "" {
+				return errors.New("--template-ref requires --template-repo")
+			}
+			overrides, err := generate.ParseOverrides(values)
+			if err != nil {
+				return fmt.Errorf("invalid --set: %w", err)
+			}
+			opts.AppName = name
+			opts.Environments = environments
+			opts.OutputPath = outputPath
+			opts.Overrides = overrides
+			opts.Out = cmd.OutOrStdout()
+			opts.Save.DiffOut = cmd.OutOrStdout()
+
+			// the domain and git owner default to the ones of the current cluster
+			if opts.Domain == "" {
+				opts.Domain = viper.GetString("flags.domain-name")
+			}
+			if opts.GitOwner == "" {
+				opts.GitOwner = viper.GetString(fmt.Sprintf("flags.%s-owner", viper.GetString("flags.git-provider")))
+			}
+
+			if opts.DryRun {
+				if _, err := generate.AppScaffold(cmd.Context(), opts); err != nil {
+					return fmt.Errorf("error scaffolding app: %w", err)
+				}
+				return nil
+			}
+
 			stepper.NewProgressStep("Create App Scaffold")
 
-			if err := generate.AppScaffold(name, environments, outputPath); err != nil {
+			summary, err := generate.AppScaffold(cmd.Context(), opts)
+			if err != nil {
+				// the summary of a conflict shows which files were edited
+				if summary != nil {
+					stepper.InfoStepString(summary.Table())
+				}
 				wrerr := fmt.Errorf("error scaffolding app: %w", err)
 				stepper.FailCurrentStep(wrerr)
 				return wrerr
@@ -49,6 +87,10 @@ func generateApp() *cobra.Command {
 
 			stepper.CompleteCurrentStep()
 
+			stepper.InfoStepString(summary.Table())
+			if opts.Save.Diff {
+				return nil
+			}
 			stepper.InfoStepString(fmt.Sprintf("App successfully scaffolded: %s", name))
 
 			return nil
@@ -59,6 +101,22 @@ func generateApp() *cobra.Command {
 	appScaffoldCmd.MarkFlagRequired("name")
 	appScaffoldCmd.Flags().StringSliceVar(&environments, "environments", []string{"development", "staging", "production"}, "environment names to create")
 	appScaffoldCmd.Flags().StringVar(&outputPath, "output-path", filepath.Join(".", "registry", "environments"), "location to save generated files")
+	appScaffoldCmd.Flags().StringVar(&opts.TemplateDir, "template-dir", "", "a directory of scaffold templates to use instead of the built-in ones, relative to the repository with --template-repo")
+	appScaffoldCmd.Flags().StringVar(&opts.TemplateRepo, "template-repo", "", "the url of a git repository holding the scaffold templates")
+	appScaffoldCmd.Flags().StringVar(&opts.TemplateRef, "template-ref", "", "the branch or tag of --template-repo to use (defaults to its default branch)")
+	appScaffoldCmd.Flags().StringVar(&opts.Image, "image", "", "the image repository of the app (defaults to the container registry of the gitops repository)")
+	appScaffoldCmd.Flags().IntVar(&opts.Port, "port", 0, "the port of the app service (defaults to the one of the chart)")
+	appScaffoldCmd.Flags().IntVar(&opts.Replicas, "replicas", 0, "the number of replicas of the app (defaults to the one of the chart)")
+	appScaffoldCmd.Flags().StringVar(&opts.IngressHost, "ingress-host", "", "the ingress host of the app (defaults to <name>-<environment>.<domain>)")
+	appScaffoldCmd.Flags().StringVar(&opts.Domain, "domain", "", "the domain of the ingress hosts (defaults to the domain of the current cluster)")
+	appScaffoldCmd.Flags().StringVar(&opts.GitOwner, "git-owner", "", "the git owner available to the templates (defaults to the one of the current cluster)")
+	appScaffoldCmd.Flags().StringArrayVar(&values, "set", nil, "a value as [<environment>.]<key>=<value>, the keys image, port, replicas, ingress-host, domain and git-owner override their flag and the others are available to the templates as .Values.<key> - can be used any number of times")
+	appScaffoldCmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "print the generated files instead of writing them")
+	appScaffoldCmd.Flags().BoolVar(&opts.Save.Force, "force", false, "overwrite the existing files which differ from the generated ones")
+	appScaffoldCmd.Flags().BoolVar(&opts.Save.SkipExisting, "skip-existing", false, "keep the existing files which differ from the generated ones")
+	appScaffoldCmd.Flags().BoolVar(&opts.Save.Diff, "diff", false, "print the diff of the existing files which differ from the generated ones without writing any file")
+	appScaffoldCmd.MarkFlagsMutuallyExclusive("force", "skip-existing")
+	appScaffoldCmd.MarkFlagsMutuallyExclusive("dry-run", "diff")
 
 	return appScaffoldCmd
 }
@@ -0,0 +1,257 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/konstructio/kubefirst/internal/gitShim"
+	"github.com/konstructio/kubefirst/internal/progress"
+	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+func GitCommand() *cobra.Command {
+	gitCmd := &cobra.Command{
+		Use:   "git",
+		Short: "check the git provider kubefirst creates repositories and teams on",
+	}
+
+	gitCmd.AddCommand(gitPreflight(), gitCleanup())
+
+	return gitCmd
+}
+
+func gitPreflight() *cobra.Command {
+	preflightCmd := &cobra.Command{
+		Use:   "preflight",
+		Short: "validate the git token, owner and names before creating a cluster",
+		Long: `Validate everything the git provider needs before creating a cluster in one run:
+the token and its scopes, the role in the organization or group, collisions with
+the repositories and teams kubefirst creates, the known_hosts entry for SSH and
+the credentials of the container registry. Every check runs, failing or not.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			opts, err := preflightOptions(cmd)
+			if err != nil {
+				stepper.InfoStep(step.EmojiError, err.Error())
+				return err
+			}
+
+			checks := gitShim.Preflight(cmd.Context(), *opts)
+			stepper.InfoStepString(preflightTable(checks))
+
+			failed := 0
+			for _, check := range checks {
+				if check.Status == gitShim.CheckFail {
+					failed++
+				}
+			}
+			if failed > 0 {
+				wrerr := fmt.Errorf("%d git preflight check(s) failed", failed)
+				stepper.InfoStep(step.EmojiError, wrerr.Error())
+				return wrerr
+			}
+
+			stepper.InfoStep(step.EmojiCheck, fmt.Sprintf("%s is ready for kubefirst", opts.Host.Name))
+			return nil
+		},
+	}
+
+	preflightCmd.Flags().String("git-provider", "github", "The git provider - one of: github, gitlab, gitea, bitbucket")
+	preflightCmd.Flags().String("git-protocol", "ssh", "The git protocol - one of: https, ssh")
+	gitShim.AddHostFlags(preflightCmd)
+	preflightCmd.Flags().String("github-org", "", "The GitHub organization for the new GitOps and Metaphor repositories")
+	preflightCmd.Flags().String("gitlab-group", "", "The GitLab group for the new GitOps and Metaphor projects")
+
+	return preflightCmd
+}
+
+// preflightOptions reads the flags of the preflight command, they mirror the
+// git flags of the create commands
+func preflightOptions(cmd *cobra.Command) (*gitShim.PreflightOptions, error) {
+	flags := cmd.Flags()
+	provider, _ := flags.GetString("git-provider")
+	protocol, _ := flags.GetString("git-protocol")
+	hostName, _ := flags.GetString("git-host")
+	apiURL, _ := flags.GetString("git-api-url")
+
+	if protocol != "ssh" && protocol != "https" {
+		return nil, fmt.Errorf("invalid git protocol %q - use one of: https, ssh", protocol)
+	}
+
+	var owner string
+	switch provider {
+	case "github":
+		owner, _ = flags.GetString("github-org")
+	case "gitlab":
+		owner, _ = flags.GetString("gitlab-group")
+	default:
+		owner, _ = flags.GetString("git-owner")
+	}
+
+	host, err := gitShim.NewHost(provider, hostName, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve git host: %w", err)
+	}
+
+	return &gitShim.PreflightOptions{
+		Host:         host,
+		Token:        os.Getenv(gitShim.TokenEnv(provider)),
+		Owner:        owner,
+		Repositories: gitShim.DefaultRepositoryNames,
+		Teams:        gitShim.DefaultTeamNames,
+		GitProtocol:  protocol,
+	}, nil
+}
+
+func preflightTable(checks []gitShim.Check) string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+
+	fmt.Fprintf(tw, "Check\tStatus\tDetail\n")
+	fmt.Fprintf(tw, "---\t---\t---\n")
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+	}
+	tw.Flush()
+
+	return buf.String()
+}
+
+func gitCleanup() *cobra.Command {
+	cleanupCmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "delete the git resources kubefirst created for a cluster",
+		Long: `List the repositories, webhooks, teams, GitLab deploy token and kbot SSH key
+kubefirst created for a cluster and delete them once confirmed. The resources are
+found through the git provider, whether or not terraform state exists, so they
+can be cleaned up after a failed install.
+
+Only the resources recorded in the local kubefirst config of the cluster are
+deleted: the repositories and teams its git credentials check found free, the
+deploy token it created and the SSH key matching its kbot public key.`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			clusterName, _ := cmd.Flags().GetString("cluster-name")
+			provider, opts, err := cleanupOptions(cmd, clusterName)
+			if err != nil {
+				stepper.InfoStep(step.EmojiError, err.Error())
+				return err
+			}
+
+			resources, err := gitShim.Inventory(cmd.Context(), provider, *opts)
+			if err != nil {
+				stepper.InfoStep(step.EmojiError, err.Error())
+				return err
+			}
+			if len(resources) == 0 {
+				stepper.InfoStep(step.EmojiCheck, fmt.Sprintf("no git resources of cluster %q found in %s", clusterName, opts.Owner))
+				return nil
+			}
+			stepper.InfoStepString(resourcesTable(resources))
+
+			if yes, _ := cmd.Flags().GetBool("yes"); !yes {
+				if err := confirmCleanup(cmd.InOrStdin(), cmd.ErrOrStderr(), len(resources)); err != nil {
+					stepper.InfoStep(step.EmojiError, err.Error())
+					return err
+				}
+			}
+
+			if err := gitShim.Cleanup(cmd.Context(), resources); err != nil {
+				wrerr := fmt.Errorf("failed to clean up git resources: %w", err)
+				stepper.InfoStep(step.EmojiError, wrerr.Error())
+				return wrerr
+			}
+
+			// the next create has to recreate what was deleted
+			viper.Set(fmt.Sprintf("kubefirst-checks.%s-credentials", provider.Host().Provider), false)
+			viper.Set(fmt.Sprintf("kubefirst-checks.terraform-apply-%s", provider.Host().Provider), false)
+			viper.Set("kbot.gitlab-user-based-ssh-key-title", "")
+			if err := gitShim.ForgetResources(); err != nil {
+				return fmt.Errorf("failed to write viper config: %w", err)
+			}
+
+			stepper.InfoStep(step.EmojiCheck, fmt.Sprintf("deleted %d git resource(s) of cluster %q", len(resources), clusterName))
+			return nil
+		},
+	}
+
+	cleanupCmd.Flags().String("cluster-name", "", "the name of the cluster to clean up the git resources of, it must be the cluster of the local kubefirst config (required)")
+	cleanupCmd.MarkFlagRequired("cluster-name")
+	cleanupCmd.Flags().Bool("yes", false, "delete the resources without prompting")
+
+	return cleanupCmd
+}
+
+// cleanupOptions returns the provider and the resources recorded in the local
+// config for clusterName, there is nothing kubefirst can prove it created
+// without them
+func cleanupOptions(cmd *cobra.Command, clusterName string) (gitShim.GitProvider, *gitShim.CleanupOptions, error) {
+	if viper.GetString("flags.cluster-name") != clusterName {
+		return nil, nil, fmt.Errorf("the local kubefirst config is not the one of cluster %q - git cleanup only deletes the resources recorded for the cluster it was created with", clusterName)
+	}
+	opts := gitShim.RecordedResources()
+	if opts == nil {
+		return nil, nil, fmt.Errorf("no git resources are recorded for cluster %q, its git credentials were never checked", clusterName)
+	}
+
+	host, err := gitShim.HostFromConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve git host: %w", err)
+	}
+	provider, err := gitShim.ConfiguredProvider(host)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to authenticate with %s: %w", host.Name, err)
+	}
+	return provider, opts, nil
+}
+
+// confirmCleanup asks the user to confirm deleting count resources
+func confirmCleanup(in io.Reader, out io.Writer, count int) error {
+	file, ok := in.(*os.File)
+	if progress.Progress != nil || !ok || !term.IsTerminal(int(file.Fd())) {
+		return errors.New("deleting the git resources must be confirmed - pass --yes")
+	}
+
+	fmt.Fprintf(out, "The %d git resource(s) above will be deleted. Type 'yes' to continue: ", count)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("deleting the git resources was not confirmed")
+	}
+	return nil
+}
+
+func resourcesTable(resources []gitShim.Resource) string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+
+	fmt.Fprintf(tw, "Kind\tName\tURL\n")
+	fmt.Fprintf(tw, "---\t---\t---\n")
+	for _, r := range resources {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Kind, r.Name, r.URL)
+	}
+	tw.Flush()
+
+	return buf.String()
+}
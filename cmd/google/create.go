@@ -10,12 +10,11 @@ import (
 	"fmt"
 	"os"
 
-	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
-	"github.com/rs/zerolog/log"
+	"github.com/konstructio/kubefirst/internal/gitShim"
 	_ "k8s.io/client-go/plugin/pkg/client/auth" // required for authentication
 )
 
-func ValidateProvidedFlags(gitProvider string) error {
+func ValidateProvidedFlags(gitHost string) error {
 	if os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") == "" {
 		return fmt.Errorf("your GOOGLE_APPLICATION_CREDENTIALS is not set - please set and re-run your last command")
 	}
@@ -25,19 +24,8 @@ func ValidateProvidedFlags(gitProvider string) error {
 		return fmt.Errorf("could not open GOOGLE_APPLICATION_CREDENTIALS file: %w", err)
 	}
 
-	switch gitProvider {
-	case "github":
-		key, err := internalssh.GetHostKey("github.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan github.com >> ~/.ssh/known_hosts` to remedy: %w", err)
-		}
-		log.Info().Msgf("%q %s", "github.com", key.Type())
-	case "gitlab":
-		key, err := internalssh.GetHostKey("gitlab.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan gitlab.com >> ~/.ssh/known_hosts` to remedy: %w", err)
-		}
-		log.Info().Msgf("%q %s", "gitlab.com", key.Type())
+	if err := gitShim.CheckKnownHost(gitHost); err != nil {
+		return err
 	}
 
 	return nil
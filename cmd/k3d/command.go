@@ -8,7 +8,11 @@ package k3d
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/konstructio/kubefirst/internal/credentials"
+	"github.com/konstructio/kubefirst/internal/gitShim"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
 	"github.com/konstructio/kubefirst/internal/progress"
 	"github.com/spf13/cobra"
 )
@@ -37,7 +41,7 @@ func NewCommand() *cobra.Command {
 	}
 
 	// wire up new commands
-	k3dCmd.AddCommand(Create(), Destroy(), MkCert(), RootCredentials(), UnsealVault())
+	k3dCmd.AddCommand(Create(), Destroy(), MkCert(), Registry(), RootCredentials(), Start(), Status(), Stop(), Trust(), UnsealVault())
 
 	return k3dCmd
 }
@@ -50,7 +54,7 @@ func LocalCommandAlias() *cobra.Command {
 	}
 
 	// wire up new commands
-	localCmd.AddCommand(Create(), Destroy(), MkCert(), RootCredentials(), UnsealVault())
+	localCmd.AddCommand(Create(), Destroy(), MkCert(), Registry(), RootCredentials(), Start(), Status(), Stop(), Trust(), UnsealVault())
 
 	return localCmd
 }
@@ -64,17 +68,27 @@ func Create() *cobra.Command {
 	}
 
 	// todo review defaults and update descriptions
+	createCmd.Flags().Bool("adopt-existing", false, "reuse the gitops and metaphor repositories when they already exist and are empty instead of failing")
+	createCmd.Flags().String("bundle", "", "an installation bundle created with `kubefirst bundle create` for air-gapped installs")
 	createCmd.Flags().Bool("ci", false, "if running kubefirst in ci, set this flag to disable interactive features")
 	createCmd.Flags().String("cluster-name", "kubefirst", "the name of the cluster to create")
 	createCmd.Flags().String("cluster-type", "mgmt", "the type of cluster to create (i.e. mgmt|workload)")
 	createCmd.Flags().String("git-provider", "github", fmt.Sprintf("the git provider - one of: %q", supportedGitProviders))
 	createCmd.Flags().String("git-protocol", "ssh", fmt.Sprintf("the git protocol - one of: %q", supportedGitProtocolOverride))
+	gitShim.AddHostFlags(createCmd)
 	createCmd.Flags().String("github-org", "", "the GitHub organization for the new gitops and metaphor repositories")
 	createCmd.Flags().String("gitlab-group", "", "the GitLab group for the new gitops and metaphor projects - required if using gitlab")
 	createCmd.Flags().String("gitops-template-branch", "", "the branch to clone for the gitops-template repository")
 	createCmd.Flags().String("gitops-template-url", "https://github.com/konstructio/gitops-template.git", "the fully qualified url to the gitops-template repository to clone")
 	createCmd.Flags().String("install-catalog-apps", "", "comma separated values of catalog apps to install after provision")
 	createCmd.Flags().Bool("use-telemetry", true, "whether to emit telemetry")
+	createCmd.Flags().String("from-phase", "", "re-run the installation from this phase, see --list-phases")
+	createCmd.Flags().String("only-phase", "", "run a single installation phase, even if it already completed")
+	createCmd.Flags().Bool("list-phases", false, "list the installation phases and whether they completed")
+	createCmd.Flags().StringToInt("phase-retries", map[string]int{}, "override the retries of a phase (i.e. gitops-push=5) - can be used any number of times")
+	createCmd.MarkFlagsMutuallyExclusive("from-phase", "only-phase")
+	internalk3d.AddTopologyFlags(createCmd)
+	internalk3d.AddTunnelFlags(createCmd)
 
 	return createCmd
 }
@@ -98,14 +112,51 @@ func MkCert() *cobra.Command {
 		RunE:  mkCert,
 	}
 
-	mkCertCmd.Flags().String("application", "", "the name of the application (required)")
-	mkCertCmd.MarkFlagRequired("application")
-	mkCertCmd.Flags().String("namespace", "", "the application namespace (required)")
-	mkCertCmd.MarkFlagRequired("namespace")
+	mkCertCmd.Flags().String("application", "", "the name of the application, its secret is <application>-tls (required unless --list or --renew-all)")
+	mkCertCmd.Flags().String("namespace", "", "the application namespace (required unless --list or --renew-all)")
+	mkCertCmd.Flags().StringSlice("sans", nil, "the hostnames of the certificate, wildcards such as *.kubefirst.dev are allowed (defaults to kubefirst.dev and <application>.kubefirst.dev)")
+	mkCertCmd.Flags().Bool("list", false, "list every certificate generated by mkcert with its expiry")
+	mkCertCmd.Flags().Bool("renew", false, "regenerate the certificate of the application")
+	mkCertCmd.Flags().Bool("renew-all", false, "regenerate every certificate expiring within --renew-before")
+	mkCertCmd.Flags().Duration("renew-before", 30*24*time.Hour, "how long before expiry certificates are renewed by --renew-all")
+	mkCertCmd.Flags().Bool("delete", false, "delete the certificate of the application")
+	mkCertCmd.MarkFlagsMutuallyExclusive("list", "renew", "renew-all", "delete")
 
 	return mkCertCmd
 }
 
+func Registry() *cobra.Command {
+	registryCmd := &cobra.Command{
+		Use:   "registry",
+		Short: "manage the local registry of the k3d cluster",
+		Long:  "manage the local registry created by `kubefirst k3d create --local-registry`",
+	}
+
+	pushCmd := &cobra.Command{
+		Use:   "push <image>",
+		Short: "push a local docker image to the local registry",
+		Long:  "tag a local docker image for the local registry and push it, so ArgoCD can deploy it without a remote registry",
+		Args:  cobra.ExactArgs(1),
+		RunE:  pushImage,
+	}
+	pushCmd.Flags().String("name", "", "the repository and tag in the local registry (defaults to the image without its registry)")
+
+	registryCmd.AddCommand(pushCmd)
+
+	return registryCmd
+}
+
+func Trust() *cobra.Command {
+	trustCmd := &cobra.Command{
+		Use:   "trust",
+		Short: "trust the local certificate authority of k3d on this machine",
+		Long:  "install the mkcert root certificate authority into the trust store of this machine and the Firefox NSS database, so the certificates of the k3d cluster are trusted",
+		RunE:  trustCA,
+	}
+
+	return trustCmd
+}
+
 func RootCredentials() *cobra.Command {
 	authCmd := &cobra.Command{
 		Use:   "root-credentials",
@@ -118,6 +169,8 @@ func RootCredentials() *cobra.Command {
 	authCmd.Flags().Bool("kbot", false, "copy the kbot password to the clipboard (optional)")
 	authCmd.Flags().Bool("vault", false, "copy the vault password to the clipboard (optional)")
 
+	credentials.AddFlags(authCmd)
+
 	return authCmd
 }
 
@@ -129,5 +182,44 @@ func UnsealVault() *cobra.Command {
 		RunE:  unsealVault,
 	}
 
+	unsealVaultCmd.Flags().Bool("watch", false, "keep running and unseal vault replicas again whenever their pod restarts")
+
 	return unsealVaultCmd
 }
+
+func Status() *cobra.Command {
+	statusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "report the health of the kubefirst platform running in k3d",
+		Long:  "check the k3d cluster, vault seal state, ArgoCD applications, ingress certificates and completed installation phases",
+		RunE:  status,
+	}
+
+	statusCmd.Flags().String("output", "table", "the output format - one of: table|json")
+
+	return statusCmd
+}
+
+func Start() *cobra.Command {
+	startCmd := &cobra.Command{
+		Use:   "start",
+		Short: "start a stopped k3d cluster and unseal vault",
+		Long:  "start the k3d cluster stopped with `kubefirst k3d stop` or by a reboot, then unseal every vault replica with the vault-unseal-secret",
+		RunE:  startK3d,
+	}
+
+	startCmd.Flags().Bool("skip-unseal", false, "do not unseal vault after starting the cluster")
+
+	return startCmd
+}
+
+func Stop() *cobra.Command {
+	stopCmd := &cobra.Command{
+		Use:   "stop",
+		Short: "stop the k3d cluster without deleting it",
+		Long:  "stop the k3d cluster without deleting it, `kubefirst k3d start` resumes it",
+		RunE:  stopK3d,
+	}
+
+	return stopCmd
+}
@@ -8,52 +8,36 @@ package k3d
 
 import (
 	"context"
-	"encoding/base64"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
-	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
-	argocdapi "github.com/argoproj/argo-cd/v2/pkg/client/clientset/versioned"
-	"github.com/atotto/clipboard"
 	"github.com/dustin/go-humanize"
-	"github.com/go-git/go-git/v5"
 	githttps "github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/konstructio/kubefirst-api/pkg/argocd"
 	"github.com/konstructio/kubefirst-api/pkg/configs"
 	constants "github.com/konstructio/kubefirst-api/pkg/constants"
-	"github.com/konstructio/kubefirst-api/pkg/gitClient"
-	"github.com/konstructio/kubefirst-api/pkg/github"
-	"github.com/konstructio/kubefirst-api/pkg/gitlab"
-	"github.com/konstructio/kubefirst-api/pkg/handlers"
 	"github.com/konstructio/kubefirst-api/pkg/k3d"
 	"github.com/konstructio/kubefirst-api/pkg/k8s"
 	"github.com/konstructio/kubefirst-api/pkg/progressPrinter"
 	"github.com/konstructio/kubefirst-api/pkg/reports"
-	"github.com/konstructio/kubefirst-api/pkg/services"
-	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
 	"github.com/konstructio/kubefirst-api/pkg/terraform"
 	"github.com/konstructio/kubefirst-api/pkg/types"
 	utils "github.com/konstructio/kubefirst-api/pkg/utils"
-	"github.com/konstructio/kubefirst-api/pkg/wrappers"
+	"github.com/konstructio/kubefirst/internal/bundle"
 	"github.com/konstructio/kubefirst/internal/catalog"
 	"github.com/konstructio/kubefirst/internal/gitShim"
+	"github.com/konstructio/kubefirst/internal/httpclient"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
+	"github.com/konstructio/kubefirst/internal/pipeline"
 	"github.com/konstructio/kubefirst/internal/progress"
 	"github.com/konstructio/kubefirst/internal/segment"
 	"github.com/konstructio/kubefirst/internal/utilities"
-	"github.com/kubefirst/metrics-client/pkg/telemetry"
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 )
 
 //nolint:gocyclo // this function is complex and needs to be refactored
@@ -64,11 +48,66 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to get flags: %w", err)
 	}
 
+	phaseOptions, err := phaseOptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	listPhases, err := cmd.Flags().GetBool("list-phases")
+	if err != nil {
+		return fmt.Errorf("failed to get list-phases flag: %w", err)
+	}
+	phaseList := pipeline.New((&installer{cliFlags: cliFlags}).phases()...)
+	if listPhases {
+		if err := phaseList.List(cmd.OutOrStdout()); err != nil {
+			return fmt.Errorf("failed to list phases: %w", err)
+		}
+		return nil
+	}
+	if _, err := phaseList.Selected(phaseOptions); err != nil {
+		return fmt.Errorf("invalid phase selection: %w", err)
+	}
+
+	topology, err := internalk3d.TopologyFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	tunnel, err := internalk3d.TunnelFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
 	log.Info().Msgf("type is %s", cliFlags.ClusterType)
 	utilities.CreateK1ClusterDirectory(cliFlags.ClusterName)
 	utils.DisplayLogHints()
 
-	isValid, catalogApps, err := catalog.ValidateCatalogApps(cmd.Context(), cliFlags.InstallCatalogApps)
+	var installBundle *bundle.Bundle
+	if cliFlags.Bundle != "" {
+		installBundle, err = bundle.Open(cliFlags.Bundle)
+		if err != nil {
+			return fmt.Errorf("failed to open bundle: %w", err)
+		}
+		// fail before anything is created rather than at the argocd phase
+		for name := range internalk3d.KustomizationPaths {
+			if _, err := installBundle.Kustomization(name); err != nil {
+				return fmt.Errorf("failed to open bundle: %w", err)
+			}
+		}
+	}
+
+	var (
+		isValid     bool
+		catalogApps []types.GitopsCatalogApp
+	)
+	if installBundle != nil {
+		index, indexErr := installBundle.CatalogIndex()
+		if indexErr != nil {
+			return fmt.Errorf("failed to read catalog index from bundle: %w", indexErr)
+		}
+		isValid, catalogApps, err = catalog.ValidateCatalogAppsFromIndex(index, cliFlags.InstallCatalogApps)
+	} else {
+		isValid, catalogApps, err = catalog.ValidateCatalogApps(cmd.Context(), cliFlags.InstallCatalogApps)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to validate catalog apps: %w", err)
 	}
@@ -77,19 +116,15 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		return errors.New("catalog apps validation failed")
 	}
 
-	switch cliFlags.GitProvider {
-	case "github":
-		key, err := internalssh.GetHostKey("github.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan github.com >> ~/.ssh/known_hosts` to remedy: %w", err)
-		}
-		log.Info().Msgf("Host key for github.com: %q", key.Type())
-	case "gitlab":
-		key, err := internalssh.GetHostKey("gitlab.com")
-		if err != nil {
-			return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan gitlab.com >> ~/.ssh/known_hosts` to remedy: %w", err)
-		}
-		log.Info().Msgf("Host key for gitlab.com: %q", key.Type())
+	if err := gitShim.CheckProvisioning(cliFlags.GitProvider); err != nil {
+		return err
+	}
+	gitHost, err := gitShim.NewHost(cliFlags.GitProvider, cliFlags.GitHost, cliFlags.GitAPIURL)
+	if err != nil {
+		return fmt.Errorf("invalid git host: %w", err)
+	}
+	if err := gitShim.CheckKnownHost(gitHost.Name); err != nil {
+		return err
 	}
 
 	err = k8s.CheckForExistingPortForwards(8080, 8200, 9000, 9094)
@@ -100,7 +135,7 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	httpClient := http.DefaultClient
+	httpClient := httpclient.New()
 
 	kubefirstTeam := os.Getenv("KUBEFIRST_TEAM")
 	if kubefirstTeam == "" {
@@ -118,11 +153,8 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 	var cGitlabOwnerGroupID int
 	switch cliFlags.GitProvider {
 	case "github":
-		cGitHost = k3d.GithubHost
-		containerRegistryHost = "ghcr.io"
-
-		gitHubService := services.NewGitHubService(httpClient)
-		gitHubHandler := handlers.NewGitHubHandler(gitHubService)
+		cGitHost = gitHost.Name
+		containerRegistryHost = gitHost.ContainerRegistryHost()
 
 		var existingToken string
 		if os.Getenv("GITHUB_TOKEN") != "" {
@@ -130,22 +162,31 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		} else if viper.GetString("github.session_token") != "" {
 			existingToken = viper.GetString("github.session_token")
 		}
-		gitHubAccessToken, err := wrappers.AuthenticateGitHubUserWrapper(existingToken, gitHubHandler)
-		if err != nil {
-			log.Warn().Msg(err.Error())
-		}
 
-		cGitToken = gitHubAccessToken
+		// the device flow authenticates against github.com only
+		if gitHost.SelfHosted() {
+			if existingToken == "" {
+				return fmt.Errorf("GITHUB_TOKEN environment variable unset - please set it to a token of %s and try again", gitHost.Name)
+			}
+			cGitToken = existingToken
+		} else {
+			cGitToken = existingToken
+			if cGitToken == "" {
+				if cGitToken, err = gitShim.AuthenticateGitHubUser(ctx, httpClient); err != nil {
+					log.Warn().Msg(err.Error())
+				}
+			}
+		}
 
-		err = github.VerifyTokenPermissions(cGitToken)
+		gitHubClient, err := gitHost.GitHubClient(cGitToken)
 		if err != nil {
-			return fmt.Errorf("failed to verify GitHub token permissions: %w", err)
+			return err
 		}
 
-		log.Info().Msg("verifying GitHub authentication")
-		githubUser, err := gitHubHandler.GetGitHubUser(cGitToken)
+		log.Info().Msgf("verifying GitHub authentication with %s", gitHost.Name)
+		githubUser, err := gitShim.VerifyGitHubToken(ctx, gitHubClient)
 		if err != nil {
-			return fmt.Errorf("failed to get GitHub user: %w", err)
+			return fmt.Errorf("failed to verify GitHub token permissions: %w", err)
 		}
 
 		if cliFlags.GithubOrg != "" {
@@ -155,6 +196,10 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		}
 		cGitUser = githubUser
 
+		if err := gitShim.CheckGitHubTokenPermissions(ctx, gitHubClient, cGitToken, cGitOwner); err != nil {
+			return fmt.Errorf("failed to verify GitHub token permissions: %w", err)
+		}
+
 		viper.Set("flags.github-owner", cGitOwner)
 		viper.Set("github.session_token", cGitToken)
 		viper.WriteConfig()
@@ -168,26 +213,21 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 			return errors.New("GITLAB_TOKEN environment variable unset - please set it and try again")
 		}
 
-		err = gitlab.VerifyTokenPermissions(cGitToken)
+		gitLabClient, err := gitHost.GitLabClient(cGitToken)
 		if err != nil {
-			return fmt.Errorf("failed to verify GitLab token permissions: %w", err)
+			return err
 		}
-
-		gitlabClient, err := gitlab.NewGitLabClient(cGitToken, cliFlags.GitlabGroup)
+		owner, err := gitShim.VerifyGitLabToken(ctx, gitLabClient, cliFlags.GitlabGroup)
 		if err != nil {
-			return fmt.Errorf("failed to create GitLab client: %w", err)
+			return fmt.Errorf("failed to verify GitLab token permissions: %w", err)
 		}
 
-		cGitHost = k3d.GitlabHost
-		cGitOwner = gitlabClient.ParentGroupPath
-		cGitlabOwnerGroupID = gitlabClient.ParentGroupID
+		cGitHost = gitHost.Name
+		cGitOwner = owner.GroupPath
+		cGitlabOwnerGroupID = owner.GroupID
 		log.Info().Msgf("set gitlab owner to %q", cGitOwner)
 
-		user, _, err := gitlabClient.Client.Users.CurrentUser()
-		if err != nil {
-			return fmt.Errorf("unable to get authenticated user info - please make sure GITLAB_TOKEN env var is set: %w", err)
-		}
-		cGitUser = user.Username
+		cGitUser = owner.User
 		viper.Set("flags.gitlab-owner", cliFlags.GitlabGroup)
 		viper.Set("flags.gitlab-owner-group-id", cGitlabOwnerGroupID)
 		viper.Set("gitlab.session_token", cGitToken)
@@ -213,6 +253,9 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to get config: %w", err)
 	}
 
+	config.DestinationGitopsRepoURL, config.DestinationGitopsRepoGitURL = gitHost.CloneURLs(cGitOwner, "gitops")
+	config.DestinationMetaphorRepoURL, config.DestinationMetaphorRepoGitURL = gitHost.CloneURLs(cGitOwner, "metaphor")
+
 	switch cliFlags.GitProvider {
 	case "github":
 		config.GithubToken = cGitToken
@@ -220,8 +263,6 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		config.GitlabToken = cGitToken
 	}
 
-	var sshPrivateKey, sshPublicKey string
-
 	// todo placed in configmap in kubefirst namespace, included in telemetry
 	clusterID := viper.GetString("kubefirst.cluster-id")
 	if clusterID == "" {
@@ -235,7 +276,7 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to initialize segment client: %w", err)
 	}
 
-	progressPrinter.AddTracker("preflight-checks", "Running preflight checks", 5)
+	progressPrinter.AddTracker("preflight-checks", "Running preflight checks", 2)
 	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
 	progressPrinter.IncrementTracker("preflight-checks")
 
@@ -261,6 +302,13 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
+	if installBundle != nil {
+		cliFlags.GitopsTemplateURL, cliFlags.GitopsTemplateBranch, err = installBundle.Template(bundle.GitopsTemplate)
+		if err != nil {
+			return fmt.Errorf("failed to read gitops template from bundle: %w", err)
+		}
+	}
+
 	log.Info().Msgf("kubefirst version configs.K1Version: %q", configs.K1Version)
 	log.Info().Msgf("cloning gitops-template repo url: %q", cliFlags.GitopsTemplateURL)
 	log.Info().Msgf("cloning gitops-template repo branch: %q", cliFlags.GitopsTemplateBranch)
@@ -272,12 +320,22 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		viper.WriteConfig()
 	}
 
-	atlantisNgrokAuthtoken := viper.GetString("secrets.atlantis-ngrok-authtoken")
-	if atlantisNgrokAuthtoken == "" {
-		atlantisNgrokAuthtoken = os.Getenv("NGROK_AUTHTOKEN")
-		viper.Set("secrets.atlantis-ngrok-authtoken", atlantisNgrokAuthtoken)
-		viper.WriteConfig()
+	// the gitops template runs ngrok whenever its authtoken is set
+	atlantisNgrokAuthtoken := ""
+	if tunnel.Provider == internalk3d.TunnelNgrok {
+		atlantisNgrokAuthtoken = viper.GetString("secrets.atlantis-ngrok-authtoken")
+		if atlantisNgrokAuthtoken == "" {
+			atlantisNgrokAuthtoken = os.Getenv("NGROK_AUTHTOKEN")
+		}
+		if atlantisNgrokAuthtoken == "" {
+			return errors.New("the ngrok tunnel requires the NGROK_AUTHTOKEN environment variable")
+		}
+	}
+	viper.Set("secrets.atlantis-ngrok-authtoken", atlantisNgrokAuthtoken)
+	if err := tunnel.Save(); err != nil {
+		return err
 	}
+	log.Info().Msgf("the Atlantis webhook tunnel is %s", tunnel)
 
 	log.Info().Msg("checking authentication to required providers")
 
@@ -295,69 +353,7 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 	}
 	progressPrinter.IncrementTracker("preflight-checks")
 
-	newRepositoryNames := []string{"gitops", "metaphor"}
-	newTeamNames := []string{"admins", "developers"}
-
-	executionControl := viper.GetBool(fmt.Sprintf("kubefirst-checks.%s-credentials", config.GitProvider))
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.GitCredentialsCheckStarted, "")
-		if len(cGitToken) == 0 {
-			msg := fmt.Sprintf("please set a %s_TOKEN environment variable to continue", strings.ToUpper(config.GitProvider))
-			telemetry.SendEvent(segClient, telemetry.GitCredentialsCheckFailed, msg)
-			return errors.New(msg)
-		}
-
-		initGitParameters := gitShim.GitInitParameters{
-			GitProvider:  cliFlags.GitProvider,
-			GitToken:     cGitToken,
-			GitOwner:     cGitOwner,
-			Repositories: newRepositoryNames,
-			Teams:        newTeamNames,
-		}
-		err = gitShim.InitializeGitProvider(&initGitParameters)
-		if err != nil {
-			return fmt.Errorf("failed to initialize Git provider: %w", err)
-		}
-
-		viper.Set(fmt.Sprintf("kubefirst-checks.%s-credentials", config.GitProvider), true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.GitCredentialsCheckCompleted, "")
-		progressPrinter.IncrementTracker("preflight-checks")
-	} else {
-		log.Info().Msg(fmt.Sprintf("already completed %q checks - continuing", config.GitProvider))
-		progressPrinter.IncrementTracker("preflight-checks")
-	}
-
 	var gitopsRepoURL string
-	executionControl = viper.GetBool("kubefirst-checks.kbot-setup")
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.KbotSetupStarted, "")
-
-		log.Info().Msg("creating an ssh key pair for your new cloud infrastructure")
-		sshPrivateKey, sshPublicKey, err = utils.CreateSSHKeyPair()
-		if err != nil {
-			telemetry.SendEvent(segClient, telemetry.KbotSetupFailed, err.Error())
-			return fmt.Errorf("failed to create SSH key pair: %w", err)
-		}
-		log.Info().Msg("ssh key pair creation complete")
-
-		viper.Set("kbot.private-key", sshPrivateKey)
-		viper.Set("kbot.public-key", sshPublicKey)
-		viper.Set("kbot.username", "kbot")
-		viper.Set("kubefirst-checks.kbot-setup", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.KbotSetupCompleted, "")
-		log.Info().Msg("kbot-setup complete")
-		progressPrinter.IncrementTracker("preflight-checks")
-	} else {
-		log.Info().Msg("already setup kbot user - continuing")
-		progressPrinter.IncrementTracker("preflight-checks")
-	}
-
-	log.Info().Msg("validation and kubefirst cli environment check is complete")
-
-	telemetry.SendEvent(segClient, telemetry.InitCompleted, "")
-
 	switch config.GitProtocol {
 	case "https":
 		gitopsRepoURL = config.DestinationGitopsRepoURL
@@ -376,8 +372,8 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		AlertsEmail:                   "REMOVE_THIS_VALUE",
 		ClusterName:                   cliFlags.ClusterName,
 		ClusterType:                   cliFlags.ClusterType,
-		GithubHost:                    k3d.GithubHost,
-		GitlabHost:                    k3d.GitlabHost,
+		GithubHost:                    gitHost.Name,
+		GitlabHost:                    gitHost.Name,
 		ArgoWorkflowsIngressURL:       fmt.Sprintf("https://argo.%s", k3d.DomainName),
 		VaultIngressURL:               fmt.Sprintf("https://vault.%s", k3d.DomainName),
 		ArgocdIngressURL:              fmt.Sprintf("https://argocd.%s", k3d.DomainName),
@@ -400,32 +396,6 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		gitopsDirectoryTokens.UseTelemetry = "false"
 	}
 
-	httpAuth := &githttps.BasicAuth{
-		Username: cGitUser,
-		Password: cGitToken,
-	}
-
-	if err != nil {
-		log.Info().Msgf("generate public keys failed: %q", err.Error())
-		return fmt.Errorf("failed to generate public keys: %w", err)
-	}
-
-	if !viper.GetBool("kubefirst-checks.tools-downloaded") {
-		log.Info().Msg("installing kubefirst dependencies")
-
-		err := k3d.DownloadTools(cliFlags.ClusterName, config.GitProvider, cGitOwner, config.ToolsDir, config.GitProtocol)
-		if err != nil {
-			return fmt.Errorf("failed to download tools: %w", err)
-		}
-
-		log.Info().Msg("download dependencies `$HOME/.k1/tools` complete")
-		viper.Set("kubefirst-checks.tools-downloaded", true)
-		viper.WriteConfig()
-	} else {
-		log.Info().Msg("already completed download of dependencies to `$HOME/.k1/tools` - continuing")
-	}
-	progressPrinter.IncrementTracker("preflight-checks")
-
 	metaphorTemplateTokens := k3d.MetaphorTokenValues{
 		ClusterName:                   cliFlags.ClusterName,
 		CloudRegion:                   cliFlags.CloudRegion,
@@ -436,793 +406,97 @@ func runK3d(cmd *cobra.Command, _ []string) error {
 		MetaphorProductionIngressURL:  fmt.Sprintf("metaphor-production.%s", k3d.DomainName),
 	}
 
-	progressPrinter.IncrementTracker("preflight-checks")
-	progressPrinter.AddTracker("cloning-and-formatting-git-repositories", "Cloning and formatting git repositories", 1)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	removeAtlantis := false
-	if viper.GetString("secrets.atlantis-ngrok-authtoken") == "" {
-		removeAtlantis = true
-	}
-	if !viper.GetBool("kubefirst-checks.gitops-ready-to-push") {
-		log.Info().Msg("generating your new gitops repository")
-		err := k3d.PrepareGitRepositories(
-			config.GitProvider,
-			cliFlags.ClusterName,
-			cliFlags.ClusterType,
-			config.DestinationGitopsRepoURL,
-			config.GitopsDir,
-			cliFlags.GitopsTemplateBranch,
-			cliFlags.GitopsTemplateURL,
-			config.DestinationMetaphorRepoURL,
-			config.K1Dir,
-			&gitopsDirectoryTokens,
-			config.MetaphorDir,
-			&metaphorTemplateTokens,
-			cliFlags.GitProtocol,
-			removeAtlantis,
-		)
-		if err != nil {
-			return fmt.Errorf("failed to prepare git repositories: %w", err)
-		}
-
-		viper.Set("kubefirst-checks.gitops-ready-to-push", true)
-		viper.WriteConfig()
-		progressPrinter.IncrementTracker("cloning-and-formatting-git-repositories")
-	} else {
-		log.Info().Msg("already completed gitops repo generation - continuing")
-		progressPrinter.IncrementTracker("cloning-and-formatting-git-repositories")
-	}
-
-	progressPrinter.AddTracker("applying-git-terraform", fmt.Sprintf("Applying %s Terraform", config.GitProvider), 1)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	switch config.GitProvider {
-	case "github":
-		executionControl = viper.GetBool("kubefirst-checks.terraform-apply-github")
-		if !executionControl {
-			telemetry.SendEvent(segClient, telemetry.GitTerraformApplyStarted, "")
-
-			log.Info().Msg("Creating GitHub resources with Terraform")
-
-			tfEntrypoint := config.GitopsDir + "/terraform/github"
-			tfEnvs := map[string]string{
-				"GITHUB_TOKEN":                 cGitToken,
-				"GITHUB_OWNER":                 cGitOwner,
-				"TF_VAR_kbot_ssh_public_key":   viper.GetString("kbot.public-key"),
-				"AWS_ACCESS_KEY_ID":            constants.MinioDefaultUsername,
-				"AWS_SECRET_ACCESS_KEY":        constants.MinioDefaultPassword,
-				"TF_VAR_aws_access_key_id":     constants.MinioDefaultUsername,
-				"TF_VAR_aws_secret_access_key": constants.MinioDefaultPassword,
-			}
-			if config.GitProtocol == "https" {
-				tfEnvs["TF_VAR_kbot_ssh_public_key"] = ""
-			}
-
-			err := terraform.InitApplyAutoApprove(config.TerraformClient, tfEntrypoint, tfEnvs)
-			if err != nil {
-				msg := fmt.Errorf("error creating GitHub resources with terraform %q: %w", tfEntrypoint, err)
-				telemetry.SendEvent(segClient, telemetry.GitTerraformApplyFailed, msg.Error())
-				return msg
-			}
-
-			log.Info().Msgf("created git repositories for github.com/%s", cGitOwner)
-			viper.Set("kubefirst-checks.terraform-apply-github", true)
-			viper.WriteConfig()
-			telemetry.SendEvent(segClient, telemetry.GitTerraformApplyCompleted, "")
-			progressPrinter.IncrementTracker("applying-git-terraform")
-		} else {
-			log.Info().Msg("already created GitHub Terraform resources")
-			progressPrinter.IncrementTracker("applying-git-terraform")
-		}
-	case "gitlab":
-		executionControl = viper.GetBool("kubefirst-checks.terraform-apply-gitlab")
-		if !executionControl {
-			telemetry.SendEvent(segClient, telemetry.GitTerraformApplyStarted, "")
-
-			log.Info().Msg("Creating GitLab resources with Terraform")
-
-			tfEntrypoint := config.GitopsDir + "/terraform/gitlab"
-			tfEnvs := map[string]string{
-				"GITLAB_TOKEN":                 cGitToken,
-				"GITLAB_OWNER":                 cliFlags.GitlabGroup,
-				"TF_VAR_owner_group_id":        strconv.Itoa(cGitlabOwnerGroupID),
-				"TF_VAR_kbot_ssh_public_key":   viper.GetString("kbot.public-key"),
-				"AWS_ACCESS_KEY_ID":            constants.MinioDefaultUsername,
-				"AWS_SECRET_ACCESS_KEY":        constants.MinioDefaultPassword,
-				"TF_VAR_aws_access_key_id":     constants.MinioDefaultUsername,
-				"TF_VAR_aws_secret_access_key": constants.MinioDefaultPassword,
-			}
-			if config.GitProtocol == "https" {
-				tfEnvs["TF_VAR_kbot_ssh_public_key"] = ""
-			}
-
-			err := terraform.InitApplyAutoApprove(config.TerraformClient, tfEntrypoint, tfEnvs)
-			if err != nil {
-				msg := fmt.Errorf("error creating GitLab resources with terraform %q: %w", tfEntrypoint, err)
-				telemetry.SendEvent(segClient, telemetry.GitTerraformApplyFailed, msg.Error())
-				return msg
-			}
-
-			log.Info().Msgf("created git projects and groups for gitlab.com/%s", cliFlags.GitlabGroup)
-			viper.Set("kubefirst-checks.terraform-apply-gitlab", true)
-			viper.WriteConfig()
-			telemetry.SendEvent(segClient, telemetry.GitTerraformApplyCompleted, "")
-			progressPrinter.IncrementTracker("applying-git-terraform")
-		} else {
-			log.Info().Msg("already created GitLab Terraform resources")
-			progressPrinter.IncrementTracker("applying-git-terraform")
-		}
-	}
-
-	progressPrinter.AddTracker("pushing-gitops-repos-upstream", "Pushing git repositories", 1)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	log.Info().Msgf("referencing gitops repository: %q", config.DestinationGitopsRepoGitURL)
-	log.Info().Msgf("referencing metaphor repository: %q", config.DestinationMetaphorRepoURL)
-
-	executionControl = viper.GetBool("kubefirst-checks.gitops-repo-pushed")
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.GitopsRepoPushStarted, "")
-
-		gitopsRepo, err := git.PlainOpen(config.GitopsDir)
-		if err != nil {
-			return fmt.Errorf("error opening repo at %q: %w", config.GitopsDir, err)
-		}
-
-		metaphorRepo, err := git.PlainOpen(config.MetaphorDir)
-		if err != nil {
-			return fmt.Errorf("error opening repo at %q: %w", config.MetaphorDir, err)
-		}
-
-		err = utils.EvalSSHKey(&types.EvalSSHKeyRequest{
-			GitProvider:     cliFlags.GitProvider,
-			GitlabGroupFlag: cliFlags.GitlabGroup,
-			GitToken:        cGitToken,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to evaluate SSH key: %w", err)
-		}
-
-		err = gitopsRepo.Push(
-			&git.PushOptions{
-				RemoteName: config.GitProvider,
-				Auth:       httpAuth,
-			},
-		)
-		if err != nil {
-			msg := fmt.Errorf("error pushing detokenized gitops repository to remote %q: %w", config.DestinationGitopsRepoGitURL, err)
-			telemetry.SendEvent(segClient, telemetry.GitopsRepoPushFailed, msg.Error())
-			if !strings.Contains(msg.Error(), "already up-to-date") {
-				log.Print(msg.Error())
-				return msg
-			}
-		}
-
-		err = metaphorRepo.Push(
-			&git.PushOptions{
-				RemoteName: "origin",
-				Auth:       httpAuth,
-			},
-		)
-		if err != nil {
-			msg := fmt.Errorf("error pushing detokenized metaphor repository to remote %q: %w", config.DestinationMetaphorRepoURL, err)
-			telemetry.SendEvent(segClient, telemetry.GitopsRepoPushFailed, msg.Error())
-			if !strings.Contains(msg.Error(), "already up-to-date") {
-				return msg
-			}
-		}
-		log.Info().Msgf("successfully pushed gitops and metaphor repositories to https://%s/%s", cGitHost, cGitOwner)
-
-		viper.Set("kubefirst-checks.gitops-repo-pushed", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.GitopsRepoPushCompleted, "")
-		progressPrinter.IncrementTracker("pushing-gitops-repos-upstream")
-	} else {
-		log.Info().Msg("already pushed detokenized gitops repository content")
-		progressPrinter.IncrementTracker("pushing-gitops-repos-upstream")
-	}
-
-	progressPrinter.AddTracker("creating-k3d-cluster", "Creating k3d cluster", 1)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	if !viper.GetBool("kubefirst-checks.create-k3d-cluster") {
-		telemetry.SendEvent(segClient, telemetry.CloudTerraformApplyStarted, "")
-
-		log.Info().Msg("Creating k3d cluster")
-
-		err := k3d.ClusterCreate(cliFlags.ClusterName, config.K1Dir, config.K3dClient, config.Kubeconfig)
-		if err != nil {
-			msg := fmt.Errorf("error creating k3d resources with k3d client %q: %w", config.K3dClient, err)
-			viper.Set("kubefirst-checks.create-k3d-cluster-failed", true)
-			viper.WriteConfig()
-			telemetry.SendEvent(segClient, telemetry.CloudTerraformApplyFailed, msg.Error())
-			return msg
-		}
-
-		log.Info().Msg("successfully created k3d cluster")
-		viper.Set("kubefirst-checks.create-k3d-cluster", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.CloudTerraformApplyCompleted, "")
-		progressPrinter.IncrementTracker("creating-k3d-cluster")
-	} else {
-		log.Info().Msg("already created k3d cluster resources")
-		progressPrinter.IncrementTracker("creating-k3d-cluster")
-	}
-
-	kcfg, err := k8s.CreateKubeConfig(false, config.Kubeconfig)
-	if err != nil {
-		return fmt.Errorf("failed to create kubeconfig: %w", err)
-	}
-
-	progressPrinter.AddTracker("bootstrapping-kubernetes-resources", "Bootstrapping Kubernetes resources", 2)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	executionControl = viper.GetBool("kubefirst-checks.k8s-secrets-created")
-	if !executionControl {
-		err := k3d.GenerateTLSSecrets(kcfg.Clientset, *config)
-		if err != nil {
-			return fmt.Errorf("failed to generate TLS secrets: %w", err)
-		}
-
-		err = k3d.AddK3DSecrets(
-			gitopsRepoURL,
-			viper.GetString("kbot.private-key"),
-			config.GitProvider,
-			cGitUser,
-			config.Kubeconfig,
-			cGitToken,
-		)
-		if err != nil {
-			log.Info().Msg("Error adding kubernetes secrets for bootstrap")
-			return fmt.Errorf("failed to add Kubernetes secrets: %w", err)
-		}
-		viper.Set("kubefirst-checks.k8s-secrets-created", true)
-		viper.WriteConfig()
-		progressPrinter.IncrementTracker("bootstrapping-kubernetes-resources")
-	} else {
-		log.Info().Msg("already added secrets to k3d cluster")
-		progressPrinter.IncrementTracker("bootstrapping-kubernetes-resources")
-	}
-
-	containerRegistryAuth := gitShim.ContainerRegistryAuth{
-		GitProvider:           cliFlags.GitProvider,
-		GitUser:               cGitUser,
-		GitToken:              cGitToken,
-		GitlabGroupFlag:       cliFlags.GitlabGroup,
-		GithubOwner:           cGitOwner,
-		ContainerRegistryHost: containerRegistryHost,
-		Clientset:             kcfg.Clientset,
-	}
-	containerRegistryAuthToken, err := gitShim.CreateContainerRegistrySecret(&containerRegistryAuth)
-	if err != nil {
-		return fmt.Errorf("failed to create container registry secret: %w", err)
-	}
-	progressPrinter.IncrementTracker("bootstrapping-kubernetes-resources")
-
-	progressPrinter.AddTracker("verifying-k3d-cluster-readiness", "Verifying Kubernetes cluster is ready", 3)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	traefikDeployment, err := k8s.ReturnDeploymentObject(
-		kcfg.Clientset,
-		"app.kubernetes.io/name",
-		"traefik",
-		"kube-system",
-		240,
-	)
-	if err != nil {
-		return fmt.Errorf("error finding traefik deployment: %w", err)
-	}
-	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, traefikDeployment, 240)
-	if err != nil {
-		return fmt.Errorf("error waiting for traefik deployment ready state: %w", err)
-	}
-	progressPrinter.IncrementTracker("verifying-k3d-cluster-readiness")
-
-	metricsServerDeployment, err := k8s.ReturnDeploymentObject(
-		kcfg.Clientset,
-		"k8s-app",
-		"metrics-server",
-		"kube-system",
-		240,
-	)
+	inst := &installer{
+		cliFlags:              cliFlags,
+		installBundle:         installBundle,
+		topology:              topology,
+		tunnel:                tunnel,
+		catalogApps:           catalogApps,
+		segClient:             segClient,
+		gitHost:               cGitHost,
+		gitOwner:              cGitOwner,
+		gitUser:               cGitUser,
+		gitToken:              cGitToken,
+		gitlabOwnerGroupID:    cGitlabOwnerGroupID,
+		containerRegistryHost: containerRegistryHost,
+		repositoryNames:       gitShim.DefaultRepositoryNames,
+		teamNames:             gitShim.DefaultTeamNames,
+		httpAuth: &githttps.BasicAuth{
+			Username: cGitUser,
+			Password: cGitToken,
+		},
+		k1Dir:                       config.K1Dir,
+		gitopsDir:                   config.GitopsDir,
+		metaphorDir:                 config.MetaphorDir,
+		toolsDir:                    config.ToolsDir,
+		kubeconfig:                  config.Kubeconfig,
+		k3dClient:                   config.K3dClient,
+		terraformClient:             config.TerraformClient,
+		destinationGitopsRepoURL:    config.DestinationGitopsRepoURL,
+		destinationGitopsRepoGitURL: config.DestinationGitopsRepoGitURL,
+		destinationMetaphorRepoURL:  config.DestinationMetaphorRepoURL,
+		gitopsRepoURL:               gitopsRepoURL,
+		gitopsDirectoryTokens:       &gitopsDirectoryTokens,
+		metaphorTemplateTokens:      &metaphorTemplateTokens,
+		generateTLSSecrets: func(clientset kubernetes.Interface) error {
+			return k3d.GenerateTLSSecrets(clientset, *config)
+		},
+		terraformApply: terraform.InitApplyAutoApprove,
+	}
+	defer inst.close()
+
+	installPipeline := pipeline.New(inst.phases()...)
+	phases, err := installPipeline.Selected(phaseOptions)
 	if err != nil {
-		return fmt.Errorf("error finding metrics-server deployment: %w", err)
+		return fmt.Errorf("invalid phase selection: %w", err)
 	}
-	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, metricsServerDeployment, 240)
-	if err != nil {
-		return fmt.Errorf("error waiting for metrics-server deployment ready state: %w", err)
+	for _, phase := range phases {
+		progressPrinter.AddTracker(phase.Name, phase.Description, 1)
 	}
-	progressPrinter.IncrementTracker("verifying-k3d-cluster-readiness")
-
-	time.Sleep(time.Second * 20)
-
-	progressPrinter.IncrementTracker("verifying-k3d-cluster-readiness")
-
-	progressPrinter.AddTracker("installing-argo-cd", "Installing and configuring Argo CD", 3)
 	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	argoCDInstallPath := fmt.Sprintf("github.com:konstructio/manifests/argocd/k3d?ref=%s", constants.KubefirstManifestRepoRef)
-	executionControl = viper.GetBool("kubefirst-checks.argocd-install")
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.ArgoCDInstallStarted, "")
-
-		log.Info().Msgf("installing ArgoCD")
-
-		yamlData, err := kcfg.KustomizeBuild(argoCDInstallPath)
-		if err != nil {
-			return fmt.Errorf("failed to build ArgoCD manifests: %w", err)
-		}
-
-		output, err := kcfg.SplitYAMLFile(yamlData)
-		if err != nil {
-			return fmt.Errorf("failed to split YAML file: %w", err)
-		}
-
-		if err := kcfg.ApplyObjects(output); err != nil {
-			telemetry.SendEvent(segClient, telemetry.ArgoCDInstallFailed, err.Error())
-			return fmt.Errorf("failed to apply ArgoCD objects: %w", err)
-		}
-
-		viper.Set("kubefirst-checks.argocd-install", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.ArgoCDInstallCompleted, "")
-		progressPrinter.IncrementTracker("installing-argo-cd")
-	} else {
-		log.Info().Msg("ArgoCD already installed, continuing")
-		progressPrinter.IncrementTracker("installing-argo-cd")
-	}
-
-	_, err = k8s.VerifyArgoCDReadiness(kcfg.Clientset, true, 300)
-	if err != nil {
-		return fmt.Errorf("error waiting for ArgoCD to become ready: %w", err)
-	}
-
-	var argocdPassword string
-	executionControl = viper.GetBool("kubefirst-checks.argocd-credentials-set")
-	if !executionControl {
-		log.Info().Msg("Setting ArgoCD username and password credentials")
-
-		argocd.ArgocdSecretClient = kcfg.Clientset.CoreV1().Secrets("argocd")
-
-		argocdPassword = k8s.GetSecretValue(argocd.ArgocdSecretClient, "argocd-initial-admin-secret", "password")
-		if argocdPassword == "" {
-			return errors.New("ArgoCD password not found in secret")
-		}
-
-		viper.Set("components.argocd.password", argocdPassword)
-		viper.Set("components.argocd.username", "admin")
-		viper.WriteConfig()
-		log.Info().Msg("ArgoCD username and password credentials set successfully")
-		log.Info().Msg("Getting an ArgoCD auth token")
-
-		var argoCDToken string
-		if err := utils.TestEndpointTLS(strings.Replace(k3d.ArgocdURL, "https://", "", 1)); err != nil {
-			argoCDStopChannel := make(chan struct{}, 1)
-			log.Info().Msgf("ArgoCD not available via https, using http")
-			defer func() {
-				close(argoCDStopChannel)
-			}()
-			k8s.OpenPortForwardPodWrapper(
-				kcfg.Clientset,
-				kcfg.RestConfig,
-				"argocd-server",
-				"argocd",
-				8080,
-				8080,
-				argoCDStopChannel,
-			)
-			argoCDHTTPURL := strings.Replace(
-				k3d.ArgocdURL,
-				"https://",
-				"http://",
-				1,
-			) + ":8080"
-			argoCDToken, err = argocd.GetArgocdTokenV2(argoCDHTTPURL, "admin", argocdPassword)
-			if err != nil {
-				return fmt.Errorf("failed to get ArgoCD token: %w", err)
-			}
-		} else {
-			argoCDToken, err = argocd.GetArgocdTokenV2(k3d.ArgocdURL, "admin", argocdPassword)
-			if err != nil {
-				return fmt.Errorf("failed to get ArgoCD token: %w", err)
-			}
-		}
-
-		log.Info().Msg("ArgoCD admin auth token set")
-
-		viper.Set("components.argocd.auth-token", argoCDToken)
-		viper.Set("kubefirst-checks.argocd-credentials-set", true)
-		viper.WriteConfig()
-		progressPrinter.IncrementTracker("installing-argo-cd")
-	} else {
-		log.Info().Msg("ArgoCD credentials already set, continuing")
-		progressPrinter.IncrementTracker("installing-argo-cd")
-	}
-
-	if configs.K1Version == "development" {
-		err := clipboard.WriteAll(argocdPassword)
-		if err != nil {
-			log.Error().Err(err).Msg("failed to copy ArgoCD password to clipboard")
-		}
-
-		if os.Getenv("SKIP_ARGOCD_LAUNCH") != "true" || !cliFlags.Ci {
-			err = utils.OpenBrowser(constants.ArgoCDLocalURLTLS)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to open ArgoCD URL in browser")
-			}
-		}
-	}
-
-	executionControl = viper.GetBool("kubefirst-checks.argocd-create-registry")
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.CreateRegistryStarted, "")
-		argocdClient, err := argocdapi.NewForConfig(kcfg.RestConfig)
-		if err != nil {
-			return fmt.Errorf("failed to create ArgoCD client: %w", err)
-		}
-
-		log.Info().Msg("applying the registry application to ArgoCD")
-		registryApplicationObject := argocd.GetArgoCDApplicationObject(gitopsRepoURL, fmt.Sprintf("registry/%s", cliFlags.ClusterName))
-
-		err = k3d.RestartDeployment(context.Background(), kcfg.Clientset, "argocd", "argocd-applicationset-controller")
-		if err != nil {
-			return fmt.Errorf("error in restarting ArgoCD controller: %w", err)
-		}
-
-		err = wait.PollUntilContextTimeout(ctx, 5*time.Second, 20*time.Second, true, func(ctx context.Context) (bool, error) {
-			_, err := argocdClient.ArgoprojV1alpha1().Applications("argocd").Create(ctx, registryApplicationObject, metav1.CreateOptions{})
-			if err != nil {
-				if errors.Is(err, syscall.ECONNREFUSED) {
-					return false, nil
-				}
-
-				if apierrors.IsAlreadyExists(err) {
-					return true, nil
-				}
-
-				return false, fmt.Errorf("error creating ArgoCD application: %w", err)
-			}
-			return true, nil
-		})
-		if err != nil {
-			return fmt.Errorf("error creating ArgoCD application: %w", err)
-		}
-
-		log.Info().Msg("ArgoCD application created successfully")
-		viper.Set("kubefirst-checks.argocd-create-registry", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.CreateRegistryCompleted, "")
-		progressPrinter.IncrementTracker("installing-argo-cd")
-	} else {
-		log.Info().Msg("ArgoCD registry create already done, continuing")
-		progressPrinter.IncrementTracker("installing-argo-cd")
+	installPipeline.Done = func(phase pipeline.Phase) {
+		progressPrinter.IncrementTracker(phase.Name)
 	}
 
-	progressPrinter.AddTracker("configuring-vault", "Configuring Vault", 4)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	vaultStatefulSet, err := k8s.ReturnStatefulSetObject(
-		kcfg.Clientset,
-		"app.kubernetes.io/instance",
-		"vault",
-		"vault",
-		120,
-	)
-	if err != nil {
-		return fmt.Errorf("error finding Vault StatefulSet: %w", err)
-	}
-	_, err = k8s.WaitForStatefulSetReady(kcfg.Clientset, vaultStatefulSet, 120, true)
-	if err != nil {
-		return fmt.Errorf("error waiting for Vault StatefulSet ready state: %w", err)
+	if err := installPipeline.Run(ctx, phaseOptions); err != nil {
+		return fmt.Errorf("failed to create k3d cluster: %w", err)
 	}
-	progressPrinter.IncrementTracker("configuring-vault")
-
-	time.Sleep(time.Second * 10)
-	progressPrinter.IncrementTracker("configuring-vault")
-
-	executionControl = viper.GetBool("kubefirst-checks.vault-initialized")
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.VaultInitializationStarted, "")
-
-		vaultHandlerPath := "github.com:konstructio/manifests.git/vault-handler/replicas-1"
-
-		yamlData, err := kcfg.KustomizeBuild(vaultHandlerPath)
-		if err != nil {
-			return fmt.Errorf("failed to build vault handler manifests: %w", err)
-		}
-
-		output, err := kcfg.SplitYAMLFile(yamlData)
-		if err != nil {
-			return fmt.Errorf("failed to split YAML file: %w", err)
-		}
-
-		if err := kcfg.ApplyObjects(output); err != nil {
-			return fmt.Errorf("failed to apply vault handler objects: %w", err)
-		}
-
-		job, err := k8s.ReturnJobObject(kcfg.Clientset, "vault", "vault-handler")
-		if err != nil {
-			return fmt.Errorf("failed to get vault job object: %w", err)
-		}
-		_, err = k8s.WaitForJobComplete(kcfg.Clientset, job.GetName(), job.GetNamespace(), 240)
-		if err != nil {
-			msg := fmt.Errorf("could not run vault unseal job: %w", err)
-			telemetry.SendEvent(segClient, telemetry.VaultInitializationFailed, msg.Error())
-			return msg
-		}
 
-		viper.Set("kubefirst-checks.vault-initialized", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.VaultInitializationCompleted, "")
-		progressPrinter.IncrementTracker("configuring-vault")
-	} else {
-		log.Info().Msg("vault is already initialized - skipping")
-		progressPrinter.IncrementTracker("configuring-vault")
+	if phaseOptions.OnlyPhase != "" {
+		log.Info().Msgf("phase %q complete", phaseOptions.OnlyPhase)
+		return nil
 	}
 
-	minioStopChannel := make(chan struct{}, 1)
-	defer func() {
-		close(minioStopChannel)
-	}()
-
-	k8s.OpenPortForwardPodWrapper(
-		kcfg.Clientset,
-		kcfg.RestConfig,
-		"minio",
-		"minio",
-		9000,
-		9000,
-		minioStopChannel,
-	)
-
-	minioClient, err := minio.New(constants.MinioPortForwardEndpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(constants.MinioDefaultUsername, constants.MinioDefaultPassword, ""),
-		Secure: false,
-		Region: constants.MinioRegion,
-	})
-	if err != nil {
-		return fmt.Errorf("error creating Minio client: %w", err)
-	}
-
-	objectName := fmt.Sprintf("terraform/%s/terraform.tfstate", config.GitProvider)
-	filePath := config.K1Dir + fmt.Sprintf("/gitops/%s", objectName)
-	contentType := "xl.meta"
-	bucketName := "kubefirst-state-store"
-	log.Info().Msgf("BucketName: %q", bucketName)
-
-	viper.Set("kubefirst.state-store.name", bucketName)
-	viper.Set("kubefirst.state-store.hostname", "minio-console.kubefirst.dev")
-	viper.Set("kubefirst.state-store-creds.access-key-id", constants.MinioDefaultUsername)
-	viper.Set("kubefirst.state-store-creds.secret-access-key-id", constants.MinioDefaultPassword)
-
-	info, err := minioClient.FPutObject(ctx, bucketName, objectName, filePath, minio.PutObjectOptions{ContentType: contentType})
-	if err != nil {
-		return fmt.Errorf("error uploading to Minio bucket: %w", err)
-	}
-
-	log.Printf("Successfully uploaded %q to bucket %q", objectName, info.Bucket)
-
-	progressPrinter.IncrementTracker("configuring-vault")
-
-	vaultStopChannel := make(chan struct{}, 1)
-	defer func() {
-		close(vaultStopChannel)
-	}()
-
-	k8s.OpenPortForwardPodWrapper(
-		kcfg.Clientset,
-		kcfg.RestConfig,
-		"vault-0",
-		"vault",
-		8200,
-		8200,
-		vaultStopChannel,
-	)
-
-	var vaultRootToken string
-	secData, err := k8s.ReadSecretV2(kcfg.Clientset, "vault", "vault-unseal-secret")
-	if err != nil {
-		return fmt.Errorf("failed to read vault unseal secret: %w", err)
-	}
-
-	vaultRootToken = secData["root-token"]
-
-	kubernetesInClusterAPIService, err := k8s.ReadService(config.Kubeconfig, "default", "kubernetes")
-	if err != nil {
-		return fmt.Errorf("error looking up kubernetes api server service: %w", err)
-	}
-
-	if err := utils.TestEndpointTLS(strings.Replace(k3d.VaultURL, "https://", "", 1)); err != nil {
-		return fmt.Errorf("unable to reach vault over https: %w", err)
-	}
-
-	executionControl = viper.GetBool("kubefirst-checks.terraform-apply-vault")
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.VaultTerraformApplyStarted, "")
-
-		tfEnvs := map[string]string{}
-		var usernamePasswordString, base64DockerAuth string
-
-		if config.GitProvider == "gitlab" {
-			usernamePasswordString = fmt.Sprintf("%s:%s", "container-registry-auth", containerRegistryAuthToken)
-			base64DockerAuth = base64.StdEncoding.EncodeToString([]byte(usernamePasswordString))
-
-			tfEnvs["TF_VAR_container_registry_auth"] = containerRegistryAuthToken
-			tfEnvs["TF_VAR_owner_group_id"] = strconv.Itoa(cGitlabOwnerGroupID)
-		} else {
-			usernamePasswordString = fmt.Sprintf("%s:%s", cGitUser, cGitToken)
-			base64DockerAuth = base64.StdEncoding.EncodeToString([]byte(usernamePasswordString))
-		}
-
-		log.Info().Msg("configuring vault with terraform")
-
-		tfEnvs["TF_VAR_email_address"] = "your@email.com"
-		tfEnvs[fmt.Sprintf("TF_VAR_%s_token", config.GitProvider)] = cGitToken
-		tfEnvs[fmt.Sprintf("TF_VAR_%s_user", config.GitProvider)] = cGitUser
-		tfEnvs["TF_VAR_vault_addr"] = k3d.VaultPortForwardURL
-		tfEnvs["TF_VAR_b64_docker_auth"] = base64DockerAuth
-		tfEnvs["TF_VAR_vault_token"] = vaultRootToken
-		tfEnvs["VAULT_ADDR"] = k3d.VaultPortForwardURL
-		tfEnvs["VAULT_TOKEN"] = vaultRootToken
-		tfEnvs["TF_VAR_atlantis_repo_webhook_secret"] = viper.GetString("secrets.atlantis-webhook")
-		tfEnvs["TF_VAR_kbot_ssh_private_key"] = viper.GetString("kbot.private-key")
-		tfEnvs["TF_VAR_kbot_ssh_public_key"] = viper.GetString("kbot.public-key")
-		tfEnvs["TF_VAR_kubernetes_api_endpoint"] = fmt.Sprintf("https://%s", kubernetesInClusterAPIService.Spec.ClusterIP)
-		tfEnvs[fmt.Sprintf("%s_OWNER", strings.ToUpper(config.GitProvider))] = viper.GetString(fmt.Sprintf("flags.%s-owner", config.GitProvider))
-		tfEnvs["AWS_ACCESS_KEY_ID"] = constants.MinioDefaultUsername
-		tfEnvs["AWS_SECRET_ACCESS_KEY"] = constants.MinioDefaultPassword
-		tfEnvs["TF_VAR_aws_access_key_id"] = constants.MinioDefaultUsername
-		tfEnvs["TF_VAR_aws_secret_access_key"] = constants.MinioDefaultPassword
-		tfEnvs["TF_VAR_ngrok_authtoken"] = viper.GetString("secrets.atlantis-ngrok-authtoken")
-
-		tfEntrypoint := config.GitopsDir + "/terraform/vault"
-		err := terraform.InitApplyAutoApprove(config.TerraformClient, tfEntrypoint, tfEnvs)
-		if err != nil {
-			telemetry.SendEvent(segClient, telemetry.VaultTerraformApplyStarted, err.Error())
-			return fmt.Errorf("failed to execute vault terraform: %w", err)
-		}
-		log.Info().Msg("vault terraform executed successfully")
-		viper.Set("kubefirst-checks.terraform-apply-vault", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.VaultTerraformApplyCompleted, "")
-		progressPrinter.IncrementTracker("configuring-vault")
-	} else {
-		log.Info().Msg("already executed vault terraform")
-		progressPrinter.IncrementTracker("configuring-vault")
-	}
-
-	progressPrinter.AddTracker("creating-users", "Creating users", 1)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	executionControl = viper.GetBool("kubefirst-checks.terraform-apply-users")
-	if !executionControl {
-		telemetry.SendEvent(segClient, telemetry.UsersTerraformApplyStarted, "")
-
-		log.Info().Msg("applying users terraform")
-
-		tfEnvs := map[string]string{}
-		tfEnvs["TF_VAR_email_address"] = "your@email.com"
-		tfEnvs[fmt.Sprintf("TF_VAR_%s_token", config.GitProvider)] = cGitToken
-		tfEnvs["TF_VAR_vault_addr"] = k3d.VaultPortForwardURL
-		tfEnvs["TF_VAR_vault_token"] = vaultRootToken
-		tfEnvs["VAULT_ADDR"] = k3d.VaultPortForwardURL
-		tfEnvs["VAULT_TOKEN"] = vaultRootToken
-		tfEnvs[fmt.Sprintf("%s_TOKEN", strings.ToUpper(config.GitProvider))] = cGitToken
-		tfEnvs[fmt.Sprintf("%s_OWNER", strings.ToUpper(config.GitProvider))] = cGitOwner
-
-		tfEntrypoint := config.GitopsDir + "/terraform/users"
-		err := terraform.InitApplyAutoApprove(config.TerraformClient, tfEntrypoint, tfEnvs)
-		if err != nil {
-			telemetry.SendEvent(segClient, telemetry.UsersTerraformApplyStarted, err.Error())
-			return fmt.Errorf("failed to apply users terraform: %w", err)
-		}
-		log.Info().Msg("executed users terraform successfully")
-		viper.Set("kubefirst-checks.terraform-apply-users", true)
-		viper.WriteConfig()
-		telemetry.SendEvent(segClient, telemetry.UsersTerraformApplyCompleted, "")
-		progressPrinter.IncrementTracker("creating-users")
-	} else {
-		log.Info().Msg("already created users with terraform")
-		progressPrinter.IncrementTracker("creating-users")
-	}
-
-	progressPrinter.AddTracker("wrapping-up", "Wrapping up", 2)
-	progressPrinter.SetupProgress(progressPrinter.TotalOfTrackers(), false)
-
-	executionControl = viper.GetBool("kubefirst-checks.post-detokenize")
-	if !executionControl {
-		if err := k3d.PostRunPrepareGitopsRepository(config.GitopsDir); err != nil {
-			return fmt.Errorf("error detokenizing post run: %w", err)
-		}
-
-		gitopsRepo, err := git.PlainOpen(config.GitopsDir)
-		if err != nil {
-			return fmt.Errorf("error opening repo at %q: %w", config.GitopsDir, err)
-		}
-
-		oldPath := fmt.Sprintf("%s/terraform/%s/remote-backend.md", config.GitopsDir, config.GitProvider)
-		newPath := fmt.Sprintf("%s/terraform/%s/remote-backend.tf", config.GitopsDir, config.GitProvider)
-
-		if err = os.Rename(oldPath, newPath); err != nil {
-			return fmt.Errorf("failed to rename remote-backend.md to remote-backend.tf: %w", err)
-		}
-
-		err = gitClient.Commit(gitopsRepo, "committing initial detokenized gitops-template repo content post run")
-		if err != nil {
-			return fmt.Errorf("failed to commit initial detokenized gitops-template repo content: %w", err)
-		}
-		err = gitopsRepo.Push(&git.PushOptions{
-			RemoteName: config.GitProvider,
-			Auth:       httpAuth,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to push initial detokenized gitops-template repo content: %w", err)
-		}
-		viper.Set("kubefirst-checks.post-detokenize", true)
-		viper.WriteConfig()
-	} else {
-		log.Info().Msg("already detokenized post run")
+	log.Info().Msg("kubefirst installation complete")
+	log.Info().Msg("welcome to your new Kubefirst platform running in K3D")
+	if topology.LocalRegistryPort != 0 {
+		log.Info().Msgf("the local registry is %s, push images to it with `kubefirst k3d registry push <image>`", topology.LocalRegistryHost())
 	}
+	time.Sleep(1 * time.Second)
 
-	progressPrinter.IncrementTracker("wrapping-up")
+	reports.LocalHandoffScreenV2(cliFlags.ClusterName, gitDestDescriptor, cGitOwner, config, cliFlags.Ci)
 
-	argoDeployment, err := k8s.ReturnDeploymentObject(kcfg.Clientset, "app.kubernetes.io/instance", "argo", "argo", 1200)
-	if err != nil {
-		return fmt.Errorf("error finding Argo Workflows Deployment: %w", err)
-	}
-	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, argoDeployment, 120)
-	if err != nil {
-		return fmt.Errorf("error waiting for Argo Workflows Deployment ready state: %w", err)
+	if cliFlags.Ci {
+		progress.Progress.Quit()
 	}
 
-	utils.SetClusterStatusFlags(k3d.CloudProvider, config.GitProvider)
-
-	cluster := utilities.CreateClusterRecordFromRaw(cliFlags.UseTelemetry, cGitOwner, cGitUser, cGitToken, cGitlabOwnerGroupID, cliFlags.GitopsTemplateURL, cliFlags.GitopsTemplateBranch, catalogApps)
-
-	err = utilities.ExportCluster(cluster, kcfg)
-	if err != nil {
-		log.Error().Err(err).Msg("error exporting cluster object")
-		viper.Set("kubefirst.setup-complete", false)
-		viper.Set("kubefirst-checks.cluster-install-complete", false)
-		viper.WriteConfig()
-		return fmt.Errorf("failed to export cluster object: %w", err)
-	}
+	return nil
+}
 
-	kubefirstDeployment, err := k8s.ReturnDeploymentObject(
-		kcfg.Clientset,
-		"app.kubernetes.io/instance",
-		"kubefirst",
-		"kubefirst",
-		600,
-	)
+// phaseOptionsFromFlags reads the phase selection flags of k3d create
+func phaseOptionsFromFlags(cmd *cobra.Command) (pipeline.Options, error) {
+	fromPhase, err := cmd.Flags().GetString("from-phase")
 	if err != nil {
-		return fmt.Errorf("error finding kubefirst Deployment: %w", err)
+		return pipeline.Options{}, fmt.Errorf("failed to get from-phase flag: %w", err)
 	}
-	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, kubefirstDeployment, 120)
+	onlyPhase, err := cmd.Flags().GetString("only-phase")
 	if err != nil {
-		return fmt.Errorf("error waiting for kubefirst Deployment ready state: %w", err)
+		return pipeline.Options{}, fmt.Errorf("failed to get only-phase flag: %w", err)
 	}
-	progressPrinter.IncrementTracker("wrapping-up")
-
-	err = utils.OpenBrowser(constants.KubefirstConsoleLocalURLTLS)
+	retries, err := cmd.Flags().GetStringToInt("phase-retries")
 	if err != nil {
-		log.Error().Err(err).Msg("failed to open Kubefirst console in browser")
+		return pipeline.Options{}, fmt.Errorf("failed to get phase-retries flag: %w", err)
 	}
 
-	telemetry.SendEvent(segClient, telemetry.ClusterInstallCompleted, "")
-	viper.Set("kubefirst-checks.cluster-install-complete", true)
-	viper.WriteConfig()
-
-	log.Info().Msg("kubefirst installation complete")
-	log.Info().Msg("welcome to your new Kubefirst platform running in K3D")
-	time.Sleep(1 * time.Second)
-
-	reports.LocalHandoffScreenV2(cliFlags.ClusterName, gitDestDescriptor, cGitOwner, config, cliFlags.Ci)
-
-	if cliFlags.Ci {
-		progress.Progress.Quit()
-	}
-
-	return nil
+	return pipeline.Options{FromPhase: fromPhase, OnlyPhase: onlyPhase, Retries: retries}, nil
 }
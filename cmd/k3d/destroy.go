@@ -7,6 +7,7 @@ See the LICENSE file for more details.
 package k3d
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -20,6 +21,7 @@ import (
 	"github.com/konstructio/kubefirst-api/pkg/progressPrinter"
 	"github.com/konstructio/kubefirst-api/pkg/terraform"
 	utils "github.com/konstructio/kubefirst-api/pkg/utils"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
 	"github.com/konstructio/kubefirst/internal/progress"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -48,7 +50,11 @@ func destroyK3d(_ *cobra.Command, _ []string) error {
 
 	log.Info().Msg("destroying kubefirst platform running in k3d")
 
-	atlantisWebhookURL := fmt.Sprintf("%s/events", viper.GetString("ngrok.host"))
+	tunnel, err := internalk3d.LoadTunnel()
+	if err != nil {
+		return err
+	}
+	atlantisWebhookURL := tunnel.WebhookURL()
 
 	var cGitOwner, cGitToken string
 	switch gitProvider {
@@ -187,11 +193,24 @@ func destroyK3d(_ *cobra.Command, _ []string) error {
 
 		// close minio port-forward
 		minioStopChannel <- struct{}{}
+		topology, err := internalk3d.LoadTopology()
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("deleting k3d cluster %q with %s", clusterName, topology)
+		if len(topology.Volumes) > 0 {
+			log.Info().Msgf("the host directories mounted as volumes are kept: %s", strings.Join(topology.Volumes, ", "))
+		}
 		if err := k3d.DeleteK3dCluster(clusterName, config.K1Dir, config.K3dClient); err != nil {
 			return fmt.Errorf("unable to delete k3d cluster %q: %w", clusterName, err)
 		}
 
+		if err := os.Remove(internalk3d.RegistriesFile(config.K1Dir)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("unable to delete the k3d registries configuration: %w", err)
+		}
+
 		viper.Set("kubefirst-checks.create-k3d-cluster", false)
+		viper.Set("k3d-topology", "")
 		viper.WriteConfig()
 		log.Info().Msg("k3d resources terraform destroyed")
 		progressPrinter.IncrementTracker("platform-destroy")
@@ -0,0 +1,131 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	utils "github.com/konstructio/kubefirst-api/pkg/utils"
+	"github.com/konstructio/kubefirst/internal/progress"
+	"github.com/konstructio/kubefirst/internal/vault"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// startK3d starts a stopped k3d cluster and unseals its vault replicas
+func startK3d(cmd *cobra.Command, _ []string) error {
+	skipUnsealFlag, err := cmd.Flags().GetBool("skip-unseal")
+	if err != nil {
+		return fmt.Errorf("failed to get skip-unseal flag: %w", err)
+	}
+
+	flags := utils.GetClusterStatusFlags()
+	if !flags.SetupComplete {
+		return fmt.Errorf("failed to start cluster: there doesn't appear to be an active k3d cluster")
+	}
+	clusterName := viper.GetString("flags.cluster-name")
+	config, err := k3d.GetConfig(
+		clusterName,
+		flags.GitProvider,
+		viper.GetString(fmt.Sprintf("flags.%s-owner", flags.GitProvider)),
+		flags.GitProtocol,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	log.Info().Msgf("starting k3d cluster %q", clusterName)
+	if _, stderr, err := shell.ExecShellReturnStrings(config.K3dClient, "cluster", "start", clusterName); err != nil {
+		return fmt.Errorf("failed to start k3d cluster %q: %s: %w", clusterName, strings.TrimSpace(stderr), err)
+	}
+
+	if skipUnsealFlag {
+		log.Info().Msg("skipping vault unseal - run `kubefirst k3d unseal-vault` once vault is running")
+		quitProgress()
+		return nil
+	}
+
+	kcfg, err := k8s.CreateKubeConfig(false, config.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to create kubeconfig: %w", err)
+	}
+
+	vaultStatefulSet, err := k8s.ReturnStatefulSetObject(kcfg.Clientset, "app.kubernetes.io/instance", "vault", vault.Namespace, 120)
+	if err != nil {
+		return fmt.Errorf("error finding Vault StatefulSet: %w", err)
+	}
+	// sealed replicas never become ready, only wait for them to run
+	if _, err := k8s.WaitForStatefulSetReady(kcfg.Clientset, vaultStatefulSet, 300, true); err != nil {
+		return fmt.Errorf("error waiting for Vault StatefulSet to run: %w", err)
+	}
+
+	unsealer := vault.NewUnsealer(kcfg)
+	var unsealErr error
+	err = wait.PollUntilContextTimeout(cmd.Context(), 10*time.Second, 3*time.Minute, true, func(ctx context.Context) (bool, error) {
+		unsealed, err := unsealer.UnsealAll(ctx)
+		if err != nil {
+			// the vault server may still be starting
+			log.Info().Msgf("vault is not ready to be unsealed yet: %v", err)
+			unsealErr = err
+			return false, nil
+		}
+		if len(unsealed) > 0 {
+			log.Info().Msgf("unsealed %s", strings.Join(unsealed, ", "))
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to unseal vault: %w", unsealErr)
+	}
+
+	log.Info().Msgf("k3d cluster %q started and vault unsealed", clusterName)
+	quitProgress()
+
+	return nil
+}
+
+// stopK3d stops the k3d cluster, keeping its state for a later `k3d start`
+func stopK3d(_ *cobra.Command, _ []string) error {
+	flags := utils.GetClusterStatusFlags()
+	if !flags.SetupComplete {
+		return fmt.Errorf("failed to stop cluster: there doesn't appear to be an active k3d cluster")
+	}
+	clusterName := viper.GetString("flags.cluster-name")
+	config, err := k3d.GetConfig(
+		clusterName,
+		flags.GitProvider,
+		viper.GetString(fmt.Sprintf("flags.%s-owner", flags.GitProvider)),
+		flags.GitProtocol,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	log.Info().Msgf("stopping k3d cluster %q", clusterName)
+	if _, stderr, err := shell.ExecShellReturnStrings(config.K3dClient, "cluster", "stop", clusterName); err != nil {
+		return fmt.Errorf("failed to stop k3d cluster %q: %s: %w", clusterName, strings.TrimSpace(stderr), err)
+	}
+
+	log.Info().Msgf("k3d cluster %q stopped - run `kubefirst k3d start` to resume it", clusterName)
+	quitProgress()
+
+	return nil
+}
+
+func quitProgress() {
+	if progress.Progress != nil {
+		progress.Progress.Quit()
+	}
+}
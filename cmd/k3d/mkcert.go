@@ -7,18 +7,25 @@ See the LICENSE file for more details.
 package k3d
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/konstructio/kubefirst-api/pkg/k3d"
 	"github.com/konstructio/kubefirst-api/pkg/k8s"
 	utils "github.com/konstructio/kubefirst-api/pkg/utils"
+	"github.com/konstructio/kubefirst/internal/certificates"
 	"github.com/konstructio/kubefirst/internal/progress"
+	"github.com/konstructio/kubefirst/internal/step"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-// mkCert creates a single certificate for a host for k3d
+// mkCert creates, lists, renews and deletes mkcert certificates for k3d
 func mkCert(cmd *cobra.Command, _ []string) error {
 	utils.DisplayLogHints()
 
@@ -32,6 +39,40 @@ func mkCert(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to get namespace flag: %w", err)
 	}
 
+	sansFlag, err := cmd.Flags().GetStringSlice("sans")
+	if err != nil {
+		return fmt.Errorf("failed to get sans flag: %w", err)
+	}
+
+	listFlag, err := cmd.Flags().GetBool("list")
+	if err != nil {
+		return fmt.Errorf("failed to get list flag: %w", err)
+	}
+
+	renewFlag, err := cmd.Flags().GetBool("renew")
+	if err != nil {
+		return fmt.Errorf("failed to get renew flag: %w", err)
+	}
+
+	renewAllFlag, err := cmd.Flags().GetBool("renew-all")
+	if err != nil {
+		return fmt.Errorf("failed to get renew-all flag: %w", err)
+	}
+
+	renewBeforeFlag, err := cmd.Flags().GetDuration("renew-before")
+	if err != nil {
+		return fmt.Errorf("failed to get renew-before flag: %w", err)
+	}
+
+	deleteFlag, err := cmd.Flags().GetBool("delete")
+	if err != nil {
+		return fmt.Errorf("failed to get delete flag: %w", err)
+	}
+
+	if !listFlag && !renewAllFlag && (appNameFlag == "" || appNamespaceFlag == "") {
+		return errors.New("--application and --namespace are required unless --list or --renew-all is set")
+	}
+
 	flags := utils.GetClusterStatusFlags()
 	if !flags.SetupComplete {
 		return fmt.Errorf("there doesn't appear to be an active k3d cluster")
@@ -52,15 +93,93 @@ func mkCert(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to create kubeconfig: %w", err)
 	}
 
-	log.Infof("Generating certificate for %s.%s...", appNameFlag, k3d.DomainName)
+	manager := certificates.NewManager(kcfg.Clientset, config.MkCertClient, config.MkCertPemDir)
+	ctx := cmd.Context()
+	secretName := certificates.SecretName(appNameFlag)
 
-	err = k3d.GenerateSingleTLSSecret(kcfg.Clientset, *config, appNameFlag, appNamespaceFlag)
-	if err != nil {
-		return fmt.Errorf("error generating certificate for %s/%s: %w", appNameFlag, appNamespaceFlag, err)
+	switch {
+	case listFlag:
+		certs, err := manager.List(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing certificates: %w", err)
+		}
+		stepper := step.NewStepFactory(cmd.ErrOrStderr())
+		stepper.InfoStepString(certificateTable(certs, renewBeforeFlag, time.Now()))
+
+	case renewAllFlag:
+		renewed, err := manager.RenewExpiring(ctx, renewBeforeFlag, time.Now())
+		for _, cert := range renewed {
+			log.Infof("Renewed certificate %s/%s for %s.", cert.Namespace, cert.Secret, strings.Join(cert.SANs, ", "))
+		}
+		if err != nil {
+			return fmt.Errorf("error renewing certificates: %w", err)
+		}
+		if len(renewed) == 0 {
+			log.Infof("No certificate expires within %s.", renewBeforeFlag)
+		}
+
+	case renewFlag:
+		cert, err := manager.Get(ctx, appNamespaceFlag, secretName)
+		if err != nil {
+			return fmt.Errorf("error renewing certificate: %w", err)
+		}
+		if len(sansFlag) > 0 {
+			cert.SANs = sansFlag
+		}
+		if err := manager.Renew(ctx, *cert); err != nil {
+			return fmt.Errorf("error renewing certificate for %s/%s: %w", appNameFlag, appNamespaceFlag, err)
+		}
+		log.Infof("Certificate %s/%s renewed for %s.", appNamespaceFlag, secretName, strings.Join(cert.SANs, ", "))
+
+	case deleteFlag:
+		if err := manager.Delete(ctx, appNamespaceFlag, secretName); err != nil {
+			return fmt.Errorf("error deleting certificate for %s/%s: %w", appNameFlag, appNamespaceFlag, err)
+		}
+		log.Infof("Certificate %s/%s deleted.", appNamespaceFlag, secretName)
+
+	default:
+		sans := sansFlag
+		if len(sans) == 0 {
+			sans = []string{k3d.DomainName, fmt.Sprintf("%s.%s", appNameFlag, k3d.DomainName)}
+		}
+
+		log.Infof("Generating certificate for %s...", strings.Join(sans, ", "))
+		if err := manager.Create(ctx, appNamespaceFlag, secretName, sans); err != nil {
+			return fmt.Errorf("error generating certificate for %s/%s: %w", appNameFlag, appNamespaceFlag, err)
+		}
+		log.Infof("Certificate generated. You can use it with an app by setting `tls.secretName: %s` on a Traefik IngressRoute.", secretName)
 	}
 
-	log.Infof("Certificate generated. You can use it with an app by setting `tls.secretName: %s-tls` on a Traefik IngressRoute.", appNameFlag)
 	progress.Progress.Quit()
 
 	return nil
 }
+
+func certificateTable(certs []certificates.Certificate, renewBefore time.Duration, now time.Time) string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+
+	fmt.Fprintln(&buf, "")
+	fmt.Fprintln(&buf, "Local certificates")
+	fmt.Fprintln(&buf, "")
+
+	fmt.Fprintf(tw, "Namespace\tSecret\tHostnames\tExpires\tStatus\n")
+	fmt.Fprintf(tw, "---\t---\t---\t---\t---\n")
+	for _, cert := range certs {
+		status := "valid"
+		switch {
+		case now.After(cert.NotAfter):
+			status = "expired"
+		case cert.NotAfter.Sub(now) <= renewBefore:
+			status = "renew"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", cert.Namespace, cert.Secret, strings.Join(cert.SANs, ","), cert.NotAfter.Format(time.DateOnly), status)
+	}
+	tw.Flush()
+
+	if len(certs) == 0 {
+		fmt.Fprintln(&buf, "no certificates generated by mkcert were found")
+	}
+	return buf.String()
+}
@@ -0,0 +1,25 @@
+package k3d
+
+import (
+	"testing"
+	"time"
+
+	"github.com/konstructio/kubefirst/internal/certificates"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertificateTable(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	table := certificateTable([]certificates.Certificate{
+		{Namespace: "argo", Secret: "argo-tls", SANs: []string{"argo.kubefirst.dev"}, NotAfter: now.AddDate(1, 0, 0)},
+		{Namespace: "demo", Secret: "demo-tls", SANs: []string{"demo.kubefirst.dev", "*.demo.kubefirst.dev"}, NotAfter: now.AddDate(0, 0, 10)},
+		{Namespace: "old", Secret: "old-tls", SANs: []string{"old.kubefirst.dev"}, NotAfter: now.AddDate(0, 0, -1)},
+	}, 30*24*time.Hour, now)
+
+	require.Contains(t, table, "argo      |argo-tls |argo.kubefirst.dev                      |2025-01-01 |valid")
+	require.Contains(t, table, "demo      |demo-tls |demo.kubefirst.dev,*.demo.kubefirst.dev |2024-01-11 |renew")
+	require.Contains(t, table, "|expired")
+
+	require.Contains(t, certificateTable(nil, time.Hour, now), "no certificates generated by mkcert were found")
+}
@@ -0,0 +1,1085 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	argocdapi "github.com/argoproj/argo-cd/v2/pkg/client/clientset/versioned"
+	"github.com/atotto/clipboard"
+	"github.com/go-git/go-git/v5"
+	githttps "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/konstructio/kubefirst-api/pkg/argocd"
+	"github.com/konstructio/kubefirst-api/pkg/configs"
+	constants "github.com/konstructio/kubefirst-api/pkg/constants"
+	"github.com/konstructio/kubefirst-api/pkg/gitClient"
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	apiTypes "github.com/konstructio/kubefirst-api/pkg/types"
+	utils "github.com/konstructio/kubefirst-api/pkg/utils"
+	"github.com/konstructio/kubefirst/internal/bundle"
+	"github.com/konstructio/kubefirst/internal/gitShim"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
+	"github.com/konstructio/kubefirst/internal/pipeline"
+	"github.com/konstructio/kubefirst/internal/tools"
+	"github.com/konstructio/kubefirst/internal/types"
+	"github.com/konstructio/kubefirst/internal/utilities"
+	"github.com/kubefirst/metrics-client/pkg/telemetry"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// installer holds the inputs of the k3d create phases along with the values
+// phases hand to each other. Values produced by a phase that may be skipped
+// on a resumed run are loaded on demand.
+type installer struct {
+	cliFlags      *types.CliFlags
+	installBundle *bundle.Bundle
+	topology      *internalk3d.Topology
+	tunnel        *internalk3d.Tunnel
+	catalogApps   []apiTypes.GitopsCatalogApp
+	segClient     telemetry.TelemetryEvent
+
+	gitHost               string
+	gitOwner              string
+	gitUser               string
+	gitToken              string
+	gitlabOwnerGroupID    int
+	containerRegistryHost string
+	repositoryNames       []string
+	teamNames             []string
+	httpAuth              *githttps.BasicAuth
+
+	// locations from the k3d config
+	k1Dir                       string
+	gitopsDir                   string
+	metaphorDir                 string
+	toolsDir                    string
+	kubeconfig                  string
+	k3dClient                   string
+	terraformClient             string
+	destinationGitopsRepoURL    string
+	destinationGitopsRepoGitURL string
+	destinationMetaphorRepoURL  string
+	gitopsRepoURL               string
+
+	gitopsDirectoryTokens  *k3d.GitopsDirectoryValues
+	metaphorTemplateTokens *k3d.MetaphorTokenValues
+
+	// generateTLSSecrets and terraformApply are replaced in tests
+	generateTLSSecrets func(clientset kubernetes.Interface) error
+	terraformApply     func(terraformClient, entrypoint string, envs map[string]string) error
+
+	kcfg                  *k8s.KubernetesClient
+	registryAuthDone      bool
+	registryAuthToken     string
+	vaultRootToken        string
+	kubernetesAPIEndpoint string
+	stopChannels          []chan struct{}
+}
+
+// phases returns the phases of a k3d installation in the order they run
+func (i *installer) phases() []pipeline.Phase {
+	return []pipeline.Phase{
+		{Name: "git-credentials", Description: fmt.Sprintf("Verify %s credentials and repository availability", i.cliFlags.GitProvider), Check: i.cliFlags.GitProvider + "-credentials", Run: i.gitCredentials},
+		{Name: "kbot-setup", Description: "Create the kbot ssh key pair", Check: "kbot-setup", Run: i.kbotSetup},
+		{Name: "tools-download", Description: "Install k3d, kubectl, mkcert and terraform", Check: "tools-downloaded", Retries: 2, Run: i.toolsDownload},
+		{Name: "gitops-prepare", Description: "Clone and detokenize the gitops and metaphor repositories", Check: "gitops-ready-to-push", Retries: 2, Run: i.gitopsPrepare},
+		{Name: "git-terraform", Description: fmt.Sprintf("Apply %s terraform", i.cliFlags.GitProvider), Check: "terraform-apply-" + i.cliFlags.GitProvider, Retries: 1, Run: i.gitTerraform},
+		{Name: "gitops-push", Description: "Push the gitops and metaphor repositories", Check: "gitops-repo-pushed", Retries: 2, Run: i.gitopsPush},
+		{Name: "cluster-create", Description: "Create the k3d cluster", Check: "create-k3d-cluster", Run: i.clusterCreate},
+		{Name: "k8s-secrets", Description: "Create the bootstrap kubernetes secrets", Check: "k8s-secrets-created", Retries: 2, Run: i.k8sSecrets},
+		{Name: "registry-auth", Description: "Create the container registry secret", Retries: 2, Run: i.registryAuth},
+		{Name: "cluster-ready", Description: "Wait for the kubernetes cluster to be ready", Retries: 1, Run: i.clusterReady},
+		{Name: "argocd-install", Description: "Install Argo CD", Check: "argocd-install", Retries: 2, Run: i.argocdInstall},
+		{Name: "argocd-ready", Description: "Wait for Argo CD to be ready", Retries: 1, Run: i.argocdReady},
+		{Name: "argocd-credentials", Description: "Set the Argo CD credentials", Check: "argocd-credentials-set", Retries: 2, Run: i.argocdCredentials},
+		{Name: "argocd-registry", Description: "Create the Argo CD registry application", Check: "argocd-create-registry", Retries: 2, Run: i.argocdRegistry},
+		{Name: "vault-ready", Description: "Wait for Vault to be ready", Retries: 1, Run: i.vaultReady},
+		{Name: "vault-initialize", Description: "Initialize and unseal Vault", Check: "vault-initialized", Retries: 1, Run: i.vaultInitialize},
+		{Name: "state-store-upload", Description: "Upload the terraform state to the state store", Retries: 2, Run: i.stateStoreUpload},
+		{Name: "vault-terraform", Description: "Configure Vault with terraform", Check: "terraform-apply-vault", Retries: 1, Run: i.vaultTerraform},
+		{Name: "users-terraform", Description: "Create users with terraform", Check: "terraform-apply-users", Retries: 1, Run: i.usersTerraform},
+		{Name: "post-detokenize", Description: "Commit and push the final gitops repository content", Check: "post-detokenize", Retries: 2, Run: i.postDetokenize},
+		{Name: "atlantis-webhook", Description: "Expose Atlantis through the tunnel and create its webhook", Retries: 2, Run: i.atlantisWebhook},
+		{Name: "finalize", Description: "Register the cluster and wait for the kubefirst console", Run: i.finalize},
+	}
+}
+
+// close stops the port-forwards opened by the phases
+func (i *installer) close() {
+	for _, stopChannel := range i.stopChannels {
+		close(stopChannel)
+	}
+	i.stopChannels = nil
+}
+
+// kubeClient returns a client for the k3d cluster
+func (i *installer) kubeClient() (*k8s.KubernetesClient, error) {
+	if i.kcfg != nil {
+		return i.kcfg, nil
+	}
+
+	kcfg, err := k8s.CreateKubeConfig(false, i.kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubeconfig: %w", err)
+	}
+	i.kcfg = kcfg
+	return kcfg, nil
+}
+
+// host returns the git server the repositories are created on
+func (i *installer) host() (*gitShim.Host, error) {
+	host, err := gitShim.NewHost(i.cliFlags.GitProvider, i.gitHost, i.cliFlags.GitAPIURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid git host: %w", err)
+	}
+	return host, nil
+}
+
+func (i *installer) gitCredentials(ctx context.Context) error {
+	telemetry.SendEvent(i.segClient, telemetry.GitCredentialsCheckStarted, "")
+	if len(i.gitToken) == 0 {
+		msg := fmt.Sprintf("please set a %s_TOKEN environment variable to continue", strings.ToUpper(i.cliFlags.GitProvider))
+		telemetry.SendEvent(i.segClient, telemetry.GitCredentialsCheckFailed, msg)
+		return errors.New(msg)
+	}
+
+	initGitParameters := gitShim.GitInitParameters{
+		GitProvider:   i.cliFlags.GitProvider,
+		GitToken:      i.gitToken,
+		GitOwner:      i.gitOwner,
+		Repositories:  i.repositoryNames,
+		Teams:         i.teamNames,
+		AdoptExisting: i.cliFlags.AdoptExisting,
+	}
+	host, err := i.host()
+	if err != nil {
+		return err
+	}
+	initGitParameters.Host = host
+	if err := gitShim.InitializeGitProvider(ctx, &initGitParameters); err != nil {
+		return fmt.Errorf("failed to initialize Git provider: %w", err)
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.GitCredentialsCheckCompleted, "")
+	return nil
+}
+
+func (i *installer) kbotSetup(_ context.Context) error {
+	telemetry.SendEvent(i.segClient, telemetry.KbotSetupStarted, "")
+
+	log.Info().Msg("creating an ssh key pair for your new cloud infrastructure")
+	sshPrivateKey, sshPublicKey, err := utils.CreateSSHKeyPair()
+	if err != nil {
+		telemetry.SendEvent(i.segClient, telemetry.KbotSetupFailed, err.Error())
+		return fmt.Errorf("failed to create SSH key pair: %w", err)
+	}
+	log.Info().Msg("ssh key pair creation complete")
+
+	viper.Set("kbot.private-key", sshPrivateKey)
+	viper.Set("kbot.public-key", sshPublicKey)
+	viper.Set("kbot.username", "kbot")
+	viper.WriteConfig()
+	telemetry.SendEvent(i.segClient, telemetry.KbotSetupCompleted, "")
+	log.Info().Msg("kbot-setup complete")
+	return nil
+}
+
+func (i *installer) toolsDownload(ctx context.Context) error {
+	log.Info().Msg("installing kubefirst dependencies")
+
+	toolManager, err := tools.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to create tool manager: %w", err)
+	}
+
+	if i.installBundle != nil {
+		if _, err := toolManager.Import(i.installBundle.ToolsCacheDir()); err != nil {
+			return fmt.Errorf("failed to import tools from bundle: %w", err)
+		}
+	}
+
+	err = toolManager.Install(ctx, i.toolsDir, tools.K3d, tools.Kubectl, tools.Mkcert, tools.Terraform)
+	if err != nil {
+		return fmt.Errorf("failed to download tools: %w", err)
+	}
+
+	log.Info().Msg("download dependencies `$HOME/.k1/tools` complete")
+	return nil
+}
+
+func (i *installer) gitopsPrepare(_ context.Context) error {
+	log.Info().Msg("generating your new gitops repository")
+	removeAtlantis := !i.tunnel.Atlantis()
+
+	err := k3d.PrepareGitRepositories(
+		i.cliFlags.GitProvider,
+		i.cliFlags.ClusterName,
+		i.cliFlags.ClusterType,
+		i.destinationGitopsRepoURL,
+		i.gitopsDir,
+		i.cliFlags.GitopsTemplateBranch,
+		i.cliFlags.GitopsTemplateURL,
+		i.destinationMetaphorRepoURL,
+		i.k1Dir,
+		i.gitopsDirectoryTokens,
+		i.metaphorDir,
+		i.metaphorTemplateTokens,
+		i.cliFlags.GitProtocol,
+		removeAtlantis,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prepare git repositories: %w", err)
+	}
+	return nil
+}
+
+func (i *installer) gitTerraform(ctx context.Context) error {
+	telemetry.SendEvent(i.segClient, telemetry.GitTerraformApplyStarted, "")
+
+	tfEnvs := map[string]string{
+		"TF_VAR_kbot_ssh_public_key":   viper.GetString("kbot.public-key"),
+		"AWS_ACCESS_KEY_ID":            constants.MinioDefaultUsername,
+		"AWS_SECRET_ACCESS_KEY":        constants.MinioDefaultPassword,
+		"TF_VAR_aws_access_key_id":     constants.MinioDefaultUsername,
+		"TF_VAR_aws_secret_access_key": constants.MinioDefaultPassword,
+	}
+	if i.cliFlags.GitProtocol == "https" {
+		tfEnvs["TF_VAR_kbot_ssh_public_key"] = ""
+	}
+
+	host, err := i.host()
+	if err != nil {
+		return err
+	}
+	maps.Copy(tfEnvs, host.TerraformEnv())
+
+	var providerName, created string
+	var importID func(name string) string
+	switch i.cliFlags.GitProvider {
+	case "github":
+		providerName = "GitHub"
+		created = fmt.Sprintf("created git repositories for %s/%s", host.Name, i.gitOwner)
+		tfEnvs["GITHUB_TOKEN"] = i.gitToken
+		tfEnvs["GITHUB_OWNER"] = i.gitOwner
+		importID = func(name string) string { return name }
+	case "gitlab":
+		providerName = "GitLab"
+		created = fmt.Sprintf("created git projects and groups for %s/%s", host.Name, i.cliFlags.GitlabGroup)
+		tfEnvs["GITLAB_TOKEN"] = i.gitToken
+		tfEnvs["GITLAB_OWNER"] = i.cliFlags.GitlabGroup
+		tfEnvs["TF_VAR_owner_group_id"] = strconv.Itoa(i.gitlabOwnerGroupID)
+		importID = func(name string) string { return i.cliFlags.GitlabGroup + "/" + name }
+	default:
+		return fmt.Errorf("invalid git provider option %q", i.cliFlags.GitProvider)
+	}
+
+	log.Info().Msgf("Creating %s resources with Terraform", providerName)
+
+	tfEntrypoint := i.gitopsDir + "/terraform/" + i.cliFlags.GitProvider
+
+	// the repositories git-credentials found empty are imported, the plan
+	// then updates them instead of failing to create them
+	if i.cliFlags.AdoptExisting {
+		provider, err := gitShim.NewGitProvider(host, i.gitToken)
+		if err != nil {
+			return err
+		}
+		existing, err := provider.ExistingRepositories(ctx, i.gitOwner, i.repositoryNames)
+		if err != nil {
+			return err
+		}
+		if err := internalk3d.ImportRepositories(i.terraformClient, tfEntrypoint, tfEnvs, existing, importID); err != nil {
+			telemetry.SendEvent(i.segClient, telemetry.GitTerraformApplyFailed, err.Error())
+			return err
+		}
+	}
+
+	if err := i.terraformApply(i.terraformClient, tfEntrypoint, tfEnvs); err != nil {
+		msg := fmt.Errorf("error creating %s resources with terraform %q: %w", providerName, tfEntrypoint, err)
+		telemetry.SendEvent(i.segClient, telemetry.GitTerraformApplyFailed, msg.Error())
+		return msg
+	}
+
+	log.Info().Msg(created)
+	telemetry.SendEvent(i.segClient, telemetry.GitTerraformApplyCompleted, "")
+	return nil
+}
+
+func (i *installer) gitopsPush(_ context.Context) error {
+	telemetry.SendEvent(i.segClient, telemetry.GitopsRepoPushStarted, "")
+
+	log.Info().Msgf("referencing gitops repository: %q", i.destinationGitopsRepoGitURL)
+	log.Info().Msgf("referencing metaphor repository: %q", i.destinationMetaphorRepoURL)
+
+	gitopsRepo, err := git.PlainOpen(i.gitopsDir)
+	if err != nil {
+		return fmt.Errorf("error opening repo at %q: %w", i.gitopsDir, err)
+	}
+
+	metaphorRepo, err := git.PlainOpen(i.metaphorDir)
+	if err != nil {
+		return fmt.Errorf("error opening repo at %q: %w", i.metaphorDir, err)
+	}
+
+	err = utils.EvalSSHKey(&apiTypes.EvalSSHKeyRequest{
+		GitProvider:     i.cliFlags.GitProvider,
+		GitlabGroupFlag: i.cliFlags.GitlabGroup,
+		GitToken:        i.gitToken,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to evaluate SSH key: %w", err)
+	}
+
+	err = gitopsRepo.Push(
+		&git.PushOptions{
+			RemoteName: i.cliFlags.GitProvider,
+			Auth:       i.httpAuth,
+		},
+	)
+	if err != nil {
+		msg := fmt.Errorf("error pushing detokenized gitops repository to remote %q: %w", i.destinationGitopsRepoGitURL, err)
+		telemetry.SendEvent(i.segClient, telemetry.GitopsRepoPushFailed, msg.Error())
+		if !strings.Contains(msg.Error(), "already up-to-date") {
+			log.Print(msg.Error())
+			return msg
+		}
+	}
+
+	err = metaphorRepo.Push(
+		&git.PushOptions{
+			RemoteName: "origin",
+			Auth:       i.httpAuth,
+		},
+	)
+	if err != nil {
+		msg := fmt.Errorf("error pushing detokenized metaphor repository to remote %q: %w", i.destinationMetaphorRepoURL, err)
+		telemetry.SendEvent(i.segClient, telemetry.GitopsRepoPushFailed, msg.Error())
+		if !strings.Contains(msg.Error(), "already up-to-date") {
+			return msg
+		}
+	}
+	log.Info().Msgf("successfully pushed gitops and metaphor repositories to https://%s/%s", i.gitHost, i.gitOwner)
+
+	telemetry.SendEvent(i.segClient, telemetry.GitopsRepoPushCompleted, "")
+	return nil
+}
+
+func (i *installer) clusterCreate(_ context.Context) error {
+	telemetry.SendEvent(i.segClient, telemetry.CloudTerraformApplyStarted, "")
+
+	log.Info().Msg("Creating k3d cluster")
+
+	if i.installBundle != nil && i.topology.Image != internalk3d.DefaultK3sImage {
+		log.Warn().Msgf("the k3s image %s is not part of the bundle, it must be available to docker", i.topology.Image)
+	}
+
+	// the topology is persisted first so destroy and status know the cluster
+	// even when its creation fails
+	if err := i.topology.Save(); err != nil {
+		return fmt.Errorf("failed to save k3d topology: %w", err)
+	}
+
+	err := internalk3d.ClusterCreate(i.cliFlags.ClusterName, i.k1Dir, i.k3dClient, i.kubeconfig, i.topology)
+	if err != nil {
+		msg := fmt.Errorf("error creating k3d resources with k3d client %q: %w", i.k3dClient, err)
+		viper.Set("kubefirst-checks.create-k3d-cluster-failed", true)
+		viper.WriteConfig()
+		telemetry.SendEvent(i.segClient, telemetry.CloudTerraformApplyFailed, msg.Error())
+		return msg
+	}
+
+	log.Info().Msg("successfully created k3d cluster")
+
+	if i.installBundle != nil && i.installBundle.ImagesArchive() != "" {
+		log.Info().Msg("importing bundled images into the k3d cluster")
+		_, _, err := shell.ExecShellReturnStrings(i.k3dClient, "image", "import", i.installBundle.ImagesArchive(), "--cluster", i.cliFlags.ClusterName)
+		if err != nil {
+			return fmt.Errorf("failed to import bundled images: %w", err)
+		}
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.CloudTerraformApplyCompleted, "")
+	return nil
+}
+
+func (i *installer) k8sSecrets(_ context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	if err := i.generateTLSSecrets(kcfg.Clientset); err != nil {
+		return fmt.Errorf("failed to generate TLS secrets: %w", err)
+	}
+
+	err = k3d.AddK3DSecrets(
+		i.gitopsRepoURL,
+		viper.GetString("kbot.private-key"),
+		i.cliFlags.GitProvider,
+		i.gitUser,
+		i.kubeconfig,
+		i.gitToken,
+	)
+	if err != nil {
+		log.Info().Msg("Error adding kubernetes secrets for bootstrap")
+		return fmt.Errorf("failed to add Kubernetes secrets: %w", err)
+	}
+	return nil
+}
+
+// registryAuth creates the container registry secret, the gitlab deploy token
+// it returns is used by the vault terraform
+func (i *installer) registryAuth(ctx context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+	host, err := i.host()
+	if err != nil {
+		return err
+	}
+
+	containerRegistryAuth := gitShim.ContainerRegistryAuth{
+		GitProvider:           i.cliFlags.GitProvider,
+		GitUser:               i.gitUser,
+		GitToken:              i.gitToken,
+		GitlabGroupFlag:       i.cliFlags.GitlabGroup,
+		GithubOwner:           i.gitOwner,
+		ContainerRegistryHost: i.containerRegistryHost,
+		Host:                  host,
+		Clientset:             kcfg.Clientset,
+	}
+	i.registryAuthToken, err = gitShim.CreateContainerRegistrySecret(ctx, &containerRegistryAuth)
+	if err != nil {
+		return fmt.Errorf("failed to create container registry secret: %w", err)
+	}
+	i.registryAuthDone = true
+	return nil
+}
+
+func (i *installer) clusterReady(_ context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	traefikDeployment, err := k8s.ReturnDeploymentObject(
+		kcfg.Clientset,
+		"app.kubernetes.io/name",
+		"traefik",
+		"kube-system",
+		240,
+	)
+	if err != nil {
+		return fmt.Errorf("error finding traefik deployment: %w", err)
+	}
+	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, traefikDeployment, 240)
+	if err != nil {
+		return fmt.Errorf("error waiting for traefik deployment ready state: %w", err)
+	}
+
+	metricsServerDeployment, err := k8s.ReturnDeploymentObject(
+		kcfg.Clientset,
+		"k8s-app",
+		"metrics-server",
+		"kube-system",
+		240,
+	)
+	if err != nil {
+		return fmt.Errorf("error finding metrics-server deployment: %w", err)
+	}
+	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, metricsServerDeployment, 240)
+	if err != nil {
+		return fmt.Errorf("error waiting for metrics-server deployment ready state: %w", err)
+	}
+
+	time.Sleep(time.Second * 20)
+	return nil
+}
+
+// kustomization returns the manifests of the kustomization name, the ones
+// rendered into the bundle when installing from one
+func (i *installer) kustomization(kcfg *k8s.KubernetesClient, name string) (*bytes.Buffer, error) {
+	if i.installBundle != nil {
+		data, err := i.installBundle.Kustomization(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s manifests from bundle: %w", name, err)
+		}
+		return bytes.NewBuffer(data), nil
+	}
+
+	yamlData, err := kcfg.KustomizeBuild(internalk3d.KustomizationPaths[name])
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s manifests: %w", name, err)
+	}
+	return yamlData, nil
+}
+
+func (i *installer) argocdInstall(_ context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.ArgoCDInstallStarted, "")
+
+	log.Info().Msgf("installing ArgoCD")
+
+	yamlData, err := i.kustomization(kcfg, internalk3d.ArgoCDKustomization)
+	if err != nil {
+		return err
+	}
+
+	output, err := kcfg.SplitYAMLFile(yamlData)
+	if err != nil {
+		return fmt.Errorf("failed to split YAML file: %w", err)
+	}
+
+	if err := kcfg.ApplyObjects(output); err != nil {
+		telemetry.SendEvent(i.segClient, telemetry.ArgoCDInstallFailed, err.Error())
+		return fmt.Errorf("failed to apply ArgoCD objects: %w", err)
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.ArgoCDInstallCompleted, "")
+	return nil
+}
+
+func (i *installer) argocdReady(_ context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	if _, err := k8s.VerifyArgoCDReadiness(kcfg.Clientset, true, 300); err != nil {
+		return fmt.Errorf("error waiting for ArgoCD to become ready: %w", err)
+	}
+	return nil
+}
+
+func (i *installer) argocdCredentials(ctx context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg("Setting ArgoCD username and password credentials")
+
+	argocd.ArgocdSecretClient = kcfg.Clientset.CoreV1().Secrets("argocd")
+
+	argocdPassword := k8s.GetSecretValue(argocd.ArgocdSecretClient, "argocd-initial-admin-secret", "password")
+	if argocdPassword == "" {
+		return errors.New("ArgoCD password not found in secret")
+	}
+
+	viper.Set("components.argocd.password", argocdPassword)
+	viper.Set("components.argocd.username", "admin")
+	viper.WriteConfig()
+	log.Info().Msg("ArgoCD username and password credentials set successfully")
+	log.Info().Msg("Getting an ArgoCD auth token")
+
+	var argoCDToken string
+	if err := utils.TestEndpointTLS(strings.Replace(k3d.ArgocdURL, "https://", "", 1)); err != nil {
+		argoCDStopChannel := make(chan struct{}, 1)
+		log.Info().Msgf("ArgoCD not available via https, using http")
+		defer func() {
+			close(argoCDStopChannel)
+		}()
+		k8s.OpenPortForwardPodWrapper(
+			kcfg.Clientset,
+			kcfg.RestConfig,
+			"argocd-server",
+			"argocd",
+			8080,
+			8080,
+			argoCDStopChannel,
+		)
+		argoCDHTTPURL := strings.Replace(
+			k3d.ArgocdURL,
+			"https://",
+			"http://",
+			1,
+		) + ":8080"
+		argoCDToken, err = internalk3d.ArgoCDToken(ctx, argoCDHTTPURL, "admin", argocdPassword)
+		if err != nil {
+			return fmt.Errorf("failed to get ArgoCD token: %w", err)
+		}
+	} else {
+		argoCDToken, err = internalk3d.ArgoCDToken(ctx, k3d.ArgocdURL, "admin", argocdPassword)
+		if err != nil {
+			return fmt.Errorf("failed to get ArgoCD token: %w", err)
+		}
+	}
+
+	log.Info().Msg("ArgoCD admin auth token set")
+
+	viper.Set("components.argocd.auth-token", argoCDToken)
+	viper.WriteConfig()
+
+	if configs.K1Version == "development" {
+		err := clipboard.WriteAll(argocdPassword)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to copy ArgoCD password to clipboard")
+		}
+
+		if os.Getenv("SKIP_ARGOCD_LAUNCH") != "true" || !i.cliFlags.Ci {
+			err = utils.OpenBrowser(constants.ArgoCDLocalURLTLS)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to open ArgoCD URL in browser")
+			}
+		}
+	}
+	return nil
+}
+
+func (i *installer) argocdRegistry(ctx context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.CreateRegistryStarted, "")
+	argocdClient, err := argocdapi.NewForConfig(kcfg.RestConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create ArgoCD client: %w", err)
+	}
+
+	log.Info().Msg("applying the registry application to ArgoCD")
+	registryApplicationObject := argocd.GetArgoCDApplicationObject(i.gitopsRepoURL, fmt.Sprintf("registry/%s", i.cliFlags.ClusterName))
+
+	err = k3d.RestartDeployment(ctx, kcfg.Clientset, "argocd", "argocd-applicationset-controller")
+	if err != nil {
+		return fmt.Errorf("error in restarting ArgoCD controller: %w", err)
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, 5*time.Second, 20*time.Second, true, func(ctx context.Context) (bool, error) {
+		_, err := argocdClient.ArgoprojV1alpha1().Applications("argocd").Create(ctx, registryApplicationObject, metav1.CreateOptions{})
+		if err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				return false, nil
+			}
+
+			if apierrors.IsAlreadyExists(err) {
+				return true, nil
+			}
+
+			return false, fmt.Errorf("error creating ArgoCD application: %w", err)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error creating ArgoCD application: %w", err)
+	}
+
+	log.Info().Msg("ArgoCD application created successfully")
+	telemetry.SendEvent(i.segClient, telemetry.CreateRegistryCompleted, "")
+	return nil
+}
+
+func (i *installer) vaultReady(_ context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	vaultStatefulSet, err := k8s.ReturnStatefulSetObject(
+		kcfg.Clientset,
+		"app.kubernetes.io/instance",
+		"vault",
+		"vault",
+		120,
+	)
+	if err != nil {
+		return fmt.Errorf("error finding Vault StatefulSet: %w", err)
+	}
+	_, err = k8s.WaitForStatefulSetReady(kcfg.Clientset, vaultStatefulSet, 120, true)
+	if err != nil {
+		return fmt.Errorf("error waiting for Vault StatefulSet ready state: %w", err)
+	}
+
+	time.Sleep(time.Second * 10)
+	return nil
+}
+
+func (i *installer) vaultInitialize(_ context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.VaultInitializationStarted, "")
+
+	yamlData, err := i.kustomization(kcfg, internalk3d.VaultHandlerKustomization)
+	if err != nil {
+		return err
+	}
+
+	output, err := kcfg.SplitYAMLFile(yamlData)
+	if err != nil {
+		return fmt.Errorf("failed to split YAML file: %w", err)
+	}
+
+	if err := kcfg.ApplyObjects(output); err != nil {
+		return fmt.Errorf("failed to apply vault handler objects: %w", err)
+	}
+
+	job, err := k8s.ReturnJobObject(kcfg.Clientset, "vault", "vault-handler")
+	if err != nil {
+		return fmt.Errorf("failed to get vault job object: %w", err)
+	}
+	_, err = k8s.WaitForJobComplete(kcfg.Clientset, job.GetName(), job.GetNamespace(), 240)
+	if err != nil {
+		msg := fmt.Errorf("could not run vault unseal job: %w", err)
+		telemetry.SendEvent(i.segClient, telemetry.VaultInitializationFailed, msg.Error())
+		return msg
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.VaultInitializationCompleted, "")
+	return nil
+}
+
+func (i *installer) stateStoreUpload(ctx context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	minioStopChannel := make(chan struct{}, 1)
+	defer func() {
+		close(minioStopChannel)
+	}()
+
+	k8s.OpenPortForwardPodWrapper(
+		kcfg.Clientset,
+		kcfg.RestConfig,
+		"minio",
+		"minio",
+		9000,
+		9000,
+		minioStopChannel,
+	)
+
+	minioClient, err := minio.New(constants.MinioPortForwardEndpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(constants.MinioDefaultUsername, constants.MinioDefaultPassword, ""),
+		Secure: false,
+		Region: constants.MinioRegion,
+	})
+	if err != nil {
+		return fmt.Errorf("error creating Minio client: %w", err)
+	}
+
+	objectName := fmt.Sprintf("terraform/%s/terraform.tfstate", i.cliFlags.GitProvider)
+	filePath := i.k1Dir + fmt.Sprintf("/gitops/%s", objectName)
+	contentType := "xl.meta"
+	bucketName := "kubefirst-state-store"
+	log.Info().Msgf("BucketName: %q", bucketName)
+
+	viper.Set("kubefirst.state-store.name", bucketName)
+	viper.Set("kubefirst.state-store.hostname", "minio-console.kubefirst.dev")
+	viper.Set("kubefirst.state-store-creds.access-key-id", constants.MinioDefaultUsername)
+	viper.Set("kubefirst.state-store-creds.secret-access-key-id", constants.MinioDefaultPassword)
+	viper.WriteConfig()
+
+	info, err := minioClient.FPutObject(ctx, bucketName, objectName, filePath, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return fmt.Errorf("error uploading to Minio bucket: %w", err)
+	}
+
+	log.Printf("Successfully uploaded %q to bucket %q", objectName, info.Bucket)
+	return nil
+}
+
+// vault opens a port-forward to vault and loads its root token along with
+// the in-cluster kubernetes api endpoint
+func (i *installer) vault() error {
+	if i.vaultRootToken != "" {
+		return nil
+	}
+
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	vaultStopChannel := make(chan struct{}, 1)
+	i.stopChannels = append(i.stopChannels, vaultStopChannel)
+	k8s.OpenPortForwardPodWrapper(
+		kcfg.Clientset,
+		kcfg.RestConfig,
+		"vault-0",
+		"vault",
+		8200,
+		8200,
+		vaultStopChannel,
+	)
+
+	secData, err := k8s.ReadSecretV2(kcfg.Clientset, "vault", "vault-unseal-secret")
+	if err != nil {
+		return fmt.Errorf("failed to read vault unseal secret: %w", err)
+	}
+
+	kubernetesInClusterAPIService, err := k8s.ReadService(i.kubeconfig, "default", "kubernetes")
+	if err != nil {
+		return fmt.Errorf("error looking up kubernetes api server service: %w", err)
+	}
+
+	if err := utils.TestEndpointTLS(strings.Replace(k3d.VaultURL, "https://", "", 1)); err != nil {
+		return fmt.Errorf("unable to reach vault over https: %w", err)
+	}
+
+	i.vaultRootToken = secData["root-token"]
+	i.kubernetesAPIEndpoint = fmt.Sprintf("https://%s", kubernetesInClusterAPIService.Spec.ClusterIP)
+	return nil
+}
+
+func (i *installer) vaultTerraform(ctx context.Context) error {
+	if err := i.vault(); err != nil {
+		return err
+	}
+	if !i.registryAuthDone {
+		if err := i.registryAuth(ctx); err != nil {
+			return err
+		}
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.VaultTerraformApplyStarted, "")
+
+	tfEnvs := map[string]string{}
+	var usernamePasswordString, base64DockerAuth string
+
+	if i.cliFlags.GitProvider == "gitlab" {
+		usernamePasswordString = fmt.Sprintf("%s:%s", "container-registry-auth", i.registryAuthToken)
+		base64DockerAuth = base64.StdEncoding.EncodeToString([]byte(usernamePasswordString))
+
+		tfEnvs["TF_VAR_container_registry_auth"] = i.registryAuthToken
+		tfEnvs["TF_VAR_owner_group_id"] = strconv.Itoa(i.gitlabOwnerGroupID)
+	} else {
+		usernamePasswordString = fmt.Sprintf("%s:%s", i.gitUser, i.gitToken)
+		base64DockerAuth = base64.StdEncoding.EncodeToString([]byte(usernamePasswordString))
+	}
+
+	log.Info().Msg("configuring vault with terraform")
+
+	gitProvider := i.cliFlags.GitProvider
+	tfEnvs["TF_VAR_email_address"] = "your@email.com"
+	tfEnvs[fmt.Sprintf("TF_VAR_%s_token", gitProvider)] = i.gitToken
+	tfEnvs[fmt.Sprintf("TF_VAR_%s_user", gitProvider)] = i.gitUser
+	tfEnvs["TF_VAR_vault_addr"] = k3d.VaultPortForwardURL
+	tfEnvs["TF_VAR_b64_docker_auth"] = base64DockerAuth
+	tfEnvs["TF_VAR_vault_token"] = i.vaultRootToken
+	tfEnvs["VAULT_ADDR"] = k3d.VaultPortForwardURL
+	tfEnvs["VAULT_TOKEN"] = i.vaultRootToken
+	tfEnvs["TF_VAR_atlantis_repo_webhook_secret"] = viper.GetString("secrets.atlantis-webhook")
+	tfEnvs["TF_VAR_kbot_ssh_private_key"] = viper.GetString("kbot.private-key")
+	tfEnvs["TF_VAR_kbot_ssh_public_key"] = viper.GetString("kbot.public-key")
+	tfEnvs["TF_VAR_kubernetes_api_endpoint"] = i.kubernetesAPIEndpoint
+	tfEnvs[fmt.Sprintf("%s_OWNER", strings.ToUpper(gitProvider))] = viper.GetString(fmt.Sprintf("flags.%s-owner", gitProvider))
+	tfEnvs["AWS_ACCESS_KEY_ID"] = constants.MinioDefaultUsername
+	tfEnvs["AWS_SECRET_ACCESS_KEY"] = constants.MinioDefaultPassword
+	tfEnvs["TF_VAR_aws_access_key_id"] = constants.MinioDefaultUsername
+	tfEnvs["TF_VAR_aws_secret_access_key"] = constants.MinioDefaultPassword
+	tfEnvs["TF_VAR_ngrok_authtoken"] = viper.GetString("secrets.atlantis-ngrok-authtoken")
+
+	host, err := i.host()
+	if err != nil {
+		return err
+	}
+	maps.Copy(tfEnvs, host.TerraformEnv())
+
+	tfEntrypoint := i.gitopsDir + "/terraform/vault"
+	if err := i.terraformApply(i.terraformClient, tfEntrypoint, tfEnvs); err != nil {
+		telemetry.SendEvent(i.segClient, telemetry.VaultTerraformApplyStarted, err.Error())
+		return fmt.Errorf("failed to execute vault terraform: %w", err)
+	}
+	log.Info().Msg("vault terraform executed successfully")
+	telemetry.SendEvent(i.segClient, telemetry.VaultTerraformApplyCompleted, "")
+	return nil
+}
+
+func (i *installer) usersTerraform(_ context.Context) error {
+	if err := i.vault(); err != nil {
+		return err
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.UsersTerraformApplyStarted, "")
+
+	log.Info().Msg("applying users terraform")
+
+	gitProvider := i.cliFlags.GitProvider
+	tfEnvs := map[string]string{}
+	tfEnvs["TF_VAR_email_address"] = "your@email.com"
+	tfEnvs[fmt.Sprintf("TF_VAR_%s_token", gitProvider)] = i.gitToken
+	tfEnvs["TF_VAR_vault_addr"] = k3d.VaultPortForwardURL
+	tfEnvs["TF_VAR_vault_token"] = i.vaultRootToken
+	tfEnvs["VAULT_ADDR"] = k3d.VaultPortForwardURL
+	tfEnvs["VAULT_TOKEN"] = i.vaultRootToken
+	tfEnvs[fmt.Sprintf("%s_TOKEN", strings.ToUpper(gitProvider))] = i.gitToken
+	tfEnvs[fmt.Sprintf("%s_OWNER", strings.ToUpper(gitProvider))] = i.gitOwner
+
+	host, err := i.host()
+	if err != nil {
+		return err
+	}
+	maps.Copy(tfEnvs, host.TerraformEnv())
+
+	tfEntrypoint := i.gitopsDir + "/terraform/users"
+	if err := i.terraformApply(i.terraformClient, tfEntrypoint, tfEnvs); err != nil {
+		telemetry.SendEvent(i.segClient, telemetry.UsersTerraformApplyStarted, err.Error())
+		return fmt.Errorf("failed to apply users terraform: %w", err)
+	}
+	log.Info().Msg("executed users terraform successfully")
+	telemetry.SendEvent(i.segClient, telemetry.UsersTerraformApplyCompleted, "")
+	return nil
+}
+
+func (i *installer) postDetokenize(_ context.Context) error {
+	if err := k3d.PostRunPrepareGitopsRepository(i.gitopsDir); err != nil {
+		return fmt.Errorf("error detokenizing post run: %w", err)
+	}
+
+	gitopsRepo, err := git.PlainOpen(i.gitopsDir)
+	if err != nil {
+		return fmt.Errorf("error opening repo at %q: %w", i.gitopsDir, err)
+	}
+
+	oldPath := fmt.Sprintf("%s/terraform/%s/remote-backend.md", i.gitopsDir, i.cliFlags.GitProvider)
+	newPath := fmt.Sprintf("%s/terraform/%s/remote-backend.tf", i.gitopsDir, i.cliFlags.GitProvider)
+
+	if _, err := os.Stat(newPath); err != nil {
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return fmt.Errorf("failed to rename remote-backend.md to remote-backend.tf: %w", err)
+		}
+	}
+
+	err = gitClient.Commit(gitopsRepo, "committing initial detokenized gitops-template repo content post run")
+	if err != nil {
+		return fmt.Errorf("failed to commit initial detokenized gitops-template repo content: %w", err)
+	}
+	err = gitopsRepo.Push(&git.PushOptions{
+		RemoteName: i.cliFlags.GitProvider,
+		Auth:       i.httpAuth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to push initial detokenized gitops-template repo content: %w", err)
+	}
+	return nil
+}
+
+// atlantisWebhook starts the tunnel and creates the Atlantis webhook of the
+// gitops repository, the gitops template only does so for ngrok. It runs on
+// every installation as a cloudflared quick tunnel changes its URL when its
+// pod restarts.
+func (i *installer) atlantisWebhook(ctx context.Context) error {
+	if !i.tunnel.ManagesWebhook() {
+		log.Info().Msgf("kubefirst creates no Atlantis webhook with the %s tunnel", i.tunnel.Provider)
+		return nil
+	}
+
+	previousURL := i.tunnel.WebhookURL()
+	if i.tunnel.Provider == internalk3d.TunnelCloudflared {
+		kcfg, err := i.kubeClient()
+		if err != nil {
+			return err
+		}
+		if i.tunnel.URL, err = internalk3d.StartCloudflared(ctx, kcfg.Clientset); err != nil {
+			return fmt.Errorf("failed to start the cloudflared tunnel: %w", err)
+		}
+		if err := i.tunnel.Save(); err != nil {
+			return err
+		}
+	}
+
+	host, err := i.host()
+	if err != nil {
+		return err
+	}
+	provider, err := gitShim.NewGitProvider(host, i.gitToken)
+	if err != nil {
+		return fmt.Errorf("failed to create git provider: %w", err)
+	}
+	err = gitShim.EnsureWebhook(ctx, provider, i.gitOwner, "gitops", gitShim.Webhook{
+		URL:         i.tunnel.WebhookURL(),
+		Secret:      viper.GetString("secrets.atlantis-webhook"),
+		PreviousURL: previousURL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create the Atlantis webhook: %w", err)
+	}
+	return nil
+}
+
+func (i *installer) finalize(_ context.Context) error {
+	kcfg, err := i.kubeClient()
+	if err != nil {
+		return err
+	}
+
+	argoDeployment, err := k8s.ReturnDeploymentObject(kcfg.Clientset, "app.kubernetes.io/instance", "argo", "argo", 1200)
+	if err != nil {
+		return fmt.Errorf("error finding Argo Workflows Deployment: %w", err)
+	}
+	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, argoDeployment, 120)
+	if err != nil {
+		return fmt.Errorf("error waiting for Argo Workflows Deployment ready state: %w", err)
+	}
+
+	utils.SetClusterStatusFlags(k3d.CloudProvider, i.cliFlags.GitProvider)
+
+	cluster := utilities.CreateClusterRecordFromRaw(i.cliFlags.UseTelemetry, i.gitOwner, i.gitUser, i.gitToken, i.gitlabOwnerGroupID, i.cliFlags.GitopsTemplateURL, i.cliFlags.GitopsTemplateBranch, i.catalogApps)
+
+	err = utilities.ExportCluster(cluster, kcfg)
+	if err != nil {
+		log.Error().Err(err).Msg("error exporting cluster object")
+		viper.Set("kubefirst.setup-complete", false)
+		viper.Set("kubefirst-checks.cluster-install-complete", false)
+		viper.WriteConfig()
+		return fmt.Errorf("failed to export cluster object: %w", err)
+	}
+
+	kubefirstDeployment, err := k8s.ReturnDeploymentObject(
+		kcfg.Clientset,
+		"app.kubernetes.io/instance",
+		"kubefirst",
+		"kubefirst",
+		600,
+	)
+	if err != nil {
+		return fmt.Errorf("error finding kubefirst Deployment: %w", err)
+	}
+	_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, kubefirstDeployment, 120)
+	if err != nil {
+		return fmt.Errorf("error waiting for kubefirst Deployment ready state: %w", err)
+	}
+
+	err = utils.OpenBrowser(constants.KubefirstConsoleLocalURLTLS)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to open Kubefirst console in browser")
+	}
+
+	telemetry.SendEvent(i.segClient, telemetry.ClusterInstallCompleted, "")
+	viper.Set("kubefirst-checks.cluster-install-complete", true)
+	viper.WriteConfig()
+	return nil
+}
@@ -0,0 +1,192 @@
+package k3d
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	"github.com/konstructio/kubefirst/internal/types"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type terraformCall struct {
+	entrypoint string
+	envs       map[string]string
+}
+
+func newTestInstaller(t *testing.T, gitProvider string) (*installer, *[]terraformCall) {
+	t.Helper()
+	t.Setenv("USE_TELEMETRY", "false")
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	var calls []terraformCall
+	inst := &installer{
+		cliFlags: &types.CliFlags{
+			ClusterName: "kubefirst",
+			GitProvider: gitProvider,
+			GitProtocol: "ssh",
+			GitlabGroup: "my-group",
+		},
+		gitOwner:           "my-owner",
+		gitUser:            "my-user",
+		gitToken:           "my-token",
+		gitlabOwnerGroupID: 42,
+		gitopsDir:          "/k1/gitops",
+		terraformClient:    "/k1/tools/terraform",
+		terraformApply: func(_, entrypoint string, envs map[string]string) error {
+			calls = append(calls, terraformCall{entrypoint: entrypoint, envs: envs})
+			return nil
+		},
+	}
+	return inst, &calls
+}
+
+func TestPhases(t *testing.T) {
+	for _, gitProvider := range []string{"github", "gitlab"} {
+		t.Run(gitProvider, func(t *testing.T) {
+			inst, _ := newTestInstaller(t, gitProvider)
+
+			names := map[string]bool{}
+			checks := map[string]bool{}
+			for _, phase := range inst.phases() {
+				require.False(t, names[phase.Name], "duplicate phase %q", phase.Name)
+				names[phase.Name] = true
+				require.NotNil(t, phase.Run, phase.Name)
+				if phase.Check != "" {
+					require.False(t, checks[phase.Check], "duplicate check %q", phase.Check)
+					checks[phase.Check] = true
+				}
+			}
+
+			require.True(t, checks[gitProvider+"-credentials"])
+			require.True(t, checks["terraform-apply-"+gitProvider])
+		})
+	}
+}
+
+func TestGitCredentialsRequiresToken(t *testing.T) {
+	inst, _ := newTestInstaller(t, "gitlab")
+	inst.gitToken = ""
+
+	err := inst.gitCredentials(context.Background())
+	require.EqualError(t, err, "please set a GITLAB_TOKEN environment variable to continue")
+}
+
+func TestKbotSetup(t *testing.T) {
+	inst, _ := newTestInstaller(t, "github")
+
+	require.NoError(t, inst.kbotSetup(context.Background()))
+	require.Contains(t, viper.GetString("kbot.private-key"), "PRIVATE KEY")
+	require.NotEmpty(t, viper.GetString("kbot.public-key"))
+	require.Equal(t, "kbot", viper.GetString("kbot.username"))
+}
+
+func TestGitTerraform(t *testing.T) {
+	t.Run("github", func(t *testing.T) {
+		inst, calls := newTestInstaller(t, "github")
+		viper.Set("kbot.public-key", "ssh-ed25519 AAAA")
+
+		require.NoError(t, inst.gitTerraform(context.Background()))
+		require.Len(t, *calls, 1)
+		call := (*calls)[0]
+		require.Equal(t, "/k1/gitops/terraform/github", call.entrypoint)
+		require.Equal(t, "my-token", call.envs["GITHUB_TOKEN"])
+		require.Equal(t, "my-owner", call.envs["GITHUB_OWNER"])
+		require.Equal(t, "ssh-ed25519 AAAA", call.envs["TF_VAR_kbot_ssh_public_key"])
+		require.NotContains(t, call.envs, "GITLAB_TOKEN")
+	})
+
+	t.Run("gitlab over https", func(t *testing.T) {
+		inst, calls := newTestInstaller(t, "gitlab")
+		inst.cliFlags.GitProtocol = "https"
+		viper.Set("kbot.public-key", "ssh-ed25519 AAAA")
+
+		require.NoError(t, inst.gitTerraform(context.Background()))
+		require.Len(t, *calls, 1)
+		call := (*calls)[0]
+		require.Equal(t, "/k1/gitops/terraform/gitlab", call.entrypoint)
+		require.Equal(t, "my-token", call.envs["GITLAB_TOKEN"])
+		require.Equal(t, "my-group", call.envs["GITLAB_OWNER"])
+		require.Equal(t, "42", call.envs["TF_VAR_owner_group_id"])
+		require.Empty(t, call.envs["TF_VAR_kbot_ssh_public_key"])
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		inst, _ := newTestInstaller(t, "github")
+		inst.terraformApply = func(string, string, map[string]string) error {
+			return errors.New("boom")
+		}
+
+		err := inst.gitTerraform(context.Background())
+		require.ErrorContains(t, err, `error creating GitHub resources with terraform "/k1/gitops/terraform/github": boom`)
+	})
+}
+
+func TestK8sSecretsTLSFailure(t *testing.T) {
+	inst, _ := newTestInstaller(t, "github")
+	inst.kcfg = &k8s.KubernetesClient{Clientset: fake.NewSimpleClientset()}
+	inst.generateTLSSecrets = func(kubernetes.Interface) error {
+		return errors.New("no pem files")
+	}
+
+	err := inst.k8sSecrets(context.Background())
+	require.EqualError(t, err, "failed to generate TLS secrets: no pem files")
+}
+
+func TestVaultTerraform(t *testing.T) {
+	t.Run("github", func(t *testing.T) {
+		inst, calls := newTestInstaller(t, "github")
+		inst.vaultRootToken = "root-token"
+		inst.kubernetesAPIEndpoint = "https://10.43.0.1"
+		inst.registryAuthDone = true
+		viper.Set("flags.github-owner", "my-owner")
+
+		require.NoError(t, inst.vaultTerraform(context.Background()))
+		require.Len(t, *calls, 1)
+		call := (*calls)[0]
+		require.Equal(t, "/k1/gitops/terraform/vault", call.entrypoint)
+		require.Equal(t, "root-token", call.envs["VAULT_TOKEN"])
+		require.Equal(t, "root-token", call.envs["TF_VAR_vault_token"])
+		require.Equal(t, "https://10.43.0.1", call.envs["TF_VAR_kubernetes_api_endpoint"])
+		require.Equal(t, "my-token", call.envs["TF_VAR_github_token"])
+		require.Equal(t, "my-user", call.envs["TF_VAR_github_user"])
+		require.Equal(t, "my-owner", call.envs["GITHUB_OWNER"])
+		// base64 of my-user:my-token
+		require.Equal(t, "bXktdXNlcjpteS10b2tlbg==", call.envs["TF_VAR_b64_docker_auth"])
+		require.NotContains(t, call.envs, "TF_VAR_container_registry_auth")
+	})
+
+	t.Run("gitlab", func(t *testing.T) {
+		inst, calls := newTestInstaller(t, "gitlab")
+		inst.vaultRootToken = "root-token"
+		inst.registryAuthDone = true
+		inst.registryAuthToken = "deploy-token"
+
+		require.NoError(t, inst.vaultTerraform(context.Background()))
+		require.Len(t, *calls, 1)
+		call := (*calls)[0]
+		require.Equal(t, "deploy-token", call.envs["TF_VAR_container_registry_auth"])
+		require.Equal(t, "42", call.envs["TF_VAR_owner_group_id"])
+		// base64 of container-registry-auth:deploy-token
+		require.Equal(t, "Y29udGFpbmVyLXJlZ2lzdHJ5LWF1dGg6ZGVwbG95LXRva2Vu", call.envs["TF_VAR_b64_docker_auth"])
+	})
+}
+
+func TestUsersTerraform(t *testing.T) {
+	inst, calls := newTestInstaller(t, "gitlab")
+	inst.vaultRootToken = "root-token"
+
+	require.NoError(t, inst.usersTerraform(context.Background()))
+	require.Len(t, *calls, 1)
+	call := (*calls)[0]
+	require.Equal(t, "/k1/gitops/terraform/users", call.entrypoint)
+	require.Equal(t, "root-token", call.envs["VAULT_TOKEN"])
+	require.Equal(t, "my-token", call.envs["GITLAB_TOKEN"])
+	require.Equal(t, "my-token", call.envs["TF_VAR_gitlab_token"])
+	require.Equal(t, "my-owner", call.envs["GITLAB_OWNER"])
+}
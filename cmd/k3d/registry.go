@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
+	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// pushImage pushes a local docker image to the local registry of the cluster
+func pushImage(cmd *cobra.Command, args []string) error {
+	name, err := cmd.Flags().GetString("name")
+	if err != nil {
+		return fmt.Errorf("failed to get name flag: %w", err)
+	}
+
+	clusterName := viper.GetString("flags.cluster-name")
+	if clusterName == "" || viper.GetString("kubefirst.cloud-provider") != k3d.CloudProvider {
+		return errors.New("there doesn't appear to be a k3d cluster - run `kubefirst k3d create` first")
+	}
+
+	topology, err := internalk3d.LoadTopology()
+	if err != nil {
+		return err
+	}
+	if topology.LocalRegistryPort == 0 {
+		return fmt.Errorf("k3d cluster %q has no local registry - create it with `kubefirst k3d create --local-registry`", clusterName)
+	}
+
+	dockerClient, err := exec.LookPath("docker")
+	if err != nil {
+		return fmt.Errorf("docker is required to push images: %w", err)
+	}
+
+	target, err := internalk3d.LocalImage(topology.LocalRegistryHost(), args[0], name)
+	if err != nil {
+		return err
+	}
+	if err := internalk3d.PushImage(dockerClient, args[0], target); err != nil {
+		return err
+	}
+
+	stepper := step.NewStepFactory(cmd.ErrOrStderr())
+	stepper.InfoStepString(fmt.Sprintf("\n## Pushed %s\n\nReference `%s` in your manifests, the cluster pulls it from the local registry.\n", args[0], target))
+	quitProgress()
+
+	return nil
+}
@@ -13,7 +13,9 @@ import (
 	"github.com/konstructio/kubefirst-api/pkg/credentials"
 	"github.com/konstructio/kubefirst-api/pkg/k3d"
 	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	rootcredentials "github.com/konstructio/kubefirst/internal/credentials"
 	"github.com/konstructio/kubefirst/internal/progress"
+	"github.com/konstructio/kubefirst/internal/vault"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -38,6 +40,10 @@ func getK3dRootCredentials(cmd *cobra.Command, _ []string) error {
 	if err != nil {
 		return fmt.Errorf("failed to get vault flag: %w", err)
 	}
+	outputOpts, err := rootcredentials.OptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
 	opts := credentials.CredentialOptions{
 		CopyArgoCDPasswordToClipboard: a,
 		CopyKbotPasswordToClipboard:   k,
@@ -66,9 +72,23 @@ func getK3dRootCredentials(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("failed to create kubeconfig: %w", err)
 	}
 
-	err = credentials.ParseAuthData(kcfg.Clientset, k3d.CloudProvider, domainName, &opts)
+	// copying to the clipboard is handled by the kubefirst API
+	if a || k || v {
+		err = credentials.ParseAuthData(kcfg.Clientset, k3d.CloudProvider, domainName, &opts)
+		if err != nil {
+			return fmt.Errorf("failed to parse auth data: %w", err)
+		}
+		progress.Progress.Quit()
+		return nil
+	}
+
+	target, err := vault.ResolveTarget(k3d.VaultURL, config.Kubeconfig)
 	if err != nil {
-		return fmt.Errorf("failed to parse auth data: %w", err)
+		return fmt.Errorf("failed to resolve vault: %w", err)
+	}
+	creds := rootcredentials.FromSecrets(cmd.Context(), kcfg.Clientset, target.URL, target.CACert)
+	if err := rootcredentials.Present(cmd, creds, k3d.CloudProvider, outputOpts); err != nil {
+		return err
 	}
 
 	progress.Progress.Quit()
@@ -0,0 +1,431 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	argocdapi "github.com/argoproj/argo-cd/v2/pkg/client/clientset/versioned"
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
+	"github.com/konstructio/kubefirst/internal/pipeline"
+	"github.com/konstructio/kubefirst/internal/progress"
+	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/konstructio/kubefirst/internal/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	statusOK      = "ok"
+	statusWarning = "warning"
+	statusError   = "error"
+	statusSkipped = "skipped"
+
+	// certificates expiring sooner are reported as a warning
+	certificateExpiryWarning = 30 * 24 * time.Hour
+)
+
+// ingressHosts are the subdomains of k3d.DomainName served by every platform
+var ingressHosts = []string{"kubefirst", "argocd", "argo", "vault", "minio-console"}
+
+// statusCheck is a single line of `k3d status`
+type statusCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+}
+
+// platformStatus is the result of `k3d status`
+type platformStatus struct {
+	ClusterName string                `json:"cluster_name"`
+	Healthy     bool                  `json:"healthy"`
+	Topology    *internalk3d.Topology `json:"topology"`
+	Tunnel      *internalk3d.Tunnel   `json:"tunnel"`
+	Checks      []statusCheck         `json:"checks"`
+}
+
+func status(cmd *cobra.Command, _ []string) error {
+	outputFlag, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("failed to get output flag: %w", err)
+	}
+	if outputFlag != "table" && outputFlag != "json" {
+		return fmt.Errorf("invalid output %q - must be one of table or json", outputFlag)
+	}
+
+	clusterName := viper.GetString("flags.cluster-name")
+	gitProvider := viper.GetString("flags.git-provider")
+	if clusterName == "" || viper.GetString("kubefirst.cloud-provider") != k3d.CloudProvider {
+		return errors.New("there doesn't appear to be a k3d cluster - run `kubefirst k3d create` first")
+	}
+
+	config, err := k3d.GetConfig(
+		clusterName,
+		gitProvider,
+		viper.GetString(fmt.Sprintf("flags.%s-owner", gitProvider)),
+		viper.GetString("flags.git-protocol"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	topology, err := internalk3d.LoadTopology()
+	if err != nil {
+		return err
+	}
+
+	tunnel, err := internalk3d.LoadTunnel()
+	if err != nil {
+		return err
+	}
+
+	ctx := cmd.Context()
+	result := platformStatus{ClusterName: clusterName, Topology: topology, Tunnel: tunnel}
+
+	cluster := clusterStatus(config.K3dClient, clusterName, topology)
+	result.Checks = append(result.Checks, cluster)
+
+	if cluster.Status == statusOK {
+		result.Checks = append(result.Checks, vaultStatus())
+
+		kcfg, err := k8s.CreateKubeConfig(false, config.Kubeconfig)
+		if err != nil {
+			result.Checks = append(result.Checks, statusCheck{Name: "argocd", Status: statusError, Details: fmt.Sprintf("failed to create kubeconfig: %v", err)})
+		} else {
+			result.Checks = append(result.Checks, argocdStatus(ctx, kcfg))
+			result.Checks = append(result.Checks, tunnelStatus(ctx, kcfg, tunnel))
+		}
+
+		for _, host := range ingressHosts {
+			result.Checks = append(result.Checks, ingressStatus(fmt.Sprintf("%s.%s", host, k3d.DomainName), time.Now()))
+		}
+	} else {
+		for _, name := range []string{"vault", "argocd", "tunnel", "ingress"} {
+			result.Checks = append(result.Checks, statusCheck{Name: name, Status: statusSkipped, Details: "the k3d cluster is not running"})
+		}
+	}
+
+	inst := &installer{cliFlags: &types.CliFlags{GitProvider: gitProvider}}
+	result.Checks = append(result.Checks, installStatus(inst.phases(), pipeline.ViperChecks{}))
+
+	result.Healthy = !slices.ContainsFunc(result.Checks, func(c statusCheck) bool {
+		return c.Status == statusError
+	})
+
+	if outputFlag == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal status: %w", err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(data))
+	} else {
+		stepper := step.NewStepFactory(cmd.ErrOrStderr())
+		stepper.InfoStepString(statusTable(result))
+	}
+
+	if progress.Progress != nil {
+		progress.Progress.Quit()
+	}
+
+	if !result.Healthy {
+		return fmt.Errorf("k3d cluster %q is not healthy", clusterName)
+	}
+	return nil
+}
+
+// k3dClusterList is the subset of `k3d cluster list -o json` used by status
+type k3dClusterList []struct {
+	Name           string `json:"name"`
+	ServersCount   int    `json:"serversCount"`
+	ServersRunning int    `json:"serversRunning"`
+	AgentsCount    int    `json:"agentsCount"`
+	AgentsRunning  int    `json:"agentsRunning"`
+}
+
+func clusterStatus(k3dClient, clusterName string, topology *internalk3d.Topology) statusCheck {
+	check := statusCheck{Name: "cluster"}
+
+	stdout, stderr, err := shell.ExecShellReturnStrings(k3dClient, "cluster", "list", "-o", "json")
+	if err != nil {
+		check.Status = statusError
+		check.Details = fmt.Sprintf("failed to list k3d clusters: %s", strings.TrimSpace(stderr))
+		return check
+	}
+
+	return parseClusterStatus(stdout, clusterName, topology)
+}
+
+// parseClusterStatus reports the nodes of clusterName, and whether they match
+// the topology it was created with
+func parseClusterStatus(clusterListJSON, clusterName string, topology *internalk3d.Topology) statusCheck {
+	check := statusCheck{Name: "cluster"}
+
+	var clusters k3dClusterList
+	if err := json.Unmarshal([]byte(clusterListJSON), &clusters); err != nil {
+		check.Status = statusError
+		check.Details = fmt.Sprintf("failed to parse k3d cluster list: %v", err)
+		return check
+	}
+
+	for _, c := range clusters {
+		if c.Name != clusterName {
+			continue
+		}
+
+		check.Details = fmt.Sprintf("%d/%d servers and %d/%d agents running", c.ServersRunning, c.ServersCount, c.AgentsRunning, c.AgentsCount)
+		mismatch := c.ServersCount != topology.Servers || c.AgentsCount != topology.Agents
+		if mismatch {
+			check.Details += fmt.Sprintf(", the topology expects %d servers and %d agents", topology.Servers, topology.Agents)
+		}
+		switch {
+		case c.ServersRunning == 0:
+			check.Status = statusError
+		case c.ServersRunning < c.ServersCount || c.AgentsRunning < c.AgentsCount || mismatch:
+			check.Status = statusWarning
+		default:
+			check.Status = statusOK
+		}
+		return check
+	}
+
+	check.Status = statusError
+	check.Details = fmt.Sprintf("k3d cluster %q does not exist", clusterName)
+	return check
+}
+
+func vaultStatus() statusCheck {
+	check := statusCheck{Name: "vault"}
+
+	vaultClient, err := newVaultClient()
+	if err != nil {
+		check.Status = statusError
+		check.Details = err.Error()
+		return check
+	}
+
+	health, err := vaultClient.Sys().Health()
+	if err != nil {
+		check.Status = statusError
+		check.Details = fmt.Sprintf("failed to check vault health: %v", err)
+		return check
+	}
+
+	switch {
+	case !health.Initialized:
+		check.Status = statusError
+		check.Details = "vault is not initialized"
+	case health.Sealed:
+		check.Status = statusError
+		check.Details = "vault is sealed - run `kubefirst k3d unseal-vault`"
+	default:
+		check.Status = statusOK
+		check.Details = fmt.Sprintf("initialized and unsealed, version %s", health.Version)
+	}
+	return check
+}
+
+func argocdStatus(ctx context.Context, kcfg *k8s.KubernetesClient) statusCheck {
+	argocdClient, err := argocdapi.NewForConfig(kcfg.RestConfig)
+	if err != nil {
+		return statusCheck{Name: "argocd", Status: statusError, Details: fmt.Sprintf("failed to create ArgoCD client: %v", err)}
+	}
+
+	apps, err := argocdClient.ArgoprojV1alpha1().Applications("argocd").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return statusCheck{Name: "argocd", Status: statusError, Details: fmt.Sprintf("failed to list ArgoCD applications: %v", err)}
+	}
+
+	return summarizeApplications(apps.Items)
+}
+
+// summarizeApplications reports how many applications are synced and healthy,
+// naming the ones that are not
+func summarizeApplications(apps []v1alpha1.Application) statusCheck {
+	check := statusCheck{Name: "argocd"}
+	if len(apps) == 0 {
+		check.Status = statusError
+		check.Details = "no ArgoCD applications found"
+		return check
+	}
+
+	var outOfSync, unhealthy []string
+	for _, app := range apps {
+		if app.Status.Sync.Status != v1alpha1.SyncStatusCodeSynced {
+			outOfSync = append(outOfSync, app.Name)
+		}
+		if healthStatus := string(app.Status.Health.Status); healthStatus != "Healthy" {
+			if healthStatus == "" {
+				healthStatus = "Unknown"
+			}
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", app.Name, healthStatus))
+		}
+	}
+	slices.Sort(outOfSync)
+	slices.Sort(unhealthy)
+
+	details := []string{fmt.Sprintf("%d applications", len(apps))}
+	if len(outOfSync) > 0 {
+		details = append(details, "out of sync: "+strings.Join(outOfSync, ", "))
+	}
+	if len(unhealthy) > 0 {
+		details = append(details, "unhealthy: "+strings.Join(unhealthy, ", "))
+	}
+	check.Details = strings.Join(details, "; ")
+
+	switch {
+	case len(unhealthy) > 0:
+		check.Status = statusError
+	case len(outOfSync) > 0:
+		check.Status = statusWarning
+	default:
+		check.Status = statusOK
+		check.Details += ", all synced and healthy"
+	}
+	return check
+}
+
+// tunnelStatus reports whether the Atlantis webhook reaches the cluster
+func tunnelStatus(ctx context.Context, kcfg *k8s.KubernetesClient, tunnel *internalk3d.Tunnel) statusCheck {
+	if tunnel.Provider != internalk3d.TunnelCloudflared {
+		return recordedTunnelStatus(tunnel)
+	}
+
+	currentURL, err := internalk3d.CloudflaredURL(ctx, kcfg.Clientset)
+	if err != nil {
+		return statusCheck{Name: "tunnel", Status: statusError, Details: fmt.Sprintf("cloudflared: %v", err)}
+	}
+	return cloudflaredStatus(tunnel, currentURL)
+}
+
+// recordedTunnelStatus reports the tunnels which run nothing kubefirst can inspect
+func recordedTunnelStatus(tunnel *internalk3d.Tunnel) statusCheck {
+	check := statusCheck{Name: "tunnel", Status: statusOK}
+	switch tunnel.Provider {
+	case internalk3d.TunnelDisabled:
+		check.Status = statusSkipped
+		check.Details = "disabled, Atlantis is not installed and Argo CD polls the repositories"
+	case internalk3d.TunnelNgrok:
+		check.Details = "ngrok, run in the cluster by the gitops template"
+	default:
+		check.Details = "webhook " + tunnel.WebhookURL()
+	}
+	return check
+}
+
+// cloudflaredStatus compares the URL of the running quick tunnel with the one
+// the webhook was created with
+func cloudflaredStatus(tunnel *internalk3d.Tunnel, currentURL string) statusCheck {
+	check := statusCheck{Name: "tunnel", Status: statusOK, Details: "cloudflared webhook " + tunnel.WebhookURL()}
+	if currentURL != tunnel.URL {
+		check.Status = statusWarning
+		check.Details = fmt.Sprintf("the cloudflared URL changed to %s, the webhook still posts to %s - run `kubefirst k3d create --only-phase atlantis-webhook`", currentURL, tunnel.WebhookURL())
+	}
+	return check
+}
+
+// ingressStatus verifies host serves a certificate trusted by this machine
+func ingressStatus(host string, now time.Time) statusCheck {
+	check := statusCheck{Name: "ingress " + host}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", host+":443", &tls.Config{MinVersion: tls.VersionTLS12})
+	if err != nil {
+		check.Status = statusError
+		check.Details = err.Error()
+		return check
+	}
+	defer conn.Close()
+
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		check.Status = statusError
+		check.Details = "no certificate presented"
+		return check
+	}
+
+	notAfter := certificates[0].NotAfter
+	check.Status = certificateStatus(notAfter, now)
+	check.Details = fmt.Sprintf("certificate valid until %s", notAfter.Format(time.DateOnly))
+	return check
+}
+
+func certificateStatus(notAfter, now time.Time) string {
+	switch {
+	case now.After(notAfter):
+		return statusError
+	case notAfter.Sub(now) < certificateExpiryWarning:
+		return statusWarning
+	default:
+		return statusOK
+	}
+}
+
+// installStatus reports the installation phases that have not completed
+func installStatus(phases []pipeline.Phase, checks pipeline.Checks) statusCheck {
+	check := statusCheck{Name: "install"}
+
+	var total int
+	var pending []string
+	for _, phase := range phases {
+		if phase.Check == "" {
+			continue
+		}
+		total++
+		if !checks.Completed(phase.Check) {
+			pending = append(pending, phase.Name)
+		}
+	}
+
+	check.Details = fmt.Sprintf("%d/%d phases completed", total-len(pending), total)
+	if len(pending) > 0 {
+		check.Status = statusError
+		check.Details += ", pending: " + strings.Join(pending, ", ")
+		return check
+	}
+
+	check.Status = statusOK
+	return check
+}
+
+func statusTable(result platformStatus) string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+
+	fmt.Fprintln(&buf, "")
+	fmt.Fprintf(&buf, "Status of k3d cluster %q\n", result.ClusterName)
+	if result.Topology != nil {
+		fmt.Fprintf(&buf, "Topology: %s\n", result.Topology)
+	}
+	if result.Tunnel != nil {
+		fmt.Fprintf(&buf, "Tunnel: %s\n", result.Tunnel)
+	}
+	fmt.Fprintln(&buf, "")
+
+	fmt.Fprintf(tw, "Check\tStatus\tDetails\n")
+	fmt.Fprintf(tw, "---\t---\t---\n")
+	for _, c := range result.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.Name, c.Status, c.Details)
+	}
+	tw.Flush()
+
+	return buf.String()
+}
@@ -0,0 +1,152 @@
+package k3d
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/health"
+	internalk3d "github.com/konstructio/kubefirst/internal/k3d"
+	"github.com/konstructio/kubefirst/internal/pipeline"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseClusterStatus(t *testing.T) {
+	list := `[
+		{"name": "other", "serversCount": 1, "serversRunning": 1, "agentsCount": 0, "agentsRunning": 0},
+		{"name": "kubefirst", "serversCount": 1, "serversRunning": 1, "agentsCount": 2, "agentsRunning": %d}
+	]`
+
+	topology := &internalk3d.Topology{Servers: 1, Agents: 2}
+
+	tests := []struct {
+		name        string
+		list        string
+		clusterName string
+		status      string
+		details     string
+	}{
+		{name: "running", list: fmt.Sprintf(list, 2), clusterName: "kubefirst", status: statusOK, details: "1/1 servers and 2/2 agents running"},
+		{name: "missing", list: fmt.Sprintf(list, 2), clusterName: "nope", status: statusError, details: `k3d cluster "nope" does not exist`},
+		{name: "invalid", list: "not json", clusterName: "kubefirst", status: statusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := parseClusterStatus(tt.list, tt.clusterName, topology)
+			require.Equal(t, tt.status, check.Status)
+			if tt.details != "" {
+				require.Equal(t, tt.details, check.Details)
+			}
+		})
+	}
+
+	t.Run("stopped agent", func(t *testing.T) {
+		check := parseClusterStatus(fmt.Sprintf(list, 1), "kubefirst", topology)
+		require.Equal(t, statusWarning, check.Status)
+	})
+
+	t.Run("topology mismatch", func(t *testing.T) {
+		check := parseClusterStatus(fmt.Sprintf(list, 2), "kubefirst", &internalk3d.Topology{Servers: 1, Agents: 3})
+		require.Equal(t, statusWarning, check.Status)
+		require.Equal(t, "1/1 servers and 2/2 agents running, the topology expects 1 servers and 3 agents", check.Details)
+	})
+}
+
+func testApplication(name string, sync v1alpha1.SyncStatusCode, healthStatus health.HealthStatusCode) v1alpha1.Application {
+	return v1alpha1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: v1alpha1.ApplicationStatus{
+			Sync:   v1alpha1.SyncStatus{Status: sync},
+			Health: v1alpha1.HealthStatus{Status: healthStatus},
+		},
+	}
+}
+
+func TestSummarizeApplications(t *testing.T) {
+	t.Run("healthy", func(t *testing.T) {
+		check := summarizeApplications([]v1alpha1.Application{
+			testApplication("vault", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy),
+			testApplication("argo", v1alpha1.SyncStatusCodeSynced, health.HealthStatusHealthy),
+		})
+		require.Equal(t, statusCheck{Name: "argocd", Status: statusOK, Details: "2 applications, all synced and healthy"}, check)
+	})
+
+	t.Run("out of sync", func(t *testing.T) {
+		check := summarizeApplications([]v1alpha1.Application{
+			testApplication("vault", v1alpha1.SyncStatusCodeOutOfSync, health.HealthStatusHealthy),
+		})
+		require.Equal(t, statusWarning, check.Status)
+		require.Equal(t, "1 applications; out of sync: vault", check.Details)
+	})
+
+	t.Run("unhealthy", func(t *testing.T) {
+		check := summarizeApplications([]v1alpha1.Application{
+			testApplication("vault", v1alpha1.SyncStatusCodeSynced, health.HealthStatusDegraded),
+			testApplication("argo", v1alpha1.SyncStatusCodeUnknown, ""),
+		})
+		require.Equal(t, statusError, check.Status)
+		require.Equal(t, "2 applications; out of sync: argo; unhealthy: argo (Unknown), vault (Degraded)", check.Details)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		require.Equal(t, statusError, summarizeApplications(nil).Status)
+	})
+}
+
+func TestCertificateStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.Equal(t, statusOK, certificateStatus(now.AddDate(1, 0, 0), now))
+	require.Equal(t, statusWarning, certificateStatus(now.AddDate(0, 0, 10), now))
+	require.Equal(t, statusError, certificateStatus(now.AddDate(0, 0, -1), now))
+}
+
+type mapChecks map[string]bool
+
+func (m mapChecks) Completed(check string) bool          { return m[check] }
+func (m mapChecks) SetCompleted(check string, done bool) { m[check] = done }
+
+func TestInstallStatus(t *testing.T) {
+	phases := []pipeline.Phase{
+		{Name: "one", Check: "one-done"},
+		{Name: "wait"},
+		{Name: "two", Check: "two-done"},
+	}
+
+	check := installStatus(phases, mapChecks{"one-done": true, "two-done": true})
+	require.Equal(t, statusCheck{Name: "install", Status: statusOK, Details: "2/2 phases completed"}, check)
+
+	check = installStatus(phases, mapChecks{"one-done": true})
+	require.Equal(t, statusCheck{Name: "install", Status: statusError, Details: "1/2 phases completed, pending: two"}, check)
+}
+
+func TestStatusTable(t *testing.T) {
+	table := statusTable(platformStatus{
+		ClusterName: "kubefirst",
+		Checks: []statusCheck{
+			{Name: "cluster", Status: statusOK, Details: "1/1 servers and 0/0 agents running"},
+			{Name: "vault", Status: statusError, Details: "vault is sealed"},
+		},
+	})
+
+	require.Contains(t, table, `Status of k3d cluster "kubefirst"`)
+	require.Contains(t, table, "cluster |ok     |1/1 servers and 0/0 agents running")
+	require.Contains(t, table, "vault   |error  |vault is sealed")
+}
+
+func TestTunnelStatus(t *testing.T) {
+	check := recordedTunnelStatus(&internalk3d.Tunnel{Provider: internalk3d.TunnelDisabled})
+	require.Equal(t, statusSkipped, check.Status)
+
+	check = recordedTunnelStatus(&internalk3d.Tunnel{Provider: internalk3d.TunnelURL, URL: "https://atlantis.example.com"})
+	require.Equal(t, statusCheck{Name: "tunnel", Status: statusOK, Details: "webhook https://atlantis.example.com/events"}, check)
+
+	tunnel := &internalk3d.Tunnel{Provider: internalk3d.TunnelCloudflared, URL: "https://old.trycloudflare.com"}
+	require.Equal(t, statusOK, cloudflaredStatus(tunnel, "https://old.trycloudflare.com").Status)
+	check = cloudflaredStatus(tunnel, "https://new.trycloudflare.com")
+	require.Equal(t, statusWarning, check.Status)
+	require.Contains(t, check.Details, "--only-phase atlantis-webhook")
+}
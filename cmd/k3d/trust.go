@@ -0,0 +1,53 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	utils "github.com/konstructio/kubefirst-api/pkg/utils"
+	"github.com/konstructio/kubefirst/internal/certificates"
+	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// trustCA installs the mkcert root certificate authority on this machine so
+// browsers and tools trust the certificates of the k3d cluster
+func trustCA(cmd *cobra.Command, _ []string) error {
+	flags := utils.GetClusterStatusFlags()
+	config, err := k3d.GetConfig(
+		viper.GetString("flags.cluster-name"),
+		flags.GitProvider,
+		viper.GetString(fmt.Sprintf("flags.%s-owner", flags.GitProvider)),
+		flags.GitProtocol,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	caRoot, changes, err := certificates.Trust(config.MkCertClient)
+	if err != nil {
+		if len(changes) > 0 {
+			err = fmt.Errorf("%w:\n%s", err, strings.Join(changes, "\n"))
+		}
+		return err
+	}
+
+	message := "\n## mkcert root certificate authority\n\n" + fmt.Sprintf("Installed from `%s`\n\n", caRoot)
+	for _, change := range changes {
+		message += fmt.Sprintf("- %s\n", change)
+	}
+
+	stepper := step.NewStepFactory(cmd.ErrOrStderr())
+	stepper.InfoStepString(message)
+	quitProgress()
+
+	return nil
+}
@@ -7,28 +7,47 @@ See the LICENSE file for more details.
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/konstructio/kubefirst/internal/cluster"
 	"github.com/konstructio/kubefirst/internal/launch"
 	"github.com/konstructio/kubefirst/internal/step"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
-// additionalHelmFlags can optionally pass user-supplied flags to helm
-var additionalHelmFlags []string
+var (
+	// additionalHelmFlags can optionally pass user-supplied flags to helm
+	additionalHelmFlags []string
+
+	// backupPathFlag is the archive used by launch backup, restore and down
+	backupPathFlag string
+
+	// skipBackupFlag disables the backup offered by launch down
+	skipBackupFlag bool
+
+	// runtimeFlags selects the local cluster the console is launched into
+	runtimeFlags launch.RuntimeOptions
+
+	// bundleFlag is an installation bundle used instead of fetching artifacts online
+	bundleFlag string
+)
 
 func LaunchCommand() *cobra.Command {
 	launchCommand := &cobra.Command{
 		Use:   "launch",
-		Short: "create a local k3d cluster and launch the Kubefirst console and API in it",
-		Long:  "create a local k3d cluster and launch the Kubefirst console and API in it",
+		Short: "create a local cluster and launch the Kubefirst console and API in it",
+		Long:  "create a local k3d or kind cluster, or use an existing one, and launch the Kubefirst console and API in it",
 	}
 
 	// wire up new commands
-	launchCommand.AddCommand(launchUp(), launchDown(), launchCluster())
+	launchCommand.AddCommand(launchUp(), launchDown(), launchBackup(), launchRestore(), launchCluster())
 
 	return launchCommand
 }
@@ -46,7 +65,7 @@ func launchUp() *cobra.Command {
 
 			stepper.NewProgressStep("Launching Console and API")
 
-			if err := launch.Up(cmd.Context(), additionalHelmFlags, false, true); err != nil {
+			if err := launch.Up(cmd.Context(), additionalHelmFlags, false, true, runtimeFlags, bundleFlag); err != nil {
 				stepper.FailCurrentStep(err)
 				return fmt.Errorf("failed to launch console and api: %w", err)
 			}
@@ -60,6 +79,10 @@ func launchUp() *cobra.Command {
 	}
 
 	launchUpCmd.Flags().StringSliceVar(&additionalHelmFlags, "helm-flag", []string{}, "additional helm flag to pass to the launch up command - can be used any number of times")
+	launchUpCmd.Flags().StringVar(&runtimeFlags.Name, "runtime", launch.RuntimeK3d, fmt.Sprintf("the local cluster runtime to launch the console into - one of: %q", launch.SupportedRuntimes))
+	launchUpCmd.Flags().StringVar(&runtimeFlags.Kubeconfig, "kubeconfig", "", "the kubeconfig of an existing cluster (only used with --runtime existing, defaults to $KUBECONFIG)")
+	launchUpCmd.Flags().StringVar(&runtimeFlags.Context, "context", "", "the kubeconfig context of an existing cluster (only used with --runtime existing, defaults to the current context)")
+	launchUpCmd.Flags().StringVar(&bundleFlag, "bundle", "", "an installation bundle created with `kubefirst bundle create` for air-gapped installs")
 
 	return launchUpCmd
 }
@@ -73,6 +96,27 @@ func launchDown() *cobra.Command {
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			stepper := step.NewStepFactory(cmd.ErrOrStderr())
 
+			if !skipBackupFlag && offerBackup(cmd.InOrStdin(), cmd.ErrOrStderr()) {
+				stepper.NewProgressStep("Backing up cluster records")
+
+				path, err := resolveBackupPath()
+				if err != nil {
+					stepper.FailCurrentStep(err)
+					return err
+				}
+
+				// a broken or unreachable console is often why it is taken
+				// down, so a failed backup doesn't stop the removal
+				count, err := launch.Backup(path)
+				if err != nil {
+					stepper.FailCurrentStep(fmt.Errorf("failed to back up cluster records: %w", err))
+					stepper.InfoStep(step.EmojiWarning, "Removing the console without a backup")
+				} else {
+					stepper.CompleteCurrentStep()
+					stepper.InfoStep(step.EmojiBulb, fmt.Sprintf("Backed up %d cluster record(s) to %s", count, path))
+				}
+			}
+
 			stepper.NewProgressStep("Destroying Console and API")
 
 			if err := launch.Down(false); err != nil {
@@ -89,9 +133,119 @@ func launchDown() *cobra.Command {
 		},
 	}
 
+	launchDownCmd.Flags().BoolVar(&skipBackupFlag, "skip-backup", false, "remove the console without offering to back up its cluster records")
+	launchDownCmd.Flags().StringVar(&backupPathFlag, "backup-path", "", "the archive to write the backup to (defaults to a timestamped file in $HOME/.k1/backups)")
+
 	return launchDownCmd
 }
 
+// launchBackup exports all cluster records from the console API to an archive
+func launchBackup() *cobra.Command {
+	launchBackupCmd := &cobra.Command{
+		Use:              "backup",
+		Short:            "back up the cluster records managed by the Kubefirst console",
+		TraverseChildren: true,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			stepper.NewProgressStep("Backing up cluster records")
+
+			path, err := resolveBackupPath()
+			if err != nil {
+				stepper.FailCurrentStep(err)
+				return err
+			}
+
+			count, err := launch.Backup(path)
+			if err != nil {
+				wrerr := fmt.Errorf("failed to back up cluster records: %w", err)
+				stepper.FailCurrentStep(wrerr)
+				return wrerr
+			}
+
+			stepper.CompleteCurrentStep()
+
+			stepper.InfoStep(step.EmojiTada, fmt.Sprintf("Backed up %d cluster record(s) to %s", count, path))
+
+			return nil
+		},
+	}
+
+	launchBackupCmd.Flags().StringVar(&backupPathFlag, "output", "", "the archive to write (defaults to a timestamped file in $HOME/.k1/backups)")
+
+	return launchBackupCmd
+}
+
+// launchRestore imports cluster records from an archive into the console API
+func launchRestore() *cobra.Command {
+	launchRestoreCmd := &cobra.Command{
+		Use:              "restore",
+		Short:            "restore cluster records into the Kubefirst console from a backup archive",
+		TraverseChildren: true,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if err := cobra.ExactArgs(1)(cmd, args); err != nil {
+				return fmt.Errorf("you must provide the path to a backup archive as the only argument to this command")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			stepper.NewProgressStep("Restoring cluster records")
+
+			count, err := launch.Restore(args[0])
+			if err != nil {
+				wrerr := fmt.Errorf("failed to restore cluster records: %w", err)
+				stepper.FailCurrentStep(wrerr)
+				return wrerr
+			}
+
+			stepper.CompleteCurrentStep()
+
+			stepper.InfoStep(step.EmojiTada, fmt.Sprintf("Restored %d cluster record(s) from %s", count, args[0]))
+
+			return nil
+		},
+	}
+
+	return launchRestoreCmd
+}
+
+// resolveBackupPath returns the user-supplied archive path or a default one
+func resolveBackupPath() (string, error) {
+	if backupPathFlag != "" {
+		return backupPathFlag, nil
+	}
+
+	path, err := launch.DefaultBackupPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine backup path: %w", err)
+	}
+	return path, nil
+}
+
+// offerBackup asks whether to back up the cluster records before removing the
+// console, without a terminal to ask on they are backed up
+func offerBackup(in io.Reader, out io.Writer) bool {
+	file, ok := in.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return true
+	}
+	return askBackup(in, out)
+}
+
+// askBackup reads the answer to the backup offer, anything but no accepts it
+func askBackup(in io.Reader, out io.Writer) bool {
+	fmt.Fprint(out, "Back up the console cluster records before removing the console? [Y/n]: ")
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "n", "no":
+		return false
+	default:
+		return true
+	}
+}
+
 // launchCluster
 func launchCluster() *cobra.Command {
 	launchClusterCmd := &cobra.Command{
@@ -0,0 +1,25 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package cmd
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfferBackup(t *testing.T) {
+	// without a terminal the records are backed up
+	require.True(t, offerBackup(strings.NewReader("n\n"), io.Discard))
+
+	require.True(t, askBackup(strings.NewReader("\n"), io.Discard))
+	require.True(t, askBackup(strings.NewReader("yes\n"), io.Discard))
+	require.False(t, askBackup(strings.NewReader("N\n"), io.Discard))
+	require.False(t, askBackup(strings.NewReader("no"), io.Discard))
+}
@@ -7,6 +7,7 @@ See the LICENSE file for more details.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -21,6 +22,7 @@ import (
 	"github.com/konstructio/kubefirst/cmd/k3s"
 	"github.com/konstructio/kubefirst/cmd/vultr"
 	"github.com/konstructio/kubefirst/internal/common"
+	"github.com/konstructio/kubefirst/internal/httpclient"
 	"github.com/konstructio/kubefirst/internal/step"
 	"github.com/spf13/cobra"
 )
@@ -28,6 +30,8 @@ import (
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	httpOptions := httpclient.DefaultOptions()
+
 	rootCmd := &cobra.Command{
 		Use:   "kubefirst",
 		Short: "kubefirst management cluster installer base command",
@@ -35,6 +39,10 @@ func Execute() {
 		open source application delivery platform in under an hour.
 		checkout the docs at https://kubefirst-pro.konstruct.io/docs/.`,
 		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if err := httpclient.Configure(httpOptions); err != nil {
+				return fmt.Errorf("failed to configure http client: %w", err)
+			}
+
 			// wire viper config for flags for all commands
 			return configs.InitializeViperConfig(cmd)
 		},
@@ -48,6 +56,9 @@ func Execute() {
 
 	output := rootCmd.ErrOrStderr()
 
+	rootCmd.PersistentFlags().StringVar(&httpOptions.CABundle, "ca-bundle", httpOptions.CABundle, fmt.Sprintf("path to a PEM bundle of additional trusted certificate authorities (env %s)", httpclient.CABundleEnv))
+	rootCmd.PersistentFlags().BoolVar(&httpOptions.InsecureSkipTLSVerify, "insecure-skip-tls-verify", httpOptions.InsecureSkipTLSVerify, fmt.Sprintf("disable TLS certificate verification for outbound connections (env %s)", httpclient.InsecureSkipTLSVerifyEnv))
+
 	rootCmd.AddCommand(
 		aws.NewCommand(),
 		azure.NewCommand(),
@@ -67,13 +78,27 @@ func Execute() {
 		VersionCommand(),
 		LogsCommand(),
 		InfoCommand(),
+		ToolsCommand(),
+		BundleCommand(),
+		VaultCommand(),
+		GitCommand(),
 	)
 
 	// This will allow all child commands to have informUser available for free.
 	// Refers: https://github.com/konstructio/runtime/issues/525
 	// Before removing next line, please read ticket above.
+	// flags are not parsed yet, the version check relies on the environment defaults
+	if err := httpclient.Configure(httpOptions); err != nil {
+		fmt.Fprintln(output, step.EmojiWarning, "Warning:", err)
+	}
 	common.CheckForVersionUpdate()
 	if err := rootCmd.Execute(); err != nil {
+		// the command already reported its own failure
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+
 		fmt.Println()
 		fmt.Fprintln(output, step.EmojiError, "Error:", err)
 		fmt.Fprintln(output, "If a detailed error message was available, please make the necessary corrections before retrying.")
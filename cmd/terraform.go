@@ -7,10 +7,15 @@ See the LICENSE file for more details.
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
 
-	"github.com/konstructio/kubefirst-api/pkg/vault"
 	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/konstructio/kubefirst/internal/vault"
 	"github.com/spf13/cobra"
 )
 
@@ -18,8 +23,28 @@ var (
 	vaultURLFlag   string
 	vaultTokenFlag string
 	outputFileFlag string
+
+	// envPathsFlag, envFormatFlag and envPrefixFlag select the secrets and how
+	// they are rendered by set-env and exec
+	envPathsFlag  []string
+	envFormatFlag string
+	envPrefixFlag string
 )
 
+// exitCodeError makes kubefirst exit with the code of a command it ran
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
 func TerraformCommand() *cobra.Command {
 	terraformCommand := &cobra.Command{
 		Use:   "terraform",
@@ -28,11 +53,34 @@ func TerraformCommand() *cobra.Command {
 	}
 
 	// wire up new commands
-	terraformCommand.AddCommand(terraformSetEnv())
+	terraformCommand.AddCommand(terraformSetEnv(), terraformExec())
 
 	return terraformCommand
 }
 
+// addEnvFlags adds the flags selecting the vault secrets used as environment
+func addEnvFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&vaultURLFlag, "vault-url", "", "the URL of the vault instance (defaults to https://vault.<domain> of the platform)")
+	cmd.Flags().StringVar(&vaultTokenFlag, "vault-token", "", "the vault token (defaults to the root token of the platform)")
+	cmd.Flags().StringSliceVar(&envPathsFlag, "path", vault.DefaultEnvPaths, "the vault secret paths to read, later paths override variables of earlier ones")
+	cmd.Flags().StringVar(&kvMountFlag, "mount", vault.KVMount, "the KV version 2 mount of the secrets")
+	cmd.Flags().StringVar(&envPrefixFlag, "prefix", "", "a prefix for every variable name, such as TF_VAR_")
+}
+
+// readEnv reads the selected vault secrets as environment variables
+func readEnv(cmd *cobra.Command) (map[string]string, error) {
+	session, err := newVaultSession(cmd.Context(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := vault.ReadEnv(cmd.Context(), session.client, kvMountFlag, envPathsFlag, session.target.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error during vault read: %w", err)
+	}
+	return vault.PrefixEnv(env, envPrefixFlag), nil
+}
+
 // terraformSetEnv retrieves Vault secrets and formats them for export in the local
 // shell for use with terraform commands
 func terraformSetEnv() *cobra.Command {
@@ -43,32 +91,98 @@ func terraformSetEnv() *cobra.Command {
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			stepper := step.NewStepFactory(cmd.ErrOrStderr())
 
-			v := vault.Configuration{
-				Config: vault.NewVault(),
+			if !slices.Contains(vault.EnvFormats, envFormatFlag) {
+				return fmt.Errorf("invalid format %q - must be one of %s", envFormatFlag, strings.Join(vault.EnvFormats, ", "))
+			}
+			if !cmd.Flags().Changed("output-file") {
+				outputFileFlag = vault.DefaultEnvFile(envFormatFlag)
 			}
 
-			err := v.IterSecrets(vaultURLFlag, vaultTokenFlag, outputFileFlag)
+			env, err := readEnv(cmd)
 			if err != nil {
-				wrerr := fmt.Errorf("error during vault read: %w", err)
-				stepper.InfoStep(step.EmojiError, wrerr.Error())
-				return wrerr
+				stepper.InfoStep(step.EmojiError, err.Error())
+				return err
+			}
+
+			content, err := vault.FormatEnv(env, envFormatFlag)
+			if err != nil {
+				return err
+			}
+
+			if outputFileFlag == "-" {
+				if _, err := cmd.OutOrStdout().Write(content); err != nil {
+					return fmt.Errorf("error writing environment: %w", err)
+				}
+				return nil
+			}
+
+			if err := os.WriteFile(outputFileFlag, content, 0o600); err != nil {
+				return fmt.Errorf("error writing file %q: %w", outputFileFlag, err)
 			}
 
 			message := `
-Generated env file at` + fmt.Sprintf("`%s`", outputFileFlag) + `
+Generated ` + envFormatFlag + ` file at` + fmt.Sprintf("`%s`", outputFileFlag) + `
+
+`
+			switch envFormatFlag {
+			case vault.FormatExport:
+				message += `:bulb: Run` + fmt.Sprintf("`source %s`", outputFileFlag) + ` to set environment variables
 
-:bulb: Run` + fmt.Sprintf("`source %s`", outputFileFlag) + ` to set environment variables
+`
+			case vault.FormatEnvrc:
+				message += `:bulb: Run ` + "`direnv allow`" + ` to load the environment variables
 
 `
+			}
 			stepper.InfoStepString(message)
 
 			return nil
 		},
 	}
 
-	terraformSetCmd.Flags().StringVar(&vaultURLFlag, "vault-url", "", "the URL of the vault instance (required)")
-	terraformSetCmd.Flags().StringVar(&vaultTokenFlag, "vault-token", "", "the vault token (required)")
-	terraformSetCmd.Flags().StringVar(&outputFileFlag, "output-file", ".env", "the file that will be created in the local directory containing secrets (.env by default)")
+	addEnvFlags(terraformSetCmd)
+	terraformSetCmd.Flags().StringVar(&outputFileFlag, "output-file", ".env", "the file that will be created containing secrets, - prints them instead (defaults to a file matching --format)")
+	terraformSetCmd.Flags().StringVar(&envFormatFlag, "format", vault.FormatExport, "the format of the file, one of export, dotenv, json, tfvars or envrc")
 
 	return terraformSetCmd
 }
+
+// terraformExec runs a command with the Vault secrets in its environment,
+// without writing them to disk
+func terraformExec() *cobra.Command {
+	terraformExecCmd := &cobra.Command{
+		Use:     "exec -- <command> [args...]",
+		Short:   "run a command with vault secrets as environment variables",
+		Long:    "run a command, such as terraform plan, with the data of the target vault secrets as environment variables, without writing them to disk",
+		Example: "  kubefirst terraform exec --prefix TF_VAR_ -- terraform plan",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			env, err := readEnv(cmd)
+			if err != nil {
+				return err
+			}
+
+			child := exec.CommandContext(cmd.Context(), args[0], args[1:]...)
+			child.Env = os.Environ()
+			for key, value := range env {
+				child.Env = append(child.Env, fmt.Sprintf("%s=%s", key, value))
+			}
+			child.Stdin = cmd.InOrStdin()
+			child.Stdout = cmd.OutOrStdout()
+			child.Stderr = cmd.ErrOrStderr()
+
+			if err := child.Run(); err != nil {
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					return &exitCodeError{code: exitErr.ExitCode(), err: fmt.Errorf("%s exited with code %d: %w", args[0], exitErr.ExitCode(), err)}
+				}
+				return fmt.Errorf("failed to run %s: %w", args[0], err)
+			}
+			return nil
+		},
+	}
+
+	addEnvFlags(terraformExecCmd)
+
+	return terraformExecCmd
+}
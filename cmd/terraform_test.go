@@ -0,0 +1,41 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTerraformExecExitCode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"data":{"REGION":"nyc1"},"metadata":{}}}`))
+	}))
+	defer server.Close()
+
+	run := func(script string) error {
+		cmd := terraformExec()
+		cmd.SetOut(io.Discard)
+		cmd.SetErr(io.Discard)
+		cmd.SetArgs([]string{"--vault-url", server.URL, "--vault-token", "root", "--path", "development", "--", "sh", "-c", script})
+		return cmd.ExecuteContext(context.Background())
+	}
+
+	require.NoError(t, run(`test "$REGION" = nyc1`))
+
+	err := run("exit 3")
+	var exitErr *exitCodeError
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, 3, exitErr.code)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/konstructio/kubefirst/internal/tools"
+	"github.com/spf13/cobra"
+)
+
+var pruneAllFlag bool
+
+func ToolsCommand() *cobra.Command {
+	toolsCmd := &cobra.Command{
+		Use:   "tools",
+		Short: "manage the cache of downloaded tool binaries",
+		Long: fmt.Sprintf(`Manage the shared cache of tool binaries (k3d, kubectl, helm, mkcert, terraform, kind)
+kept in $HOME/.k1/tools-cache. Set %s to download from a mirror laid out
+as <mirror>/<tool>/<version>/<artifact> for air-gapped installs.`, tools.MirrorEnv),
+	}
+
+	toolsCmd.AddCommand(toolsList(), toolsPrune(), toolsVerify())
+
+	return toolsCmd
+}
+
+func toolsList() *cobra.Command {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "list cached tool binaries",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			manager, err := tools.NewManager()
+			if err != nil {
+				return fmt.Errorf("failed to create tool manager: %w", err)
+			}
+
+			cached, err := manager.List()
+			if err != nil {
+				wrerr := fmt.Errorf("failed to list cached tools: %w", err)
+				stepper.InfoStep(step.EmojiError, wrerr.Error())
+				return wrerr
+			}
+
+			if len(cached) == 0 {
+				stepper.InfoStepString("no tools cached yet")
+				return nil
+			}
+
+			stepper.InfoStepString(toolsTable(cached))
+			return nil
+		},
+	}
+
+	return listCmd
+}
+
+func toolsPrune() *cobra.Command {
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "remove cached tool versions that are no longer used",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			manager, err := tools.NewManager()
+			if err != nil {
+				return fmt.Errorf("failed to create tool manager: %w", err)
+			}
+
+			removed, err := manager.Prune(pruneAllFlag)
+			if err != nil {
+				wrerr := fmt.Errorf("failed to prune tools cache: %w", err)
+				stepper.InfoStep(step.EmojiError, wrerr.Error())
+				return wrerr
+			}
+
+			stepper.InfoStep(step.EmojiCheck, fmt.Sprintf("removed %d cached tool(s)", len(removed)))
+			return nil
+		},
+	}
+
+	pruneCmd.Flags().BoolVar(&pruneAllFlag, "all", false, "remove every cached tool, including the versions currently in use")
+
+	return pruneCmd
+}
+
+func toolsVerify() *cobra.Command {
+	verifyCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "check the integrity of cached tool binaries",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			manager, err := tools.NewManager()
+			if err != nil {
+				return fmt.Errorf("failed to create tool manager: %w", err)
+			}
+
+			failed, err := manager.Verify()
+			if err != nil {
+				wrerr := fmt.Errorf("failed to verify tools cache: %w", err)
+				stepper.InfoStep(step.EmojiError, wrerr.Error())
+				return wrerr
+			}
+
+			if len(failed) > 0 {
+				stepper.InfoStepString(toolsTable(failed))
+				wrerr := fmt.Errorf("%d cached tool(s) failed verification, run `kubefirst tools prune --all` to clear the cache", len(failed))
+				stepper.InfoStep(step.EmojiError, wrerr.Error())
+				return wrerr
+			}
+
+			stepper.InfoStep(step.EmojiCheck, "all cached tools verified")
+			return nil
+		},
+	}
+
+	return verifyCmd
+}
+
+func toolsTable(cached []tools.CachedTool) string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+
+	fmt.Fprintf(tw, "Name\tVersion\tPlatform\tSize\tChecksum\n")
+	fmt.Fprintf(tw, "---\t---\t---\t---\t---\n")
+	for _, c := range cached {
+		checksum := "published"
+		if !c.Verified {
+			checksum = "recorded"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", c.Name, c.Version, c.Platform, c.Size, checksum)
+	}
+	tw.Flush()
+
+	return buf.String()
+}
@@ -0,0 +1,577 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	"github.com/konstructio/kubefirst/internal/step"
+	"github.com/konstructio/kubefirst/internal/vault"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	// kubeconfigFlag overrides the kubeconfig of the platform recorded in the kubefirst config
+	kubeconfigFlag string
+
+	// watchFlag keeps unsealing vault replicas as they restart
+	watchFlag bool
+
+	// kvMountFlag is the KV version 2 mount used by the vault kv commands
+	kvMountFlag string
+
+	// kvFieldFlag prints a single field of a secret
+	kvFieldFlag string
+
+	// vaultOutputFlag selects how vault commands print their result
+	vaultOutputFlag string
+
+	// keepOldTokenFlag skips revoking the previous root token after rotate-root
+	keepOldTokenFlag bool
+)
+
+func VaultCommand() *cobra.Command {
+	vaultCommand := &cobra.Command{
+		Use:   "vault",
+		Short: "interact with the vault of a kubefirst platform",
+		Long:  "interact with the vault of a kubefirst platform, on any cloud provider",
+	}
+
+	vaultCommand.PersistentFlags().StringVar(&vaultURLFlag, "vault-url", "", "the URL of the vault instance (defaults to https://vault.<domain> of the platform)")
+	vaultCommand.PersistentFlags().StringVar(&vaultTokenFlag, "vault-token", "", "the vault token (defaults to the root token of the platform)")
+	vaultCommand.PersistentFlags().StringVar(&kubeconfigFlag, "kubeconfig", "", "the kubeconfig of the cluster running vault (defaults to the kubeconfig of the platform)")
+
+	// wire up new commands
+	vaultCommand.AddCommand(vaultKV(), vaultLogin(), vaultRotateRoot(), vaultStatus(), vaultUnseal())
+
+	return vaultCommand
+}
+
+// vaultSession is the vault of the platform with a client for its ingress
+type vaultSession struct {
+	target *vault.Target
+	client *api.Client
+	kcfg   *k8s.KubernetesClient
+}
+
+// newVaultSession resolves the vault of the platform. When authenticate is
+// set the client uses --vault-token, or the root token of the platform.
+func newVaultSession(ctx context.Context, authenticate bool) (*vaultSession, error) {
+	target, err := vault.ResolveTarget(vaultURLFlag, kubeconfigFlag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve vault: %w", err)
+	}
+
+	client, err := vault.NewClient(target.URL, target.CACert)
+	if err != nil {
+		return nil, err
+	}
+	session := &vaultSession{target: target, client: client}
+
+	if !authenticate {
+		return session, nil
+	}
+	if vaultTokenFlag != "" {
+		client.SetToken(vaultTokenFlag)
+		return session, nil
+	}
+
+	// the init secret is a fallback for a root token rotated after install
+	var clientset kubernetes.Interface
+	if target.Kubeconfig != "" {
+		kcfg, err := session.kubeClient()
+		if err != nil {
+			log.Debug().Msgf("unable to read the vault init secret: %v", err)
+		} else {
+			clientset = kcfg.Clientset
+		}
+	}
+
+	token, err := vault.RootToken(ctx, client, target, clientset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vault root token: %w", err)
+	}
+	client.SetToken(token)
+
+	return session, nil
+}
+
+// kubeClient returns a client for the cluster running vault
+func (s *vaultSession) kubeClient() (*k8s.KubernetesClient, error) {
+	if s.kcfg != nil {
+		return s.kcfg, nil
+	}
+	if s.target.Kubeconfig == "" {
+		return nil, errors.New("no kubeconfig for the cluster running vault - pass --kubeconfig")
+	}
+
+	kcfg, err := k8s.CreateKubeConfig(false, s.target.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubeconfig: %w", err)
+	}
+	s.kcfg = kcfg
+	return kcfg, nil
+}
+
+// vaultStatus shows whether vault is sealed, its HA mode and its version
+func vaultStatus() *cobra.Command {
+	vaultStatusCmd := &cobra.Command{
+		Use:   "status",
+		Short: "show the seal status, HA mode and version of vault",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			session, err := newVaultSession(cmd.Context(), false)
+			if err != nil {
+				return err
+			}
+
+			sealStatus, err := session.client.Sys().SealStatusWithContext(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("failed to get vault seal status from %s: %w", session.target.URL, err)
+			}
+
+			// the leader endpoint is only served by unsealed replicas
+			var leader *api.LeaderResponse
+			if !sealStatus.Sealed {
+				leader, err = session.client.Sys().LeaderWithContext(cmd.Context())
+				if err != nil {
+					return fmt.Errorf("failed to get vault leader from %s: %w", session.target.URL, err)
+				}
+			}
+
+			stepper.InfoStepString(vaultStatusTable(session.target.URL, sealStatus, leader))
+			return nil
+		},
+	}
+
+	return vaultStatusCmd
+}
+
+func vaultStatusTable(vaultURL string, sealStatus *api.SealStatusResponse, leader *api.LeaderResponse) string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+
+	fmt.Fprintln(&buf, "")
+	fmt.Fprintf(&buf, "Vault status of %s\n", vaultURL)
+	fmt.Fprintln(&buf, "")
+
+	fmt.Fprintf(tw, "Name\tValue\n")
+	fmt.Fprintf(tw, "---\t---\n")
+	fmt.Fprintf(tw, "Initialized\t%t\n", sealStatus.Initialized)
+	fmt.Fprintf(tw, "Sealed\t%t\n", sealStatus.Sealed)
+	fmt.Fprintf(tw, "Unseal Progress\t%d/%d\n", sealStatus.Progress, sealStatus.T)
+	fmt.Fprintf(tw, "Version\t%s\n", sealStatus.Version)
+	fmt.Fprintf(tw, "Storage Type\t%s\n", sealStatus.StorageType)
+	fmt.Fprintf(tw, "Cluster Name\t%s\n", sealStatus.ClusterName)
+	if leader != nil {
+		fmt.Fprintf(tw, "HA Enabled\t%t\n", leader.HAEnabled)
+		if leader.HAEnabled {
+			mode := "standby"
+			if leader.IsSelf {
+				mode = "active"
+			}
+			fmt.Fprintf(tw, "HA Mode\t%s\n", mode)
+			fmt.Fprintf(tw, "Active Node Address\t%s\n", leader.LeaderAddress)
+		}
+		if leader.RaftCommittedIndex > 0 {
+			fmt.Fprintf(tw, "Raft Committed Index\t%d\n", leader.RaftCommittedIndex)
+			fmt.Fprintf(tw, "Raft Applied Index\t%d\n", leader.RaftAppliedIndex)
+		}
+	}
+	tw.Flush()
+
+	return buf.String()
+}
+
+// vaultLogin prints the vault address and root token as shell exports
+func vaultLogin() *cobra.Command {
+	vaultLoginCmd := &cobra.Command{
+		Use:   "login",
+		Short: "export the vault address and root token to your shell",
+		Long:  "print the vault address and the root token of the platform as shell exports, run `eval \"$(kubefirst vault login)\"` to use them with the vault CLI",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			session, err := newVaultSession(cmd.Context(), true)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), loginExports(session.target, session.client.Token()))
+			log.Info().Msgf("logged in to %s", session.target.URL)
+			return nil
+		},
+	}
+
+	return vaultLoginCmd
+}
+
+func loginExports(target *vault.Target, token string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "export VAULT_ADDR=%q\n", target.URL)
+	fmt.Fprintf(&buf, "export VAULT_TOKEN=%q\n", token)
+	if target.CACert != "" {
+		fmt.Fprintf(&buf, "export VAULT_CACERT=%q\n", target.CACert)
+	}
+	return buf.String()
+}
+
+// vaultKV reads and writes the secrets of the platform
+func vaultKV() *cobra.Command {
+	vaultKVCmd := &cobra.Command{
+		Use:   "kv",
+		Short: "read and write the secrets of the platform",
+		Long:  "read and write the secrets stored in the KV version 2 mount of the platform",
+	}
+
+	vaultKVCmd.PersistentFlags().StringVar(&kvMountFlag, "mount", vault.KVMount, "the KV version 2 mount of the secrets")
+
+	vaultKVCmd.AddCommand(vaultKVGet(), vaultKVList(), vaultKVPut())
+
+	return vaultKVCmd
+}
+
+func vaultKVGet() *cobra.Command {
+	vaultKVGetCmd := &cobra.Command{
+		Use:   "get <path>",
+		Short: "read a secret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if vaultOutputFlag != "table" && vaultOutputFlag != "json" {
+				return fmt.Errorf("invalid output %q - must be one of table or json", vaultOutputFlag)
+			}
+
+			session, err := newVaultSession(cmd.Context(), true)
+			if err != nil {
+				return err
+			}
+
+			secret, err := session.client.KVv2(kvMountFlag).Get(cmd.Context(), args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read secret %q: %w", args[0], err)
+			}
+
+			if kvFieldFlag != "" {
+				value, ok := secret.Data[kvFieldFlag]
+				if !ok {
+					return fmt.Errorf("secret %q has no field %q", args[0], kvFieldFlag)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), value)
+				return nil
+			}
+
+			if vaultOutputFlag == "json" {
+				data, err := json.MarshalIndent(secret.Data, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal secret: %w", err)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+				return nil
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), secretTable(secret.Data))
+			return nil
+		},
+	}
+
+	vaultKVGetCmd.Flags().StringVar(&kvFieldFlag, "field", "", "only print the value of this field")
+	vaultKVGetCmd.Flags().StringVar(&vaultOutputFlag, "output", "table", "the output format, one of table or json")
+
+	return vaultKVGetCmd
+}
+
+func secretTable(data map[string]interface{}) string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	fmt.Fprintf(tw, "Key\tValue\n")
+	fmt.Fprintf(tw, "---\t---\n")
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%v\n", key, data[key])
+	}
+	tw.Flush()
+
+	return buf.String()
+}
+
+func vaultKVList() *cobra.Command {
+	vaultKVListCmd := &cobra.Command{
+		Use:   "list [path]",
+		Short: "list the secrets under a path",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var path string
+			if len(args) > 0 {
+				path = strings.Trim(args[0], "/")
+			}
+
+			session, err := newVaultSession(cmd.Context(), true)
+			if err != nil {
+				return err
+			}
+
+			secret, err := session.client.Logical().ListWithContext(cmd.Context(), fmt.Sprintf("%s/metadata/%s", kvMountFlag, path))
+			if err != nil {
+				return fmt.Errorf("failed to list secrets under %q: %w", path, err)
+			}
+			if secret == nil {
+				return fmt.Errorf("no secrets found under %q", path)
+			}
+
+			keys, ok := secret.Data["keys"].([]interface{})
+			if !ok {
+				return fmt.Errorf("unexpected list response for %q", path)
+			}
+			for _, key := range keys {
+				fmt.Fprintln(cmd.OutOrStdout(), key)
+			}
+			return nil
+		},
+	}
+
+	return vaultKVListCmd
+}
+
+func vaultKVPut() *cobra.Command {
+	vaultKVPutCmd := &cobra.Command{
+		Use:   "put <path> <key=value>...",
+		Short: "write a secret, replacing its current data",
+		Long:  "write a secret, replacing its current data. A value of @file reads the value from that file",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			data, err := parseKVPairs(args[1:])
+			if err != nil {
+				return err
+			}
+
+			session, err := newVaultSession(cmd.Context(), true)
+			if err != nil {
+				return err
+			}
+
+			secret, err := session.client.KVv2(kvMountFlag).Put(cmd.Context(), args[0], data)
+			if err != nil {
+				return fmt.Errorf("failed to write secret %q: %w", args[0], err)
+			}
+
+			stepper.InfoStep(step.EmojiCheck, fmt.Sprintf("Wrote version %d of %s/%s", secret.VersionMetadata.Version, kvMountFlag, args[0]))
+			return nil
+		},
+	}
+
+	return vaultKVPutCmd
+}
+
+// parseKVPairs parses key=value arguments, reading values of the form @file from file
+func parseKVPairs(pairs []string) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid secret data %q - must be key=value", pair)
+		}
+
+		if file, isFile := strings.CutPrefix(value, "@"); isFile {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("error reading value of %q: %w", key, err)
+			}
+			value = string(content)
+		}
+		data[key] = value
+	}
+	return data, nil
+}
+
+// vaultRotateRoot generates a new root token with the unseal keys, stores it in
+// the init secret and revokes the previous one
+func vaultRotateRoot() *cobra.Command {
+	vaultRotateRootCmd := &cobra.Command{
+		Use:   "rotate-root",
+		Short: "generate a new vault root token and revoke the previous one",
+		Long:  "generate a new vault root token with the unseal keys of the platform, store it in the vault init secret and revoke the previous root token",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+			ctx := cmd.Context()
+
+			session, err := newVaultSession(ctx, false)
+			if err != nil {
+				return err
+			}
+			kcfg, err := session.kubeClient()
+			if err != nil {
+				return err
+			}
+
+			initResponse, err := vault.ReadInitSecret(kcfg.Clientset)
+			if err != nil {
+				return fmt.Errorf("failed to read vault init secret: %w", err)
+			}
+
+			stepper.NewProgressStep("Generating Root Token")
+			token, err := vault.GenerateRoot(ctx, session.client.Sys(), initResponse.Keys)
+			if err != nil {
+				stepper.FailCurrentStep(err)
+				return fmt.Errorf("failed to generate root token: %w", err)
+			}
+			stepper.CompleteCurrentStep()
+
+			stepper.NewProgressStep("Updating Vault Init Secret")
+			if err := vault.UpdateInitSecretRootToken(kcfg.Clientset, token); err != nil {
+				// the token is the only root token left unless it is saved
+				wrerr := fmt.Errorf("failed to store the new root token, it was not revoked: %w", err)
+				if path, saveErr := saveRootToken(token); saveErr != nil {
+					wrerr = fmt.Errorf("%w - and failed to save it: %w", wrerr, saveErr)
+				} else {
+					wrerr = fmt.Errorf("%w - it was saved to %s", wrerr, path)
+				}
+				stepper.FailCurrentStep(wrerr)
+				return wrerr
+			}
+			stepper.CompleteCurrentStep()
+
+			oldToken := vaultTokenFlag
+			if oldToken == "" {
+				oldToken = initResponse.RootToken
+			}
+			if !keepOldTokenFlag && oldToken != "" && oldToken != token {
+				stepper.NewProgressStep("Revoking Previous Root Token")
+				session.client.SetToken(oldToken)
+				if err := session.client.Auth().Token().RevokeSelfWithContext(ctx, ""); err != nil {
+					wrerr := fmt.Errorf("failed to revoke the previous root token: %w", err)
+					stepper.FailCurrentStep(wrerr)
+					return wrerr
+				}
+				stepper.CompleteCurrentStep()
+			}
+
+			stepper.InfoStep(step.EmojiBulb, "The new root token is stored in the vault-unseal-secret secret - run `kubefirst vault login` to use it")
+			return nil
+		},
+	}
+
+	vaultRotateRootCmd.Flags().BoolVar(&keepOldTokenFlag, "keep-old-token", false, "do not revoke the previous root token")
+
+	return vaultRotateRootCmd
+}
+
+// saveRootToken writes a root token which couldn't be stored in the cluster to
+// a new file of ~/.k1 readable by the current user only and returns its path
+func saveRootToken(token string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find the home directory: %w", err)
+	}
+	dir := filepath.Join(home, ".k1")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("error creating directory %q: %w", dir, err)
+	}
+
+	// temporary files are created readable by the current user only
+	file, err := os.CreateTemp(dir, "vault-root-token-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating root token file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(token + "\n"); err != nil {
+		return "", fmt.Errorf("error writing root token file %q: %w", file.Name(), err)
+	}
+	return file.Name(), nil
+}
+
+// vaultUnseal unseals every vault replica of the platform with the keys stored
+// in the cluster, then verifies vault is reachable through its ingress
+func vaultUnseal() *cobra.Command {
+	vaultUnsealCmd := &cobra.Command{
+		Use:   "unseal",
+		Short: "unseal every vault replica of the platform",
+		Long:  "unseal every vault replica of the platform with the unseal keys stored in the cluster, including raft followers of highly available vaults",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			stepper := step.NewStepFactory(cmd.ErrOrStderr())
+
+			session, err := newVaultSession(cmd.Context(), false)
+			if err != nil {
+				return err
+			}
+			kcfg, err := session.kubeClient()
+			if err != nil {
+				return err
+			}
+			unsealer := vault.NewUnsealer(kcfg)
+
+			if watchFlag {
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+				defer stop()
+
+				log.Info().Msg("watching vault pods, press Ctrl+C to stop")
+				if err := unsealer.Watch(ctx); err != nil {
+					return fmt.Errorf("failed to watch vault: %w", err)
+				}
+				return nil
+			}
+
+			stepper.NewProgressStep("Unsealing Vault")
+			unsealed, err := unsealer.UnsealAll(cmd.Context())
+			if err != nil {
+				wrerr := fmt.Errorf("failed to unseal vault: %w", err)
+				stepper.FailCurrentStep(wrerr)
+				return wrerr
+			}
+			stepper.CompleteCurrentStep()
+
+			if len(unsealed) == 0 {
+				stepper.InfoStep(step.EmojiCheck, "Every vault replica is already unsealed")
+			} else {
+				stepper.InfoStep(step.EmojiCheck, fmt.Sprintf("Unsealed %s", strings.Join(unsealed, ", ")))
+			}
+
+			stepper.NewProgressStep(fmt.Sprintf("Verifying %s", session.target.URL))
+			health, err := session.client.Sys().HealthWithContext(cmd.Context())
+			if err != nil {
+				wrerr := fmt.Errorf("vault was unsealed but %s is not reachable, use --ca-bundle if it is served with a private certificate authority: %w", session.target.URL, err)
+				stepper.FailCurrentStep(wrerr)
+				return wrerr
+			}
+			if health.Sealed {
+				wrerr := fmt.Errorf("vault at %s still reports being sealed", session.target.URL)
+				stepper.FailCurrentStep(wrerr)
+				return wrerr
+			}
+			stepper.CompleteCurrentStep()
+
+			return nil
+		},
+	}
+
+	vaultUnsealCmd.Flags().BoolVar(&watchFlag, "watch", false, "keep running and unseal vault replicas again whenever they restart")
+
+	return vaultUnsealCmd
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/konstructio/kubefirst/internal/vault"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKVPairs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "value")
+	require.NoError(t, os.WriteFile(file, []byte("from-file"), 0o600))
+
+	data, err := parseKVPairs([]string{"user=admin", "password=a=b", "cert=@" + file, "empty="})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"user":     "admin",
+		"password": "a=b",
+		"cert":     "from-file",
+		"empty":    "",
+	}, data)
+
+	_, err = parseKVPairs([]string{"novalue"})
+	require.EqualError(t, err, `invalid secret data "novalue" - must be key=value`)
+
+	_, err = parseKVPairs([]string{"=value"})
+	require.Error(t, err)
+
+	_, err = parseKVPairs([]string{"cert=@" + filepath.Join(t.TempDir(), "missing")})
+	require.ErrorContains(t, err, `error reading value of "cert"`)
+}
+
+func TestVaultStatusTable(t *testing.T) {
+	sealStatus := &api.SealStatusResponse{Initialized: true, T: 3, Version: "1.15.2", StorageType: "raft", ClusterName: "vault-cluster"}
+	leader := &api.LeaderResponse{HAEnabled: true, IsSelf: true, LeaderAddress: "https://vault-0.vault-internal:8200", RaftCommittedIndex: 42, RaftAppliedIndex: 42}
+
+	table := vaultStatusTable("https://vault.example.com", sealStatus, leader)
+	require.Contains(t, table, "Vault status of https://vault.example.com")
+	require.Contains(t, table, "Sealed               |false")
+	require.Contains(t, table, "HA Mode              |active")
+	require.Contains(t, table, "Raft Committed Index |42")
+
+	sealStatus.Sealed = true
+	table = vaultStatusTable("https://vault.example.com", sealStatus, nil)
+	require.Contains(t, table, "Sealed          |true")
+	require.NotContains(t, table, "HA Enabled")
+}
+
+func TestLoginExports(t *testing.T) {
+	exports := loginExports(&vault.Target{URL: "https://vault.example.com"}, "hvs.root")
+	require.Equal(t, "export VAULT_ADDR=\"https://vault.example.com\"\nexport VAULT_TOKEN=\"hvs.root\"\n", exports)
+
+	exports = loginExports(&vault.Target{URL: "https://vault.kubefirst.dev", CACert: "/ca/rootCA.pem"}, "hvs.root")
+	require.Contains(t, exports, "export VAULT_CACERT=\"/ca/rootCA.pem\"\n")
+}
+
+func TestSecretTable(t *testing.T) {
+	table := secretTable(map[string]interface{}{"b": "2", "a": "1"})
+	require.Equal(t, "Key |Value\n--- |---\na   |1\nb   |2\n", table)
+}
+
+func TestSaveRootToken(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	path, err := saveRootToken("hvs.root")
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "hvs.root\n", string(content))
+}
@@ -0,0 +1,313 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/konstructio/kubefirst-api/pkg/configs"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// formatVersion is bumped whenever the bundle layout changes in a way
+	// older CLIs cannot read
+	formatVersion = 1
+
+	manifestName     = "manifest.json"
+	toolsCacheDir    = "tools-cache"
+	chartsDir        = "charts"
+	kustomizeDir     = "kustomizations"
+	imagesArchive    = "images/images.tar"
+	templatesDir     = "templates"
+	catalogIndexName = "catalog/index.yaml"
+
+	// GitopsTemplate names the gitops template repository in a bundle
+	GitopsTemplate = "gitops-template"
+)
+
+// Chart is a helm chart collected into a bundle
+type Chart struct {
+	Name    string `json:"name"`
+	Repo    string `json:"repo"`
+	Version string `json:"version"`
+	File    string `json:"file,omitempty"`
+}
+
+// Kustomization is a remote kustomization rendered into a bundle
+type Kustomization struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	File string `json:"file,omitempty"`
+}
+
+// Template is a git repository collected into a bundle as a bare clone
+type Template struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Ref  string `json:"ref"`
+	Dir  string `json:"dir"`
+}
+
+// Manifest describes the content of an installation bundle
+type Manifest struct {
+	Version          int             `json:"version"`
+	KubefirstVersion string          `json:"kubefirst_version"`
+	CreatedAt        time.Time       `json:"created_at"`
+	OS               string          `json:"os"`
+	Arch             string          `json:"arch"`
+	Tools            []string        `json:"tools"`
+	Charts           []Chart         `json:"charts"`
+	Kustomizations   []Kustomization `json:"kustomizations,omitempty"`
+	Images           []string        `json:"images"`
+	Templates        []Template      `json:"templates"`
+	CatalogIndex     bool            `json:"catalog_index"`
+}
+
+// Bundle is an installation bundle extracted on disk
+type Bundle struct {
+	Dir      string
+	Manifest Manifest
+}
+
+// Open extracts the bundle archive at path into $HOME/.k1/bundles and
+// validates its manifest. Archives already extracted are reused.
+func Open(path string) (*Bundle, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user's home directory: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening bundle %q: %w", path, err)
+	}
+
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), ".tar")
+	dir := filepath.Join(homeDir, ".k1", "bundles", fmt.Sprintf("%s-%d", name, info.ModTime().Unix()))
+
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); err != nil {
+		log.Info().Msgf("extracting bundle %q to %q", path, dir)
+		if err := extract(path, dir); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("error extracting bundle %q: %w", path, err)
+		}
+	}
+
+	b, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	if b.Manifest.OS != runtime.GOOS || b.Manifest.Arch != runtime.GOARCH {
+		return nil, fmt.Errorf("bundle %q was created for %s/%s and cannot be used on %s/%s", path, b.Manifest.OS, b.Manifest.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	// templates are bare repositories cloned in-process, without a git binary
+	gitclient.InstallProtocol("file", server.NewClient(server.DefaultLoader))
+
+	return b, nil
+}
+
+// Load reads the manifest of a bundle already extracted to dir
+func Load(dir string) (*Bundle, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading bundle manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing bundle manifest: %w", err)
+	}
+
+	if manifest.Version > formatVersion {
+		return nil, fmt.Errorf("bundle format version %d is newer than supported version %d - please upgrade kubefirst", manifest.Version, formatVersion)
+	}
+	if manifest.KubefirstVersion != configs.K1Version {
+		log.Warn().Msgf("bundle was created for kubefirst %s, running %s", manifest.KubefirstVersion, configs.K1Version)
+	}
+
+	return &Bundle{Dir: dir, Manifest: manifest}, nil
+}
+
+// ToolsCacheDir returns the tool cache shipped in the bundle
+func (b *Bundle) ToolsCacheDir() string {
+	return filepath.Join(b.Dir, toolsCacheDir)
+}
+
+// ImagesArchive returns the path of the `docker save` archive, empty when the
+// bundle was created without images
+func (b *Bundle) ImagesArchive() string {
+	if len(b.Manifest.Images) == 0 {
+		return ""
+	}
+	return filepath.Join(b.Dir, imagesArchive)
+}
+
+// ChartPath returns the packaged chart with the given name
+func (b *Bundle) ChartPath(name string) (string, error) {
+	for _, c := range b.Manifest.Charts {
+		if c.Name == name {
+			return filepath.Join(b.Dir, chartsDir, c.File), nil
+		}
+	}
+	return "", fmt.Errorf("chart %q is not part of the bundle", name)
+}
+
+// Kustomization returns the manifests the kustomization with the given name
+// was rendered to
+func (b *Bundle) Kustomization(name string) ([]byte, error) {
+	for _, k := range b.Manifest.Kustomizations {
+		if k.Name == name {
+			data, err := os.ReadFile(filepath.Join(b.Dir, kustomizeDir, k.File))
+			if err != nil {
+				return nil, fmt.Errorf("error reading kustomization %q: %w", name, err)
+			}
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("kustomization %q is not part of the bundle - create the bundle again with this kubefirst release", name)
+}
+
+// Template returns the local clone URL and ref of a template repository
+func (b *Bundle) Template(name string) (string, string, error) {
+	for _, t := range b.Manifest.Templates {
+		if t.Name == name {
+			return "file://" + filepath.Join(b.Dir, templatesDir, t.Dir), t.Ref, nil
+		}
+	}
+	return "", "", fmt.Errorf("template %q is not part of the bundle", name)
+}
+
+// CatalogIndex returns the gitops catalog index.yaml shipped in the bundle
+func (b *Bundle) CatalogIndex() ([]byte, error) {
+	if !b.Manifest.CatalogIndex {
+		return nil, errors.New("the gitops catalog index is not part of the bundle")
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.Dir, catalogIndexName))
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog index: %w", err)
+	}
+	return data, nil
+}
+
+func extract(archivePath, dir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("error opening %q: %w", archivePath, err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive entry: %w", err)
+		}
+
+		target := filepath.Join(dir, filepath.Clean(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %q escapes the bundle directory", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("error creating %q: %w", target, err)
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return fmt.Errorf("error creating %q: %w", filepath.Dir(target), err)
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return fmt.Errorf("error creating %q: %w", target, err)
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return fmt.Errorf("error writing %q: %w", target, err)
+			}
+			if err := out.Close(); err != nil {
+				return fmt.Errorf("error closing %q: %w", target, err)
+			}
+		}
+	}
+}
+
+// archive writes the content of dir as a tar.gz to w
+func archive(dir string, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return fmt.Errorf("error creating header for %q: %w", rel, err)
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("error writing header for %q: %w", rel, err)
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("error opening %q: %w", path, err)
+		}
+		defer f.Close()
+
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("error writing %q: %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error archiving %q: %w", dir, err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error closing tar writer: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("error closing gzip writer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	staging := t.TempDir()
+	manifest := Manifest{
+		Version:        formatVersion,
+		Charts:         []Chart{{Name: "kubefirst", Version: "1.0.0", File: "kubefirst-1.0.0.tgz"}},
+		Kustomizations: []Kustomization{{Name: "argocd", Path: "github.com:konstructio/manifests/argocd/k3d?ref=v1.1.0", File: "argocd.yaml"}},
+		Images:         []string{"rancher/k3s:v1.28.12-k3s1"},
+		Templates:      []Template{{Name: GitopsTemplate, Ref: "v1.0.0", Dir: "gitops-template.git"}},
+		CatalogIndex:   true,
+	}
+	data, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	require.NoError(t, writeFile(filepath.Join(staging, manifestName), data))
+	require.NoError(t, writeFile(filepath.Join(staging, catalogIndexName), []byte("apps: []\n")))
+	require.NoError(t, writeFile(filepath.Join(staging, kustomizeDir, "argocd.yaml"), []byte("kind: Namespace\n")))
+
+	archivePath := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	f, err := os.Create(archivePath)
+	require.NoError(t, err)
+	require.NoError(t, archive(staging, f))
+	require.NoError(t, f.Close())
+
+	dir := t.TempDir()
+	require.NoError(t, extract(archivePath, dir))
+
+	b, err := Load(dir)
+	require.NoError(t, err)
+	require.Equal(t, manifest.Images, b.Manifest.Images)
+
+	chart, err := b.ChartPath("kubefirst")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, chartsDir, "kubefirst-1.0.0.tgz"), chart)
+
+	url, ref, err := b.Template(GitopsTemplate)
+	require.NoError(t, err)
+	require.Equal(t, "file://"+filepath.Join(dir, templatesDir, "gitops-template.git"), url)
+	require.Equal(t, "v1.0.0", ref)
+
+	argocd, err := b.Kustomization("argocd")
+	require.NoError(t, err)
+	require.Equal(t, "kind: Namespace\n", string(argocd))
+	_, err = b.Kustomization("vault-handler")
+	require.ErrorContains(t, err, `kustomization "vault-handler" is not part of the bundle`)
+
+	index, err := b.CatalogIndex()
+	require.NoError(t, err)
+	require.Equal(t, "apps: []\n", string(index))
+	require.Equal(t, filepath.Join(dir, imagesArchive), b.ImagesArchive())
+}
+
+func TestExtractRejectsPathTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0o644, Size: 1, Typeflag: tar.TypeReg}))
+	_, err := tw.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+
+	archivePath := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	require.NoError(t, os.WriteFile(archivePath, buf.Bytes(), 0o644))
+
+	require.ErrorContains(t, extract(archivePath, t.TempDir()), "escapes the bundle directory")
+}
+
+func TestFindImages(t *testing.T) {
+	content := `
+spec:
+  containers:
+    - name: api
+      image: ghcr.io/konstructio/kubefirst-api:1.2.3
+    - image: "docker.io/library/redis:7"
+  initContainers:
+    - image: <CONTAINER_REGISTRY_URL>/metaphor:latest
+      image: '{{ .Values.image }}'
+`
+	require.Equal(t, []string{
+		"ghcr.io/konstructio/kubefirst-api:1.2.3",
+		"docker.io/library/redis:7",
+	}, findImages(content))
+}
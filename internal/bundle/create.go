@@ -0,0 +1,338 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package bundle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/konstructio/kubefirst-api/pkg/configs"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	"github.com/konstructio/kubefirst/internal/catalog"
+	"github.com/konstructio/kubefirst/internal/k3d"
+	"github.com/konstructio/kubefirst/internal/tools"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/mod/semver"
+)
+
+// imagePattern matches `image: repo/name:tag` lines in rendered manifests
+var imagePattern = regexp.MustCompile(`(?m)^\s*-?\s*image:\s*["']?([^"'\s]+)["']?\s*$`)
+
+// CreateOptions selects what goes into a bundle
+type CreateOptions struct {
+	Output string
+	// OS and Arch are the target platform of the tools and images
+	OS   string
+	Arch string
+
+	Charts               []Chart
+	Kustomizations       []Kustomization
+	GitopsTemplateURL    string
+	GitopsTemplateBranch string
+	ExtraImages          []string
+	SkipImages           bool
+}
+
+// Create collects every tool binary, chart, container image and template
+// needed for an installation into the tar.gz at opts.Output
+func Create(ctx context.Context, opts CreateOptions) (*Manifest, error) {
+	if opts.OS == "" {
+		opts.OS = runtime.GOOS
+	}
+	if opts.Arch == "" {
+		opts.Arch = runtime.GOARCH
+	}
+
+	staging, err := os.MkdirTemp("", "kubefirst-bundle-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	manifest := Manifest{
+		Version:          formatVersion,
+		KubefirstVersion: configs.K1Version,
+		CreatedAt:        time.Now().UTC(),
+		OS:               opts.OS,
+		Arch:             opts.Arch,
+	}
+
+	// tools for the target platform
+	targetManager, err := tools.NewManager()
+	if err != nil {
+		return nil, fmt.Errorf("error creating tool manager: %w", err)
+	}
+	targetManager.GOOS, targetManager.GOARCH = opts.OS, opts.Arch
+
+	log.Info().Msgf("collecting tools for %s/%s", opts.OS, opts.Arch)
+	if err := targetManager.Export(ctx, filepath.Join(staging, toolsCacheDir), tools.Registry...); err != nil {
+		return nil, fmt.Errorf("error collecting tools: %w", err)
+	}
+	for _, t := range tools.Registry {
+		manifest.Tools = append(manifest.Tools, fmt.Sprintf("%s@%s", t.Name, t.Version))
+	}
+
+	// helm runs on this machine, whatever the target platform is
+	hostManager, err := tools.NewManager()
+	if err != nil {
+		return nil, fmt.Errorf("error creating tool manager: %w", err)
+	}
+	helmClient, err := hostManager.Ensure(ctx, tools.Helm)
+	if err != nil {
+		return nil, fmt.Errorf("error installing helm: %w", err)
+	}
+
+	images := []string{k3d.DefaultK3sImage}
+	for _, chart := range opts.Charts {
+		file, chartImages, err := pullChart(helmClient, chart, filepath.Join(staging, chartsDir))
+		if err != nil {
+			return nil, err
+		}
+		chart.File = file
+		manifest.Charts = append(manifest.Charts, chart)
+		images = append(images, chartImages...)
+	}
+
+	for _, k := range opts.Kustomizations {
+		file, kustomizationImages, err := buildKustomization(k, filepath.Join(staging, kustomizeDir))
+		if err != nil {
+			return nil, err
+		}
+		k.File = file
+		manifest.Kustomizations = append(manifest.Kustomizations, k)
+		images = append(images, kustomizationImages...)
+	}
+
+	// templates
+	templateDir := filepath.Join(staging, templatesDir)
+	gitopsTemplate := Template{
+		Name: GitopsTemplate,
+		URL:  opts.GitopsTemplateURL,
+		Ref:  opts.GitopsTemplateBranch,
+		Dir:  GitopsTemplate + ".git",
+	}
+	repo, err := bareClone(ctx, gitopsTemplate, templateDir)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Templates = append(manifest.Templates, gitopsTemplate)
+
+	templateImages, err := imagesFromRepository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting images from %s: %w", GitopsTemplate, err)
+	}
+	images = append(images, templateImages...)
+
+	// catalog index
+	index, err := catalog.ReadIndex(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error collecting the gitops catalog index: %w", err)
+	}
+	if err := writeFile(filepath.Join(staging, catalogIndexName), index); err != nil {
+		return nil, err
+	}
+	manifest.CatalogIndex = true
+
+	// container images
+	if !opts.SkipImages {
+		images = append(images, opts.ExtraImages...)
+		slices.Sort(images)
+		manifest.Images = slices.Compact(images)
+
+		if err := saveImages(manifest.Images, opts.Arch, filepath.Join(staging, imagesArchive)); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling bundle manifest: %w", err)
+	}
+	if err := writeFile(filepath.Join(staging, manifestName), data); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(opts.Output), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating bundle directory: %w", err)
+	}
+	f, err := os.Create(opts.Output)
+	if err != nil {
+		return nil, fmt.Errorf("error creating bundle file %q: %w", opts.Output, err)
+	}
+	defer f.Close()
+
+	log.Info().Msgf("writing bundle to %q", opts.Output)
+	if err := archive(staging, f); err != nil {
+		return nil, err
+	}
+
+	return &manifest, nil
+}
+
+// pullChart packages a chart into dir and returns its file name along with the
+// images referenced by its default values
+func pullChart(helmClient string, chart Chart, dir string) (string, []string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", nil, fmt.Errorf("error creating %q: %w", dir, err)
+	}
+
+	log.Info().Msgf("pulling chart %s %s from %q", chart.Name, chart.Version, chart.Repo)
+	_, _, err := shell.ExecShellReturnStrings(
+		helmClient,
+		"pull",
+		chart.Name,
+		"--repo",
+		chart.Repo,
+		"--version",
+		chart.Version,
+		"--devel",
+		"--destination",
+		dir,
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("error pulling chart %q: %w", chart.Name, err)
+	}
+
+	file := fmt.Sprintf("%s-%s.tgz", chart.Name, chart.Version)
+	rendered, _, err := shell.ExecShellReturnStrings(helmClient, "template", chart.Name, filepath.Join(dir, file))
+	if err != nil {
+		return "", nil, fmt.Errorf("error rendering chart %q: %w", chart.Name, err)
+	}
+
+	return file, findImages(rendered), nil
+}
+
+// buildKustomization renders a remote kustomization into dir and returns its
+// file name along with the images it references
+func buildKustomization(k Kustomization, dir string) (string, []string, error) {
+	log.Info().Msgf("building kustomization %s from %q", k.Name, k.Path)
+	rendered, err := k8s.KubernetesClient{}.KustomizeBuild(k.Path)
+	if err != nil {
+		return "", nil, fmt.Errorf("error building kustomization %q: %w", k.Name, err)
+	}
+
+	file := k.Name + ".yaml"
+	if err := writeFile(filepath.Join(dir, file), rendered.Bytes()); err != nil {
+		return "", nil, err
+	}
+	return file, findImages(rendered.String()), nil
+}
+
+// bareClone clones t.URL at t.Ref into dir, resolving the ref the same way
+// kubefirst does when cloning templates so the bundle can stand in for the remote
+func bareClone(ctx context.Context, t Template, dir string) (*git.Repository, error) {
+	refName := plumbing.NewBranchReferenceName(t.Ref)
+	if semver.IsValid(t.Ref) {
+		refName = plumbing.NewTagReferenceName(t.Ref)
+	}
+
+	log.Info().Msgf("cloning %q at %q", t.URL, t.Ref)
+	repo, err := git.PlainCloneContext(ctx, filepath.Join(dir, t.Dir), true, &git.CloneOptions{
+		URL:           t.URL,
+		ReferenceName: refName,
+		SingleBranch:  true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error cloning %q at %q: %w", t.URL, t.Ref, err)
+	}
+	return repo, nil
+}
+
+// imagesFromRepository returns the images referenced by the k3d manifests of
+// a template repository
+func imagesFromRepository(repo *git.Repository) ([]string, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("error resolving HEAD: %w", err)
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("error reading commit %s: %w", head.Hash(), err)
+	}
+	files, err := commit.Files()
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %w", err)
+	}
+
+	var images []string
+	err = files.ForEach(func(f *object.File) error {
+		if !strings.HasPrefix(f.Name, "k3d") || !(strings.HasSuffix(f.Name, ".yaml") || strings.HasSuffix(f.Name, ".yml")) {
+			return nil
+		}
+		content, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("error reading %q: %w", f.Name, err)
+		}
+		images = append(images, findImages(content)...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking repository: %w", err)
+	}
+	return images, nil
+}
+
+// findImages extracts image references, skipping templated values
+func findImages(content string) []string {
+	var images []string
+	for _, match := range imagePattern.FindAllStringSubmatch(content, -1) {
+		image := match[1]
+		if strings.ContainsAny(image, "<>{}$") {
+			continue
+		}
+		images = append(images, image)
+	}
+	return images
+}
+
+func saveImages(images []string, arch, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("error creating %q: %w", filepath.Dir(dest), err)
+	}
+
+	var failed []string
+	for _, image := range images {
+		log.Info().Msgf("pulling image %q", image)
+		_, _, err := shell.ExecShellReturnStrings("docker", "pull", "--platform", "linux/"+arch, image)
+		if err != nil {
+			log.Warn().Msgf("error pulling image %q: %v", image, err)
+			failed = append(failed, image)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("error pulling %d image(s): %s", len(failed), strings.Join(failed, ", "))
+	}
+
+	log.Info().Msgf("saving %d image(s) to the bundle", len(images))
+	args := append([]string{"save", "-o", dest}, images...)
+	if _, _, err := shell.ExecShellReturnStrings("docker", args...); err != nil {
+		return fmt.Errorf("error saving images: %w", err)
+	}
+	return nil
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating %q: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error writing %q: %w", path, err)
+	}
+	return nil
+}
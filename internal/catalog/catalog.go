@@ -16,6 +16,7 @@ import (
 	git "github.com/google/go-github/v52/github"
 
 	apiTypes "github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/konstructio/kubefirst/internal/httpclient"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
@@ -33,27 +34,33 @@ type GitHubClient struct {
 
 // NewGitHub instantiates an unauthenticated GitHub client
 func NewGitHub() *git.Client {
-	return git.NewClient(nil)
+	return git.NewClient(httpclient.New())
 }
 
-func ReadActiveApplications(ctx context.Context) (apiTypes.GitopsCatalogApps, error) {
+// ReadIndex returns the raw index.yaml of the gitops catalog repository
+func ReadIndex(ctx context.Context) ([]byte, error) {
 	gh := GitHubClient{
 		Client: NewGitHub(),
 	}
 
 	activeContent, err := gh.ReadGitopsCatalogRepoContents(ctx)
 	if err != nil {
-		return apiTypes.GitopsCatalogApps{}, fmt.Errorf("error retrieving gitops catalog repository content: %w", err)
+		return nil, fmt.Errorf("error retrieving gitops catalog repository content: %w", err)
 	}
 
 	index, err := gh.ReadGitopsCatalogIndex(ctx, activeContent)
 	if err != nil {
-		return apiTypes.GitopsCatalogApps{}, fmt.Errorf("error retrieving gitops catalog index content: %w", err)
+		return nil, fmt.Errorf("error retrieving gitops catalog index content: %w", err)
 	}
 
+	return index, nil
+}
+
+// ParseIndex parses the content of a gitops catalog index.yaml
+func ParseIndex(index []byte) (apiTypes.GitopsCatalogApps, error) {
 	var out apiTypes.GitopsCatalogApps
 
-	err = yaml.Unmarshal(index, &out)
+	err := yaml.Unmarshal(index, &out)
 	if err != nil {
 		return apiTypes.GitopsCatalogApps{}, fmt.Errorf("error retrieving gitops catalog applications: %w", err)
 	}
@@ -61,20 +68,48 @@ func ReadActiveApplications(ctx context.Context) (apiTypes.GitopsCatalogApps, er
 	return out, nil
 }
 
-func ValidateCatalogApps(ctx context.Context, catalogApps string) (bool, []apiTypes.GitopsCatalogApp, error) {
-	items := strings.Split(catalogApps, ",")
+func ReadActiveApplications(ctx context.Context) (apiTypes.GitopsCatalogApps, error) {
+	index, err := ReadIndex(ctx)
+	if err != nil {
+		return apiTypes.GitopsCatalogApps{}, err
+	}
 
-	gitopsCatalogapps := []apiTypes.GitopsCatalogApp{}
+	return ParseIndex(index)
+}
+
+func ValidateCatalogApps(ctx context.Context, catalogApps string) (bool, []apiTypes.GitopsCatalogApp, error) {
 	if catalogApps == "" {
-		return true, gitopsCatalogapps, nil
+		return true, []apiTypes.GitopsCatalogApp{}, nil
 	}
 
 	apps, err := ReadActiveApplications(ctx)
 	if err != nil {
 		log.Error().Msgf("error getting gitops catalog applications: %s", err)
-		return false, gitopsCatalogapps, err
+		return false, []apiTypes.GitopsCatalogApp{}, err
 	}
 
+	return validateApps(apps, catalogApps)
+}
+
+// ValidateCatalogAppsFromIndex validates catalogApps against a local copy of
+// the catalog index, as shipped in an installation bundle
+func ValidateCatalogAppsFromIndex(index []byte, catalogApps string) (bool, []apiTypes.GitopsCatalogApp, error) {
+	if catalogApps == "" {
+		return true, []apiTypes.GitopsCatalogApp{}, nil
+	}
+
+	apps, err := ParseIndex(index)
+	if err != nil {
+		return false, []apiTypes.GitopsCatalogApp{}, err
+	}
+
+	return validateApps(apps, catalogApps)
+}
+
+func validateApps(apps apiTypes.GitopsCatalogApps, catalogApps string) (bool, []apiTypes.GitopsCatalogApp, error) {
+	items := strings.Split(catalogApps, ",")
+	gitopsCatalogapps := []apiTypes.GitopsCatalogApp{}
+
 	for _, app := range items {
 		found := false
 		for _, catalogApp := range apps.Apps {
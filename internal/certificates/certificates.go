@@ -0,0 +1,279 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package certificates
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// SANsAnnotation records the hostnames a certificate was generated for
+	SANsAnnotation = "kubefirst.konstruct.io/mkcert-sans"
+
+	// mkcertIssuer is the organization of every mkcert certificate authority
+	mkcertIssuer = "mkcert development CA"
+)
+
+// Certificate is a TLS secret signed by the mkcert certificate authority
+type Certificate struct {
+	Namespace string
+	Secret    string
+	SANs      []string
+	NotAfter  time.Time
+}
+
+// SecretName returns the TLS secret generated for app
+func SecretName(app string) string {
+	return fmt.Sprintf("%s-tls", app)
+}
+
+// Manager generates mkcert certificates and stores them as TLS secrets
+type Manager struct {
+	Clientset kubernetes.Interface
+	// MkCertClient is the mkcert binary
+	MkCertClient string
+	// PemDir keeps a copy of every generated certificate and key
+	PemDir string
+	// Generate runs mkcert, it defaults to the MkCertClient binary
+	Generate func(certFile, keyFile string, sans []string) error
+}
+
+// NewManager returns a manager running mkcertClient
+func NewManager(clientset kubernetes.Interface, mkcertClient, pemDir string) *Manager {
+	m := &Manager{Clientset: clientset, MkCertClient: mkcertClient, PemDir: pemDir}
+	m.Generate = m.mkcert
+	return m
+}
+
+func (m *Manager) mkcert(certFile, keyFile string, sans []string) error {
+	args := append([]string{"-cert-file", certFile, "-key-file", keyFile}, sans...)
+	if _, stderr, err := shell.ExecShellReturnStrings(m.MkCertClient, args...); err != nil {
+		return fmt.Errorf("error running mkcert: %s: %w", strings.TrimSpace(stderr), err)
+	}
+	return nil
+}
+
+// Create generates a certificate for sans and stores it in the secret name of
+// namespace, replacing the certificate it holds
+func (m *Manager) Create(ctx context.Context, namespace, name string, sans []string) error {
+	if len(sans) == 0 {
+		return errors.New("at least one hostname is required")
+	}
+
+	if err := os.MkdirAll(m.PemDir, 0o700); err != nil {
+		return fmt.Errorf("error creating directory %q: %w", m.PemDir, err)
+	}
+	certFile := filepath.Join(m.PemDir, fmt.Sprintf("%s-%s-cert.pem", namespace, name))
+	keyFile := filepath.Join(m.PemDir, fmt.Sprintf("%s-%s-key.pem", namespace, name))
+
+	log.Info().Msgf("generating certificate for %s", strings.Join(sans, ", "))
+	if err := m.Generate(certFile, keyFile, sans); err != nil {
+		return err
+	}
+
+	certPem, err := os.ReadFile(certFile)
+	if err != nil {
+		return fmt.Errorf("error reading certificate file %q: %w", certFile, err)
+	}
+	keyPem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("error reading key file %q: %w", keyFile, err)
+	}
+
+	if err := m.ensureNamespace(ctx, namespace); err != nil {
+		return err
+	}
+
+	secret := &v1.Secret{
+		Type: v1.SecretTypeTLS,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: map[string]string{SANsAnnotation: strings.Join(sans, ",")},
+		},
+		Data: map[string][]byte{
+			v1.TLSCertKey:       certPem,
+			v1.TLSPrivateKeyKey: keyPem,
+		},
+	}
+
+	secrets := m.Clientset.CoreV1().Secrets(namespace)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("error creating kubernetes secret %s/%s: %w", namespace, name, err)
+		}
+		log.Info().Msgf("created kubernetes secret: %s/%s", namespace, name)
+	case err != nil:
+		return fmt.Errorf("error getting kubernetes secret %s/%s: %w", namespace, name, err)
+	default:
+		if existing.Type != v1.SecretTypeTLS {
+			return fmt.Errorf("kubernetes secret %s/%s exists and is not a TLS secret", namespace, name)
+		}
+		existing.Data = secret.Data
+		if existing.Annotations == nil {
+			existing.Annotations = map[string]string{}
+		}
+		existing.Annotations[SANsAnnotation] = secret.Annotations[SANsAnnotation]
+		if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("error updating kubernetes secret %s/%s: %w", namespace, name, err)
+		}
+		log.Info().Msgf("updated kubernetes secret: %s/%s", namespace, name)
+	}
+	return nil
+}
+
+func (m *Manager) ensureNamespace(ctx context.Context, namespace string) error {
+	_, err := m.Clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error getting namespace %q: %w", namespace, err)
+	}
+
+	_, err = m.Clientset.CoreV1().Namespaces().Create(ctx, &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating namespace %q: %w", namespace, err)
+	}
+	log.Info().Msgf("namespace created: %s", namespace)
+	return nil
+}
+
+// List returns every TLS secret of the cluster signed by mkcert, sorted by
+// namespace and name
+func (m *Manager) List(ctx context.Context) ([]Certificate, error) {
+	secrets, err := m.Clientset.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{FieldSelector: "type=" + string(v1.SecretTypeTLS)})
+	if err != nil {
+		return nil, fmt.Errorf("error listing TLS secrets: %w", err)
+	}
+
+	var certs []Certificate
+	for _, secret := range secrets.Items {
+		// the fake clientset used in tests ignores field selectors
+		if secret.Type != v1.SecretTypeTLS {
+			continue
+		}
+		cert, err := parseCertificate(secret.Data[v1.TLSCertKey])
+		if err != nil {
+			log.Debug().Msgf("skipping secret %s/%s: %v", secret.Namespace, secret.Name, err)
+			continue
+		}
+		if !slices.ContainsFunc(cert.Issuer.Organization, func(o string) bool { return o == mkcertIssuer }) {
+			continue
+		}
+
+		sans := cert.DNSNames
+		if annotation := secret.Annotations[SANsAnnotation]; annotation != "" {
+			sans = strings.Split(annotation, ",")
+		}
+		certs = append(certs, Certificate{
+			Namespace: secret.Namespace,
+			Secret:    secret.Name,
+			SANs:      sans,
+			NotAfter:  cert.NotAfter,
+		})
+	}
+
+	slices.SortFunc(certs, func(a, b Certificate) int {
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Secret, b.Secret)
+	})
+	return certs, nil
+}
+
+// Get returns the mkcert certificate stored in the secret name of namespace
+func (m *Manager) Get(ctx context.Context, namespace, name string) (*Certificate, error) {
+	certs, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, cert := range certs {
+		if cert.Namespace == namespace && cert.Secret == name {
+			return &cert, nil
+		}
+	}
+	return nil, fmt.Errorf("no mkcert certificate found in secret %s/%s", namespace, name)
+}
+
+// Renew regenerates cert for the hostnames it was generated for
+func (m *Manager) Renew(ctx context.Context, cert Certificate) error {
+	return m.Create(ctx, cert.Namespace, cert.Secret, cert.SANs)
+}
+
+// RenewExpiring renews every certificate expiring within before of now and
+// returns the ones it renewed
+func (m *Manager) RenewExpiring(ctx context.Context, before time.Duration, now time.Time) ([]Certificate, error) {
+	certs, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var renewed []Certificate
+	var errs []error
+	for _, cert := range certs {
+		if cert.NotAfter.Sub(now) > before {
+			continue
+		}
+		if err := m.Renew(ctx, cert); err != nil {
+			errs = append(errs, fmt.Errorf("error renewing %s/%s: %w", cert.Namespace, cert.Secret, err))
+			continue
+		}
+		renewed = append(renewed, cert)
+	}
+	return renewed, errors.Join(errs...)
+}
+
+// Delete removes the secret name of namespace and its local copy
+func (m *Manager) Delete(ctx context.Context, namespace, name string) error {
+	err := m.Clientset.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error deleting kubernetes secret %s/%s: %w", namespace, name, err)
+	}
+	if apierrors.IsNotFound(err) {
+		log.Warn().Msgf("kubernetes secret %s/%s does not exist", namespace, name)
+	}
+
+	for _, suffix := range []string{"cert", "key"} {
+		file := filepath.Join(m.PemDir, fmt.Sprintf("%s-%s-%s.pem", namespace, name, suffix))
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error deleting %q: %w", file, err)
+		}
+	}
+	return nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,186 @@
+package certificates
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeMkcert signs certificates with an mkcert-like certificate authority
+type fakeMkcert struct {
+	t        *testing.T
+	key      *ecdsa.PrivateKey
+	ca       *x509.Certificate
+	validFor time.Duration
+	calls    [][]string
+}
+
+func newFakeMkcert(t *testing.T, issuer string) *fakeMkcert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{issuer}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &fakeMkcert{t: t, key: key, ca: ca, validFor: 365 * 24 * time.Hour}
+}
+
+func (f *fakeMkcert) sign(sans []string) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		DNSNames:     sans,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(f.validFor),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, f.ca, &f.key.PublicKey, f.key)
+	require.NoError(f.t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func (f *fakeMkcert) generate(certFile, keyFile string, sans []string) error {
+	f.calls = append(f.calls, sans)
+	if err := os.WriteFile(certFile, f.sign(sans), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, []byte("key"), 0o600)
+}
+
+func testManager(t *testing.T, objects ...*v1.Secret) (*Manager, *fakeMkcert) {
+	clientset := fake.NewSimpleClientset()
+	for _, secret := range objects {
+		_, err := clientset.CoreV1().Secrets(secret.Namespace).Create(context.Background(), secret, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	mkcert := newFakeMkcert(t, mkcertIssuer)
+	m := NewManager(clientset, "mkcert", filepath.Join(t.TempDir(), "pem"))
+	m.Generate = mkcert.generate
+	return m, mkcert
+}
+
+func TestCreate(t *testing.T) {
+	m, _ := testManager(t)
+	ctx := context.Background()
+
+	require.NoError(t, m.Create(ctx, "demo", "demo-tls", []string{"demo.kubefirst.dev", "*.demo.kubefirst.dev"}))
+
+	secret, err := m.Clientset.CoreV1().Secrets("demo").Get(ctx, "demo-tls", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, v1.SecretTypeTLS, secret.Type)
+	require.Equal(t, "demo.kubefirst.dev,*.demo.kubefirst.dev", secret.Annotations[SANsAnnotation])
+	require.Equal(t, []byte("key"), secret.Data[v1.TLSPrivateKeyKey])
+
+	_, err = m.Clientset.CoreV1().Namespaces().Get(ctx, "demo", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// creating again replaces the certificate
+	require.NoError(t, m.Create(ctx, "demo", "demo-tls", []string{"other.kubefirst.dev"}))
+	cert, err := m.Get(ctx, "demo", "demo-tls")
+	require.NoError(t, err)
+	require.Equal(t, []string{"other.kubefirst.dev"}, cert.SANs)
+
+	require.Error(t, m.Create(ctx, "demo", "demo-tls", nil))
+}
+
+func TestList(t *testing.T) {
+	other := newFakeMkcert(t, "Let's Encrypt")
+	m, mkcert := testManager(t,
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-tls", Namespace: "vault"},
+			Type:       v1.SecretTypeTLS,
+			Data:       map[string][]byte{v1.TLSCertKey: newFakeMkcert(t, mkcertIssuer).sign([]string{"vault.kubefirst.dev"})},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "public-tls", Namespace: "web"},
+			Type:       v1.SecretTypeTLS,
+			Data:       map[string][]byte{v1.TLSCertKey: other.sign([]string{"example.com"})},
+		},
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "opaque", Namespace: "web"},
+			Data:       map[string][]byte{"password": []byte("secret")},
+		},
+	)
+	ctx := context.Background()
+	require.NoError(t, m.Create(ctx, "argo", "argo-tls", []string{"argo.kubefirst.dev"}))
+	require.Len(t, mkcert.calls, 1)
+
+	certs, err := m.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, certs, 2)
+	require.Equal(t, "argo", certs[0].Namespace)
+	require.Equal(t, "vault", certs[1].Namespace)
+	require.Equal(t, []string{"vault.kubefirst.dev"}, certs[1].SANs)
+
+	_, err = m.Get(ctx, "web", "public-tls")
+	require.Error(t, err)
+}
+
+func TestRenewExpiring(t *testing.T) {
+	m, mkcert := testManager(t)
+	ctx := context.Background()
+
+	mkcert.validFor = 10 * 24 * time.Hour
+	require.NoError(t, m.Create(ctx, "soon", "soon-tls", []string{"soon.kubefirst.dev"}))
+	mkcert.validFor = 365 * 24 * time.Hour
+	require.NoError(t, m.Create(ctx, "later", "later-tls", []string{"later.kubefirst.dev"}))
+
+	renewed, err := m.RenewExpiring(ctx, 30*24*time.Hour, time.Now())
+	require.NoError(t, err)
+	require.Len(t, renewed, 1)
+	require.Equal(t, "soon-tls", renewed[0].Secret)
+
+	cert, err := m.Get(ctx, "soon", "soon-tls")
+	require.NoError(t, err)
+	require.True(t, cert.NotAfter.After(time.Now().Add(300*24*time.Hour)))
+}
+
+func TestDelete(t *testing.T) {
+	m, _ := testManager(t)
+	ctx := context.Background()
+
+	require.NoError(t, m.Create(ctx, "demo", "demo-tls", []string{"demo.kubefirst.dev"}))
+	require.FileExists(t, filepath.Join(m.PemDir, "demo-demo-tls-cert.pem"))
+
+	require.NoError(t, m.Delete(ctx, "demo", "demo-tls"))
+	require.NoFileExists(t, filepath.Join(m.PemDir, "demo-demo-tls-cert.pem"))
+
+	certs, err := m.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, certs)
+
+	// deleting a missing certificate is not an error
+	require.NoError(t, m.Delete(ctx, "demo", "demo-tls"))
+}
+
+func TestMkcertReport(t *testing.T) {
+	output := "The local CA is now installed in the system trust store! ⚡️\n\nThe local CA is now installed in the Firefox trust store (requires browser restart)! 🦊\n"
+	require.Equal(t, []string{
+		"The local CA is now installed in the system trust store! ⚡️",
+		"The local CA is now installed in the Firefox trust store (requires browser restart)! 🦊",
+	}, mkcertReport(output))
+}
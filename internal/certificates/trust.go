@@ -0,0 +1,42 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package certificates
+
+import (
+	"fmt"
+	"strings"
+
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+)
+
+// Trust installs the mkcert root certificate authority into the system trust
+// store and, when certutil is available, the Firefox and Chrome NSS databases.
+// It returns the certificate authority directory and what mkcert reported.
+func Trust(mkcertClient string) (string, []string, error) {
+	caRoot, stderr, err := shell.ExecShellReturnStrings(mkcertClient, "-CAROOT")
+	if err != nil {
+		return "", nil, fmt.Errorf("error locating the mkcert root certificate authority: %s: %w", strings.TrimSpace(stderr), err)
+	}
+
+	stdout, stderr, err := shell.ExecShellReturnStrings(mkcertClient, "-install")
+	changes := mkcertReport(stdout + "\n" + stderr)
+	if err != nil {
+		return "", changes, fmt.Errorf("error installing the mkcert root certificate authority: %w", err)
+	}
+	return strings.TrimSpace(caRoot), changes, nil
+}
+
+// mkcertReport returns the non-empty lines of mkcert output
+func mkcertReport(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
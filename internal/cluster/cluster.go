@@ -18,6 +18,7 @@ import (
 	"github.com/rs/zerolog/log"
 
 	apiTypes "github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/konstructio/kubefirst/internal/httpclient"
 	"github.com/konstructio/kubefirst/internal/types"
 )
 
@@ -59,8 +60,7 @@ func (c *Client) ResetClusterProgress(clusterName string) error {
 }
 
 func CreateCluster(cluster apiTypes.ClusterDefinition) error {
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	httpClient := http.Client{Transport: customTransport}
+	httpClient := httpclient.New()
 
 	requestObject := types.ProxyCreateClusterRequest{
 		Body: cluster,
@@ -104,8 +104,7 @@ func CreateCluster(cluster apiTypes.ClusterDefinition) error {
 }
 
 func ResetClusterProgress(clusterName string) error {
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	httpClient := http.Client{Transport: customTransport}
+	httpClient := httpclient.New()
 
 	requestObject := types.ProxyResetClusterRequest{
 		URL: fmt.Sprintf("/cluster/%s/reset_progress", clusterName),
@@ -149,8 +148,7 @@ func ResetClusterProgress(clusterName string) error {
 var ErrNotFound = fmt.Errorf("cluster not found")
 
 func GetCluster(clusterName string) (apiTypes.Cluster, error) {
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	httpClient := http.Client{Transport: customTransport}
+	httpClient := httpclient.New()
 
 	cluster := apiTypes.Cluster{}
 	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/proxy?url=/cluster/%s", GetConsoleIngressURL(), clusterName), nil)
@@ -194,8 +192,7 @@ func GetCluster(clusterName string) (apiTypes.Cluster, error) {
 }
 
 func GetClusters() ([]apiTypes.Cluster, error) {
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	httpClient := http.Client{Transport: customTransport}
+	httpClient := httpclient.New()
 
 	clusters := []apiTypes.Cluster{}
 	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/proxy?url=/cluster", GetConsoleIngressURL()), nil)
@@ -234,8 +231,7 @@ func GetClusters() ([]apiTypes.Cluster, error) {
 }
 
 func DeleteCluster(clusterName string) error {
-	customTransport := http.DefaultTransport.(*http.Transport).Clone()
-	httpClient := http.Client{Transport: customTransport}
+	httpClient := httpclient.New()
 
 	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/api/proxy?url=/cluster/%s", GetConsoleIngressURL(), clusterName), nil)
 	if err != nil {
@@ -265,3 +261,102 @@ func DeleteCluster(clusterName string) error {
 
 	return nil
 }
+
+// ExportCluster retrieves the full cluster record, including credentials, through
+// the console API export endpoint
+func ExportCluster(clusterName string) (apiTypes.Cluster, error) {
+	httpClient := httpclient.New()
+
+	cluster := apiTypes.Cluster{}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/proxy?url=/cluster/%s/export", GetConsoleIngressURL(), clusterName), nil)
+	if err != nil {
+		log.Printf("error creating request: %v", err)
+		return cluster, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("error executing request: %v", err)
+		return cluster, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusBadRequest:
+		// the export endpoint answers every failure with a bad request, a
+		// missing cluster is told apart by its message
+		var failure struct {
+			Message string `json:"message"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&failure); err == nil && failure.Message == fmt.Sprintf("cluster %q not found", clusterName) {
+			return cluster, ErrNotFound
+		}
+		log.Printf("unable to export cluster: %q %s", res.Status, failure.Message)
+		return cluster, fmt.Errorf("unable to export cluster: API returned %q: %s", res.Status, failure.Message)
+	case http.StatusOK:
+		// continue with the rest
+	default:
+		log.Printf("unable to export cluster: %q", res.Status)
+		return cluster, fmt.Errorf("unable to export cluster: API returned unexpected status code %q", res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Printf("unable to read response body: %v", err)
+		return cluster, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	err = json.Unmarshal(body, &cluster)
+	if err != nil {
+		log.Printf("unable to unmarshal cluster object: %v", err)
+		return cluster, fmt.Errorf("failed to unmarshal cluster object: %w", err)
+	}
+
+	return cluster, nil
+}
+
+// ImportCluster submits a previously exported cluster record to the console API
+func ImportCluster(cluster apiTypes.Cluster) error {
+	httpClient := httpclient.New()
+
+	requestObject := types.ProxyImportClusterRequest{
+		Body: cluster,
+		URL:  "/cluster/import",
+	}
+
+	payload, err := json.Marshal(requestObject)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request object: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/proxy", GetConsoleIngressURL()), bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("error creating request: %v", err)
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		log.Printf("error executing request: %v", err)
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Printf("unable to read response body: %v", err)
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusAccepted {
+		log.Printf("unable to import cluster: %q %q", res.Status, body)
+		return fmt.Errorf("unable to import cluster: API returned unexpected status code %q: %s", res.Status, body)
+	}
+
+	log.Info().Msgf("Import: %s", string(body))
+	return nil
+}
@@ -0,0 +1,43 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package cluster
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCluster(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("url") {
+		case "/cluster/kubefirst/export":
+			w.Write([]byte(`{"cluster_name":"kubefirst"}`))
+		case "/cluster/missing/export":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message":"cluster \"missing\" not found"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"message":"secret not found: forbidden"}`))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("K1_LOCAL_DEBUG", "true")
+	t.Setenv("K1_CONSOLE_REMOTE_URL", server.URL)
+
+	cluster, err := ExportCluster("kubefirst")
+	require.NoError(t, err)
+	require.Equal(t, "kubefirst", cluster.ClusterName)
+
+	_, err = ExportCluster("missing")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = ExportCluster("broken")
+	require.EqualError(t, err, `unable to export cluster: API returned "400 Bad Request": secret not found: forbidden`)
+}
@@ -18,6 +18,8 @@ import (
 	"github.com/konstructio/kubefirst-api/pkg/configs"
 	"github.com/konstructio/kubefirst-api/pkg/providerConfigs"
 	"github.com/konstructio/kubefirst/internal/cluster"
+	"github.com/konstructio/kubefirst/internal/credentials"
+	"github.com/konstructio/kubefirst/internal/httpclient"
 	"github.com/konstructio/kubefirst/internal/launch"
 	"github.com/konstructio/kubefirst/internal/progress"
 	"github.com/konstructio/kubefirst/internal/step"
@@ -62,7 +64,7 @@ func versionCheck() (*CheckResponse, bool) {
 	var latestVersion string
 	flatVersion := strings.ReplaceAll(configs.K1Version, "v", "")
 
-	resp, err := http.Get("https://raw.githubusercontent.com/Homebrew/homebrew-core/master/Formula/k/kubefirst.rb")
+	resp, err := httpclient.New().Get("https://raw.githubusercontent.com/Homebrew/homebrew-core/master/Formula/k/kubefirst.rb")
 	if err != nil {
 		fmt.Printf("checking for a newer version failed (cannot get Homebrew formula) with: %s", err)
 		return nil, true
@@ -105,6 +107,11 @@ func versionCheck() (*CheckResponse, bool) {
 func GetRootCredentials(cmd *cobra.Command, _ []string) error {
 	stepper := step.NewStepFactory(cmd.ErrOrStderr())
 
+	opts, err := credentials.OptionsFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
 	stepper.NewProgressStep("Fetching Credentials")
 
 	clusterName := viper.GetString("flags.cluster-name")
@@ -118,24 +125,7 @@ func GetRootCredentials(cmd *cobra.Command, _ []string) error {
 
 	stepper.CompleteCurrentStep()
 
-	header := `
-##
-# Root Credentials
-
-### :bulb: Keep this data secure. These passwords can be used to access the following applications in your platform
-
-## ArgoCD Admin Password
-##### ` + cluster.ArgoCDPassword + `
-
-## KBot User Password
-##### ` + cluster.VaultAuth.KbotPassword + `
-
-## Vault Root Token
-##### ` + cluster.VaultAuth.RootToken + `
-`
-	stepper.InfoStep(step.EmojiBulb, progress.RenderMessage(header))
-
-	return nil
+	return credentials.Present(cmd, credentials.FromCluster(cluster), cluster.CloudProvider, opts)
 }
 
 func Destroy(cmd *cobra.Command, _ []string) error {
@@ -0,0 +1,297 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	apiTypes "github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/konstructio/kubefirst/internal/progress"
+	"github.com/konstructio/kubefirst/internal/vault"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Output formats of root-credentials
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputEnv  = "env"
+)
+
+// mask replaces credentials that are not revealed
+const mask = "********"
+
+// clearScreen moves the cursor home and clears the screen and its scrollback
+const clearScreen = "\033[H\033[2J\033[3J"
+
+// Credentials are the root credentials of a platform
+type Credentials struct {
+	ArgoCDPassword string `json:"argocd_password"`
+	KbotPassword   string `json:"kbot_password"`
+	VaultRootToken string `json:"vault_root_token"`
+}
+
+// FromCluster returns the credentials recorded by the kubefirst API
+func FromCluster(cluster apiTypes.Cluster) *Credentials {
+	return &Credentials{
+		ArgoCDPassword: cluster.ArgoCDPassword,
+		KbotPassword:   cluster.VaultAuth.KbotPassword,
+		VaultRootToken: cluster.VaultAuth.RootToken,
+	}
+}
+
+// FromSecrets reads the credentials from the secrets of the cluster, and the
+// kbot password from vault at vaultURL
+func FromSecrets(ctx context.Context, clientset kubernetes.Interface, vaultURL, caCert string) *Credentials {
+	creds := &Credentials{}
+
+	initResponse, err := vault.ReadInitSecret(clientset)
+	if err != nil {
+		log.Warn().Msgf("vault secret may not exist: %v", err)
+	} else {
+		creds.VaultRootToken = initResponse.RootToken
+	}
+
+	argoCDSecret, err := k8s.ReadSecretV2(clientset, "argocd", "argocd-initial-admin-secret")
+	if err != nil {
+		log.Warn().Msgf("Argo CD secret may not exist: %v", err)
+	} else {
+		creds.ArgoCDPassword = argoCDSecret["password"]
+	}
+
+	if creds.VaultRootToken == "" {
+		return creds
+	}
+	vaultClient, err := vault.NewClient(vaultURL, caCert)
+	if err != nil {
+		log.Warn().Msgf("problem retrieving kbot password: %v", err)
+		return creds
+	}
+	vaultClient.SetToken(creds.VaultRootToken)
+
+	kbot, err := vaultClient.KVv2("users").Get(ctx, "kbot")
+	if err != nil {
+		log.Warn().Msgf("problem retrieving kbot password: %v", err)
+		return creds
+	}
+	if password, ok := kbot.Data["initial-password"].(string); ok {
+		creds.KbotPassword = password
+	}
+	return creds
+}
+
+// Options select how credentials are presented
+type Options struct {
+	Output    string
+	Show      bool
+	Yes       bool
+	WriteTo   string
+	RevealFor time.Duration
+}
+
+// AddFlags adds the output flags of root-credentials to cmd
+func AddFlags(cmd *cobra.Command) {
+	cmd.Flags().String("output", OutputText, "the output format, one of text, json or env")
+	cmd.Flags().Bool("show", false, "print the credentials in clear text, after confirmation")
+	cmd.Flags().Bool("yes", false, "confirm --show and --reveal-for without prompting")
+	cmd.Flags().String("write-to", "", "write the credentials in clear text to this file, created with 0600 permissions")
+	cmd.Flags().Duration("reveal-for", 0, "print the credentials in clear text, then clear the screen after this duration")
+	cmd.MarkFlagsMutuallyExclusive("write-to", "reveal-for")
+}
+
+// OptionsFromFlags reads the flags added by AddFlags
+func OptionsFromFlags(cmd *cobra.Command) (*Options, error) {
+	var opts Options
+	var err error
+
+	if opts.Output, err = cmd.Flags().GetString("output"); err != nil {
+		return nil, fmt.Errorf("failed to get output flag: %w", err)
+	}
+	if opts.Show, err = cmd.Flags().GetBool("show"); err != nil {
+		return nil, fmt.Errorf("failed to get show flag: %w", err)
+	}
+	if opts.Yes, err = cmd.Flags().GetBool("yes"); err != nil {
+		return nil, fmt.Errorf("failed to get yes flag: %w", err)
+	}
+	if opts.WriteTo, err = cmd.Flags().GetString("write-to"); err != nil {
+		return nil, fmt.Errorf("failed to get write-to flag: %w", err)
+	}
+	if opts.RevealFor, err = cmd.Flags().GetDuration("reveal-for"); err != nil {
+		return nil, fmt.Errorf("failed to get reveal-for flag: %w", err)
+	}
+
+	switch opts.Output {
+	case OutputText, OutputJSON, OutputEnv:
+	default:
+		return nil, fmt.Errorf("invalid output %q - must be one of text, json or env", opts.Output)
+	}
+	if opts.RevealFor < 0 {
+		return nil, fmt.Errorf("invalid reveal-for %s - must be positive", opts.RevealFor)
+	}
+	if opts.RevealFor > 0 && opts.Output != OutputText {
+		return nil, errors.New("--reveal-for can only be used with the text output")
+	}
+	return &opts, nil
+}
+
+// Render formats creds, masking them unless reveal is set
+func Render(creds *Credentials, cloudProvider, output string, reveal bool) ([]byte, error) {
+	shown := *creds
+	if !reveal {
+		shown = Credentials{
+			ArgoCDPassword: maskValue(creds.ArgoCDPassword),
+			KbotPassword:   maskValue(creds.KbotPassword),
+			VaultRootToken: maskValue(creds.VaultRootToken),
+		}
+	}
+
+	var buf bytes.Buffer
+	switch output {
+	case OutputJSON:
+		data, err := json.MarshalIndent(shown, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal credentials: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteString("\n")
+	case OutputEnv:
+		fmt.Fprintf(&buf, "ARGOCD_PASSWORD=%q\n", shown.ArgoCDPassword)
+		fmt.Fprintf(&buf, "KBOT_PASSWORD=%q\n", shown.KbotPassword)
+		fmt.Fprintf(&buf, "VAULT_TOKEN=%q\n", shown.VaultRootToken)
+	default:
+		buf.WriteString(`
+##
+# Root Credentials (` + cloudProvider + `)
+
+### :bulb: Keep this data secure. These passwords can be used to access the following applications in your platform
+
+## ArgoCD Admin Password
+##### ` + shown.ArgoCDPassword + `
+
+## KBot User Password
+##### ` + shown.KbotPassword + `
+
+## Vault Root Token
+##### ` + shown.VaultRootToken + `
+`)
+		if !reveal {
+			buf.WriteString("\n:lock: Run with `--show`, `--reveal-for <duration>` or `--write-to <file>` to see the credentials\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func maskValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return mask
+}
+
+// Present writes creds according to opts: to a private file, or to the
+// command output, in clear text only once confirmed
+func Present(cmd *cobra.Command, creds *Credentials, cloudProvider string, opts *Options) error {
+	if opts.WriteTo != "" {
+		content, err := Render(creds, cloudProvider, opts.Output, true)
+		if err != nil {
+			return err
+		}
+		if err := WritePrivateFile(opts.WriteTo, content); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "root credentials written to %s\n", opts.WriteTo)
+		return nil
+	}
+
+	reveal := opts.Show || opts.RevealFor > 0
+	if reveal && !opts.Yes {
+		if err := confirm(cmd.InOrStdin(), cmd.ErrOrStderr()); err != nil {
+			return err
+		}
+	}
+
+	content, err := Render(creds, cloudProvider, opts.Output, reveal)
+	if err != nil {
+		return err
+	}
+
+	if opts.Output != OutputText {
+		if _, err := cmd.OutOrStdout().Write(content); err != nil {
+			return fmt.Errorf("failed to write the credentials: %w", err)
+		}
+		return nil
+	}
+
+	out := cmd.ErrOrStderr()
+	fmt.Fprintln(out, progress.RenderMessage(string(content)))
+
+	if opts.RevealFor > 0 {
+		fmt.Fprintf(out, "the screen will be cleared in %s\n", opts.RevealFor)
+		select {
+		case <-cmd.Context().Done():
+		case <-time.After(opts.RevealFor):
+		}
+		fmt.Fprint(out, clearScreen)
+	}
+	return nil
+}
+
+// confirm asks the user to confirm printing credentials in clear text, the
+// progress display of k3d hands the terminal over while waiting for the answer
+func confirm(in io.Reader, out io.Writer) error {
+	if !isTerminal(in) {
+		return errors.New("printing the credentials in clear text must be confirmed - pass --yes")
+	}
+
+	return progress.WithTerminal(func() error {
+		fmt.Fprint(out, "The root credentials will be printed in clear text. Type 'yes' to continue: ")
+		answer, err := bufio.NewReader(in).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read confirmation: %w", err)
+		}
+		if strings.TrimSpace(answer) != "yes" {
+			return errors.New("printing the credentials was not confirmed")
+		}
+		return nil
+	})
+}
+
+func isTerminal(in io.Reader) bool {
+	file, ok := in.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
+
+// WritePrivateFile writes content to path, readable by the current user only
+func WritePrivateFile(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating file %q: %w", path, err)
+	}
+	defer file.Close()
+
+	// an existing file keeps its permissions when truncated
+	if err := file.Chmod(0o600); err != nil {
+		return fmt.Errorf("error setting permissions of %q: %w", path, err)
+	}
+	if _, err := file.Write(content); err != nil {
+		return fmt.Errorf("error writing file %q: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testCredentials = &Credentials{ArgoCDPassword: "argo-pass", KbotPassword: "kbot-pass", VaultRootToken: "hvs.root"}
+
+func testCommand(args ...string) (*cobra.Command, *bytes.Buffer, *bytes.Buffer) {
+	cmd := &cobra.Command{Use: "root-credentials", RunE: func(*cobra.Command, []string) error { return nil }}
+	AddFlags(cmd)
+	cmd.SetArgs(args)
+	cmd.SetIn(strings.NewReader(""))
+
+	var stdout, stderr bytes.Buffer
+	cmd.SetOut(&stdout)
+	cmd.SetErr(&stderr)
+	cmd.SetContext(context.Background())
+	if err := cmd.ParseFlags(args); err != nil {
+		panic(err)
+	}
+	return cmd, &stdout, &stderr
+}
+
+func TestRender(t *testing.T) {
+	content, err := Render(testCredentials, "civo", OutputEnv, true)
+	require.NoError(t, err)
+	require.Equal(t, "ARGOCD_PASSWORD=\"argo-pass\"\nKBOT_PASSWORD=\"kbot-pass\"\nVAULT_TOKEN=\"hvs.root\"\n", string(content))
+
+	content, err = Render(testCredentials, "civo", OutputJSON, false)
+	require.NoError(t, err)
+	require.Equal(t, "{\n  \"argocd_password\": \"********\",\n  \"kbot_password\": \"********\",\n  \"vault_root_token\": \"********\"\n}\n", string(content))
+
+	content, err = Render(testCredentials, "civo", OutputText, false)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "hvs.root")
+	require.Contains(t, string(content), "--show")
+
+	content, err = Render(&Credentials{VaultRootToken: "hvs.root"}, "civo", OutputText, true)
+	require.NoError(t, err)
+	require.Contains(t, string(content), "##### hvs.root")
+	require.NotContains(t, string(content), "--show")
+}
+
+func TestOptionsFromFlags(t *testing.T) {
+	cmd, _, _ := testCommand("--output", "json", "--show")
+	opts, err := OptionsFromFlags(cmd)
+	require.NoError(t, err)
+	require.Equal(t, &Options{Output: OutputJSON, Show: true}, opts)
+
+	cmd, _, _ = testCommand("--output", "yaml")
+	_, err = OptionsFromFlags(cmd)
+	require.EqualError(t, err, `invalid output "yaml" - must be one of text, json or env`)
+
+	cmd, _, _ = testCommand("--output", "json", "--reveal-for", "10s")
+	_, err = OptionsFromFlags(cmd)
+	require.EqualError(t, err, "--reveal-for can only be used with the text output")
+}
+
+func TestPresent(t *testing.T) {
+	t.Run("write to", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "credentials.env")
+		require.NoError(t, os.WriteFile(path, []byte("old"), 0o644))
+
+		cmd, stdout, _ := testCommand()
+		err := Present(cmd, testCredentials, "civo", &Options{Output: OutputEnv, WriteTo: path})
+		require.NoError(t, err)
+		require.Empty(t, stdout.String())
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(content), `VAULT_TOKEN="hvs.root"`)
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("show requires confirmation", func(t *testing.T) {
+		cmd, stdout, _ := testCommand()
+		err := Present(cmd, testCredentials, "civo", &Options{Output: OutputJSON, Show: true})
+		require.EqualError(t, err, "printing the credentials in clear text must be confirmed - pass --yes")
+		require.Empty(t, stdout.String())
+	})
+
+	t.Run("show confirmed", func(t *testing.T) {
+		cmd, stdout, _ := testCommand()
+		err := Present(cmd, testCredentials, "civo", &Options{Output: OutputJSON, Show: true, Yes: true})
+		require.NoError(t, err)
+		require.Contains(t, stdout.String(), `"vault_root_token": "hvs.root"`)
+	})
+
+	t.Run("masked", func(t *testing.T) {
+		cmd, stdout, _ := testCommand()
+		err := Present(cmd, testCredentials, "civo", &Options{Output: OutputEnv})
+		require.NoError(t, err)
+		require.Contains(t, stdout.String(), `VAULT_TOKEN="********"`)
+	})
+
+	t.Run("reveal for", func(t *testing.T) {
+		cmd, _, stderr := testCommand()
+		err := Present(cmd, testCredentials, "civo", &Options{Output: OutputText, RevealFor: time.Millisecond, Yes: true})
+		require.NoError(t, err)
+		require.Contains(t, stderr.String(), "hvs.root")
+		require.True(t, strings.HasSuffix(stderr.String(), clearScreen))
+	})
+}
+
+func TestFromSecrets(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "argocd-initial-admin-secret", Namespace: "argocd"},
+		Data:       map[string][]byte{"password": []byte("argo-pass")},
+	})
+
+	creds := FromSecrets(context.Background(), clientset, "https://vault.kubefirst.dev", "")
+	require.Equal(t, &Credentials{ArgoCDPassword: "argo-pass"}, creds)
+}
@@ -2,15 +2,59 @@ package generate
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Statuses of the files written by Save
+const (
+	FileCreated   = "created"
+	FileUnchanged = "unchanged"
+	FileModified  = "modified"
+	FileSkipped   = "skipped"
 )
 
 type Files struct {
 	data map[string]bytes.Buffer
 }
 
+// SaveOptions decide what Save does with the files which exist with a
+// different content, it fails without writing any file by default
+type SaveOptions struct {
+	// Force overwrites them
+	Force bool
+	// SkipExisting keeps them
+	SkipExisting bool
+	// Diff writes their diff to DiffOut and no file is written
+	Diff    bool
+	DiffOut io.Writer
+}
+
+// SavedFile is the status of a file after Save
+type SavedFile struct {
+	Path   string
+	Status string
+
+	// file is the name the file was added with
+	file string
+}
+
+// SaveSummary lists the files of Save by status
+type SaveSummary struct {
+	Files []SavedFile
+	// Written is false when no file was written
+	Written bool
+}
+
 func (f *Files) Add(file string, content bytes.Buffer) {
 	if f.data == nil {
 		f.data = map[string]bytes.Buffer{}
@@ -19,18 +63,172 @@ func (f *Files) Add(file string, content bytes.Buffer) {
 	f.data[file] = content
 }
 
-func (f *Files) Save(filePrefix string) error {
-	for file, content := range f.data {
+// names returns the files in a stable order
+func (f *Files) names() []string {
+	names := make([]string, 0, len(f.data))
+	for file := range f.data {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Print writes the files to w as they would be saved under filePrefix
+func (f *Files) Print(w io.Writer, filePrefix string) error {
+	for _, file := range f.names() {
+		content := f.data[file]
+		if _, err := fmt.Fprintf(w, "# %s\n%s\n", filepath.Join(filePrefix, file), content.String()); err != nil {
+			return fmt.Errorf("failed to print file: %w", err)
+		}
+	}
+	return nil
+}
+
+// Save writes the files under filePrefix. Every file is compared with the
+// existing one first, so a conflict fails before any file is written, and
+// files are replaced atomically.
+func (f *Files) Save(filePrefix string, opts SaveOptions) (*SaveSummary, error) {
+	if opts.Force && opts.SkipExisting {
+		return nil, errors.New("force and skip existing can't be used together")
+	}
+
+	summary := &SaveSummary{}
+	var modified []string
+	for _, file := range f.names() {
 		name := filepath.Join(filePrefix, file)
+		content := f.data[file]
 
-		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
-			return fmt.Errorf("failed to create directory: %w", err)
+		existing, err := os.ReadFile(name)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			summary.Files = append(summary.Files, SavedFile{Path: name, Status: FileCreated, file: file})
+		case err != nil:
+			return nil, fmt.Errorf("failed to read existing file: %w", err)
+		case bytes.Equal(existing, content.Bytes()):
+			summary.Files = append(summary.Files, SavedFile{Path: name, Status: FileUnchanged, file: file})
+		case opts.SkipExisting:
+			summary.Files = append(summary.Files, SavedFile{Path: name, Status: FileSkipped, file: file})
+		default:
+			summary.Files = append(summary.Files, SavedFile{Path: name, Status: FileModified, file: file})
+			modified = append(modified, name)
+			if opts.Diff {
+				if err := writeDiff(opts.DiffOut, name, string(existing), content.String()); err != nil {
+					return nil, err
+				}
+			}
 		}
+	}
 
-		if err := os.WriteFile(name, content.Bytes(), 0o644); err != nil {
-			return fmt.Errorf("failed to write file: %w", err)
+	if opts.Diff {
+		return summary, nil
+	}
+	if len(modified) > 0 && !opts.Force {
+		return summary, fmt.Errorf("%d existing file(s) differ from the generated ones: %q - review them with --diff, then overwrite them with --force or keep them with --skip-existing", len(modified), modified)
+	}
+
+	for _, saved := range summary.Files {
+		if saved.Status != FileCreated && saved.Status != FileModified {
+			continue
 		}
+		content := f.data[saved.file]
+		if err := writeFileAtomic(saved.Path, content.Bytes()); err != nil {
+			return summary, err
+		}
+	}
+	summary.Written = true
+	return summary, nil
+}
+
+// writeDiff writes the unified diff of name from existing to generated
+func writeDiff(w io.Writer, name, existing, generated string) error {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(existing),
+		B:        splitLines(generated),
+		FromFile: name,
+		ToFile:   name + " (generated)",
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to diff %q: %w", name, err)
+	}
+	if _, err := io.WriteString(w, diff); err != nil {
+		return fmt.Errorf("failed to print diff: %w", err)
+	}
+	return nil
+}
+
+// splitLines splits content after its newlines, difflib.SplitLines adds an
+// empty line after a final newline
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// writeFileAtomic replaces name with content through a temporary file in
+// the same directory, keeping the mode of an existing file
+func writeFileAtomic(name string, content []byte) error {
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(name); err == nil {
+		mode = info.Mode().Perm()
 	}
 
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
 	return nil
 }
+
+// Count returns the number of files with status
+func (s *SaveSummary) Count(status string) int {
+	var count int
+	for _, file := range s.Files {
+		if file.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Table lists the files and their status, then the totals
+func (s *SaveSummary) Table() string {
+	var buf bytes.Buffer
+
+	tw := tabwriter.NewWriter(&buf, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintf(tw, "File\tStatus\n")
+	fmt.Fprintf(tw, "---\t---\n")
+	for _, file := range s.Files {
+		fmt.Fprintf(tw, "%s\t%s\n", file.Path, file.Status)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(&buf, "\n%d created, %d unchanged, %d modified, %d skipped\n",
+		s.Count(FileCreated), s.Count(FileUnchanged), s.Count(FileModified), s.Count(FileSkipped))
+	if !s.Written {
+		fmt.Fprintln(&buf, "no file was written")
+	}
+	return buf.String()
+}
@@ -0,0 +1,101 @@
+package generate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFiles(t *testing.T) (*Files, string) {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "app"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "Chart.yaml"), []byte("name: app\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app", "values.yaml"), []byte("replicas: 1\nport: 80\n"), 0o600))
+
+	files := &Files{}
+	files.Add("app.yaml", *bytes.NewBufferString("kind: Application\n"))
+	files.Add(filepath.Join("app", "Chart.yaml"), *bytes.NewBufferString("name: app\n"))
+	files.Add(filepath.Join("app", "values.yaml"), *bytes.NewBufferString("replicas: 3\nport: 80\n"))
+	return files, dir
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func TestSaveConflict(t *testing.T) {
+	files, dir := newTestFiles(t)
+
+	summary, err := files.Save(dir, SaveOptions{})
+	require.ErrorContains(t, err, "1 existing file(s) differ from the generated ones")
+	require.Equal(t, []SavedFile{
+		{Path: filepath.Join(dir, "app.yaml"), Status: FileCreated, file: "app.yaml"},
+		{Path: filepath.Join(dir, "app", "Chart.yaml"), Status: FileUnchanged, file: filepath.Join("app", "Chart.yaml")},
+		{Path: filepath.Join(dir, "app", "values.yaml"), Status: FileModified, file: filepath.Join("app", "values.yaml")},
+	}, summary.Files)
+	require.False(t, summary.Written)
+
+	// nothing is written when a file was edited
+	require.NoFileExists(t, filepath.Join(dir, "app.yaml"))
+	require.Equal(t, "replicas: 1\nport: 80\n", readFile(t, filepath.Join(dir, "app", "values.yaml")))
+}
+
+func TestSaveForce(t *testing.T) {
+	files, dir := newTestFiles(t)
+
+	summary, err := files.Save(dir, SaveOptions{Force: true})
+	require.NoError(t, err)
+	require.True(t, summary.Written)
+	require.Equal(t, "kind: Application\n", readFile(t, filepath.Join(dir, "app.yaml")))
+	require.Equal(t, "replicas: 3\nport: 80\n", readFile(t, filepath.Join(dir, "app", "values.yaml")))
+
+	// the mode of the replaced file is kept and no temporary file is left
+	info, err := os.Stat(filepath.Join(dir, "app", "values.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Join(dir, "app"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	summary, err = files.Save(dir, SaveOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 3, summary.Count(FileUnchanged))
+}
+
+func TestSaveSkipExisting(t *testing.T) {
+	files, dir := newTestFiles(t)
+
+	summary, err := files.Save(dir, SaveOptions{SkipExisting: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Count(FileCreated))
+	require.Equal(t, 1, summary.Count(FileSkipped))
+	require.Equal(t, "kind: Application\n", readFile(t, filepath.Join(dir, "app.yaml")))
+	require.Equal(t, "replicas: 1\nport: 80\n", readFile(t, filepath.Join(dir, "app", "values.yaml")))
+
+	_, err = files.Save(dir, SaveOptions{Force: true, SkipExisting: true})
+	require.ErrorContains(t, err, "can't be used together")
+}
+
+func TestSaveDiff(t *testing.T) {
+	files, dir := newTestFiles(t)
+
+	var diff bytes.Buffer
+	summary, err := files.Save(dir, SaveOptions{Diff: true, DiffOut: &diff})
+	require.NoError(t, err)
+	require.False(t, summary.Written)
+	require.NoFileExists(t, filepath.Join(dir, "app.yaml"))
+
+	values := filepath.Join(dir, "app", "values.yaml")
+	require.Equal(t, "--- "+values+"\n+++ "+values+" (generated)\n@@ -1,2 +1,2 @@\n-replicas: 1\n+replicas: 3\n port: 80\n", diff.String())
+
+	table := summary.Table()
+	require.Contains(t, table, values+" |modified")
+	require.Contains(t, table, "1 created, 1 unchanged, 1 modified, 0 skipped\nno file was written\n")
+}
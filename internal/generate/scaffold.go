@@ -2,87 +2,328 @@ package generate
 
 import (
 	"bytes"
+	"context"
 	"embed"
 	"fmt"
+	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/mod/semver"
 )
 
 //go:embed scaffold
 var scaffoldFS embed.FS
 
+// ScaffoldData is the data the scaffold templates are rendered with, once
+// per environment
 type ScaffoldData struct {
 	AppName        string
 	DeploymentName string
 	Description    string
 	Environment    string
 	Namespace      string
+
+	// Image is the image repository of the app
+	Image string
+	// Port is the port of the app service, 0 keeps the chart default
+	Port int
+	// Replicas is the number of replicas of the app, 0 keeps the chart default
+	Replicas    int
+	IngressHost string
+	Domain      string
+	// GitOwner is the git owner of the cluster the app is added to
+	GitOwner string
+	// Values are the custom values set with --set, for team-owned templates
+	Values map[string]string
 }
 
-func AppScaffold(appName string, environments []string, outputPath string) error {
-	for _, env := range environments {
-		files, err := generateAppScaffoldEnvironmentFiles(appName, env)
+// ScaffoldOptions select the templates of an app scaffold and the data
+// they are rendered with
+type ScaffoldOptions struct {
+	AppName      string
+	Environments []string
+	OutputPath   string
+
+	// TemplateDir is a local scaffold, or the scaffold directory of
+	// TemplateRepo when both are set
+	TemplateDir  string
+	TemplateRepo string
+	TemplateRef  string
+
+	Image       string
+	Port        int
+	Replicas    int
+	IngressHost string
+	Domain      string
+	GitOwner    string
+
+	// Overrides are the values set for all environments, under the key "",
+	// and for a single environment, under its name
+	Overrides map[string]map[string]string
+
+	// DryRun prints the files to Out instead of writing them
+	DryRun bool
+	Out    io.Writer
+	// Save decides what happens to the files which were edited
+	Save SaveOptions
+}
+
+// AppScaffold renders the scaffold of an app for every environment and
+// saves it, or prints it on a dry run. All the environments are saved at
+// once so an edited file fails before any file is written.
+func AppScaffold(ctx context.Context, opts ScaffoldOptions) (*SaveSummary, error) {
+	for env := range opts.Overrides {
+		if env != "" && !slices.Contains(opts.Environments, env) {
+			return nil, fmt.Errorf("values are set for environment %q which is not one of %q", env, opts.Environments)
+		}
+	}
+
+	templates, cleanup, err := scaffoldTemplates(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	files := &Files{}
+	for _, env := range opts.Environments {
+		data, err := scaffoldData(opts, env)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if err := files.Save(filepath.Join(outputPath, env)); err != nil {
-			return err
+		envFiles, err := generateAppScaffoldEnvironmentFiles(templates, data)
+		if err != nil {
+			return nil, err
+		}
+		for file, content := range envFiles.data {
+			files.Add(filepath.Join(env, file), content)
 		}
 	}
-	return nil
+
+	if opts.DryRun {
+		return nil, files.Print(opts.Out, opts.OutputPath)
+	}
+	return files.Save(opts.OutputPath, opts.Save)
 }
 
-func generateAppScaffoldEnvironmentFiles(appName, environment string) (*Files, error) {
-	rootDir := "scaffold/"
+// scaffoldTemplates returns the templates selected by opts, the embedded ones
+// when none are, and a function removing the clone of a template repository
+func scaffoldTemplates(ctx context.Context, opts ScaffoldOptions) (fs.FS, func(), error) {
+	noop := func() {}
+	switch {
+	case opts.TemplateRepo != "":
+		dir, err := os.MkdirTemp("", "kubefirst-scaffold-")
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		cleanup := func() { os.RemoveAll(dir) }
+		if err := cloneTemplateRepo(ctx, opts.TemplateRepo, opts.TemplateRef, dir); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+
+		root := filepath.Join(dir, filepath.FromSlash(opts.TemplateDir))
+		if rel, err := filepath.Rel(dir, root); err != nil || strings.HasPrefix(rel, "..") {
+			cleanup()
+			return nil, noop, fmt.Errorf("template directory %q is outside of repository %q", opts.TemplateDir, opts.TemplateRepo)
+		}
+		if err := checkTemplateDir(root); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		return os.DirFS(root), cleanup, nil
+	case opts.TemplateDir != "":
+		if err := checkTemplateDir(opts.TemplateDir); err != nil {
+			return nil, noop, err
+		}
+		return os.DirFS(opts.TemplateDir), noop, nil
+	default:
+		templates, err := fs.Sub(scaffoldFS, "scaffold")
+		if err != nil {
+			return nil, noop, fmt.Errorf("failed to read embedded scaffold: %w", err)
+		}
+		return templates, noop, nil
+	}
+}
 
-	tpl, err := template.New("tpl").ParseFS(scaffoldFS, rootDir+"*.yaml", rootDir+"**/*.yaml")
+func checkTemplateDir(dir string) error {
+	info, err := os.Stat(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create template: %w", err)
+		return fmt.Errorf("unable to read template directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("template directory %q is not a directory", dir)
 	}
+	return nil
+}
 
+// cloneTemplateRepo clones ref of url into dir, a semver ref is a tag and
+// any other ref a branch
+func cloneTemplateRepo(ctx context.Context, url, ref, dir string) error {
+	cloneOptions := &git.CloneOptions{URL: url, Depth: 1, SingleBranch: true}
+	if ref != "" {
+		cloneOptions.ReferenceName = plumbing.NewBranchReferenceName(ref)
+		if semver.IsValid(ref) {
+			cloneOptions.ReferenceName = plumbing.NewTagReferenceName(ref)
+		}
+	}
+
+	log.Info().Msgf("cloning scaffold templates %q", url)
+	if _, err := git.PlainCloneContext(ctx, dir, false, cloneOptions); err != nil {
+		return fmt.Errorf("error cloning template repository %q: %w", url, err)
+	}
+	return nil
+}
+
+// scaffoldData returns the data of env, the options with the overrides of
+// all environments and then the ones of env applied
+func scaffoldData(opts ScaffoldOptions, env string) (ScaffoldData, error) {
 	data := ScaffoldData{
-		AppName:        appName,
-		DeploymentName: fmt.Sprintf("%s-environment-%s", environment, appName),
-		Description:    fmt.Sprintf("%s example application", appName),
-		Environment:    environment,
-		Namespace:      environment,
+		AppName:        opts.AppName,
+		DeploymentName: fmt.Sprintf("%s-environment-%s", env, opts.AppName),
+		Description:    fmt.Sprintf("%s example application", opts.AppName),
+		Environment:    env,
+		Namespace:      env,
+		Image:          opts.Image,
+		Port:           opts.Port,
+		Replicas:       opts.Replicas,
+		IngressHost:    opts.IngressHost,
+		Domain:         opts.Domain,
+		GitOwner:       opts.GitOwner,
+		Values:         map[string]string{},
+	}
+
+	for _, scope := range []string{"", env} {
+		for key, value := range opts.Overrides[scope] {
+			if err := data.set(key, value); err != nil {
+				return ScaffoldData{}, fmt.Errorf("invalid value for environment %q: %w", env, err)
+			}
+		}
+	}
+
+	if data.Port < 0 || data.Port > 65535 {
+		return ScaffoldData{}, fmt.Errorf("invalid port %d", data.Port)
+	}
+	if data.Replicas < 0 {
+		return ScaffoldData{}, fmt.Errorf("invalid replicas %d", data.Replicas)
 	}
 
+	// the placeholders are the tokens of the gitops template
+	if data.Image == "" {
+		data.Image = "<CONTAINER_REGISTRY_URL>/" + data.AppName
+	}
+	if data.Domain == "" {
+		data.Domain = "<DOMAIN_NAME>"
+	}
+	if data.IngressHost == "" {
+		data.IngressHost = fmt.Sprintf("%s-%s.%s", data.AppName, env, data.Domain)
+	}
+	return data, nil
+}
+
+// set sets the field of key, keys which are not fields are custom values
+func (d *ScaffoldData) set(key, value string) error {
+	var err error
+	switch key {
+	case "image":
+		d.Image = value
+	case "port":
+		if d.Port, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid port %q", value)
+		}
+	case "replicas":
+		if d.Replicas, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid replicas %q", value)
+		}
+	case "ingress-host":
+		d.IngressHost = value
+	case "domain":
+		d.Domain = value
+	case "git-owner":
+		d.GitOwner = value
+	default:
+		d.Values[key] = value
+	}
+	return nil
+}
+
+// ParseOverrides parses values set as [<environment>.]<key>=<value>, a value
+// without environment applies to all of them
+func ParseOverrides(values []string) (map[string]map[string]string, error) {
+	overrides := map[string]map[string]string{}
+	for _, value := range values {
+		key, v, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid value %q - must be [<environment>.]<key>=<value>", value)
+		}
+		env, name, found := strings.Cut(key, ".")
+		if !found {
+			env, name = "", key
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid value %q - must be [<environment>.]<key>=<value>", value)
+		}
+		if overrides[env] == nil {
+			overrides[env] = map[string]string{}
+		}
+		overrides[env][name] = v
+	}
+	return overrides, nil
+}
+
+// generateAppScaffoldEnvironmentFiles renders templates with data, the paths
+// of the files are templates as well
+func generateAppScaffoldEnvironmentFiles(templates fs.FS, data ScaffoldData) (*Files, error) {
 	files := &Files{}
-	err = fs.WalkDir(scaffoldFS, ".", func(path string, d fs.DirEntry, err error) error {
+	err := fs.WalkDir(templates, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("error walking directory: %w", err)
 		}
 
 		if d.IsDir() {
+			if path != "." && strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
 			return nil
 		}
 
-		// Get the file name without the root path
-		file, _ := strings.CutPrefix(path, rootDir)
-
 		// Parse any template variables in the file name
-		fileTpl, err := tpl.Parse(file)
+		fileTpl, err := template.New(path).Option("missingkey=error").Parse(path)
 		if err != nil {
-			return fmt.Errorf("error parsing file name: %w", err)
+			return fmt.Errorf("error parsing file name %q: %w", path, err)
 		}
 
 		var fileNameOutput bytes.Buffer
 		if err := fileTpl.Execute(&fileNameOutput, data); err != nil {
-			return fmt.Errorf("error executing file name: %w", err)
+			return fmt.Errorf("error executing file name %q: %w", path, err)
 		}
 
 		// Parse the contents of the file
+		content, err := fs.ReadFile(templates, path)
+		if err != nil {
+			return fmt.Errorf("error reading template %q: %w", path, err)
+		}
+		tpl, err := template.New(path).Option("missingkey=error").Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("error parsing template %q: %w", path, err)
+		}
+
 		var fileContent bytes.Buffer
-		if err := tpl.ExecuteTemplate(&fileContent, d.Name(), data); err != nil {
-			return fmt.Errorf("error executing template: %w", err)
+		if err := tpl.Execute(&fileContent, data); err != nil {
+			return fmt.Errorf("error executing template %q: %w", path, err)
 		}
 
 		// Now store everything for output
-		files.Add(fileNameOutput.String(), fileContent)
+		files.Add(filepath.FromSlash(fileNameOutput.String()), fileContent)
 
 		return nil
 	})
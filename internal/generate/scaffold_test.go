@@ -1,13 +1,18 @@
 package generate
 
 import (
+	"bytes"
+	"context"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/stretchr/testify/require"
 )
 
@@ -34,7 +39,12 @@ func Test_generateAppScaffoldEnvironmentFiles(t *testing.T) {
 	for _, test := range tests {
 		goldenDir := filepath.Join(".", "testdata", "scaffold", test.Environment)
 
-		fileData, err := generateAppScaffoldEnvironmentFiles(test.Name, test.Environment)
+		templates, _, err := scaffoldTemplates(context.Background(), ScaffoldOptions{})
+		require.NoError(t, err)
+		data, err := scaffoldData(ScaffoldOptions{AppName: test.Name}, test.Environment)
+		require.NoError(t, err)
+
+		fileData, err := generateAppScaffoldEnvironmentFiles(templates, data)
 		require.Equal(t, test.Error, err)
 
 		expectedFiles := []string{}
@@ -72,3 +82,126 @@ func Test_generateAppScaffoldEnvironmentFiles(t *testing.T) {
 		require.Equal(t, expectedFiles, actualFiles)
 	}
 }
+
+func TestParseOverrides(t *testing.T) {
+	overrides, err := ParseOverrides([]string{"replicas=2", "production.replicas=5", "production.team=payments"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]string{
+		"":           {"replicas": "2"},
+		"production": {"replicas": "5", "team": "payments"},
+	}, overrides)
+
+	_, err = ParseOverrides([]string{"replicas"})
+	require.ErrorContains(t, err, `invalid value "replicas"`)
+	_, err = ParseOverrides([]string{"production.=5"})
+	require.ErrorContains(t, err, `invalid value "production.=5"`)
+}
+
+func TestAppScaffoldDryRun(t *testing.T) {
+	overrides, err := ParseOverrides([]string{"replicas=2", "production.replicas=5", "production.ingress-host=shop.example.com"})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	outputPath := t.TempDir()
+	_, err = AppScaffold(context.Background(), ScaffoldOptions{
+		AppName:      "shop",
+		Environments: []string{"development", "production"},
+		OutputPath:   outputPath,
+		Image:        "ghcr.io/platform/shop",
+		Port:         8080,
+		Domain:       "example.com",
+		Overrides:    overrides,
+		DryRun:       true,
+		Out:          &out,
+	})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(outputPath)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	printed := out.String()
+	require.Contains(t, printed, "# "+filepath.Join(outputPath, "development", "shop", "values.yaml")+"\n")
+	require.Contains(t, printed, "# "+filepath.Join(outputPath, "production", "shop.yaml")+"\n")
+	require.Contains(t, printed, "\"shop\":\n  replicaCount: 2\n")
+	require.Contains(t, printed, "\"shop\":\n  replicaCount: 5\n")
+	require.Contains(t, printed, "    repository: \"ghcr.io/platform/shop\"\n  service:\n    port: 8080\n")
+	require.Contains(t, printed, `- host: "shop-development.example.com"`)
+	require.Contains(t, printed, `- host: "shop.example.com"`)
+
+	_, err = AppScaffold(context.Background(), ScaffoldOptions{
+		AppName:      "shop",
+		Environments: []string{"development"},
+		Overrides:    overrides,
+		DryRun:       true,
+		Out:          &out,
+	})
+	require.ErrorContains(t, err, `values are set for environment "production" which is not one of ["development"]`)
+}
+
+func TestAppScaffoldTemplateDir(t *testing.T) {
+	templateDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(templateDir, "{{ .AppName }}"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "{{ .AppName }}", "values.yaml"), []byte("owner: {{ .GitOwner }}\nteam: {{ .Values.team }}\n"), 0o644))
+
+	outputPath := t.TempDir()
+	opts := ScaffoldOptions{
+		AppName:      "shop",
+		Environments: []string{"staging"},
+		OutputPath:   outputPath,
+		TemplateDir:  templateDir,
+		GitOwner:     "platform",
+		Overrides:    map[string]map[string]string{"staging": {"team": "payments"}},
+	}
+	_, err := AppScaffold(context.Background(), opts)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(outputPath, "staging", "shop", "values.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "owner: platform\nteam: payments\n", string(content))
+
+	opts.Overrides = nil
+	_, err = AppScaffold(context.Background(), opts)
+	require.ErrorContains(t, err, `map has no entry for key "team"`)
+
+	opts.TemplateDir = filepath.Join(templateDir, "missing")
+	_, err = AppScaffold(context.Background(), opts)
+	require.ErrorContains(t, err, "unable to read template directory")
+}
+
+func TestAppScaffoldTemplateRepo(t *testing.T) {
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, "scaffolds", "web"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "scaffolds", "web", "{{ .AppName }}.yaml"), []byte("env: {{ .Environment }}\n"), 0o644))
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = worktree.Add("scaffolds")
+	require.NoError(t, err)
+	_, err = worktree.Commit("add web scaffold", &git.CommitOptions{Author: &object.Signature{Name: "kbot", Email: "kbot@example.com", When: time.Now()}})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	_, err = AppScaffold(context.Background(), ScaffoldOptions{
+		AppName:      "shop",
+		Environments: []string{"development"},
+		OutputPath:   "registry",
+		TemplateRepo: repoDir,
+		TemplateDir:  "scaffolds/web",
+		DryRun:       true,
+		Out:          &out,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "# "+filepath.Join("registry", "development", "shop.yaml")+"\nenv: development\n\n", out.String())
+
+	_, err = AppScaffold(context.Background(), ScaffoldOptions{
+		AppName:      "shop",
+		Environments: []string{"development"},
+		TemplateRepo: repoDir,
+		TemplateDir:  "../outside",
+		DryRun:       true,
+		Out:          &out,
+	})
+	require.ErrorContains(t, err, "is outside of repository")
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// bitbucketRequiredScopes are the scopes of an OAuth or access token
+// kubefirst needs
+var bitbucketRequiredScopes = []string{
+	"repository:admin",
+	"repository:write",
+	"webhook",
+}
+
+// bitbucketProvider serves Bitbucket Cloud, where workspaces own the
+// repositories
+type bitbucketProvider struct {
+	host  *Host
+	api   *restClient
+	token string
+}
+
+func newBitbucketProvider(host *Host, token string) *bitbucketProvider {
+	return &bitbucketProvider{host: host, api: newRESTClient(host.APIURL, "Bearer "+token), token: token}
+}
+
+func (p *bitbucketProvider) Host() *Host {
+	return p.host
+}
+
+func (p *bitbucketProvider) ValidateCredentials(ctx context.Context, owner string) (types.GitAuth, error) {
+	gitAuth := types.GitAuth{Token: p.token, Owner: owner}
+
+	log.Info().Msg("verifying Bitbucket authentication")
+	user, err := p.VerifyToken(ctx)
+	if err != nil {
+		return gitAuth, err
+	}
+	gitAuth.User = user
+
+	if _, err := p.CheckOwner(ctx, owner, user); err != nil {
+		return gitAuth, err
+	}
+	return gitAuth, nil
+}
+
+func (p *bitbucketProvider) VerifyToken(ctx context.Context) (string, error) {
+	var user struct {
+		Username string `json:"username"`
+	}
+	resp, err := p.api.get(ctx, "/user", &user)
+	if err != nil {
+		return "", fmt.Errorf("error getting Bitbucket user - please make sure BITBUCKET_TOKEN is set: %w", err)
+	}
+
+	// app passwords don't report their scopes
+	if header := resp.Header.Get("X-OAuth-Scopes"); header != "" {
+		var scopes []string
+		for _, scope := range strings.Split(header, ",") {
+			scopes = append(scopes, strings.TrimSpace(scope))
+		}
+		var missingScopes []string
+		for _, scope := range bitbucketRequiredScopes {
+			if !slices.Contains(scopes, scope) {
+				missingScopes = append(missingScopes, scope)
+			}
+		}
+		if len(missingScopes) > 0 {
+			return "", fmt.Errorf("the supplied bitbucket token is missing authorization scopes - please add: %v", missingScopes)
+		}
+	}
+	return user.Username, nil
+}
+
+func (p *bitbucketProvider) CheckOwner(ctx context.Context, owner, _ string) (string, error) {
+
+	var permissions struct {
+		Values []struct {
+			Permission string `json:"permission"`
+		} `json:"values"`
+	}
+	path := "/user/permissions/workspaces?q=" + url.QueryEscape(fmt.Sprintf("workspace.slug=%q", owner))
+	if _, err := p.api.get(ctx, path, &permissions); err != nil {
+		return "", fmt.Errorf("error getting Bitbucket workspace permissions: %w", err)
+	}
+	if len(permissions.Values) == 0 {
+		return "", fmt.Errorf("could not find bitbucket workspace %s", owner)
+	}
+	role := permissions.Values[0].Permission
+	if role != "owner" {
+		return role, fmt.Errorf("authenticated user (via BITBUCKET_TOKEN) doesn't have adequate permissions - make sure they are an owner of the %s workspace, current role: %s", owner, role)
+	}
+	return role, nil
+}
+
+func (p *bitbucketProvider) ExistingRepositories(ctx context.Context, owner string, names []string) ([]string, error) {
+	var existing []string
+	for _, name := range names {
+		found, err := p.api.exists(ctx, fmt.Sprintf("/repositories/%s/%s", url.PathEscape(owner), url.PathEscape(name)))
+		if err != nil {
+			return nil, fmt.Errorf("error checking repository %q: %w", p.host.RepositoryURL(owner, name), err)
+		}
+		if found {
+			existing = append(existing, name)
+		}
+	}
+	return existing, nil
+}
+
+func (p *bitbucketProvider) RepositoryEmpty(ctx context.Context, owner, name string) (bool, error) {
+	var branches struct {
+		Values []any `json:"values"`
+	}
+	path := fmt.Sprintf("/repositories/%s/%s/refs/branches?pagelen=1", url.PathEscape(owner), url.PathEscape(name))
+	if _, err := p.api.get(ctx, path, &branches); err != nil {
+		return false, fmt.Errorf("error listing branches of repository %q: %w", p.host.RepositoryURL(owner, name), err)
+	}
+	return len(branches.Values) == 0, nil
+}
+
+// ExistingTeams returns no teams, the 2.0 API of Bitbucket Cloud has no
+// workspace groups so there is nothing to collide with
+func (p *bitbucketProvider) ExistingTeams(_ context.Context, _ string, _ []string) ([]string, error) {
+	return nil, nil
+}
+
+func (p *bitbucketProvider) RegistryCredentials(_ context.Context, _ types.GitAuth) (*RegistryCredentials, error) {
+	return nil, fmt.Errorf("bitbucket: %w", ErrNoRegistry)
+}
+
+// CheckRegistryAccess fails with ErrNoRegistry, Bitbucket Cloud has no
+// container registry
+func (p *bitbucketProvider) CheckRegistryAccess(_ context.Context, _ string) error {
+	return fmt.Errorf("bitbucket: %w", ErrNoRegistry)
+}
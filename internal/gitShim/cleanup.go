@@ -0,0 +1,145 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Kinds of the git resources kubefirst creates
+const (
+	ResourceRepository  = "repository"
+	ResourceWebhook     = "webhook"
+	ResourceTeam        = "team"
+	ResourceSubgroup    = "subgroup"
+	ResourceDeployToken = "deploy token"
+	ResourceSSHKey      = "ssh key"
+)
+
+// Resource is a git resource kubefirst created for a cluster
+type Resource struct {
+	Kind string
+	Name string
+	URL  string
+
+	remove func(ctx context.Context) error
+}
+
+// Keys of the git resources recorded in the kubefirst config
+const (
+	ownerKey         = "git.owner"
+	repositoriesKey  = "git.repositories"
+	teamsKey         = "git.teams"
+	deployTokenIDKey = "git.registry-deploy-token-id"
+)
+
+// CleanupOptions select the resources of a cluster. Only resources recorded
+// when the cluster was created are selected, as the names kubefirst uses are
+// common ones an owner may have created on their own.
+type CleanupOptions struct {
+	Owner        string
+	Repositories []string
+	Teams        []string
+	// KbotPublicKey matches the kbot SSH key by its content, the key pair is
+	// generated for the cluster
+	KbotPublicKey string
+	// DeployTokenID is the GitLab group deploy token of the registry, 0 when
+	// none was created
+	DeployTokenID int
+}
+
+// Cleaner is a git provider which lists and deletes the resources kubefirst
+// created, whether or not terraform state exists
+type Cleaner interface {
+	// Inventory returns the resources of opts that exist, in the order
+	// they can be deleted in
+	Inventory(ctx context.Context, opts CleanupOptions) ([]Resource, error)
+}
+
+var (
+	_ Cleaner = (*gitHubProvider)(nil)
+	_ Cleaner = (*gitLabProvider)(nil)
+)
+
+// recordResources records the repositories and teams of owner the git
+// credentials check found free
+func recordResources(owner string, repositories, teams []string) error {
+	viper.Set(ownerKey, owner)
+	viper.Set(repositoriesKey, repositories)
+	viper.Set(teamsKey, teams)
+	if err := viper.WriteConfig(); err != nil {
+		return fmt.Errorf("error writing git provider config: %w", err)
+	}
+	return nil
+}
+
+// RecordedResources returns the resources recorded for the cluster of the
+// kubefirst config, nil when its git credentials were never checked
+func RecordedResources() *CleanupOptions {
+	owner := viper.GetString(ownerKey)
+	if owner == "" {
+		return nil
+	}
+	return &CleanupOptions{
+		Owner:         owner,
+		Repositories:  viper.GetStringSlice(repositoriesKey),
+		Teams:         viper.GetStringSlice(teamsKey),
+		KbotPublicKey: viper.GetString("kbot.public-key"),
+		DeployTokenID: viper.GetInt(deployTokenIDKey),
+	}
+}
+
+// ForgetResources removes the recorded resources once they are deleted
+func ForgetResources() error {
+	for _, key := range []string{ownerKey, repositoriesKey, teamsKey, deployTokenIDKey} {
+		viper.Set(key, "")
+	}
+	if err := viper.WriteConfig(); err != nil {
+		return fmt.Errorf("error writing git provider config: %w", err)
+	}
+	return nil
+}
+
+// Inventory returns the resources kubefirst created with provider
+func Inventory(ctx context.Context, provider GitProvider, opts CleanupOptions) ([]Resource, error) {
+	cleaner, ok := provider.(Cleaner)
+	if !ok {
+		return nil, fmt.Errorf("cleaning up git provider %q is not supported - use one of %q", provider.Host().Provider, ProvisioningProviders)
+	}
+	resources, err := cleaner.Inventory(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the git resources of %s: %w", opts.Owner, err)
+	}
+	return resources, nil
+}
+
+// Cleanup deletes resources, a resource that can't be deleted doesn't stop
+// the others and its error is returned
+func Cleanup(ctx context.Context, resources []Resource) error {
+	var errs []error
+	for _, resource := range resources {
+		log.Info().Msgf("deleting %s %s", resource.Kind, resource.Name)
+		if err := resource.remove(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error deleting %s %s: %w", resource.Kind, resource.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isKbotKey reports whether the SSH key with content key is the kbot key of
+// the cluster
+func isKbotKey(key, kbotPublicKey string) bool {
+	kbotPublicKey = strings.TrimSpace(kbotPublicKey)
+	// the API returns the key without its comment
+	return kbotPublicKey != "" && strings.HasPrefix(kbotPublicKey, strings.TrimSpace(key))
+}
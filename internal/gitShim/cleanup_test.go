@@ -0,0 +1,119 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitHubInventory(t *testing.T) {
+	bodies := map[string]any{
+		"/api/v3/repos/platform/gitops":       map[string]any{"name": "gitops"},
+		"/api/v3/repos/platform/gitops/hooks": []map[string]any{{"id": 5, "config": map[string]any{"url": "https://atlantis.example.com/events"}}},
+		"/api/v3/orgs/platform/teams/admins":  map[string]any{"slug": "admins"},
+		"/api/v3/user/keys": []map[string]any{
+			{"id": 1, "title": "laptop", "key": "ssh-ed25519 AAAAlaptop"},
+			{"id": 2, "title": "kbot-ssh-key", "key": "ssh-ed25519 AAAAold"},
+			{"id": 3, "title": "kbot", "key": "ssh-ed25519 AAAAkbot"},
+		},
+	}
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	host, err := NewHost("github", "github.example.com", server.URL+"/api/v3")
+	require.NoError(t, err)
+	provider, err := NewGitProvider(host, "token")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	resources, err := Inventory(ctx, provider, CleanupOptions{
+		Owner:         "platform",
+		Repositories:  []string{"gitops", "metaphor"},
+		Teams:         []string{"admins", "developers"},
+		KbotPublicKey: "ssh-ed25519 AAAAkbot kbot@example.com\n",
+	})
+	require.NoError(t, err)
+
+	var kinds, names []string
+	for _, resource := range resources {
+		kinds = append(kinds, resource.Kind)
+		names = append(names, resource.Name)
+	}
+	// the kbot-ssh-key of another cluster is kept
+	require.Equal(t, []string{ResourceWebhook, ResourceRepository, ResourceTeam, ResourceSSHKey}, kinds)
+	require.Equal(t, []string{"gitops -> https://atlantis.example.com/events", "gitops", "admins", "kbot"}, names)
+	require.Equal(t, "https://github.example.com/platform/gitops/settings/hooks/5", resources[0].URL)
+
+	require.NoError(t, Cleanup(ctx, resources))
+	require.Equal(t, []string{
+		"/api/v3/repos/platform/gitops/hooks/5",
+		"/api/v3/repos/platform/gitops",
+		"/api/v3/orgs/platform/teams/admins",
+		"/api/v3/user/keys/3",
+	}, deleted)
+
+	// without a recorded kbot key no SSH key is listed
+	resources, err = Inventory(ctx, provider, CleanupOptions{Owner: "platform"})
+	require.NoError(t, err)
+	require.Empty(t, resources)
+}
+
+func TestRecordedResources(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	config := filepath.Join(t.TempDir(), "kubefirst.yaml")
+	require.NoError(t, os.WriteFile(config, nil, 0o644))
+	viper.SetConfigFile(config)
+
+	require.Nil(t, RecordedResources())
+
+	viper.Set("kbot.public-key", "ssh-ed25519 AAAAkbot")
+	require.NoError(t, recordResources("platform", DefaultRepositoryNames, DefaultTeamNames))
+	viper.Set(deployTokenIDKey, 42)
+	require.Equal(t, &CleanupOptions{
+		Owner:         "platform",
+		Repositories:  DefaultRepositoryNames,
+		Teams:         DefaultTeamNames,
+		KbotPublicKey: "ssh-ed25519 AAAAkbot",
+		DeployTokenID: 42,
+	}, RecordedResources())
+
+	require.NoError(t, ForgetResources())
+	require.Nil(t, RecordedResources())
+}
+
+func TestInventoryUnsupported(t *testing.T) {
+	host, err := NewHost("gitea", "git.example.com", "")
+	require.NoError(t, err)
+	provider, err := NewGitProvider(host, "token")
+	require.NoError(t, err)
+
+	_, err = Inventory(context.Background(), provider, CleanupOptions{Owner: "platform"})
+	require.ErrorContains(t, err, `cleaning up git provider "gitea" is not supported`)
+}
@@ -7,11 +7,12 @@ See the LICENSE file for more details.
 package gitShim //nolint:revive // allowed during refactoring
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 
-	"github.com/konstructio/kubefirst-api/pkg/gitlab"
 	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	"github.com/konstructio/kubefirst-api/pkg/types"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -27,62 +28,71 @@ type ContainerRegistryAuth struct {
 	GitlabGroupFlag       string
 	GithubOwner           string
 	ContainerRegistryHost string
+	// Host is the git server, the public host of GitProvider when nil
+	Host *Host
 
 	Clientset kubernetes.Interface
 }
 
-// CreateContainerRegistrySecret
-func CreateContainerRegistrySecret(obj *ContainerRegistryAuth) (string, error) {
-	// Handle secret creation for container registry authentication
-	switch obj.GitProvider {
-	// GitHub docker auth secret
-	// kaniko requires a specific format for Docker auth created as a secret
-	// For GitHub, this becomes the provided token (pat)
-	case "github":
-		usernamePasswordString := fmt.Sprintf("%s:%s", obj.GitUser, obj.GitToken)
-		usernamePasswordStringB64 := base64.StdEncoding.EncodeToString([]byte(usernamePasswordString))
-		dockerConfigString := fmt.Sprintf(`{"auths": {"%s": {"username": %q, "password": %q, "email": %q, "auth": %q}}}`,
-			obj.ContainerRegistryHost,
-			obj.GithubOwner,
-			obj.GitToken,
-			"k-bot@example.com",
-			usernamePasswordStringB64,
-		)
-
-		data := map[string][]byte{"config.json": []byte(dockerConfigString)}
-		argoDeployTokenSecret := &v1.Secret{
-			ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: "argo"},
-			Data:       data,
-			Type:       "Opaque",
-		}
-		err := k8s.CreateSecretV2(obj.Clientset, argoDeployTokenSecret)
-		if errors.IsAlreadyExists(err) {
-			if err := k8s.UpdateSecretV2(obj.Clientset, "argo", secretName, data); err != nil {
-				return "", fmt.Errorf("error while updating secret for GitHub container registry auth: %w", err)
-			}
+// CreateContainerRegistrySecret creates the docker config kaniko pushes
+// images with. GitLab gets a group deploy token instead, which is returned for
+// the vault terraform to store.
+func CreateContainerRegistrySecret(ctx context.Context, obj *ContainerRegistryAuth) (string, error) {
+	host := obj.Host
+	if host == nil {
+		var err error
+		if host, err = NewHost(obj.GitProvider, "", ""); err != nil {
+			return "", err
 		}
+	}
+	provider, err := NewGitProvider(host, obj.GitToken)
+	if err != nil {
+		return "", err
+	}
 
-		if err != nil && !errors.IsAlreadyExists(err) {
-			return "", fmt.Errorf("error while creating secret for GitHub container registry auth: %w", err)
-		}
+	owner := obj.GithubOwner
+	if obj.GitProvider == "gitlab" {
+		owner = obj.GitlabGroupFlag
+	}
+	credentials, err := provider.RegistryCredentials(ctx, types.GitAuth{Token: obj.GitToken, User: obj.GitUser, Owner: owner})
+	if err != nil {
+		return "", fmt.Errorf("error getting container registry credentials: %w", err)
+	}
+	if obj.GitProvider == "gitlab" {
+		return credentials.Password, nil
+	}
 
-	case "gitlab":
-		gitlabClient, err := gitlab.NewGitLabClient(obj.GitToken, obj.GitlabGroupFlag)
-		if err != nil {
-			return "", fmt.Errorf("error while creating GitLab client: %w", err)
-		}
+	registryHost := credentials.Host
+	if obj.ContainerRegistryHost != "" {
+		registryHost = obj.ContainerRegistryHost
+	}
 
-		p := gitlab.DeployTokenCreateParameters{
-			Name:     secretName,
-			Username: secretName,
-			Scopes:   []string{"read_registry", "write_registry"},
-		}
-		token, err := gitlabClient.CreateGroupDeployToken(0, &p)
-		if err != nil {
-			return "", fmt.Errorf("error while creating GitLab group deploy token: %w", err)
+	// kaniko requires a specific format for Docker auth created as a secret
+	usernamePasswordString := fmt.Sprintf("%s:%s", credentials.Username, credentials.Password)
+	usernamePasswordStringB64 := base64.StdEncoding.EncodeToString([]byte(usernamePasswordString))
+	dockerConfigString := fmt.Sprintf(`{"auths": {"%s": {"username": %q, "password": %q, "email": %q, "auth": %q}}}`,
+		registryHost,
+		credentials.Username,
+		credentials.Password,
+		"k-bot@example.com",
+		usernamePasswordStringB64,
+	)
+
+	data := map[string][]byte{"config.json": []byte(dockerConfigString)}
+	argoDeployTokenSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: "argo"},
+		Data:       data,
+		Type:       "Opaque",
+	}
+	err = k8s.CreateSecretV2(obj.Clientset, argoDeployTokenSecret)
+	if errors.IsAlreadyExists(err) {
+		if err := k8s.UpdateSecretV2(obj.Clientset, "argo", secretName, data); err != nil {
+			return "", fmt.Errorf("error while updating secret for container registry auth: %w", err)
 		}
+	}
 
-		return token, nil
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("error while creating secret for container registry auth: %w", err)
 	}
 
 	return "", nil
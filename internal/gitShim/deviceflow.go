@@ -0,0 +1,137 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/konstructio/kubefirst-api/pkg/reports"
+	utils "github.com/konstructio/kubefirst-api/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// gitHubOAuthClientID is the OAuth app of kubefirst the device flow
+// authorizes, the same the kubefirst API uses
+const gitHubOAuthClientID = "2ced340927e0a6c49a45"
+
+// gitHubDeviceFlowScopes are the scopes the device flow requests
+const gitHubDeviceFlowScopes = "repo public_repo admin:repo_hook admin:org admin:public_key admin:org_hook user project delete_repo write:packages admin:gpg_key workflow"
+
+// gitHubDeviceFlowURL is the base url of the github.com device flow, a
+// variable to be replaced in tests
+var gitHubDeviceFlowURL = "https://github.com"
+
+// gitHubDeviceFlowInterval is the time between two polls of the access token
+var gitHubDeviceFlowInterval = 5 * time.Second
+
+// openBrowser opens the verification page, a variable to be replaced in tests
+var openBrowser = utils.OpenBrowser
+
+// gitHubDeviceFlowAttempts bounds the polls of the access token to 90 seconds
+const gitHubDeviceFlowAttempts = 18
+
+type gitHubDeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+}
+
+type gitHubAccessToken struct {
+	AccessToken string `json:"access_token"`
+}
+
+// AuthenticateGitHubUser runs the github.com device flow with client and
+// returns the access token the user authorized in the browser
+func AuthenticateGitHubUser(ctx context.Context, client *http.Client) (string, error) {
+	var code gitHubDeviceCode
+	err := postGitHubDeviceFlow(ctx, client, "/login/device/code", map[string]string{
+		"client_id": gitHubOAuthClientID,
+		"scope":     gitHubDeviceFlowScopes,
+	}, &code)
+	if err != nil {
+		return "", fmt.Errorf("error requesting a GitHub device code: %w", err)
+	}
+
+	fmt.Println(reports.StyleMessage(gitHubDeviceFlowReport(code.UserCode, code.VerificationURI)))
+	if err := openBrowser(code.VerificationURI); err != nil {
+		log.Error().Msgf("error opening browser: %s", err)
+		return "", fmt.Errorf("error opening browser: %w", err)
+	}
+
+	for i := 0; i < gitHubDeviceFlowAttempts; i++ {
+		var token gitHubAccessToken
+		err := postGitHubDeviceFlow(ctx, client, "/login/oauth/access_token", map[string]string{
+			"client_id":   gitHubOAuthClientID,
+			"device_code": code.DeviceCode,
+			"grant_type":  "urn:ietf:params:oauth:grant-type:device_code",
+		}, &token)
+		if err != nil {
+			log.Warn().Msgf("%s", err)
+		}
+		if token.AccessToken != "" {
+			fmt.Printf("\n\nGitHub access token set!\n\n")
+			return token.AccessToken, nil
+		}
+
+		fmt.Printf("\rwaiting for authorization (%d seconds)", int(gitHubDeviceFlowInterval.Seconds())*(gitHubDeviceFlowAttempts-i))
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("GitHub authorization canceled: %w", ctx.Err())
+		case <-time.After(gitHubDeviceFlowInterval):
+		}
+	}
+	fmt.Println("")
+	return "", errors.New("unable to retrieve a GitHub token for the user")
+}
+
+// postGitHubDeviceFlow posts body to path of the device flow and decodes the
+// response into out
+func postGitHubDeviceFlow(ctx context.Context, client *http.Client, path string, body map[string]string, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error marshalling request body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gitHubDeviceFlowURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling GitHub: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from GitHub: %s", res.Status)
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding GitHub response: %w", err)
+	}
+	return nil
+}
+
+func gitHubDeviceFlowReport(userCode, verificationURI string) string {
+	var report bytes.Buffer
+	report.WriteString(strings.Repeat("-", 69))
+	report.WriteString("\nNo GITHUB_TOKEN env variable found!\nUse the code below to get a temporary GitHub Access Token\nThis token will be used by Kubefirst to create your environment\n")
+	report.WriteString("\n\nA GitHub Access Token is required to provision GitHub repositories and run workflows in GitHub.\n")
+	report.WriteString(strings.Repeat("-", 69) + "\n")
+	report.WriteString("1. Copy this code: 📋 " + userCode + " 📋\n\n")
+	report.WriteString(fmt.Sprintf("2. The page at %s opens in your browser\n\n", verificationURI))
+	report.WriteString("3. Authorize the organization you'll be using Kubefirst with - this may also be your personal account")
+	return report.String()
+}
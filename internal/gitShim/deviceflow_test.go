@@ -0,0 +1,60 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthenticateGitHubUser(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, gitHubOAuthClientID, body["client_id"])
+
+		switch r.URL.Path {
+		case "/login/device/code":
+			w.Write([]byte(`{"device_code":"device","user_code":"ABCD-1234","verification_uri":"https://github.com/login/device"}`))
+		case "/login/oauth/access_token":
+			require.Equal(t, "device", body["device_code"])
+			polls++
+			if polls < 2 {
+				w.Write([]byte(`{"error":"authorization_pending"}`))
+				return
+			}
+			w.Write([]byte(`{"access_token":"gho_token"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var opened string
+	defer func(url string, interval time.Duration, open func(string) error) {
+		gitHubDeviceFlowURL, gitHubDeviceFlowInterval, openBrowser = url, interval, open
+	}(gitHubDeviceFlowURL, gitHubDeviceFlowInterval, openBrowser)
+	gitHubDeviceFlowURL = server.URL
+	gitHubDeviceFlowInterval = time.Millisecond
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	token, err := AuthenticateGitHubUser(context.Background(), server.Client())
+	require.NoError(t, err)
+	require.Equal(t, "gho_token", token)
+	require.Equal(t, "https://github.com/login/device", opened)
+	require.Equal(t, 2, polls)
+}
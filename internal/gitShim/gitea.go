@@ -0,0 +1,139 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// giteaProvider serves Gitea and Forgejo, which share the same API
+type giteaProvider struct {
+	host  *Host
+	api   *restClient
+	token string
+}
+
+func newGiteaProvider(host *Host, token string) *giteaProvider {
+	return &giteaProvider{host: host, api: newRESTClient(host.APIURL, "token "+token), token: token}
+}
+
+func (p *giteaProvider) Host() *Host {
+	return p.host
+}
+
+func (p *giteaProvider) ValidateCredentials(ctx context.Context, owner string) (types.GitAuth, error) {
+	gitAuth := types.GitAuth{Token: p.token, Owner: owner}
+
+	log.Info().Msgf("verifying Gitea authentication with %s", p.host.Name)
+	user, err := p.VerifyToken(ctx)
+	if err != nil {
+		return gitAuth, err
+	}
+	gitAuth.User = user
+
+	if _, err := p.CheckOwner(ctx, owner, user); err != nil {
+		return gitAuth, err
+	}
+	return gitAuth, nil
+}
+
+func (p *giteaProvider) VerifyToken(ctx context.Context) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if _, err := p.api.get(ctx, "/user", &user); err != nil {
+		return "", fmt.Errorf("error getting Gitea user - please make sure GITEA_TOKEN is set and has the read:user scope: %w", err)
+	}
+	return user.Login, nil
+}
+
+func (p *giteaProvider) CheckOwner(ctx context.Context, owner, user string) (string, error) {
+	var permissions struct {
+		IsOwner             bool `json:"is_owner"`
+		CanCreateRepository bool `json:"can_create_repository"`
+	}
+	path := fmt.Sprintf("/users/%s/orgs/%s/permissions", url.PathEscape(user), url.PathEscape(owner))
+	if _, err := p.api.get(ctx, path, &permissions); err != nil {
+		if errors.Is(err, errNotFound) {
+			return "", fmt.Errorf("could not find gitea organization %s on %s", owner, p.host.Name)
+		}
+		return "", fmt.Errorf("error getting Gitea organization permissions - the token needs the read:organization scope: %w", err)
+	}
+	switch {
+	case permissions.IsOwner && permissions.CanCreateRepository:
+		return "owner", nil
+	case permissions.IsOwner:
+		return "owner", fmt.Errorf("authenticated user (via GITEA_TOKEN) can't create repositories in %s", owner)
+	default:
+		return "member", fmt.Errorf("authenticated user (via GITEA_TOKEN) doesn't have adequate permissions - make sure they are an `Owner` of %s", owner)
+	}
+}
+
+// CheckRegistryAccess fails with ErrRegistryUnverified, the token pushes to
+// the registry when it has the write:package scope but Gitea doesn't list the
+// scopes of a token
+func (p *giteaProvider) CheckRegistryAccess(_ context.Context, _ string) error {
+	return fmt.Errorf("gitea needs the write:package scope: %w", ErrRegistryUnverified)
+}
+
+func (p *giteaProvider) ExistingRepositories(ctx context.Context, owner string, names []string) ([]string, error) {
+	var existing []string
+	for _, name := range names {
+		found, err := p.api.exists(ctx, fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(name)))
+		if err != nil {
+			return nil, fmt.Errorf("error checking repository %q: %w", p.host.RepositoryURL(owner, name), err)
+		}
+		if found {
+			existing = append(existing, name)
+		}
+	}
+	return existing, nil
+}
+
+func (p *giteaProvider) RepositoryEmpty(ctx context.Context, owner, name string) (bool, error) {
+	var repository struct {
+		Empty bool `json:"empty"`
+	}
+	if _, err := p.api.get(ctx, fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(name)), &repository); err != nil {
+		return false, fmt.Errorf("error getting repository %q: %w", p.host.RepositoryURL(owner, name), err)
+	}
+	return repository.Empty, nil
+}
+
+func (p *giteaProvider) ExistingTeams(ctx context.Context, owner string, names []string) ([]string, error) {
+	var existing []string
+	for page := 1; ; page++ {
+		var teams []struct {
+			Name string `json:"name"`
+		}
+		path := fmt.Sprintf("/orgs/%s/teams?page=%d&limit=50", url.PathEscape(owner), page)
+		if _, err := p.api.get(ctx, path, &teams); err != nil {
+			return nil, fmt.Errorf("could not get teams of gitea organization %s: %w", owner, err)
+		}
+		for _, team := range teams {
+			if slices.Contains(names, team.Name) {
+				existing = append(existing, team.Name)
+			}
+		}
+		if len(teams) < 50 {
+			return existing, nil
+		}
+	}
+}
+
+// RegistryCredentials returns the token, the container registry of Gitea
+// accepts it as a password when it has the write:package scope
+func (p *giteaProvider) RegistryCredentials(_ context.Context, auth types.GitAuth) (*RegistryCredentials, error) {
+	return &RegistryCredentials{Host: p.host.ContainerRegistryHost(), Username: auth.User, Password: auth.Token}, nil
+}
@@ -0,0 +1,447 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v52/github"
+	"github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/konstructio/kubefirst/internal/httpclient"
+	"github.com/rs/zerolog/log"
+)
+
+// gitHubRequiredScopes are the scopes of a classic token kubefirst needs
+var gitHubRequiredScopes = []string{
+	"admin:org",
+	"admin:public_key",
+	"admin:repo_hook",
+	"delete_repo",
+	"repo",
+	"user",
+	"workflow",
+	"write:packages",
+}
+
+// tokenTransport authenticates every request with a bearer token
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req) //nolint:wrapcheck // the transport error is returned as is
+}
+
+// ErrGitHubInstallationToken is returned for the token of a GitHub App
+// installation, kubefirst stores the token in the cluster and an
+// installation token expires after an hour
+var ErrGitHubInstallationToken = errors.New("github app installation tokens expire after an hour and can't be stored in the cluster - use a fine-grained personal access token")
+
+// GitHubClient returns a GitHub client of the host authenticated with token
+func (h *Host) GitHubClient(token string) (*github.Client, error) {
+	if strings.HasPrefix(token, "ghs_") {
+		return nil, ErrGitHubInstallationToken
+	}
+
+	httpClient := httpclient.New()
+	httpClient.Transport = &tokenTransport{token: token, base: httpClient.Transport}
+
+	if h.APIURL == gitHubAPIURL {
+		return github.NewClient(httpClient), nil
+	}
+	client, err := github.NewEnterpriseClient(h.APIURL+"/", h.APIURL+"/", httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("error creating GitHub client for %q: %w", h.APIURL, err)
+	}
+	return client, nil
+}
+
+// VerifyGitHubToken verifies token has the scopes kubefirst needs and returns
+// the user it belongs to
+func VerifyGitHubToken(ctx context.Context, client *github.Client) (string, error) {
+	req, err := client.NewRequest(http.MethodGet, "", nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to create request to verify token permissions: %w", err)
+	}
+	resp, err := client.Do(ctx, req, nil)
+	if err != nil {
+		return "", fmt.Errorf("error calling GitHub API %q: %w", client.BaseURL, err)
+	}
+
+	// fine-grained tokens have permissions instead of scopes, they are
+	// probed on the owner with CheckGitHubTokenPermissions
+	if scopes, classic := gitHubScopes(resp); classic {
+		var missingScopes []string
+		for _, scope := range gitHubRequiredScopes {
+			if !slices.Contains(scopes, scope) {
+				missingScopes = append(missingScopes, scope)
+			}
+		}
+		if len(missingScopes) > 0 {
+			return "", fmt.Errorf("the supplied github token is missing authorization scopes - please add: %v", missingScopes)
+		}
+	} else {
+		log.Info().Msg("the github token is fine-grained, its permissions are probed on the owner")
+	}
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("error getting GitHub user: %w", err)
+	}
+	if user.GetLogin() == "" {
+		return "", errors.New("unable to retrieve username via GitHub API")
+	}
+	log.Info().Msgf("GitHub user: %s", user.GetLogin())
+	return user.GetLogin(), nil
+}
+
+// gitHubScopes returns the scopes of the token of resp, classic is false for
+// fine-grained tokens which have none
+func gitHubScopes(resp *github.Response) (scopes []string, classic bool) {
+	if _, classic = resp.Header["X-Oauth-Scopes"]; !classic {
+		return nil, false
+	}
+	for _, scope := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		scopes = append(scopes, strings.TrimSpace(scope))
+	}
+	return scopes, true
+}
+
+// gitHubFineGrained reports whether token is a fine-grained personal access
+// token, which has permissions on a single owner instead of scopes
+func gitHubFineGrained(token string) bool {
+	return strings.HasPrefix(token, "github_pat_")
+}
+
+// gitHubProbe is a read request which fails without permission
+type gitHubProbe struct {
+	permission string
+	request    func() (*github.Response, error)
+}
+
+// CheckGitHubTokenPermissions probes the permissions kubefirst needs on owner
+// when token is fine-grained, a classic token is verified by its scopes. A
+// probe is a read request, it finds a permission that isn't granted but can't
+// tell read from write access, and Contents and Workflows have no request to
+// probe them with
+func CheckGitHubTokenPermissions(ctx context.Context, client *github.Client, token, owner string) error {
+	if !gitHubFineGrained(token) {
+		return nil
+	}
+
+	account, _, err := client.Users.Get(ctx, owner)
+	if err != nil {
+		return fmt.Errorf("error getting GitHub account %q: %w", owner, err)
+	}
+	organization := account.GetType() == "Organization"
+
+	one := github.ListOptions{PerPage: 1}
+	containers := &github.PackageListOptions{PackageType: github.String("container"), ListOptions: one}
+	var probes []gitHubProbe
+	var repositories []*github.Repository
+	if organization {
+		probes = append(probes,
+			gitHubProbe{"organization Members", func() (*github.Response, error) {
+				_, resp, err := client.Teams.ListTeams(ctx, owner, &one)
+				return resp, err //nolint:wrapcheck // wrapped with the permission below
+			}},
+			gitHubProbe{"Packages", func() (*github.Response, error) {
+				_, resp, err := client.Organizations.ListPackages(ctx, owner, containers)
+				return resp, err //nolint:wrapcheck // wrapped with the permission below
+			}},
+		)
+		repositories, _, err = client.Repositories.ListByOrg(ctx, owner, &github.RepositoryListByOrgOptions{ListOptions: one})
+	} else {
+		probes = append(probes, gitHubProbe{"Packages", func() (*github.Response, error) {
+			_, resp, err := client.Users.ListPackages(ctx, owner, containers)
+			return resp, err //nolint:wrapcheck // wrapped with the permission below
+		}})
+		repositories, _, err = client.Repositories.List(ctx, owner, &github.RepositoryListOptions{ListOptions: one})
+	}
+	if err != nil {
+		return fmt.Errorf("error listing the repositories of %q: %w", owner, err)
+	}
+
+	// the repository permissions are probed on any repository of the owner,
+	// the token needs them on all of them to create the new ones
+	if len(repositories) == 0 {
+		log.Info().Msgf("%s has no repository to probe the repository permissions of the github token with", owner)
+	} else {
+		name := repositories[0].GetName()
+		probes = append(probes,
+			gitHubProbe{"repository Administration", func() (*github.Response, error) {
+				_, resp, err := client.Repositories.ListKeys(ctx, owner, name, &one)
+				return resp, err //nolint:wrapcheck // wrapped with the permission below
+			}},
+			gitHubProbe{"repository Webhooks", func() (*github.Response, error) {
+				_, resp, err := client.Repositories.ListHooks(ctx, owner, name, &one)
+				return resp, err //nolint:wrapcheck // wrapped with the permission below
+			}},
+		)
+	}
+
+	var missing []string
+	for _, probe := range probes {
+		resp, err := probe.request()
+		switch {
+		case resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound):
+			log.Debug().Err(err).Msgf("the github token has no %s permission", probe.permission)
+			missing = append(missing, probe.permission)
+		case err != nil:
+			return fmt.Errorf("error probing the %s permission of the github token: %w", probe.permission, err)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the fine-grained github token is missing permissions on %s - please grant read and write access to: %s", owner, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkGitHubOrganizationOwner verifies user is an owner of org and returns
+// its role
+func checkGitHubOrganizationOwner(ctx context.Context, client *github.Client, org, user string) (string, error) {
+	membership, _, err := client.Organizations.GetOrgMembership(ctx, user, org)
+	if err != nil {
+		return "", fmt.Errorf("something went wrong calling GitHub API during org lookup: %w", err)
+	}
+
+	log.Info().Msgf("the github owner role is: %s", membership.GetRole())
+	if membership.GetRole() != "admin" {
+		return membership.GetRole(), fmt.Errorf("authenticated user (via GITHUB_TOKEN) doesn't have adequate permissions - make sure they are an `Owner` in %s, current role: %s", org, membership.GetRole())
+	}
+	return membership.GetRole(), nil
+}
+
+// gitHubRepositoryExists reports whether owner has the repository name
+func gitHubRepositoryExists(ctx context.Context, client *github.Client, owner, name string) (bool, error) {
+	_, resp, err := client.Repositories.Get(ctx, owner, name)
+	return exists(resp, err)
+}
+
+// gitHubTeamExists reports whether org has the team name
+func gitHubTeamExists(ctx context.Context, client *github.Client, org, name string) (bool, error) {
+	_, resp, err := client.Teams.GetTeamBySlug(ctx, org, name)
+	return exists(resp, err)
+}
+
+func exists(resp *github.Response, err error) (bool, error) {
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error calling GitHub API: %w", err)
+	}
+	return true, nil
+}
+
+type gitHubProvider struct {
+	host   *Host
+	client *github.Client
+	token  string
+}
+
+func (p *gitHubProvider) Host() *Host {
+	return p.host
+}
+
+func (p *gitHubProvider) ValidateCredentials(ctx context.Context, owner string) (types.GitAuth, error) {
+	gitAuth := types.GitAuth{Token: p.token, Owner: owner}
+
+	log.Info().Msgf("verifying GitHub authentication with %s", p.host.Name)
+	githubUser, err := p.VerifyToken(ctx)
+	if err != nil {
+		return gitAuth, fmt.Errorf("error verifying GitHub token permissions: %w", err)
+	}
+	gitAuth.User = githubUser
+
+	if _, err := p.CheckOwner(ctx, owner, githubUser); err != nil {
+		return gitAuth, err
+	}
+	return gitAuth, nil
+}
+
+func (p *gitHubProvider) VerifyToken(ctx context.Context) (string, error) {
+	return VerifyGitHubToken(ctx, p.client)
+}
+
+// CheckOwner requires the owner role in the organization, a fine-grained
+// token also needs the permissions probed on it
+func (p *gitHubProvider) CheckOwner(ctx context.Context, owner, user string) (string, error) {
+	role, err := checkGitHubOrganizationOwner(ctx, p.client, owner, user)
+	if err != nil && gitHubFineGrained(p.token) {
+		return role, fmt.Errorf("error checking GitHub organization permissions - make sure the resource owner of the fine-grained token is %s and it has the organization members permission: %w", owner, err)
+	}
+	if err != nil {
+		return role, fmt.Errorf("error checking GitHub organization permissions: %w", err)
+	}
+	if err := CheckGitHubTokenPermissions(ctx, p.client, p.token, owner); err != nil {
+		return role, err
+	}
+	return role, nil
+}
+
+// CheckRegistryAccess requires the write:packages scope of a classic token, a
+// fine-grained token fails with ErrRegistryUnverified as its probe can't tell
+// read from write access
+func (p *gitHubProvider) CheckRegistryAccess(ctx context.Context, _ string) error {
+	req, err := p.client.NewRequest(http.MethodGet, "", nil)
+	if err != nil {
+		return fmt.Errorf("unable to create request to verify token scopes: %w", err)
+	}
+	resp, err := p.client.Do(ctx, req, nil)
+	if err != nil {
+		return fmt.Errorf("error calling GitHub API %q: %w", p.client.BaseURL, err)
+	}
+	scopes, classic := gitHubScopes(resp)
+	if !classic {
+		return fmt.Errorf("the fine-grained github token needs write access to packages: %w", ErrRegistryUnverified)
+	}
+	if !slices.Contains(scopes, "write:packages") {
+		return errors.New("the github token is missing the write:packages scope")
+	}
+	return nil
+}
+
+func (p *gitHubProvider) ExistingRepositories(ctx context.Context, owner string, names []string) ([]string, error) {
+	var existing []string
+	for _, name := range names {
+		found, err := gitHubRepositoryExists(ctx, p.client, owner, name)
+		if err != nil {
+			return nil, fmt.Errorf("error checking repository %q: %w", p.host.RepositoryURL(owner, name), err)
+		}
+		if found {
+			existing = append(existing, name)
+		}
+	}
+	return existing, nil
+}
+
+func (p *gitHubProvider) RepositoryEmpty(ctx context.Context, owner, name string) (bool, error) {
+	commits, resp, err := p.client.Repositories.ListCommits(ctx, owner, name, &github.CommitsListOptions{ListOptions: github.ListOptions{PerPage: 1}})
+	// the commits of an empty repository conflict
+	if resp != nil && resp.StatusCode == http.StatusConflict {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error listing commits of repository %q: %w", p.host.RepositoryURL(owner, name), err)
+	}
+	return len(commits) == 0, nil
+}
+
+func (p *gitHubProvider) ExistingTeams(ctx context.Context, owner string, names []string) ([]string, error) {
+	var existing []string
+	for _, name := range names {
+		found, err := gitHubTeamExists(ctx, p.client, owner, name)
+		if err != nil {
+			return nil, fmt.Errorf("error checking team %q: %w", p.host.TeamURL(owner, name), err)
+		}
+		if found {
+			existing = append(existing, name)
+		}
+	}
+	return existing, nil
+}
+
+// RegistryCredentials returns the token, it needs the write:packages scope
+func (p *gitHubProvider) RegistryCredentials(_ context.Context, auth types.GitAuth) (*RegistryCredentials, error) {
+	return &RegistryCredentials{Host: p.host.ContainerRegistryHost(), Username: auth.User, Password: auth.Token}, nil
+}
+
+// Inventory returns the repositories of opts with their webhooks, the teams
+// and the kbot SSH key of the cluster
+func (p *gitHubProvider) Inventory(ctx context.Context, opts CleanupOptions) ([]Resource, error) {
+	owner := opts.Owner
+	var resources []Resource
+	for _, name := range opts.Repositories {
+		found, err := gitHubRepositoryExists(ctx, p.client, owner, name)
+		if err != nil {
+			return nil, fmt.Errorf("error checking repository %q: %w", p.host.RepositoryURL(owner, name), err)
+		}
+		if !found {
+			continue
+		}
+
+		repositoryURL := p.host.RepositoryURL(owner, name)
+		hooks, _, err := p.client.Repositories.ListHooks(ctx, owner, name, &github.ListOptions{PerPage: 100})
+		if err != nil {
+			return nil, fmt.Errorf("error listing webhooks of repository %q: %w", repositoryURL, err)
+		}
+		for _, hook := range hooks {
+			id := hook.GetID()
+			resources = append(resources, Resource{
+				Kind: ResourceWebhook,
+				Name: fmt.Sprintf("%s -> %v", name, hook.Config["url"]),
+				URL:  fmt.Sprintf("%s/settings/hooks/%d", repositoryURL, id),
+				remove: func(ctx context.Context) error {
+					_, err := p.client.Repositories.DeleteHook(ctx, owner, name, id)
+					return err //nolint:wrapcheck // wrapped by Cleanup
+				},
+			})
+		}
+
+		resources = append(resources, Resource{
+			Kind: ResourceRepository,
+			Name: name,
+			URL:  repositoryURL,
+			remove: func(ctx context.Context) error {
+				_, err := p.client.Repositories.Delete(ctx, owner, name)
+				return err //nolint:wrapcheck // wrapped by Cleanup
+			},
+		})
+	}
+
+	for _, name := range opts.Teams {
+		found, err := gitHubTeamExists(ctx, p.client, owner, name)
+		if err != nil {
+			return nil, fmt.Errorf("error checking team %q: %w", p.host.TeamURL(owner, name), err)
+		}
+		if !found {
+			continue
+		}
+		resources = append(resources, Resource{
+			Kind: ResourceTeam,
+			Name: name,
+			URL:  p.host.TeamURL(owner, name),
+			remove: func(ctx context.Context) error {
+				_, err := p.client.Teams.DeleteTeamBySlug(ctx, owner, name)
+				return err //nolint:wrapcheck // wrapped by Cleanup
+			},
+		})
+	}
+
+	if opts.KbotPublicKey == "" {
+		return resources, nil
+	}
+	keys, _, err := p.client.Users.ListKeys(ctx, "", &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, fmt.Errorf("error listing SSH keys of the authenticated user: %w", err)
+	}
+	for _, key := range keys {
+		if !isKbotKey(key.GetKey(), opts.KbotPublicKey) {
+			continue
+		}
+		id := key.GetID()
+		resources = append(resources, Resource{
+			Kind: ResourceSSHKey,
+			Name: key.GetTitle(),
+			URL:  fmt.Sprintf("https://%s/settings/keys", p.host.Name),
+			remove: func(ctx context.Context) error {
+				_, err := p.client.Users.DeleteKey(ctx, id)
+				return err //nolint:wrapcheck // wrapped by Cleanup
+			},
+		})
+	}
+	return resources, nil
+}
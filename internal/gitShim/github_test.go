@@ -0,0 +1,116 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyGitHubTokenFineGrained(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/":
+			w.Write([]byte(`{}`))
+		case "/api/v3/user":
+			w.Write([]byte(`{"login":"kbot"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host, err := NewHost("github", "github.example.com", server.URL+"/api/v3")
+	require.NoError(t, err)
+	client, err := host.GitHubClient("github_pat_token")
+	require.NoError(t, err)
+
+	// fine-grained tokens send no scopes header
+	user, err := VerifyGitHubToken(context.Background(), client)
+	require.NoError(t, err)
+	require.Equal(t, "kbot", user)
+	require.True(t, gitHubFineGrained("github_pat_token"))
+	require.False(t, gitHubFineGrained("ghp_token"))
+
+	_, err = host.GitHubClient("ghs_token")
+	require.ErrorIs(t, err, ErrGitHubInstallationToken)
+}
+
+func TestCheckGitHubTokenPermissions(t *testing.T) {
+	forbidden := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if forbidden[r.URL.Path] {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Resource not accessible by personal access token"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v3/users/platform":
+			w.Write([]byte(`{"login":"platform","type":"Organization"}`))
+		case "/api/v3/orgs/platform/repos":
+			w.Write([]byte(`[{"name":"docs"}]`))
+		case "/api/v3/orgs/platform/teams", "/api/v3/orgs/platform/packages",
+			"/api/v3/repos/platform/docs/keys", "/api/v3/repos/platform/docs/hooks":
+			w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host, err := NewHost("github", "github.example.com", server.URL+"/api/v3")
+	require.NoError(t, err)
+	client, err := host.GitHubClient("github_pat_token")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, CheckGitHubTokenPermissions(ctx, client, "github_pat_token", "platform"))
+
+	forbidden["/api/v3/orgs/platform/teams"] = true
+	forbidden["/api/v3/repos/platform/docs/hooks"] = true
+	err = CheckGitHubTokenPermissions(ctx, client, "github_pat_token", "platform")
+	require.EqualError(t, err, "the fine-grained github token is missing permissions on platform - please grant read and write access to: organization Members, repository Webhooks")
+
+	// classic tokens are verified by their scopes
+	require.NoError(t, CheckGitHubTokenPermissions(ctx, client, "ghp_token", "platform"))
+}
+
+func TestGitHubCheckRegistryAccess(t *testing.T) {
+	scopes := map[string]string{
+		"ghp_packages": "repo, write:packages",
+		"ghp_repo":     "repo",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if scope, classic := scopes[token]; classic {
+			w.Header().Set("X-OAuth-Scopes", scope)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	host, err := NewHost("github", "github.example.com", server.URL+"/api/v3")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	provider, err := NewGitProvider(host, "ghp_packages")
+	require.NoError(t, err)
+	require.NoError(t, provider.CheckRegistryAccess(ctx, "platform"))
+
+	provider, err = NewGitProvider(host, "ghp_repo")
+	require.NoError(t, err)
+	require.EqualError(t, provider.CheckRegistryAccess(ctx, "platform"), "the github token is missing the write:packages scope")
+
+	provider, err = NewGitProvider(host, "github_pat_token")
+	require.NoError(t, err)
+	require.ErrorIs(t, provider.CheckRegistryAccess(ctx, "platform"), ErrRegistryUnverified)
+}
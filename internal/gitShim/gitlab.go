@@ -0,0 +1,435 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/konstructio/kubefirst/internal/httpclient"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"github.com/xanzy/go-gitlab"
+)
+
+// gitLabRequiredScopes are the scopes kubefirst needs when a token lacks api
+var gitLabRequiredScopes = []string{
+	"read_api",
+	"read_user",
+	"read_repository",
+	"write_repository",
+	"read_registry",
+	"write_registry",
+}
+
+// GitLabOwner is the group owning the repositories and the authenticated user
+type GitLabOwner struct {
+	GroupID   int
+	GroupPath string
+	User      string
+	UserID    int
+}
+
+// GitLabClient returns a GitLab client of the host authenticated with token
+func (h *Host) GitLabClient(token string) (*gitlab.Client, error) {
+	client, err := gitlab.NewClient(token, gitlab.WithBaseURL(h.APIURL), gitlab.WithHTTPClient(httpclient.New()))
+	if err != nil {
+		return nil, fmt.Errorf("error creating GitLab client for %q: %w", h.APIURL, err)
+	}
+	return client, nil
+}
+
+// VerifyGitLabToken verifies token has the scopes kubefirst needs and returns
+// the group at groupPath with the user the token belongs to
+func VerifyGitLabToken(ctx context.Context, client *gitlab.Client, groupPath string) (*GitLabOwner, error) {
+	user, err := verifyGitLabScopes(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	group, _, err := client.Groups.GetGroup(groupPath, &gitlab.GetGroupOptions{}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("could not find gitlab group %s: %w", groupPath, err)
+	}
+
+	return &GitLabOwner{GroupID: group.ID, GroupPath: group.FullPath, User: user.Username, UserID: user.ID}, nil
+}
+
+// verifyGitLabScopes verifies the token of client has the scopes kubefirst
+// needs and returns the user it belongs to
+func verifyGitLabScopes(ctx context.Context, client *gitlab.Client) (*gitlab.User, error) {
+	req, err := client.NewRequest(http.MethodGet, "personal_access_tokens/self", nil, []gitlab.RequestOptionFunc{gitlab.WithContext(ctx)})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request to verify token permissions: %w", err)
+	}
+	var token struct {
+		Scopes []string `json:"scopes"`
+	}
+	if _, err := client.Do(req, &token); err != nil {
+		return nil, fmt.Errorf("unable to verify GitLab token permissions: %w", err)
+	}
+	if !slices.Contains(token.Scopes, "api") {
+		var missingScopes []string
+		for _, scope := range gitLabRequiredScopes {
+			if !slices.Contains(token.Scopes, scope) {
+				missingScopes = append(missingScopes, scope)
+			}
+		}
+		if len(missingScopes) > 0 {
+			return nil, fmt.Errorf("the supplied gitlab token is missing authorization scopes - please add: %v", missingScopes)
+		}
+	}
+
+	user, _, err := client.Users.CurrentUser(gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get authenticated user info - please make sure GITLAB_TOKEN env var is set: %w", err)
+	}
+	return user, nil
+}
+
+// gitLabProjects returns the names of the projects of group, without the ones
+// pending deletion
+func gitLabProjects(ctx context.Context, client *gitlab.Client, groupID int) ([]string, error) {
+	var names []string
+	for page := 1; page > 0; {
+		projects, resp, err := client.Groups.ListGroupProjects(groupID, &gitlab.ListGroupProjectsOptions{
+			ListOptions: gitlab.ListOptions{Page: page, PerPage: 100},
+		}, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("could not get projects for parent group %d: %w", groupID, err)
+		}
+		for _, project := range projects {
+			if !strings.Contains(project.Name, "deleted") {
+				names = append(names, project.Name)
+			}
+		}
+		page = resp.NextPage
+	}
+	return names, nil
+}
+
+// gitLabSubgroups returns the names of the subgroups of group
+func gitLabSubgroups(ctx context.Context, client *gitlab.Client, groupID int) ([]string, error) {
+	var names []string
+	for page := 1; page > 0; {
+		subgroups, resp, err := client.Groups.ListSubGroups(groupID, &gitlab.ListSubGroupsOptions{
+			ListOptions: gitlab.ListOptions{Page: page, PerPage: 100},
+		}, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("could not get subgroups for parent group %d: %w", groupID, err)
+		}
+		for _, subgroup := range subgroups {
+			names = append(names, subgroup.Name)
+		}
+		page = resp.NextPage
+	}
+	return names, nil
+}
+
+// createGitLabDeployToken creates the group deploy token name and records it,
+// replacing the one recorded by a previous run. Tokens of the same name may
+// belong to other clusters of the group and are kept.
+func createGitLabDeployToken(ctx context.Context, client *gitlab.Client, groupID int, name string, scopes []string) (string, error) {
+	if previousID := viper.GetInt(deployTokenIDKey); previousID != 0 {
+		resp, err := client.DeployTokens.DeleteGroupDeployToken(groupID, previousID, gitlab.WithContext(ctx))
+		if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+			return "", fmt.Errorf("could not delete previous group deploy token %s: %w", name, err)
+		}
+	}
+
+	token, _, err := client.DeployTokens.CreateGroupDeployToken(groupID, &gitlab.CreateGroupDeployTokenOptions{
+		Name:     &name,
+		Username: &name,
+		Scopes:   &scopes,
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("could not create group deploy token %s: %w", name, err)
+	}
+
+	viper.Set(deployTokenIDKey, token.ID)
+	if err := viper.WriteConfig(); err != nil {
+		return "", fmt.Errorf("error writing git provider config: %w", err)
+	}
+	return token.Token, nil
+}
+
+type gitLabProvider struct {
+	host   *Host
+	client *gitlab.Client
+	token  string
+
+	// owner is the group looked up at ownerPath
+	owner     *GitLabOwner
+	ownerPath string
+}
+
+// gitLabRoles are the names of the access levels
+var gitLabRoles = map[gitlab.AccessLevelValue]string{
+	gitlab.NoPermissions:            "none",
+	gitlab.MinimalAccessPermissions: "minimal access",
+	gitlab.GuestPermissions:         "guest",
+	gitlab.ReporterPermissions:      "reporter",
+	gitlab.DeveloperPermissions:     "developer",
+	gitlab.MaintainerPermissions:    "maintainer",
+	gitlab.OwnerPermissions:         "owner",
+}
+
+func (p *gitLabProvider) Host() *Host {
+	return p.host
+}
+
+// resolveOwner returns the group at groupPath, looked up once
+func (p *gitLabProvider) resolveOwner(ctx context.Context, groupPath string) (*GitLabOwner, error) {
+	if p.owner != nil && (p.ownerPath == groupPath || p.owner.GroupPath == groupPath) {
+		return p.owner, nil
+	}
+	owner, err := VerifyGitLabToken(ctx, p.client, groupPath)
+	if err != nil {
+		return nil, err
+	}
+	p.owner, p.ownerPath = owner, groupPath
+	return owner, nil
+}
+
+func (p *gitLabProvider) ValidateCredentials(ctx context.Context, owner string) (types.GitAuth, error) {
+	gitAuth := types.GitAuth{Token: p.token}
+
+	group, err := p.resolveOwner(ctx, owner)
+	if err != nil {
+		return gitAuth, fmt.Errorf("error verifying GitLab token permissions: %w", err)
+	}
+	gitAuth.Owner = group.GroupPath
+	gitAuth.User = group.User
+	log.Info().Msgf("set GitLab owner to %q", gitAuth.Owner)
+	return gitAuth, nil
+}
+
+func (p *gitLabProvider) VerifyToken(ctx context.Context) (string, error) {
+	user, err := verifyGitLabScopes(ctx, p.client)
+	if err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+// CheckOwner requires the maintainer role in the group, which creates the
+// projects and subgroups
+func (p *gitLabProvider) CheckOwner(ctx context.Context, owner, _ string) (string, error) {
+	group, err := p.resolveOwner(ctx, owner)
+	if err != nil {
+		return "", err
+	}
+	member, _, err := p.client.GroupMembers.GetInheritedGroupMember(group.GroupID, group.UserID, gitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("could not get membership of %s in gitlab group %s: %w", group.User, group.GroupPath, err)
+	}
+	role := gitLabRoles[member.AccessLevel]
+	if member.AccessLevel < gitlab.MaintainerPermissions {
+		return role, fmt.Errorf("authenticated user (via GITLAB_TOKEN) doesn't have adequate permissions - make sure they are a `Maintainer` or `Owner` of %s, current role: %s", group.GroupPath, role)
+	}
+	return role, nil
+}
+
+// preflightDeployToken is the group deploy token the preflight checks create
+const preflightDeployToken = "kubefirst-preflight"
+
+// CheckRegistryAccess creates and deletes a group deploy token, the cluster
+// authenticates with the registry using one
+func (p *gitLabProvider) CheckRegistryAccess(ctx context.Context, owner string) error {
+	group, err := p.resolveOwner(ctx, owner)
+	if err != nil {
+		return err
+	}
+	name := preflightDeployToken
+	token, _, err := p.client.DeployTokens.CreateGroupDeployToken(group.GroupID, &gitlab.CreateGroupDeployTokenOptions{
+		Name:   &name,
+		Scopes: &[]string{"read_registry"},
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("could not create group deploy tokens in %s: %w", group.GroupPath, err)
+	}
+	if _, err := p.client.DeployTokens.DeleteGroupDeployToken(group.GroupID, token.ID, gitlab.WithContext(ctx)); err != nil {
+		return fmt.Errorf("could not delete the %s group deploy token of %s: %w", name, group.GroupPath, err)
+	}
+	return nil
+}
+
+func (p *gitLabProvider) ExistingRepositories(ctx context.Context, owner string, names []string) ([]string, error) {
+	group, err := p.resolveOwner(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	projects, err := gitLabProjects(ctx, p.client, group.GroupID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get GitLab projects: %w", err)
+	}
+	return intersect(names, projects), nil
+}
+
+func (p *gitLabProvider) RepositoryEmpty(ctx context.Context, owner, name string) (bool, error) {
+	group, err := p.resolveOwner(ctx, owner)
+	if err != nil {
+		return false, err
+	}
+	project, _, err := p.client.Projects.GetProject(group.GroupPath+"/"+name, &gitlab.GetProjectOptions{}, gitlab.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("could not get project %s/%s: %w", group.GroupPath, name, err)
+	}
+	return project.EmptyRepo, nil
+}
+
+func (p *gitLabProvider) ExistingTeams(ctx context.Context, owner string, names []string) ([]string, error) {
+	group, err := p.resolveOwner(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	subgroups, err := gitLabSubgroups(ctx, p.client, group.GroupID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get GitLab subgroups for group %q: %w", owner, err)
+	}
+	return intersect(names, subgroups), nil
+}
+
+// RegistryCredentials creates a group deploy token for the registry,
+// replacing the one of a previous run
+func (p *gitLabProvider) RegistryCredentials(ctx context.Context, auth types.GitAuth) (*RegistryCredentials, error) {
+	group, err := p.resolveOwner(ctx, auth.Owner)
+	if err != nil {
+		return nil, err
+	}
+	token, err := createGitLabDeployToken(ctx, p.client, group.GroupID, secretName, []string{"read_registry", "write_registry"})
+	if err != nil {
+		return nil, fmt.Errorf("error while creating GitLab group deploy token: %w", err)
+	}
+	return &RegistryCredentials{Host: p.host.ContainerRegistryHost(), Username: secretName, Password: token}, nil
+}
+
+// intersect returns the names found in existing, in the order of names
+func intersect(names, existing []string) []string {
+	var found []string
+	for _, name := range names {
+		if slices.Contains(existing, name) {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// Inventory returns the projects of opts with their webhooks, the subgroups,
+// the registry deploy token and the kbot SSH key of the cluster
+func (p *gitLabProvider) Inventory(ctx context.Context, opts CleanupOptions) ([]Resource, error) {
+	group, err := p.resolveOwner(ctx, opts.Owner)
+	if err != nil {
+		return nil, err
+	}
+	owner := group.GroupPath
+
+	var resources []Resource
+	for _, name := range opts.Repositories {
+		repositoryURL := p.host.RepositoryURL(owner, name)
+		project, resp, err := p.client.Projects.GetProject(owner+"/"+name, &gitlab.GetProjectOptions{}, gitlab.WithContext(ctx))
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error checking project %q: %w", repositoryURL, err)
+		}
+
+		hooks, _, err := p.client.Projects.ListProjectHooks(project.ID, &gitlab.ListProjectHooksOptions{PerPage: 100}, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("error listing webhooks of project %q: %w", repositoryURL, err)
+		}
+		for _, hook := range hooks {
+			projectID, hookID := project.ID, hook.ID
+			resources = append(resources, Resource{
+				Kind: ResourceWebhook,
+				Name: fmt.Sprintf("%s -> %s", name, hook.URL),
+				URL:  repositoryURL + "/-/hooks",
+				remove: func(ctx context.Context) error {
+					_, err := p.client.Projects.DeleteProjectHook(projectID, hookID, gitlab.WithContext(ctx))
+					return err //nolint:wrapcheck // wrapped by Cleanup
+				},
+			})
+		}
+
+		projectID := project.ID
+		resources = append(resources, Resource{
+			Kind: ResourceRepository,
+			Name: name,
+			URL:  repositoryURL,
+			remove: func(ctx context.Context) error {
+				_, err := p.client.Projects.DeleteProject(projectID, gitlab.WithContext(ctx))
+				return err //nolint:wrapcheck // wrapped by Cleanup
+			},
+		})
+	}
+
+	subgroups, err := gitLabSubgroups(ctx, p.client, group.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range intersect(opts.Teams, subgroups) {
+		path := owner + "/" + name
+		resources = append(resources, Resource{
+			Kind: ResourceSubgroup,
+			Name: name,
+			URL:  p.host.TeamURL(owner, name),
+			remove: func(ctx context.Context) error {
+				_, err := p.client.Groups.DeleteGroup(path, &gitlab.DeleteGroupOptions{}, gitlab.WithContext(ctx))
+				return err //nolint:wrapcheck // wrapped by Cleanup
+			},
+		})
+	}
+
+	tokens, _, err := p.client.DeployTokens.ListGroupDeployTokens(group.GroupID, &gitlab.ListGroupDeployTokensOptions{}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("could not list group deploy tokens for group %d: %w", group.GroupID, err)
+	}
+	for _, token := range tokens {
+		if opts.DeployTokenID == 0 || token.ID != opts.DeployTokenID {
+			continue
+		}
+		tokenID := token.ID
+		resources = append(resources, Resource{
+			Kind: ResourceDeployToken,
+			Name: token.Name,
+			URL:  fmt.Sprintf("https://%s/groups/%s/-/settings/repository", p.host.Name, owner),
+			remove: func(ctx context.Context) error {
+				_, err := p.client.DeployTokens.DeleteGroupDeployToken(group.GroupID, tokenID, gitlab.WithContext(ctx))
+				return err //nolint:wrapcheck // wrapped by Cleanup
+			},
+		})
+	}
+
+	if opts.KbotPublicKey == "" {
+		return resources, nil
+	}
+	keys, _, err := p.client.Users.ListSSHKeys(&gitlab.ListSSHKeysOptions{PerPage: 100}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("error listing SSH keys of the authenticated user: %w", err)
+	}
+	for _, key := range keys {
+		if !isKbotKey(key.Key, opts.KbotPublicKey) {
+			continue
+		}
+		keyID := key.ID
+		resources = append(resources, Resource{
+			Kind: ResourceSSHKey,
+			Name: key.Title,
+			URL:  fmt.Sprintf("https://%s/-/user_settings/ssh_keys", p.host.Name),
+			remove: func(ctx context.Context) error {
+				_, err := p.client.Users.DeleteSSHKey(keyID, gitlab.WithContext(ctx))
+				return err //nolint:wrapcheck // wrapped by Cleanup
+			},
+		})
+	}
+	return resources, nil
+}
@@ -0,0 +1,188 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	internalssh "github.com/konstructio/kubefirst-api/pkg/ssh"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Public hosts of the git providers
+const (
+	GitHubHost    = "github.com"
+	GitLabHost    = "gitlab.com"
+	BitbucketHost = "bitbucket.org"
+
+	gitHubAPIURL    = "https://api.github.com"
+	bitbucketAPIURL = "https://api.bitbucket.org/2.0"
+)
+
+// publicHosts are the hosts of the providers offered as a service, Gitea and
+// Forgejo are always self-hosted
+var publicHosts = map[string]string{
+	"github":    GitHubHost,
+	"gitlab":    GitLabHost,
+	"bitbucket": BitbucketHost,
+}
+
+// Host is the server of a git provider, either its public host or a
+// self-hosted GitHub Enterprise Server, GitLab, Gitea or Forgejo instance
+type Host struct {
+	Provider string
+	// Name is the hostname of the server, i.e. github.example.com
+	Name string
+	// APIURL is the base URL of the REST API, without a trailing slash
+	APIURL string
+}
+
+// AddHostFlags adds the self-hosted git server flags to cmd
+func AddHostFlags(cmd *cobra.Command) {
+	cmd.Flags().String("git-host", "", "the hostname of a self-hosted GitHub Enterprise Server, GitLab, Gitea or Forgejo instance (defaults to the public host of the git provider)")
+	cmd.Flags().String("git-api-url", "", "the API base URL of the git host (defaults to https://<git-host>/api/v3 for GitHub, /api/v4 for GitLab and /api/v1 for Gitea)")
+	cmd.Flags().String("git-owner", "", "the organization (gitea) or workspace (bitbucket) owning the new repositories")
+}
+
+// NewHost returns the host of provider at name, the public host of the
+// provider when name is empty. The API URL is derived from the host when
+// apiURL is empty.
+func NewHost(provider, name, apiURL string) (*Host, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid git host %q - must be a hostname such as github.example.com", name)
+	}
+
+	switch provider {
+	case "github":
+		if name == "" {
+			name = GitHubHost
+		}
+		if apiURL == "" {
+			apiURL = "https://" + name + "/api/v3"
+			if name == GitHubHost {
+				apiURL = gitHubAPIURL
+			}
+		}
+	case "gitlab":
+		if name == "" {
+			name = GitLabHost
+		}
+		if apiURL == "" {
+			apiURL = "https://" + name + "/api/v4"
+		}
+	case "gitea":
+		if name == "" {
+			return nil, fmt.Errorf("the gitea git provider requires the hostname of the instance - please set --git-host")
+		}
+		if apiURL == "" {
+			apiURL = "https://" + name + "/api/v1"
+		}
+	case "bitbucket":
+		if name == "" {
+			name = BitbucketHost
+		}
+		if name != BitbucketHost {
+			return nil, fmt.Errorf("invalid git host %q - only Bitbucket Cloud (%s) is supported", name, BitbucketHost)
+		}
+		if apiURL == "" {
+			apiURL = bitbucketAPIURL
+		}
+	default:
+		return nil, fmt.Errorf("invalid git provider %q", provider)
+	}
+
+	u, err := url.Parse(apiURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid git API URL %q - must be an http or https URL", apiURL)
+	}
+
+	return &Host{Provider: provider, Name: name, APIURL: strings.TrimSuffix(apiURL, "/")}, nil
+}
+
+// HostFromConfig returns the git host recorded in the kubefirst config
+func HostFromConfig() (*Host, error) {
+	return NewHost(viper.GetString("flags.git-provider"), viper.GetString("flags.git-host"), viper.GetString("flags.git-api-url"))
+}
+
+// SelfHosted reports whether the host is not the public host of its provider
+func (h *Host) SelfHosted() bool {
+	return h.Name != publicHosts[h.Provider]
+}
+
+// RepositoryURL returns the web URL of the repository name of owner
+func (h *Host) RepositoryURL(owner, name string) string {
+	return fmt.Sprintf("https://%s/%s/%s", h.Name, owner, name)
+}
+
+// CloneURLs returns the HTTPS and SSH clone URLs of the repository name of owner
+func (h *Host) CloneURLs(owner, name string) (string, string) {
+	return fmt.Sprintf("https://%s/%s/%s.git", h.Name, owner, name), fmt.Sprintf("git@%s:%s/%s.git", h.Name, owner, name)
+}
+
+// TeamURL returns the web URL of the team, a subgroup on GitLab and a
+// workspace group on Bitbucket
+func (h *Host) TeamURL(owner, team string) string {
+	switch h.Provider {
+	case "gitlab":
+		return fmt.Sprintf("https://%s/%s/%s", h.Name, owner, team)
+	case "gitea":
+		return fmt.Sprintf("https://%s/org/%s/teams/%s", h.Name, owner, team)
+	case "bitbucket":
+		return fmt.Sprintf("https://%s/%s/workspace/settings/groups", h.Name, owner)
+	}
+	return fmt.Sprintf("https://%s/orgs/%s/teams/%s", h.Name, owner, team)
+}
+
+// ContainerRegistryHost returns the container registry served with the host,
+// empty when the provider has none. GitHub Enterprise Server and GitLab serve
+// it on a subdomain by default, Gitea on the host itself.
+func (h *Host) ContainerRegistryHost() string {
+	switch {
+	case h.Provider == "github" && !h.SelfHosted():
+		return "ghcr.io"
+	case h.Provider == "github":
+		return "containers." + h.Name
+	case h.Provider == "gitlab" && !h.SelfHosted():
+		return "registry.gitlab.com"
+	case h.Provider == "gitlab":
+		return "registry." + h.Name
+	case h.Provider == "gitea":
+		return h.Name
+	default:
+		return ""
+	}
+}
+
+// TerraformEnv returns the environment pointing the terraform provider of a
+// self-hosted git server at its API
+func (h *Host) TerraformEnv() map[string]string {
+	if !h.SelfHosted() {
+		return map[string]string{}
+	}
+	switch h.Provider {
+	case "gitlab":
+		return map[string]string{"GITLAB_BASE_URL": h.APIURL + "/"}
+	case "gitea":
+		return map[string]string{"GITEA_BASE_URL": "https://" + h.Name}
+	}
+	return map[string]string{"GITHUB_BASE_URL": h.APIURL + "/"}
+}
+
+// CheckKnownHost verifies this machine knows the SSH host key of host
+func CheckKnownHost(host string) error {
+	key, err := internalssh.GetHostKey(host)
+	if err != nil {
+		return fmt.Errorf("known_hosts file does not exist - please run `ssh-keyscan %s >> ~/.ssh/known_hosts` to remedy: %w", host, err)
+	}
+	log.Info().Msgf("%q %s", host, key.Type())
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		host     string
+		apiURL   string
+		expected *Host
+		err      string
+	}{
+		{name: "github", provider: "github", expected: &Host{Provider: "github", Name: "github.com", APIURL: "https://api.github.com"}},
+		{name: "gitlab", provider: "gitlab", expected: &Host{Provider: "gitlab", Name: "gitlab.com", APIURL: "https://gitlab.com/api/v4"}},
+		{name: "github enterprise", provider: "github", host: "GitHub.Example.com", expected: &Host{Provider: "github", Name: "github.example.com", APIURL: "https://github.example.com/api/v3"}},
+		{name: "self-hosted gitlab", provider: "gitlab", host: "gitlab.example.com", expected: &Host{Provider: "gitlab", Name: "gitlab.example.com", APIURL: "https://gitlab.example.com/api/v4"}},
+		{name: "api url", provider: "gitlab", host: "gitlab.example.com", apiURL: "https://api.example.com/gitlab/", expected: &Host{Provider: "gitlab", Name: "gitlab.example.com", APIURL: "https://api.example.com/gitlab"}},
+		{name: "url as host", provider: "github", host: "https://github.example.com", err: "invalid git host"},
+		{name: "invalid api url", provider: "github", host: "github.example.com", apiURL: "github.example.com/api", err: "invalid git API URL"},
+		{name: "invalid provider", provider: "bogus", err: "invalid git provider"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, err := NewHost(tt.provider, tt.host, tt.apiURL)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, host)
+		})
+	}
+}
+
+func TestHostURLs(t *testing.T) {
+	github, err := NewHost("github", "", "")
+	require.NoError(t, err)
+	require.False(t, github.SelfHosted())
+	require.Equal(t, "https://github.com/org/gitops", github.RepositoryURL("org", "gitops"))
+	require.Equal(t, "https://github.com/orgs/org/teams/admins", github.TeamURL("org", "admins"))
+	require.Equal(t, "ghcr.io", github.ContainerRegistryHost())
+	require.Empty(t, github.TerraformEnv())
+
+	enterprise, err := NewHost("github", "github.example.com", "")
+	require.NoError(t, err)
+	require.True(t, enterprise.SelfHosted())
+	https, ssh := enterprise.CloneURLs("org", "metaphor")
+	require.Equal(t, "https://github.example.com/org/metaphor.git", https)
+	require.Equal(t, "git@github.example.com:org/metaphor.git", ssh)
+	require.Equal(t, "containers.github.example.com", enterprise.ContainerRegistryHost())
+	require.Equal(t, map[string]string{"GITHUB_BASE_URL": "https://github.example.com/api/v3/"}, enterprise.TerraformEnv())
+
+	gitlab, err := NewHost("gitlab", "gitlab.example.com", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://gitlab.example.com/group/admins", gitlab.TeamURL("group", "admins"))
+	require.Equal(t, "registry.gitlab.example.com", gitlab.ContainerRegistryHost())
+	require.Equal(t, map[string]string{"GITLAB_BASE_URL": "https://gitlab.example.com/api/v4/"}, gitlab.TerraformEnv())
+}
+
+func TestVerifyGitHubTokenEnterprise(t *testing.T) {
+	scopes := "admin:org, admin:public_key, admin:repo_hook, delete_repo, repo, user, workflow, write:packages"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Header().Set("X-OAuth-Scopes", scopes)
+		switch r.URL.Path {
+		case "/api/v3/":
+			w.Write([]byte(`{}`))
+		case "/api/v3/user":
+			w.Write([]byte(`{"login":"kbot"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host, err := NewHost("github", "github.example.com", server.URL+"/api/v3")
+	require.NoError(t, err)
+	client, err := host.GitHubClient("token")
+	require.NoError(t, err)
+
+	user, err := VerifyGitHubToken(context.Background(), client)
+	require.NoError(t, err)
+	require.Equal(t, "kbot", user)
+
+	scopes = "repo, user"
+	_, err = VerifyGitHubToken(context.Background(), client)
+	require.ErrorContains(t, err, "missing authorization scopes")
+}
+
+func TestVerifyGitLabTokenSelfHosted(t *testing.T) {
+	tokenScopes := []string{"api"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token", r.Header.Get("PRIVATE-TOKEN"))
+		var body any
+		switch {
+		case r.URL.Path == "/api/v4/personal_access_tokens/self":
+			body = map[string]any{"scopes": tokenScopes}
+		case strings.HasPrefix(r.URL.Path, "/api/v4/groups/"):
+			body = map[string]any{"id": 42, "full_path": "platform/team"}
+		case r.URL.Path == "/api/v4/user":
+			body = map[string]any{"id": 7, "username": "kbot"}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	host, err := NewHost("gitlab", "gitlab.example.com", server.URL+"/api/v4")
+	require.NoError(t, err)
+	client, err := host.GitLabClient("token")
+	require.NoError(t, err)
+
+	owner, err := VerifyGitLabToken(context.Background(), client, "platform/team")
+	require.NoError(t, err)
+	require.Equal(t, &GitLabOwner{GroupID: 42, GroupPath: "platform/team", User: "kbot", UserID: 7}, owner)
+
+	tokenScopes = []string{"read_api"}
+	_, err = VerifyGitLabToken(context.Background(), client, "platform/team")
+	require.ErrorContains(t, err, "missing authorization scopes")
+}
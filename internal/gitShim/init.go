@@ -7,15 +7,11 @@ See the LICENSE file for more details.
 package gitShim //nolint:revive // allowed during refactoring
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 
-	"github.com/konstructio/kubefirst-api/pkg/github"
-	"github.com/konstructio/kubefirst-api/pkg/gitlab"
-	"github.com/konstructio/kubefirst-api/pkg/handlers"
-	"github.com/konstructio/kubefirst-api/pkg/services"
 	"github.com/konstructio/kubefirst-api/pkg/types"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
@@ -27,168 +23,123 @@ type GitInitParameters struct {
 	GitOwner     string
 	Repositories []string
 	Teams        []string
+	// AdoptExisting reuses the repositories that exist and are empty, only
+	// set when the caller imports them into its terraform state
+	AdoptExisting bool
+	// Host is the git server, the public host of GitProvider when nil
+	Host *Host
 }
 
 // InitializeGitProvider
-func InitializeGitProvider(p *GitInitParameters) error {
-	switch p.GitProvider {
-	case "github":
-		githubSession := github.New(p.GitToken)
-		newRepositoryExists := false
-		errorMsg := "the following repositories must be removed before continuing with your Kubefirst installation.\n\t"
-
-		for _, repositoryName := range p.Repositories {
-			responseStatusCode := githubSession.CheckRepoExists(p.GitOwner, repositoryName)
-
-			repositoryExistsStatusCode := 200
-			repositoryDoesNotExistStatusCode := 404
-
-			if responseStatusCode == repositoryExistsStatusCode {
-				log.Info().Msgf("repository %q exists", fmt.Sprintf("https://github.com/%s/%s", p.GitOwner, repositoryName))
-				errorMsg += fmt.Sprintf("https://github.com/%s/%s\n\t", p.GitOwner, repositoryName)
-				newRepositoryExists = true
-			} else if responseStatusCode == repositoryDoesNotExistStatusCode {
-				log.Info().Msgf("repository %q does not exist, continuing", fmt.Sprintf("https://github.com/%s/%s", p.GitOwner, repositoryName))
-			}
-		}
-		if newRepositoryExists {
-			return errors.New(errorMsg)
+func InitializeGitProvider(ctx context.Context, p *GitInitParameters) error {
+	host := p.Host
+	if host == nil {
+		var err error
+		if host, err = NewHost(p.GitProvider, "", ""); err != nil {
+			return err
 		}
+	}
 
-		newTeamExists := false
-		errorMsg = "the following teams must be removed before continuing with your Kubefirst installation.\n\t"
-
-		for _, teamName := range p.Teams {
-			responseStatusCode := githubSession.CheckTeamExists(p.GitOwner, teamName)
-
-			// https://docs.github.com/en/rest/teams/teams?apiVersion=2022-11-28#get-a-team-by-name
-			teamExistsStatusCode := 200
-			teamDoesNotExistStatusCode := 404
+	provider, err := NewGitProvider(host, p.GitToken)
+	if err != nil {
+		return err
+	}
 
-			if responseStatusCode == teamExistsStatusCode {
-				log.Info().Msgf("team %q exists", fmt.Sprintf("https://github.com/%s/%s", p.GitOwner, teamName))
-				errorMsg += fmt.Sprintf("https://github.com/orgs/%s/teams/%s\n\t", p.GitOwner, teamName)
-				newTeamExists = true
-			} else if responseStatusCode == teamDoesNotExistStatusCode {
-				log.Info().Msgf("team %q does not exist, continuing", fmt.Sprintf("https://github.com/orgs/%s/teams/%s", p.GitOwner, teamName))
+	repositories, err := provider.ExistingRepositories(ctx, p.GitOwner, p.Repositories)
+	if err != nil {
+		return err
+	}
+	if p.AdoptExisting {
+		var notEmpty []string
+		for _, repositoryName := range repositories {
+			empty, err := provider.RepositoryEmpty(ctx, p.GitOwner, repositoryName)
+			if err != nil {
+				return err
+			}
+			if !empty {
+				notEmpty = append(notEmpty, repositoryName)
+				continue
 			}
+			log.Info().Msgf("repository %q exists and is empty, adopting it", host.RepositoryURL(p.GitOwner, repositoryName))
 		}
-		if newTeamExists {
+		if len(notEmpty) > 0 {
+			errorMsg := "the following repositories are not empty and can't be adopted - remove them before continuing with your Kubefirst installation.\n\t"
+			for _, repositoryName := range notEmpty {
+				errorMsg += host.RepositoryURL(p.GitOwner, repositoryName) + "\n\t"
+			}
 			return errors.New(errorMsg)
 		}
-	case "gitlab":
-		gitlabClient, err := gitlab.NewGitLabClient(p.GitToken, p.GitOwner)
-		if err != nil {
-			return fmt.Errorf("error creating GitLab client: %w", err)
+	} else if len(repositories) > 0 {
+		errorMsg := "the following repositories must be removed before continuing with your Kubefirst installation.\n\t"
+		for _, repositoryName := range repositories {
+			log.Info().Msgf("repository %q exists", host.RepositoryURL(p.GitOwner, repositoryName))
+			errorMsg += host.RepositoryURL(p.GitOwner, repositoryName) + "\n\t"
 		}
+		return errors.New(errorMsg)
+	}
+	log.Info().Msgf("repositories %q checked, continuing", p.Repositories)
 
-		projects, err := gitlabClient.GetProjects()
-		if err != nil {
-			return fmt.Errorf("couldn't get GitLab projects: %w", err)
-		}
-		for _, repositoryName := range p.Repositories {
-			for _, project := range projects {
-				if project.Name == repositoryName {
-					return fmt.Errorf("project %q already exists and will need to be deleted before continuing", repositoryName)
-				}
-			}
+	teams, err := provider.ExistingTeams(ctx, p.GitOwner, p.Teams)
+	if err != nil {
+		return err
+	}
+	if len(teams) > 0 {
+		errorMsg := "the following teams must be removed before continuing with your Kubefirst installation.\n\t"
+		for _, teamName := range teams {
+			log.Info().Msgf("team %q exists", host.TeamURL(p.GitOwner, teamName))
+			errorMsg += host.TeamURL(p.GitOwner, teamName) + "\n\t"
 		}
+		return errors.New(errorMsg)
+	}
+	log.Info().Msgf("teams %q do not exist, continuing", p.Teams)
 
-		subgroups, err := gitlabClient.GetSubGroups()
-		if err != nil {
-			return fmt.Errorf("couldn't get GitLab subgroups for group %q: %w", p.GitOwner, err)
-		}
-		for _, teamName := range p.Teams {
-			for _, sg := range subgroups {
-				if sg.Name == teamName {
-					return fmt.Errorf("subgroup %q already exists and will need to be deleted before continuing", teamName)
-				}
-			}
-		}
+	// none of them existed or they were adopted empty, so git cleanup can
+	// delete what is found at these names once the cluster is created
+	if err := recordResources(p.GitOwner, p.Repositories, p.Teams); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func ValidateGitCredentials(gitProviderFlag, githubOrgFlag, gitlabGroupFlag string) (types.GitAuth, error) {
+// ValidateGitCredentials verifies the token of the git provider of host in
+// the environment can create the repositories and teams of owner
+func ValidateGitCredentials(ctx context.Context, host *Host, owner string) (types.GitAuth, error) {
 	gitAuth := types.GitAuth{}
 
-	switch gitProviderFlag {
-	case "github":
-		if githubOrgFlag == "" {
-			return gitAuth, fmt.Errorf("please provide a GitHub organization using the --github-org flag")
-		}
-		if os.Getenv("GITHUB_TOKEN") == "" {
-			return gitAuth, fmt.Errorf("your GITHUB_TOKEN is not set. Please set and try again")
-		}
-
-		gitAuth.Owner = githubOrgFlag
-		gitAuth.Token = os.Getenv("GITHUB_TOKEN")
-
-		err := github.VerifyTokenPermissions(gitAuth.Token)
-		if err != nil {
-			return gitAuth, fmt.Errorf("error verifying GitHub token permissions: %w", err)
-		}
-
-		httpClient := http.DefaultClient
-		gitHubService := services.NewGitHubService(httpClient)
-		gitHubHandler := handlers.NewGitHubHandler(gitHubService)
-
-		log.Info().Msg("verifying GitHub authentication")
-		githubUser, err := gitHubHandler.GetGitHubUser(gitAuth.Token)
-		if err != nil {
-			return gitAuth, fmt.Errorf("error getting GitHub user: %w", err)
-		}
-
-		gitAuth.User = githubUser
-		viper.Set("github.user", githubUser)
-		err = viper.WriteConfig()
-		if err != nil {
-			return gitAuth, fmt.Errorf("error writing GitHub config: %w", err)
-		}
-		err = gitHubHandler.CheckGithubOrganizationPermissions(gitAuth.Token, githubOrgFlag, githubUser)
-		if err != nil {
-			return gitAuth, fmt.Errorf("error checking GitHub organization permissions: %w", err)
-		}
-		viper.Set("flags.github-owner", githubOrgFlag)
-		viper.WriteConfig()
-	case "gitlab":
-		if gitlabGroupFlag == "" {
-			return gitAuth, fmt.Errorf("please provide a GitLab group using the --gitlab-group flag")
-		}
-		if os.Getenv("GITLAB_TOKEN") == "" {
-			return gitAuth, fmt.Errorf("your GITLAB_TOKEN is not set. Please set and try again")
-		}
-
-		gitAuth.Token = os.Getenv("GITLAB_TOKEN")
-
-		err := gitlab.VerifyTokenPermissions(gitAuth.Token)
-		if err != nil {
-			return gitAuth, fmt.Errorf("error verifying GitLab token permissions: %w", err)
-		}
-
-		gitlabClient, err := gitlab.NewGitLabClient(gitAuth.Token, gitlabGroupFlag)
-		if err != nil {
-			return gitAuth, fmt.Errorf("error creating GitLab client: %w", err)
-		}
-
-		gitAuth.Owner = gitlabClient.ParentGroupPath
-		cGitlabOwnerGroupID := gitlabClient.ParentGroupID
-		log.Info().Msgf("set GitLab owner to %q", gitAuth.Owner)
-
-		user, _, err := gitlabClient.Client.Users.CurrentUser()
-		if err != nil {
-			return gitAuth, fmt.Errorf("unable to get authenticated user info - please make sure GITLAB_TOKEN env var is set: %w", err)
-		}
-		gitAuth.User = user.Username
+	if owner == "" {
+		return gitAuth, fmt.Errorf("please provide the owner of the new repositories using the %s flag", OwnerFlag(host.Provider))
+	}
+	provider, err := ConfiguredProvider(host)
+	if err != nil {
+		return gitAuth, err
+	}
+	gitAuth, err = provider.ValidateCredentials(ctx, owner)
+	if err != nil {
+		return gitAuth, err
+	}
 
-		viper.Set("flags.gitlab-owner", gitlabGroupFlag)
-		viper.Set("flags.gitlab-owner-group-id", cGitlabOwnerGroupID)
-		viper.WriteConfig()
-	default:
-		log.Printf("invalid git provider option: %q", gitProviderFlag)
-		return gitAuth, fmt.Errorf("invalid git provider: %q", gitProviderFlag)
+	viper.Set(fmt.Sprintf("flags.%s-owner", host.Provider), owner)
+	switch p := provider.(type) {
+	case *gitHubProvider:
+		viper.Set("github.user", gitAuth.User)
+	case *gitLabProvider:
+		viper.Set("flags.gitlab-owner-group-id", p.owner.GroupID)
+	}
+	if err := viper.WriteConfig(); err != nil {
+		return gitAuth, fmt.Errorf("error writing git provider config: %w", err)
 	}
 
 	return gitAuth, nil
 }
+
+// ConfiguredProvider returns the provider of host authenticated with the
+// token of its environment variable
+func ConfiguredProvider(host *Host) (GitProvider, error) {
+	tokenEnv := TokenEnv(host.Provider)
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		return nil, fmt.Errorf("your %s is not set. Please set and try again", tokenEnv)
+	}
+	return NewGitProvider(host, token)
+}
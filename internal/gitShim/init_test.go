@@ -0,0 +1,64 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializeGitProvider(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	config := filepath.Join(t.TempDir(), "kubefirst.yaml")
+	require.NoError(t, os.WriteFile(config, nil, 0o644))
+	viper.SetConfigFile(config)
+
+	server := fakeAPI(t, "token secret", map[string]any{
+		"/api/v1/repos/platform/gitops":               map[string]any{"empty": true},
+		"/api/v1/repos/platform/docs":                 map[string]any{"empty": false},
+		"/api/v1/orgs/platform/teams?page=1&limit=50": []map[string]any{{"name": "developers"}},
+	})
+	host, err := NewHost("gitea", "git.example.com", server.URL+"/api/v1")
+	require.NoError(t, err)
+
+	p := &GitInitParameters{
+		GitProvider:  "gitea",
+		GitToken:     "secret",
+		GitOwner:     "platform",
+		Repositories: []string{"metaphor"},
+		Teams:        []string{"admins"},
+		Host:         host,
+	}
+	require.NoError(t, InitializeGitProvider(context.Background(), p))
+	require.Equal(t, &CleanupOptions{Owner: "platform", Repositories: []string{"metaphor"}, Teams: []string{"admins"}}, RecordedResources())
+
+	p.Repositories = []string{"gitops", "metaphor"}
+	err = InitializeGitProvider(context.Background(), p)
+	require.ErrorContains(t, err, "must be removed")
+	require.ErrorContains(t, err, "https://git.example.com/platform/gitops")
+	require.NotContains(t, err.Error(), "platform/metaphor")
+
+	p.AdoptExisting = true
+	require.NoError(t, InitializeGitProvider(context.Background(), p))
+
+	p.Repositories = []string{"gitops", "docs"}
+	err = InitializeGitProvider(context.Background(), p)
+	require.ErrorContains(t, err, "not empty and can't be adopted")
+	require.ErrorContains(t, err, "https://git.example.com/platform/docs")
+	require.NotContains(t, err.Error(), "platform/gitops")
+
+	p.AdoptExisting = false
+	p.Repositories = []string{"metaphor"}
+	p.Teams = []string{"developers"}
+	require.ErrorContains(t, InitializeGitProvider(context.Background(), p), "https://git.example.com/org/platform/teams/developers")
+}
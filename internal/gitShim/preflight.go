@@ -0,0 +1,157 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Statuses of a preflight check
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// Check is the result of a preflight check
+type Check struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// PreflightOptions are the settings of the cluster the preflight checks
+// verify the git provider for
+type PreflightOptions struct {
+	Host         *Host
+	Token        string
+	Owner        string
+	Repositories []string
+	Teams        []string
+	GitProtocol  string
+}
+
+// Preflight runs every check of the git provider and returns their results,
+// a failing check doesn't stop the checks that don't depend on it
+func Preflight(ctx context.Context, opts PreflightOptions) []Check {
+	var checks []Check
+	add := func(name, status, detail string) {
+		checks = append(checks, Check{Name: name, Status: status, Detail: detail})
+	}
+	fail := func(name string, err error) {
+		add(name, CheckFail, err.Error())
+	}
+
+	tokenEnv := TokenEnv(opts.Host.Provider)
+	teamsCheck := "team collisions"
+	if opts.Host.Provider == "gitlab" {
+		teamsCheck = "subgroup collisions"
+	}
+	dependent := []string{"token scopes", "owner role", "repository collisions", teamsCheck, "registry access"}
+
+	if opts.GitProtocol == "ssh" {
+		if err := CheckKnownHost(opts.Host.Name); err != nil {
+			fail("known_hosts", err)
+		} else {
+			add("known_hosts", CheckPass, fmt.Sprintf("%s has a known SSH host key", opts.Host.Name))
+		}
+	} else {
+		add("known_hosts", CheckSkip, fmt.Sprintf("not needed with the %s protocol", opts.GitProtocol))
+	}
+
+	if opts.Token == "" {
+		fail("token", fmt.Errorf("%s is not set", tokenEnv))
+		for _, name := range dependent {
+			add(name, CheckSkip, fmt.Sprintf("requires %s", tokenEnv))
+		}
+		return checks
+	}
+	add("token", CheckPass, fmt.Sprintf("%s is set", tokenEnv))
+
+	provider, err := NewGitProvider(opts.Host, opts.Token)
+	if err != nil {
+		fail("token scopes", err)
+		return checks
+	}
+
+	user, err := provider.VerifyToken(ctx)
+	if err != nil {
+		fail("token scopes", err)
+		for _, name := range dependent[1:] {
+			add(name, CheckSkip, "requires a valid token")
+		}
+		return checks
+	}
+	add("token scopes", CheckPass, fmt.Sprintf("authenticated as %s", user))
+
+	if opts.Owner == "" {
+		fail("owner role", fmt.Errorf("please provide an owner using the %s flag", OwnerFlag(opts.Host.Provider)))
+		for _, name := range dependent[2:] {
+			add(name, CheckSkip, "requires an owner")
+		}
+		return checks
+	}
+	role, err := provider.CheckOwner(ctx, opts.Owner, user)
+	if err != nil {
+		fail("owner role", err)
+	} else {
+		add("owner role", CheckPass, fmt.Sprintf("%s is %s of %s", user, role, opts.Owner))
+	}
+
+	if status, detail, err := repositoryCollisions(ctx, provider, opts); err != nil {
+		fail("repository collisions", err)
+	} else {
+		add("repository collisions", status, detail)
+	}
+
+	existing, err := provider.ExistingTeams(ctx, opts.Owner, opts.Teams)
+	switch {
+	case err != nil:
+		fail(teamsCheck, err)
+	case len(existing) == 0:
+		add(teamsCheck, CheckPass, fmt.Sprintf("%s available", strings.Join(opts.Teams, ", ")))
+	default:
+		var urls []string
+		for _, name := range existing {
+			urls = append(urls, opts.Host.TeamURL(opts.Owner, name))
+		}
+		add(teamsCheck, CheckFail, fmt.Sprintf("already exist: %s", strings.Join(urls, ", ")))
+	}
+
+	switch err := provider.CheckRegistryAccess(ctx, opts.Owner); {
+	case errors.Is(err, ErrNoRegistry), errors.Is(err, ErrRegistryUnverified):
+		add("registry access", CheckSkip, err.Error())
+	case err != nil:
+		fail("registry access", err)
+	case opts.Host.Provider == "gitlab":
+		add("registry access", CheckPass, "group deploy tokens can be created")
+	default:
+		add("registry access", CheckPass, fmt.Sprintf("%s accepts %s", opts.Host.ContainerRegistryHost(), tokenEnv))
+	}
+
+	return checks
+}
+
+// repositoryCollisions checks the repositories of opts don't exist yet
+func repositoryCollisions(ctx context.Context, provider GitProvider, opts PreflightOptions) (string, string, error) {
+	existing, err := provider.ExistingRepositories(ctx, opts.Owner, opts.Repositories)
+	if err != nil {
+		return "", "", err
+	}
+	if len(existing) == 0 {
+		return CheckPass, fmt.Sprintf("%s available", strings.Join(opts.Repositories, ", ")), nil
+	}
+
+	var urls []string
+	for _, name := range existing {
+		urls = append(urls, opts.Host.RepositoryURL(opts.Owner, name))
+	}
+	return CheckFail, fmt.Sprintf("already exist: %s", strings.Join(urls, ", ")), nil
+}
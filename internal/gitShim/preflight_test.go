@@ -0,0 +1,69 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func checkStatuses(checks []Check) map[string]string {
+	statuses := make(map[string]string)
+	for _, check := range checks {
+		statuses[check.Name] = check.Status
+	}
+	return statuses
+}
+
+func TestPreflight(t *testing.T) {
+	server := fakeAPI(t, "token secret", map[string]any{
+		"/api/v1/user": map[string]any{"login": "kbot"},
+		"/api/v1/users/kbot/orgs/platform/permissions":   map[string]any{"is_owner": true, "can_create_repository": true},
+		"/api/v1/users/kbot/orgs/developers/permissions": map[string]any{"is_owner": false},
+		"/api/v1/repos/platform/metaphor":                map[string]any{"empty": false},
+		"/api/v1/orgs/platform/teams?page=1&limit=50":    []map[string]any{{"name": "admins"}},
+		"/api/v1/orgs/developers/teams?page=1&limit=50":  []map[string]any{},
+	})
+	host, err := NewHost("gitea", "git.example.com", server.URL+"/api/v1")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	opts := PreflightOptions{
+		Host:         host,
+		Token:        "secret",
+		Owner:        "platform",
+		Repositories: []string{"gitops", "metaphor"},
+		Teams:        []string{"admins", "developers"},
+		GitProtocol:  "https",
+	}
+	checks := Preflight(ctx, opts)
+	require.Equal(t, map[string]string{
+		"known_hosts":           CheckSkip,
+		"token":                 CheckPass,
+		"token scopes":          CheckPass,
+		"owner role":            CheckPass,
+		"repository collisions": CheckFail,
+		"team collisions":       CheckFail,
+		"registry access":       CheckSkip,
+	}, checkStatuses(checks))
+	require.Contains(t, checks[4].Detail, "https://git.example.com/platform/metaphor")
+	require.Contains(t, checks[5].Detail, "https://git.example.com/org/platform/teams/admins")
+
+	opts.Owner = "developers"
+	statuses := checkStatuses(Preflight(ctx, opts))
+	require.Equal(t, CheckFail, statuses["owner role"])
+	require.Equal(t, CheckPass, statuses["repository collisions"])
+	require.Equal(t, CheckPass, statuses["team collisions"])
+
+	opts.Token = ""
+	statuses = checkStatuses(Preflight(ctx, opts))
+	require.Equal(t, CheckFail, statuses["token"])
+	require.Equal(t, CheckSkip, statuses["owner role"])
+	require.Equal(t, CheckSkip, statuses["registry access"])
+}
@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/konstructio/kubefirst-api/pkg/types"
+)
+
+// ProvisioningProviders are the git providers the gitops template has
+// terraform for, the other providers are supported by the git checks only
+var ProvisioningProviders = []string{"github", "gitlab"}
+
+// CheckProvisioning verifies clusters can be provisioned with provider
+func CheckProvisioning(provider string) error {
+	if !slices.Contains(ProvisioningProviders, provider) {
+		return fmt.Errorf("git provider %q can't provision clusters yet - use one of %q", provider, ProvisioningProviders)
+	}
+	return nil
+}
+
+// ErrNoRegistry is returned by providers that don't serve a container registry
+var ErrNoRegistry = errors.New("the git provider has no container registry")
+
+// ErrRegistryUnverified is returned by providers that can't tell whether the
+// token pushes to their container registry
+var ErrRegistryUnverified = errors.New("the container registry access of the token can't be verified")
+
+// GitProvider is a git server kubefirst creates the gitops and metaphor
+// repositories and the teams on
+type GitProvider interface {
+	// Host returns the server of the provider
+	Host() *Host
+	// ValidateCredentials verifies the token is allowed to create the
+	// repositories and teams of owner and returns the resolved git auth
+	ValidateCredentials(ctx context.Context, owner string) (types.GitAuth, error)
+	// VerifyToken verifies the token has the scopes kubefirst needs and
+	// returns the user it belongs to
+	VerifyToken(ctx context.Context) (string, error)
+	// CheckOwner returns the role of user in owner, failing when it can't
+	// create the repositories and teams
+	CheckOwner(ctx context.Context, owner, user string) (string, error)
+	// CheckRegistryAccess verifies the token can create the credentials the
+	// cluster authenticates with the container registry
+	CheckRegistryAccess(ctx context.Context, owner string) error
+	// ExistingRepositories returns the repositories of names owner already has
+	ExistingRepositories(ctx context.Context, owner string, names []string) ([]string, error)
+	// RepositoryEmpty reports whether the existing repository name of owner
+	// has no commits
+	RepositoryEmpty(ctx context.Context, owner, name string) (bool, error)
+	// ExistingTeams returns the teams of names owner already has
+	ExistingTeams(ctx context.Context, owner string, names []string) ([]string, error)
+	// RegistryCredentials returns the credentials the cluster pushes images
+	// to the container registry of the provider with
+	RegistryCredentials(ctx context.Context, auth types.GitAuth) (*RegistryCredentials, error)
+}
+
+var (
+	_ GitProvider = (*gitHubProvider)(nil)
+	_ GitProvider = (*gitLabProvider)(nil)
+	_ GitProvider = (*giteaProvider)(nil)
+	_ GitProvider = (*bitbucketProvider)(nil)
+)
+
+// RegistryCredentials authenticate with a container registry
+type RegistryCredentials struct {
+	Host     string
+	Username string
+	Password string
+}
+
+// NewGitProvider returns the provider serving host authenticated with token
+func NewGitProvider(host *Host, token string) (GitProvider, error) {
+	switch host.Provider {
+	case "github":
+		client, err := host.GitHubClient(token)
+		if err != nil {
+			return nil, err
+		}
+		return &gitHubProvider{host: host, client: client, token: token}, nil
+	case "gitlab":
+		client, err := host.GitLabClient(token)
+		if err != nil {
+			return nil, err
+		}
+		return &gitLabProvider{host: host, client: client, token: token}, nil
+	case "gitea":
+		return newGiteaProvider(host, token), nil
+	case "bitbucket":
+		return newBitbucketProvider(host, token), nil
+	default:
+		return nil, fmt.Errorf("invalid git provider %q", host.Provider)
+	}
+}
+
+// TokenEnv returns the environment variable holding the token of provider
+func TokenEnv(provider string) string {
+	return strings.ToUpper(provider) + "_TOKEN"
+}
+
+// OwnerFlag returns the flag setting the owner of the repositories of provider
+func OwnerFlag(provider string) string {
+	switch provider {
+	case "github":
+		return "--github-org"
+	case "gitlab":
+		return "--gitlab-group"
+	default:
+		return "--git-owner"
+	}
+}
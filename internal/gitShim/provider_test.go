@@ -0,0 +1,137 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPI serves JSON bodies by request path, other paths respond 404
+func fakeAPI(t *testing.T, authorization string, bodies map[string]any) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, authorization, r.Header.Get("Authorization"))
+		body, ok := bodies[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGiteaProvider(t *testing.T) {
+	permissions := map[string]any{"is_owner": true, "can_create_repository": true}
+	server := fakeAPI(t, "token secret", map[string]any{
+		"/api/v1/user": map[string]any{"login": "kbot"},
+		"/api/v1/users/kbot/orgs/platform/permissions":   permissions,
+		"/api/v1/repos/platform/gitops":                  map[string]any{"name": "gitops"},
+		"/api/v1/orgs/platform/teams?page=1&limit=50":    []map[string]any{{"name": "Owners"}, {"name": "admins"}},
+		"/api/v1/users/kbot/orgs/developers/permissions": map[string]any{"is_owner": false, "can_create_repository": true},
+	})
+
+	host, err := NewHost("gitea", "git.example.com", server.URL+"/api/v1")
+	require.NoError(t, err)
+	provider, err := NewGitProvider(host, "secret")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	auth, err := provider.ValidateCredentials(ctx, "platform")
+	require.NoError(t, err)
+	require.Equal(t, types.GitAuth{Token: "secret", User: "kbot", Owner: "platform"}, auth)
+
+	_, err = provider.ValidateCredentials(ctx, "unknown")
+	require.ErrorContains(t, err, "could not find gitea organization unknown")
+
+	_, err = provider.ValidateCredentials(ctx, "developers")
+	require.ErrorContains(t, err, "make sure they are an `Owner` of developers")
+
+	repositories, err := provider.ExistingRepositories(ctx, "platform", []string{"gitops", "metaphor"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"gitops"}, repositories)
+
+	teams, err := provider.ExistingTeams(ctx, "platform", []string{"admins", "developers"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"admins"}, teams)
+
+	credentials, err := provider.RegistryCredentials(ctx, auth)
+	require.NoError(t, err)
+	require.Equal(t, &RegistryCredentials{Host: "git.example.com", Username: "kbot", Password: "secret"}, credentials)
+
+	err = InitializeGitProvider(ctx, &GitInitParameters{
+		GitProvider:  "gitea",
+		GitToken:     "secret",
+		GitOwner:     "platform",
+		Repositories: []string{"gitops", "metaphor"},
+		Host:         host,
+	})
+	require.ErrorContains(t, err, "https://git.example.com/platform/gitops")
+}
+
+func TestBitbucketProvider(t *testing.T) {
+	server := fakeAPI(t, "Bearer secret", map[string]any{
+		"/2.0/user": map[string]any{"username": "kbot"},
+		`/2.0/user/permissions/workspaces?q=workspace.slug%3D%22platform%22`: map[string]any{
+			"values": []map[string]any{{"permission": "owner"}},
+		},
+		`/2.0/user/permissions/workspaces?q=workspace.slug%3D%22shared%22`: map[string]any{
+			"values": []map[string]any{{"permission": "member"}},
+		},
+		`/2.0/user/permissions/workspaces?q=workspace.slug%3D%22unknown%22`: map[string]any{"values": []any{}},
+		"/2.0/repositories/platform/metaphor":                               map[string]any{"slug": "metaphor"},
+	})
+
+	host, err := NewHost("bitbucket", "", server.URL+"/2.0")
+	require.NoError(t, err)
+	require.False(t, host.SelfHosted())
+	provider, err := NewGitProvider(host, "secret")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	auth, err := provider.ValidateCredentials(ctx, "platform")
+	require.NoError(t, err)
+	require.Equal(t, types.GitAuth{Token: "secret", User: "kbot", Owner: "platform"}, auth)
+
+	_, err = provider.ValidateCredentials(ctx, "shared")
+	require.ErrorContains(t, err, "current role: member")
+
+	_, err = provider.ValidateCredentials(ctx, "unknown")
+	require.ErrorContains(t, err, "could not find bitbucket workspace unknown")
+
+	repositories, err := provider.ExistingRepositories(ctx, "platform", []string{"gitops", "metaphor"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"metaphor"}, repositories)
+
+	_, err = provider.RegistryCredentials(ctx, auth)
+	require.ErrorIs(t, err, ErrNoRegistry)
+}
+
+func TestNewHostProviders(t *testing.T) {
+	_, err := NewHost("gitea", "", "")
+	require.ErrorContains(t, err, "please set --git-host")
+
+	_, err = NewHost("bitbucket", "bitbucket.example.com", "")
+	require.ErrorContains(t, err, "only Bitbucket Cloud")
+
+	gitea, err := NewHost("gitea", "codeberg.org", "")
+	require.NoError(t, err)
+	require.Equal(t, "https://codeberg.org/api/v1", gitea.APIURL)
+	require.Equal(t, "https://codeberg.org/org/platform/teams/admins", gitea.TeamURL("platform", "admins"))
+	require.Equal(t, map[string]string{"GITEA_BASE_URL": "https://codeberg.org"}, gitea.TerraformEnv())
+
+	require.NoError(t, CheckProvisioning("gitlab"))
+	require.ErrorContains(t, CheckProvisioning("gitea"), "can't provision clusters yet")
+}
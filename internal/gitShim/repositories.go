@@ -0,0 +1,20 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+// Names of the repositories and teams kubefirst creates. They are fixed: the
+// kubefirst-api controller and the gitops template both hard-code them.
+const (
+	DefaultGitopsRepoName   = "gitops"
+	DefaultMetaphorRepoName = "metaphor"
+)
+
+// DefaultRepositoryNames are the repositories kubefirst creates
+var DefaultRepositoryNames = []string{DefaultGitopsRepoName, DefaultMetaphorRepoName}
+
+// DefaultTeamNames are the teams kubefirst creates
+var DefaultTeamNames = []string{"admins", "developers"}
@@ -0,0 +1,77 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/konstructio/kubefirst/internal/httpclient"
+)
+
+// errNotFound is returned by restClient when the API responds 404
+var errNotFound = errors.New("not found")
+
+// restClient calls the JSON API of the providers without a go client
+type restClient struct {
+	baseURL       string
+	authorization string
+	client        *http.Client
+}
+
+func newRESTClient(baseURL, authorization string) *restClient {
+	return &restClient{baseURL: baseURL, authorization: authorization, client: httpclient.New()}
+}
+
+// get decodes the response to path into out, skipped when out is nil
+func (c *restClient) get(ctx context.Context, path string, out any) (*http.Response, error) {
+	return c.do(ctx, http.MethodGet, path, out)
+}
+
+func (c *restClient) do(ctx context.Context, method, path string, out any) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to %q: %w", path, err)
+	}
+	req.Header.Set("Authorization", c.authorization)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s %q: %w", method, req.URL.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return resp, fmt.Errorf("%s %q: %w", method, req.URL.Redacted(), errNotFound)
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp, fmt.Errorf("%s %q returned %s: %s", method, req.URL.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("error decoding response of %q: %w", req.URL.Redacted(), err)
+		}
+	}
+	return resp, nil
+}
+
+// exists reports whether the resource at path exists
+func (c *restClient) exists(ctx context.Context, path string) (bool, error) {
+	_, err := c.get(ctx, path, nil)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,132 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v52/github"
+	"github.com/rs/zerolog/log"
+	"github.com/xanzy/go-gitlab"
+)
+
+// Webhook is the Atlantis webhook of a repository
+type Webhook struct {
+	URL    string
+	Secret string
+	// PreviousURL is updated to URL instead of creating another webhook,
+	// tunnels may change their URL
+	PreviousURL string
+}
+
+// Webhooker is a git provider which creates the Atlantis webhook when the
+// gitops template doesn't
+type Webhooker interface {
+	// EnsureWebhook creates hook on repository of owner, or updates the
+	// webhook at hook.PreviousURL
+	EnsureWebhook(ctx context.Context, owner, repository string, hook Webhook) error
+}
+
+var (
+	_ Webhooker = (*gitHubProvider)(nil)
+	_ Webhooker = (*gitLabProvider)(nil)
+)
+
+// EnsureWebhook creates the Atlantis webhook of repository with provider
+func EnsureWebhook(ctx context.Context, provider GitProvider, owner, repository string, hook Webhook) error {
+	webhooker, ok := provider.(Webhooker)
+	if !ok {
+		return fmt.Errorf("creating webhooks with git provider %q is not supported - use one of %q", provider.Host().Provider, ProvisioningProviders)
+	}
+	if err := webhooker.EnsureWebhook(ctx, owner, repository, hook); err != nil {
+		return fmt.Errorf("error creating the webhook of %q: %w", provider.Host().RepositoryURL(owner, repository), err)
+	}
+	return nil
+}
+
+// gitHubAtlantisEvents are the events Atlantis handles
+var gitHubAtlantisEvents = []string{"issue_comment", "pull_request", "pull_request_review", "push"}
+
+func (p *gitHubProvider) EnsureWebhook(ctx context.Context, owner, repository string, hook Webhook) error {
+	hooks, _, err := p.client.Repositories.ListHooks(ctx, owner, repository, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return fmt.Errorf("error listing webhooks: %w", err)
+	}
+
+	config := map[string]any{
+		"url":          hook.URL,
+		"content_type": "json",
+		"secret":       hook.Secret,
+		"insecure_ssl": "0",
+	}
+	for _, existing := range hooks {
+		existingURL, _ := existing.Config["url"].(string)
+		switch {
+		case existingURL == hook.URL:
+			log.Info().Msgf("the webhook %s already exists", hook.URL)
+			return nil
+		case hook.PreviousURL != "" && existingURL == hook.PreviousURL:
+			log.Info().Msgf("updating the webhook %s to %s", hook.PreviousURL, hook.URL)
+			_, _, err := p.client.Repositories.EditHook(ctx, owner, repository, existing.GetID(), &github.Hook{Config: config, Events: gitHubAtlantisEvents, Active: github.Bool(true)})
+			return err //nolint:wrapcheck // wrapped by EnsureWebhook
+		}
+	}
+
+	log.Info().Msgf("creating the webhook %s", hook.URL)
+	_, _, err = p.client.Repositories.CreateHook(ctx, owner, repository, &github.Hook{Config: config, Events: gitHubAtlantisEvents, Active: github.Bool(true)})
+	return err //nolint:wrapcheck // wrapped by EnsureWebhook
+}
+
+func (p *gitLabProvider) EnsureWebhook(ctx context.Context, owner, repository string, hook Webhook) error {
+	group, err := p.resolveOwner(ctx, owner)
+	if err != nil {
+		return err
+	}
+	project, resp, err := p.client.Projects.GetProject(group.GroupPath+"/"+repository, &gitlab.GetProjectOptions{}, gitlab.WithContext(ctx))
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("project %q does not exist", p.host.RepositoryURL(group.GroupPath, repository))
+	}
+	if err != nil {
+		return fmt.Errorf("error getting project: %w", err)
+	}
+
+	hooks, _, err := p.client.Projects.ListProjectHooks(project.ID, &gitlab.ListProjectHooksOptions{PerPage: 100}, gitlab.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error listing webhooks: %w", err)
+	}
+	for _, existing := range hooks {
+		switch {
+		case existing.URL == hook.URL:
+			log.Info().Msgf("the webhook %s already exists", hook.URL)
+			return nil
+		case hook.PreviousURL != "" && existing.URL == hook.PreviousURL:
+			log.Info().Msgf("updating the webhook %s to %s", hook.PreviousURL, hook.URL)
+			_, _, err := p.client.Projects.EditProjectHook(project.ID, existing.ID, &gitlab.EditProjectHookOptions{
+				URL:                   gitlab.Ptr(hook.URL),
+				Token:                 gitlab.Ptr(hook.Secret),
+				PushEvents:            gitlab.Ptr(true),
+				MergeRequestsEvents:   gitlab.Ptr(true),
+				NoteEvents:            gitlab.Ptr(true),
+				EnableSSLVerification: gitlab.Ptr(true),
+			}, gitlab.WithContext(ctx))
+			return err //nolint:wrapcheck // wrapped by EnsureWebhook
+		}
+	}
+
+	log.Info().Msgf("creating the webhook %s", hook.URL)
+	_, _, err = p.client.Projects.AddProjectHook(project.ID, &gitlab.AddProjectHookOptions{
+		URL:                   gitlab.Ptr(hook.URL),
+		Token:                 gitlab.Ptr(hook.Secret),
+		PushEvents:            gitlab.Ptr(true),
+		MergeRequestsEvents:   gitlab.Ptr(true),
+		NoteEvents:            gitlab.Ptr(true),
+		EnableSSLVerification: gitlab.Ptr(true),
+	}, gitlab.WithContext(ctx))
+	return err //nolint:wrapcheck // wrapped by EnsureWebhook
+}
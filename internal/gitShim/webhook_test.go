@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package gitShim //nolint:revive // allowed during refactoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitHubEnsureWebhook(t *testing.T) {
+	hooks := []map[string]any{{"id": 5, "config": map[string]any{"url": "https://old.trycloudflare.com/events"}}}
+	var requests []string
+	var config map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodGet {
+			json.NewEncoder(w).Encode(hooks)
+			return
+		}
+		var hook struct {
+			Config map[string]any `json:"config"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&hook))
+		config = hook.Config
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	host, err := NewHost("github", "github.example.com", server.URL+"/api/v3")
+	require.NoError(t, err)
+	provider, err := NewGitProvider(host, "token")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	hook := Webhook{URL: "https://new.trycloudflare.com/events", Secret: "secret", PreviousURL: "https://old.trycloudflare.com/events"}
+	require.NoError(t, EnsureWebhook(ctx, provider, "platform", "gitops", hook))
+	require.Equal(t, []string{"GET /api/v3/repos/platform/gitops/hooks", "PATCH /api/v3/repos/platform/gitops/hooks/5"}, requests)
+	require.Equal(t, "https://new.trycloudflare.com/events", config["url"])
+	require.Equal(t, "secret", config["secret"])
+
+	requests = nil
+	hook.PreviousURL = ""
+	require.NoError(t, EnsureWebhook(ctx, provider, "platform", "gitops", hook))
+	require.Equal(t, []string{"GET /api/v3/repos/platform/gitops/hooks", "POST /api/v3/repos/platform/gitops/hooks"}, requests)
+
+	requests = nil
+	hooks[0]["config"] = map[string]any{"url": hook.URL}
+	require.NoError(t, EnsureWebhook(ctx, provider, "platform", "gitops", hook))
+	require.Equal(t, []string{"GET /api/v3/repos/platform/gitops/hooks"}, requests)
+}
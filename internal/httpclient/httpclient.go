@@ -0,0 +1,113 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	gitclient "github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// CABundleEnv and InsecureSkipTLSVerifyEnv provide defaults for the
+	// matching flags, they also apply to calls made before flags are parsed
+	CABundleEnv              = "KUBEFIRST_CA_BUNDLE"
+	InsecureSkipTLSVerifyEnv = "KUBEFIRST_INSECURE_SKIP_TLS_VERIFY"
+)
+
+// Options controls how outbound TLS connections are verified
+type Options struct {
+	// CABundle is a PEM file of certificates trusted in addition to the system pool
+	CABundle string
+	// InsecureSkipTLSVerify disables certificate verification entirely
+	InsecureSkipTLSVerify bool
+}
+
+var (
+	mu      sync.RWMutex
+	current Options
+	rootCAs *x509.CertPool
+
+	// baseTransport is the standard library default transport, cloned
+	// before Configure replaces it
+	baseTransport = http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // the default transport is an *http.Transport
+)
+
+// DefaultOptions returns the options derived from the environment
+func DefaultOptions() Options {
+	insecure, _ := strconv.ParseBool(os.Getenv(InsecureSkipTLSVerifyEnv))
+	return Options{
+		CABundle:              os.Getenv(CABundleEnv),
+		InsecureSkipTLSVerify: insecure,
+	}
+}
+
+// Configure validates opts and applies them to every transport created
+// afterwards and to http.DefaultTransport, which the kubefirst-api helpers
+// using http.DefaultClient go through
+func Configure(opts Options) error {
+	var pool *x509.CertPool
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return fmt.Errorf("error reading CA bundle %q: %w", opts.CABundle, err)
+		}
+
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			log.Warn().Msgf("unable to load the system certificate pool, only trusting %q: %v", opts.CABundle, err)
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no PEM certificates found in CA bundle %q", opts.CABundle)
+		}
+	}
+
+	if opts.InsecureSkipTLSVerify {
+		log.Warn().Msg("TLS certificate verification is disabled for all outbound connections")
+	}
+
+	mu.Lock()
+	current = opts
+	rootCAs = pool
+	mu.Unlock()
+
+	http.DefaultTransport = NewTransport()
+
+	// git clones and pushes over https go through go-git's own client
+	gitclient.InstallProtocol("https", githttp.NewClient(New()))
+	return nil
+}
+
+// NewTransport returns a transport that honours HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY and trusts the configured CA bundle
+func NewTransport() *http.Transport {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	transport := baseTransport.Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		RootCAs:            rootCAs,
+		InsecureSkipVerify: current.InsecureSkipTLSVerify, //nolint:gosec // explicit opt-in through --insecure-skip-tls-verify
+	}
+	return transport
+}
+
+// New returns an HTTP client using NewTransport
+func New() *http.Client {
+	return &http.Client{Transport: NewTransport()}
+}
@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	t.Cleanup(func() { require.NoError(t, Configure(Options{})) })
+
+	res, err := New().Get(server.URL)
+	if err == nil {
+		res.Body.Close()
+	}
+	require.Error(t, err, "untrusted certificate should be rejected")
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, cert, 0o600))
+	require.NoError(t, Configure(Options{CABundle: bundle}))
+
+	res, err = New().Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	require.NoError(t, Configure(Options{InsecureSkipTLSVerify: true}))
+	res, err = New().Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+}
+
+func TestConfigureInvalidBundle(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(bundle, []byte("not a certificate"), 0o600))
+
+	require.ErrorContains(t, Configure(Options{CABundle: bundle}), "no PEM certificates")
+	require.ErrorContains(t, Configure(Options{CABundle: bundle + ".missing"}), "error reading CA bundle")
+}
+
+func TestConfigureDefaultTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	t.Cleanup(func() { require.NoError(t, Configure(Options{})) })
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, cert, 0o600))
+	require.NoError(t, Configure(Options{CABundle: bundle}))
+
+	// the kubefirst-api helpers use http.DefaultClient
+	res, err := http.DefaultClient.Get(server.URL)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+)
+
+// adoptPlanFile is the plan written to find the repositories to import
+const adoptPlanFile = "kubefirst-adopt.tfplan"
+
+// repositoryResourceTypes are the terraform resources creating a repository
+var repositoryResourceTypes = []string{"github_repository", "gitlab_project"}
+
+// ImportRepositories imports the existing repositories of names into the
+// state of the terraform at entrypoint, so its apply adopts them instead of
+// failing on a name that is taken. Only the repositories the plan creates are
+// imported, importID returns the id terraform imports a repository by.
+func ImportRepositories(terraformClient, entrypoint string, envs map[string]string, names []string, importID func(name string) string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	if _, err := runTerraform(terraformClient, entrypoint, envs, "init", "-input=false", "-no-color"); err != nil {
+		return err
+	}
+	if _, err := runTerraform(terraformClient, entrypoint, envs, "plan", "-input=false", "-no-color", "-out="+adoptPlanFile); err != nil {
+		return err
+	}
+	defer os.Remove(filepath.Join(entrypoint, adoptPlanFile))
+
+	plan, err := runTerraform(terraformClient, entrypoint, envs, "show", "-json", adoptPlanFile)
+	if err != nil {
+		return err
+	}
+	addresses, err := plannedRepositories(plan, names)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		address, planned := addresses[name]
+		if !planned {
+			continue
+		}
+		log.Info().Msgf("importing the existing repository %q as %s", name, address)
+		if _, err := runTerraform(terraformClient, entrypoint, envs, "import", "-input=false", "-no-color", address, importID(name)); err != nil {
+			return fmt.Errorf("failed to adopt repository %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// plannedRepositories returns the address of the repository resource of each
+// of names the terraform plan creates
+func plannedRepositories(plan []byte, names []string) (map[string]string, error) {
+	var parsed struct {
+		ResourceChanges []struct {
+			Address string `json:"address"`
+			Type    string `json:"type"`
+			Change  struct {
+				Actions []string `json:"actions"`
+				After   struct {
+					Name string `json:"name"`
+				} `json:"after"`
+			} `json:"change"`
+		} `json:"resource_changes"`
+	}
+	if err := json.Unmarshal(plan, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to read terraform plan: %w", err)
+	}
+
+	addresses := make(map[string]string)
+	for _, change := range parsed.ResourceChanges {
+		if !slices.Contains(repositoryResourceTypes, change.Type) || !slices.Contains(change.Change.Actions, "create") {
+			continue
+		}
+		if name := change.Change.After.Name; slices.Contains(names, name) {
+			addresses[name] = change.Address
+		}
+	}
+	return addresses, nil
+}
+
+// runTerraform runs terraform in dir with envs added to the environment and
+// returns its output
+func runTerraform(terraformClient, dir string, envs map[string]string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(terraformClient, args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for key, value := range envs {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		log.Error().Msgf("terraform %s for %q failed: %s", args[0], dir, stderr.String())
+		return nil, fmt.Errorf("terraform %s for %q failed: %w", args[0], dir, err)
+	}
+	return stdout.Bytes(), nil
+}
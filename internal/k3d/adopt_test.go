@@ -0,0 +1,58 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const adoptPlan = `{"resource_changes":[
+	{"address":"module.gitops.github_repository.repo","type":"github_repository","change":{"actions":["create"],"after":{"name":"gitops"}}},
+	{"address":"module.metaphor.github_repository.repo","type":"github_repository","change":{"actions":["create"],"after":{"name":"metaphor"}}},
+	{"address":"github_team.developers","type":"github_team","change":{"actions":["create"],"after":{"name":"gitops"}}},
+	{"address":"module.docs.github_repository.repo","type":"github_repository","change":{"actions":["no-op"],"after":{"name":"docs"}}}
+]}`
+
+func TestPlannedRepositories(t *testing.T) {
+	addresses, err := plannedRepositories([]byte(adoptPlan), []string{"gitops", "docs"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"gitops": "module.gitops.github_repository.repo"}, addresses)
+
+	_, err = plannedRepositories([]byte("not json"), []string{"gitops"})
+	require.ErrorContains(t, err, "failed to read terraform plan")
+}
+
+func TestImportRepositories(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	plan := filepath.Join(dir, "plan.json")
+	require.NoError(t, os.WriteFile(plan, []byte(adoptPlan), 0o600))
+
+	// the fake terraform records its arguments and prints the plan on show
+	terraformClient := filepath.Join(dir, "terraform")
+	script := "#!/bin/sh\necho \"$GITHUB_OWNER $*\" >> " + calls + "\nif [ \"$1\" = show ]; then cat " + plan + "; fi\n"
+	require.NoError(t, os.WriteFile(terraformClient, []byte(script), 0o700))
+
+	err := ImportRepositories(terraformClient, dir, map[string]string{"GITHUB_OWNER": "platform"}, []string{"gitops", "docs"}, func(name string) string {
+		return "platform/" + name
+	})
+	require.NoError(t, err)
+
+	recorded, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	require.Equal(t, `platform init -input=false -no-color
+platform plan -input=false -no-color -out=kubefirst-adopt.tfplan
+platform show -json kubefirst-adopt.tfplan
+platform import -input=false -no-color module.gitops.github_repository.repo platform/gitops
+`, string(recorded))
+
+	require.NoError(t, ImportRepositories(filepath.Join(dir, "missing"), dir, nil, nil, nil))
+}
@@ -0,0 +1,58 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/konstructio/kubefirst/internal/httpclient"
+)
+
+// argoCDSessionTimeout bounds the request creating an Argo CD session
+const argoCDSessionTimeout = 30 * time.Second
+
+// ArgoCDToken creates a session of username in the Argo CD at baseURL and
+// returns its token. The request honours the proxy settings, the certificate
+// of the local Argo CD isn't verified as it may still be self-signed.
+func ArgoCDToken(ctx context.Context, baseURL, username, password string) (string, error) {
+	transport := httpclient.NewTransport()
+	transport.TLSClientConfig.InsecureSkipVerify = true //nolint:gosec // the local Argo CD serves a self-signed certificate until cert-manager issues one
+	client := &http.Client{Transport: transport, Timeout: argoCDSessionTimeout}
+
+	payload, err := json.Marshal(map[string]string{"username": username, "password": password})
+	if err != nil {
+		return "", fmt.Errorf("unable to encode argocd session request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/api/v1/session", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("unable to create argocd session request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to retrieve argocd token: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to retrieve argocd token: status code was %d", res.StatusCode)
+	}
+
+	var session struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&session); err != nil {
+		return "", fmt.Errorf("unable to decode argocd token response: %w", err)
+	}
+	return session.Token, nil
+}
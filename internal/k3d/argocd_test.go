@@ -0,0 +1,38 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgoCDToken(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/session", r.URL.Path)
+		var session map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&session))
+		if session["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"token":"argocd-token"}`))
+	}))
+	defer server.Close()
+
+	token, err := ArgoCDToken(context.Background(), server.URL, "admin", "secret")
+	require.NoError(t, err)
+	require.Equal(t, "argocd-token", token)
+
+	_, err = ArgoCDToken(context.Background(), server.URL, "admin", "wrong")
+	require.EqualError(t, err, "unable to retrieve argocd token: status code was 401")
+}
@@ -0,0 +1,25 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	constants "github.com/konstructio/kubefirst-api/pkg/constants"
+)
+
+// Kustomizations k3d create applies itself before Argo CD syncs the gitops
+// repository
+const (
+	ArgoCDKustomization       = "argocd"
+	VaultHandlerKustomization = "vault-handler"
+)
+
+// KustomizationPaths are the remote kustomizations by name, bundles render
+// them ahead of time for installs without network access
+var KustomizationPaths = map[string]string{
+	ArgoCDKustomization:       "github.com:konstructio/manifests/argocd/k3d?ref=" + constants.KubefirstManifestRepoRef,
+	VaultHandlerKustomization: "github.com:konstructio/manifests.git/vault-handler/replicas-1",
+}
@@ -0,0 +1,86 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultLocalRegistryPort is the host port of the local registry
+	DefaultLocalRegistryPort = 5050
+
+	// registryContainerPort is the port the registry listens on in its container
+	registryContainerPort = 5000
+)
+
+// RegistryName returns the registry container created with clusterName
+func RegistryName(clusterName string) string {
+	return "k3d-" + clusterName + "-registry"
+}
+
+// LocalRegistryHost returns the host of the local registry, as used both from
+// this machine and from the cluster
+func (t *Topology) LocalRegistryHost() string {
+	if t.LocalRegistryPort == 0 {
+		return ""
+	}
+	return fmt.Sprintf("localhost:%d", t.LocalRegistryPort)
+}
+
+// LocalImage returns the reference of image in the local registry at host.
+// The registry of image is dropped, and name replaces its repository and tag
+// when set.
+func LocalImage(host, image, name string) (string, error) {
+	if name == "" {
+		name = repositoryOf(image)
+		if strings.Contains(name, "@") {
+			return "", fmt.Errorf("image %q is referenced by digest - set a name with a tag for the local registry", image)
+		}
+	}
+	if name == "" || strings.ContainsAny(name, " \t\n@") || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("invalid image name %q", name)
+	}
+
+	// a colon after the last slash is a tag
+	if !strings.Contains(name[strings.LastIndex(name, "/")+1:], ":") {
+		name += ":latest"
+	}
+	return host + "/" + name, nil
+}
+
+// repositoryOf returns image without its registry, which is the first path
+// component when it contains a dot or a port, or is localhost
+func repositoryOf(image string) string {
+	first, rest, ok := strings.Cut(image, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return rest
+	}
+	return image
+}
+
+// PushImage tags the local docker image as target and pushes it
+func PushImage(dockerClient, image, target string) error {
+	if _, stderr, err := shell.ExecShellReturnStrings(dockerClient, "tag", image, target); err != nil {
+		return fmt.Errorf("error tagging image %q as %q: %s: %w", image, target, strings.TrimSpace(stderr), err)
+	}
+
+	log.Info().Msgf("pushing %s", target)
+	_, stderr, err := shell.ExecShellReturnStrings(dockerClient, "push", target)
+	if err != nil {
+		if strings.Contains(stderr, "connection refused") {
+			err = errors.Join(err, errors.New("the local registry is not running - start the cluster with `kubefirst k3d start`"))
+		}
+		return fmt.Errorf("error pushing image %q: %s: %w", target, strings.TrimSpace(stderr), err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalImage(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    string
+		rename   string
+		expected string
+		err      string
+	}{
+		{name: "docker hub", image: "nginx", expected: "localhost:5050/nginx:latest"},
+		{name: "tag", image: "org/app:1.0", expected: "localhost:5050/org/app:1.0"},
+		{name: "registry", image: "ghcr.io/org/app:1.0", expected: "localhost:5050/org/app:1.0"},
+		{name: "registry port", image: "registry.local:5000/app", expected: "localhost:5050/app:latest"},
+		{name: "localhost", image: "localhost/app:dev", expected: "localhost:5050/app:dev"},
+		{name: "renamed", image: "ghcr.io/org/app:1.0", rename: "metaphor:dev", expected: "localhost:5050/metaphor:dev"},
+		{name: "digest", image: "nginx@sha256:0123", err: `image "nginx@sha256:0123" is referenced by digest`},
+		{name: "renamed digest", image: "nginx@sha256:0123", rename: "nginx:pinned", expected: "localhost:5050/nginx:pinned"},
+		{name: "invalid name", image: "nginx", rename: "my app", err: `invalid image name "my app"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image, err := LocalImage("localhost:5050", tt.image, tt.rename)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, image)
+		})
+	}
+}
+
+func TestLocalRegistry(t *testing.T) {
+	topology := DefaultTopology()
+	require.Empty(t, topology.LocalRegistryHost())
+
+	topology.LocalRegistryPort = DefaultLocalRegistryPort
+	require.Equal(t, "localhost:5050", topology.LocalRegistryHost())
+
+	args := topology.CreateArgs("kubefirst", "/k1", "/k1/registries.yaml")
+	require.Contains(t, args, "k3d-kubefirst-registry:0.0.0.0:5050")
+	require.Equal(t, []string{"--registry-config", "/k1/registries.yaml"}, args[len(args)-2:])
+
+	data, err := topology.registriesConfig("kubefirst")
+	require.NoError(t, err)
+	require.Equal(t, "mirrors:\n    localhost:5050:\n        endpoint:\n            - http://k3d-kubefirst-registry:5000\n", string(data))
+}
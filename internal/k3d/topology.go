@@ -0,0 +1,536 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultK3sImage is the node image of k3d clusters, kept in sync with kubefirst-api
+	DefaultK3sImage = "rancher/k3s:v1.28.12-k3s1"
+
+	// topologyKey is where the topology of the cluster is kept in the kubefirst config
+	topologyKey = "k3d-topology"
+
+	// ingressPort is the container port of the loadbalancer serving the platform ingress
+	ingressPort = "443"
+)
+
+var memoryPattern = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// RegistryMirror points pulls from a registry at mirror endpoints
+type RegistryMirror struct {
+	Registry  string   `yaml:"registry" mapstructure:"registry" json:"registry"`
+	Endpoints []string `yaml:"endpoints" mapstructure:"endpoints" json:"endpoints"`
+}
+
+// Topology is the shape of a k3d cluster
+type Topology struct {
+	Servers         int              `yaml:"servers" mapstructure:"servers" json:"servers"`
+	Agents          int              `yaml:"agents" mapstructure:"agents" json:"agents"`
+	AgentsMemory    string           `yaml:"agentsMemory" mapstructure:"agents-memory" json:"agents_memory"`
+	Image           string           `yaml:"image" mapstructure:"image" json:"image"`
+	Ports           []string         `yaml:"ports" mapstructure:"ports" json:"ports"`
+	Volumes         []string         `yaml:"volumes" mapstructure:"volumes" json:"volumes"`
+	RegistryMirrors []RegistryMirror `yaml:"registryMirrors" mapstructure:"registry-mirrors" json:"registry_mirrors"`
+	// LocalRegistryPort is the host port of the local registry, 0 when disabled
+	LocalRegistryPort int `yaml:"localRegistryPort" mapstructure:"local-registry-port" json:"local_registry_port"`
+}
+
+// topologySpec is a topology file, unset values keep their current setting
+type topologySpec struct {
+	Servers           *int             `yaml:"servers"`
+	Agents            *int             `yaml:"agents"`
+	AgentsMemory      string           `yaml:"agentsMemory"`
+	Image             string           `yaml:"image"`
+	Ports             []string         `yaml:"ports"`
+	Volumes           []string         `yaml:"volumes"`
+	RegistryMirrors   []RegistryMirror `yaml:"registryMirrors"`
+	LocalRegistryPort *int             `yaml:"localRegistryPort"`
+}
+
+// DefaultTopology returns the shape kubefirst has always created
+func DefaultTopology() *Topology {
+	return &Topology{
+		Servers:      1,
+		Agents:       3,
+		AgentsMemory: "1024m",
+		Image:        DefaultK3sImage,
+		Ports:        []string{ingressPort + ":" + ingressPort + "@loadbalancer"},
+	}
+}
+
+// AddTopologyFlags adds the topology flags of k3d create to cmd
+func AddTopologyFlags(cmd *cobra.Command) {
+	defaults := DefaultTopology()
+	cmd.Flags().String("topology-file", "", "a yaml file describing the cluster topology, flags override its values")
+	cmd.Flags().Int("servers", defaults.Servers, "the number of k3s server nodes")
+	cmd.Flags().Int("agents", defaults.Agents, "the number of k3s agent nodes")
+	cmd.Flags().String("agents-memory", defaults.AgentsMemory, "the memory limit of every agent node (i.e. 2g)")
+	cmd.Flags().String("k3s-image", defaults.Image, "the k3s node image")
+	cmd.Flags().StringArray("port", nil, "an additional port mapping, in k3d syntax (i.e. 8080:80@loadbalancer) - can be used any number of times")
+	cmd.Flags().StringArray("volume", nil, "an additional volume mount, in k3d syntax (i.e. ./src:/src@agent:*) - can be used any number of times")
+	cmd.Flags().StringArray("registry-mirror", nil, "a registry mirror as <registry>=<endpoint> (i.e. docker.io=https://mirror.gcr.io) - can be used any number of times")
+	cmd.Flags().Bool("local-registry", false, "create a local registry the cluster pulls from, push images to it with `kubefirst k3d registry push`")
+	cmd.Flags().Int("local-registry-port", DefaultLocalRegistryPort, "the host port of the local registry, implies --local-registry")
+}
+
+// TopologyFromFlags returns the topology selected by the flags added by
+// AddTopologyFlags. It starts from the topology persisted by a previous run,
+// or the default one, then applies the topology file and the flags set.
+func TopologyFromFlags(cmd *cobra.Command) (*Topology, error) {
+	topology, err := LoadTopology()
+	if err != nil {
+		return nil, err
+	}
+
+	topologyFile, err := cmd.Flags().GetString("topology-file")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topology-file flag: %w", err)
+	}
+	if topologyFile != "" {
+		if err := topology.mergeFile(topologyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("servers") {
+		if topology.Servers, err = flags.GetInt("servers"); err != nil {
+			return nil, fmt.Errorf("failed to get servers flag: %w", err)
+		}
+	}
+	if flags.Changed("agents") {
+		if topology.Agents, err = flags.GetInt("agents"); err != nil {
+			return nil, fmt.Errorf("failed to get agents flag: %w", err)
+		}
+	}
+	if flags.Changed("agents-memory") {
+		if topology.AgentsMemory, err = flags.GetString("agents-memory"); err != nil {
+			return nil, fmt.Errorf("failed to get agents-memory flag: %w", err)
+		}
+	}
+	if flags.Changed("k3s-image") {
+		if topology.Image, err = flags.GetString("k3s-image"); err != nil {
+			return nil, fmt.Errorf("failed to get k3s-image flag: %w", err)
+		}
+	}
+
+	ports, err := flags.GetStringArray("port")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get port flag: %w", err)
+	}
+	for _, port := range ports {
+		if !slices.Contains(topology.Ports, port) {
+			topology.Ports = append(topology.Ports, port)
+		}
+	}
+
+	volumes, err := flags.GetStringArray("volume")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get volume flag: %w", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	for _, volume := range volumes {
+		volume = absVolume(volume, cwd)
+		if !slices.Contains(topology.Volumes, volume) {
+			topology.Volumes = append(topology.Volumes, volume)
+		}
+	}
+
+	localRegistry, err := flags.GetBool("local-registry")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get local-registry flag: %w", err)
+	}
+	if localRegistry || flags.Changed("local-registry-port") {
+		if topology.LocalRegistryPort, err = flags.GetInt("local-registry-port"); err != nil {
+			return nil, fmt.Errorf("failed to get local-registry-port flag: %w", err)
+		}
+	}
+
+	mirrors, err := flags.GetStringArray("registry-mirror")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get registry-mirror flag: %w", err)
+	}
+	for _, mirror := range mirrors {
+		registry, endpoint, ok := strings.Cut(mirror, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid registry mirror %q - must be <registry>=<endpoint>", mirror)
+		}
+		topology.addMirror(registry, endpoint)
+	}
+
+	if err := topology.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid k3d topology: %w", err)
+	}
+	return topology, nil
+}
+
+// mergeFile overrides the topology with the values set in the yaml file path.
+// Relative volume sources are resolved from the directory of the file.
+func (t *Topology) mergeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading topology file %q: %w", path, err)
+	}
+
+	var spec topologySpec
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil {
+		return fmt.Errorf("error parsing topology file %q: %w", path, err)
+	}
+
+	if spec.Servers != nil {
+		t.Servers = *spec.Servers
+	}
+	if spec.Agents != nil {
+		t.Agents = *spec.Agents
+	}
+	if spec.AgentsMemory != "" {
+		t.AgentsMemory = spec.AgentsMemory
+	}
+	if spec.Image != "" {
+		t.Image = spec.Image
+	}
+	if spec.Ports != nil {
+		t.Ports = spec.Ports
+	}
+	if spec.Volumes != nil {
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return fmt.Errorf("error resolving directory of %q: %w", path, err)
+		}
+		t.Volumes = make([]string, 0, len(spec.Volumes))
+		for _, volume := range spec.Volumes {
+			t.Volumes = append(t.Volumes, absVolume(volume, dir))
+		}
+	}
+	if spec.RegistryMirrors != nil {
+		t.RegistryMirrors = spec.RegistryMirrors
+	}
+	if spec.LocalRegistryPort != nil {
+		t.LocalRegistryPort = *spec.LocalRegistryPort
+	}
+	return nil
+}
+
+func (t *Topology) addMirror(registry, endpoint string) {
+	for i := range t.RegistryMirrors {
+		if t.RegistryMirrors[i].Registry == registry {
+			if !slices.Contains(t.RegistryMirrors[i].Endpoints, endpoint) {
+				t.RegistryMirrors[i].Endpoints = append(t.RegistryMirrors[i].Endpoints, endpoint)
+			}
+			return
+		}
+	}
+	t.RegistryMirrors = append(t.RegistryMirrors, RegistryMirror{Registry: registry, Endpoints: []string{endpoint}})
+}
+
+// absVolume resolves the source of a relative volume mount from dir
+func absVolume(volume, dir string) string {
+	source, rest, ok := strings.Cut(volume, ":")
+	if !ok || filepath.IsAbs(source) {
+		return volume
+	}
+	if home, err := os.UserHomeDir(); err == nil && (source == "~" || strings.HasPrefix(source, "~/")) {
+		return filepath.Join(home, strings.TrimPrefix(source, "~")) + ":" + rest
+	}
+	return filepath.Join(dir, source) + ":" + rest
+}
+
+// Validate reports every invalid setting of the topology
+func (t *Topology) Validate() error {
+	var errs []error
+
+	if t.Servers < 1 {
+		errs = append(errs, fmt.Errorf("servers must be at least 1, got %d", t.Servers))
+	}
+	if t.Agents < 0 {
+		errs = append(errs, fmt.Errorf("agents must not be negative, got %d", t.Agents))
+	}
+	if t.AgentsMemory != "" && !memoryPattern.MatchString(t.AgentsMemory) {
+		errs = append(errs, fmt.Errorf("invalid agents memory %q - must be a number with an optional k, m or g unit", t.AgentsMemory))
+	}
+	if t.Image == "" || strings.ContainsAny(t.Image, " \t\n") {
+		errs = append(errs, fmt.Errorf("invalid k3s image %q", t.Image))
+	}
+
+	ingress := false
+	for _, port := range t.Ports {
+		containerPort, filter, err := parsePort(port)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if containerPort == ingressPort && (filter == "loadbalancer" || filter == "") {
+			ingress = true
+		}
+	}
+	if !ingress {
+		errs = append(errs, errors.New("a port mapping to 443 on the loadbalancer is required to reach the platform ingress (i.e. 443:443@loadbalancer)"))
+	}
+
+	for _, volume := range t.Volumes {
+		if err := validateVolume(volume); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if t.LocalRegistryPort < 0 || t.LocalRegistryPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid local registry port %d - must be between 1 and 65535, or 0 to disable it", t.LocalRegistryPort))
+	}
+
+	for _, mirror := range t.RegistryMirrors {
+		if mirror.Registry == "" {
+			errs = append(errs, errors.New("registry mirror without a registry"))
+			continue
+		}
+		if len(mirror.Endpoints) == 0 {
+			errs = append(errs, fmt.Errorf("registry mirror %q has no endpoint", mirror.Registry))
+		}
+		for _, endpoint := range mirror.Endpoints {
+			u, err := url.Parse(endpoint)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("invalid endpoint %q of registry mirror %q - must be an http or https url", endpoint, mirror.Registry))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parsePort returns the container port and node filter of a k3d port mapping
+// [HOST:][HOSTPORT:]CONTAINERPORT[/PROTOCOL][@NODEFILTER]
+func parsePort(port string) (string, string, error) {
+	mapping, filter, _ := strings.Cut(port, "@")
+	mapping, protocol, hasProtocol := strings.Cut(mapping, "/")
+	if hasProtocol && protocol != "tcp" && protocol != "udp" {
+		return "", "", fmt.Errorf("invalid port mapping %q - protocol must be tcp or udp", port)
+	}
+
+	parts := strings.Split(mapping, ":")
+	containerPort := parts[len(parts)-1]
+	for _, p := range parts[max(0, len(parts)-2):] {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("invalid port mapping %q - ports must be between 1 and 65535", port)
+		}
+	}
+	return containerPort, filter, nil
+}
+
+// validateVolume checks a k3d volume mount SOURCE:DEST[:MODE][@NODEFILTER]
+func validateVolume(volume string) error {
+	mount, _, _ := strings.Cut(volume, "@")
+	parts := strings.Split(mount, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("invalid volume %q - must be <source>:<destination>", volume)
+	}
+	if !filepath.IsAbs(parts[0]) {
+		return fmt.Errorf("invalid volume %q - the source must be an absolute path", volume)
+	}
+	if !strings.HasPrefix(parts[1], "/") {
+		return fmt.Errorf("invalid volume %q - the destination must be an absolute path", volume)
+	}
+	if _, err := os.Stat(parts[0]); err != nil {
+		return fmt.Errorf("invalid volume %q - the source does not exist: %w", volume, err)
+	}
+	return nil
+}
+
+// String summarizes the topology
+func (t *Topology) String() string {
+	summary := []string{
+		fmt.Sprintf("%d servers", t.Servers),
+		fmt.Sprintf("%d agents", t.Agents),
+		"image " + t.Image,
+	}
+	if len(t.Ports) > 0 {
+		summary = append(summary, "ports "+strings.Join(t.Ports, ", "))
+	}
+	if len(t.Volumes) > 0 {
+		summary = append(summary, "volumes "+strings.Join(t.Volumes, ", "))
+	}
+	if len(t.RegistryMirrors) > 0 {
+		registries := make([]string, 0, len(t.RegistryMirrors))
+		for _, mirror := range t.RegistryMirrors {
+			registries = append(registries, mirror.Registry)
+		}
+		summary = append(summary, "mirrors of "+strings.Join(registries, ", "))
+	}
+	if t.LocalRegistryPort != 0 {
+		summary = append(summary, "local registry "+t.LocalRegistryHost())
+	}
+	return strings.Join(summary, ", ")
+}
+
+// Save persists the topology in the kubefirst config
+func (t *Topology) Save() error {
+	mirrors := make([]map[string]any, 0, len(t.RegistryMirrors))
+	for _, mirror := range t.RegistryMirrors {
+		mirrors = append(mirrors, map[string]any{"registry": mirror.Registry, "endpoints": mirror.Endpoints})
+	}
+
+	viper.Set(topologyKey, map[string]any{
+		"servers":             t.Servers,
+		"agents":              t.Agents,
+		"agents-memory":       t.AgentsMemory,
+		"image":               t.Image,
+		"ports":               t.Ports,
+		"volumes":             t.Volumes,
+		"registry-mirrors":    mirrors,
+		"local-registry-port": t.LocalRegistryPort,
+	})
+	if err := viper.WriteConfig(); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+// LoadTopology returns the topology persisted in the kubefirst config, or the
+// default topology when none was persisted
+func LoadTopology() (*Topology, error) {
+	if settings, ok := viper.Get(topologyKey).(map[string]any); !ok || len(settings) == 0 {
+		return DefaultTopology(), nil
+	}
+
+	var topology Topology
+	if err := viper.UnmarshalKey(topologyKey, &topology); err != nil {
+		return nil, fmt.Errorf("failed to read k3d topology from config: %w", err)
+	}
+	return &topology, nil
+}
+
+func (t *Topology) hasRegistriesConfig() bool {
+	return len(t.RegistryMirrors) > 0 || t.LocalRegistryPort != 0
+}
+
+// RegistriesFile returns the k3s registries configuration written in k1Dir
+func RegistriesFile(k1Dir string) string {
+	return filepath.Join(k1Dir, "registries.yaml")
+}
+
+// registriesConfig renders the registry mirrors as a k3s registries.yaml
+func (t *Topology) registriesConfig(clusterName string) ([]byte, error) {
+	type endpoints struct {
+		Endpoint []string `yaml:"endpoint"`
+	}
+	mirrors := make(map[string]endpoints, len(t.RegistryMirrors)+1)
+	if t.LocalRegistryPort != 0 {
+		// images pushed to the local registry from this machine are pulled
+		// with the same reference from within the cluster
+		mirrors[t.LocalRegistryHost()] = endpoints{Endpoint: []string{fmt.Sprintf("http://%s:%d", RegistryName(clusterName), registryContainerPort)}}
+	}
+	for _, mirror := range t.RegistryMirrors {
+		mirrors[mirror.Registry] = endpoints{Endpoint: mirror.Endpoints}
+	}
+
+	data, err := yaml.Marshal(map[string]any{"mirrors": mirrors})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal registries configuration: %w", err)
+	}
+	return data, nil
+}
+
+// CreateArgs returns the arguments of `k3d cluster create` for the topology.
+// registriesFile is passed as the registry configuration when the topology
+// has registry mirrors or a local registry.
+func (t *Topology) CreateArgs(clusterName, k1Dir, registriesFile string) []string {
+	// eviction thresholds apply to the nodes running workloads
+	nodes := "agent:*"
+	if t.Agents == 0 {
+		nodes = "server:*"
+	}
+
+	args := []string{
+		"cluster", "create", clusterName,
+		"--image", t.Image,
+		"--servers", strconv.Itoa(t.Servers),
+		"--agents", strconv.Itoa(t.Agents),
+	}
+	if t.AgentsMemory != "" && t.Agents > 0 {
+		args = append(args, "--agents-memory", t.AgentsMemory)
+	}
+	registry := RegistryName(clusterName)
+	if t.LocalRegistryPort != 0 {
+		registry += fmt.Sprintf(":0.0.0.0:%d", t.LocalRegistryPort)
+	}
+	args = append(args,
+		"--registry-create", registry,
+		"--k3s-arg", "--kubelet-arg=eviction-hard=imagefs.available<1%,nodefs.available<1%@"+nodes,
+		"--k3s-arg", "--kubelet-arg=eviction-minimum-reclaim=imagefs.available=1%,nodefs.available=1%@"+nodes,
+		"--volume", filepath.Join(k1Dir, "minio-storage")+":/var/lib/rancher/k3s/storage@all",
+	)
+	for _, volume := range t.Volumes {
+		args = append(args, "--volume", volume)
+	}
+	for _, port := range t.Ports {
+		args = append(args, "--port", port)
+	}
+	if t.hasRegistriesConfig() {
+		args = append(args, "--registry-config", registriesFile)
+	}
+	return args
+}
+
+// ClusterCreate creates the k3d cluster clusterName with the topology and
+// writes its kubeconfig
+func ClusterCreate(clusterName, k1Dir, k3dClient, kubeconfig string, topology *Topology) error {
+	log.Info().Msgf("creating k3d cluster with %s", topology)
+
+	volumeDir := filepath.Join(k1Dir, "minio-storage")
+	if err := os.MkdirAll(volumeDir, os.ModePerm); err != nil {
+		return fmt.Errorf("error creating directory %q: %w", volumeDir, err)
+	}
+
+	registriesFile := RegistriesFile(k1Dir)
+	if topology.hasRegistriesConfig() {
+		registries, err := topology.registriesConfig(clusterName)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(registriesFile, registries, 0o644); err != nil {
+			return fmt.Errorf("error writing registries configuration %q: %w", registriesFile, err)
+		}
+	}
+
+	stdout, stderr, err := shell.ExecShellReturnStrings(k3dClient, topology.CreateArgs(clusterName, k1Dir, registriesFile)...)
+	if err != nil {
+		return fmt.Errorf("error creating k3d cluster: %s %s %w", stdout, stderr, err)
+	}
+
+	time.Sleep(20 * time.Second)
+
+	kubeconfigContent, _, err := shell.ExecShellReturnStrings(k3dClient, "kubeconfig", "get", clusterName)
+	if err != nil {
+		return fmt.Errorf("error getting kubeconfig: %w", err)
+	}
+	if err := os.WriteFile(kubeconfig, []byte(kubeconfigContent), 0o644); err != nil {
+		return fmt.Errorf("error writing kubeconfig %q: %w", kubeconfig, err)
+	}
+	return nil
+}
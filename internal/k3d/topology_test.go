@@ -0,0 +1,196 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func newTopologyCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	cmd := &cobra.Command{Use: "create"}
+	AddTopologyFlags(cmd)
+	require.NoError(t, cmd.ParseFlags(args))
+	return cmd
+}
+
+func TestTopologyFromFlagsDefault(t *testing.T) {
+	topology, err := TopologyFromFlags(newTopologyCommand(t))
+	require.NoError(t, err)
+	require.Equal(t, DefaultTopology(), topology)
+}
+
+func TestTopologyFromFlags(t *testing.T) {
+	src := t.TempDir()
+	cmd := newTopologyCommand(t,
+		"--agents", "5",
+		"--agents-memory", "2g",
+		"--k3s-image", "rancher/k3s:v1.30.4-k3s1",
+		"--port", "8080:80@loadbalancer",
+		"--volume", src+":/src@agent:*",
+		"--registry-mirror", "docker.io=https://mirror.gcr.io",
+		"--registry-mirror", "docker.io=https://registry.example.com",
+		"--local-registry",
+	)
+
+	topology, err := TopologyFromFlags(cmd)
+	require.NoError(t, err)
+	require.Equal(t, &Topology{
+		Servers:      1,
+		Agents:       5,
+		AgentsMemory: "2g",
+		Image:        "rancher/k3s:v1.30.4-k3s1",
+		Ports:        []string{"443:443@loadbalancer", "8080:80@loadbalancer"},
+		Volumes:      []string{src + ":/src@agent:*"},
+		RegistryMirrors: []RegistryMirror{
+			{Registry: "docker.io", Endpoints: []string{"https://mirror.gcr.io", "https://registry.example.com"}},
+		},
+		LocalRegistryPort: DefaultLocalRegistryPort,
+	}, topology)
+}
+
+func TestTopologyFromFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0o755))
+	file := filepath.Join(dir, "topology.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+servers: 3
+agents: 0
+ports:
+  - 8443:443@loadbalancer
+volumes:
+  - ./src:/src
+registryMirrors:
+  - registry: ghcr.io
+    endpoints: [http://localhost:5000]
+`), 0o644))
+
+	// flags override the file
+	topology, err := TopologyFromFlags(newTopologyCommand(t, "--topology-file", file, "--servers", "1"))
+	require.NoError(t, err)
+	require.Equal(t, &Topology{
+		Servers:         1,
+		Agents:          0,
+		AgentsMemory:    "1024m",
+		Image:           DefaultK3sImage,
+		Ports:           []string{"8443:443@loadbalancer"},
+		Volumes:         []string{filepath.Join(dir, "src") + ":/src"},
+		RegistryMirrors: []RegistryMirror{{Registry: "ghcr.io", Endpoints: []string{"http://localhost:5000"}}},
+	}, topology)
+}
+
+func TestTopologyFromFileUnknownField(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "topology.yaml")
+	require.NoError(t, os.WriteFile(file, []byte("nodes: 3\n"), 0o644))
+
+	_, err := TopologyFromFlags(newTopologyCommand(t, "--topology-file", file))
+	require.ErrorContains(t, err, "field nodes not found")
+}
+
+func TestTopologyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Topology)
+		err    string
+	}{
+		{name: "no server", modify: func(t *Topology) { t.Servers = 0 }, err: "servers must be at least 1, got 0"},
+		{name: "negative agents", modify: func(t *Topology) { t.Agents = -1 }, err: "agents must not be negative, got -1"},
+		{name: "memory", modify: func(t *Topology) { t.AgentsMemory = "lots" }, err: `invalid agents memory "lots"`},
+		{name: "image", modify: func(t *Topology) { t.Image = "" }, err: `invalid k3s image ""`},
+		{name: "port", modify: func(t *Topology) { t.Ports = append(t.Ports, "80:http") }, err: `invalid port mapping "80:http"`},
+		{name: "protocol", modify: func(t *Topology) { t.Ports = append(t.Ports, "53:53/sctp") }, err: "protocol must be tcp or udp"},
+		{name: "no ingress", modify: func(t *Topology) { t.Ports = []string{"8080:80@loadbalancer"} }, err: "a port mapping to 443 on the loadbalancer is required"},
+		{name: "relative volume", modify: func(t *Topology) { t.Volumes = []string{"src:/src"} }, err: "the source must be an absolute path"},
+		{name: "missing volume", modify: func(t *Topology) { t.Volumes = []string{"/does/not/exist:/src"} }, err: "the source does not exist"},
+		{name: "mirror endpoint", modify: func(t *Topology) {
+			t.RegistryMirrors = []RegistryMirror{{Registry: "docker.io", Endpoints: []string{"mirror.gcr.io"}}}
+		}, err: `invalid endpoint "mirror.gcr.io" of registry mirror "docker.io"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topology := DefaultTopology()
+			tt.modify(topology)
+			require.ErrorContains(t, topology.Validate(), tt.err)
+		})
+	}
+
+	require.NoError(t, DefaultTopology().Validate())
+}
+
+func TestTopologySaveLoad(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	config := filepath.Join(t.TempDir(), "kubefirst.yaml")
+	require.NoError(t, os.WriteFile(config, nil, 0o644))
+	viper.SetConfigFile(config)
+
+	topology := DefaultTopology()
+	topology.Agents = 1
+	topology.Volumes = []string{"/src:/src"}
+	topology.RegistryMirrors = []RegistryMirror{{Registry: "docker.io", Endpoints: []string{"https://mirror.gcr.io"}}}
+	require.NoError(t, topology.Save())
+
+	// read the persisted config back as a new command would
+	viper.Reset()
+	viper.SetConfigFile(config)
+	require.NoError(t, viper.ReadInConfig())
+	loaded, err := LoadTopology()
+	require.NoError(t, err)
+	require.Equal(t, topology, loaded)
+}
+
+func TestCreateArgs(t *testing.T) {
+	topology := DefaultTopology()
+	require.Equal(t, []string{
+		"cluster", "create", "kubefirst",
+		"--image", DefaultK3sImage,
+		"--servers", "1",
+		"--agents", "3",
+		"--agents-memory", "1024m",
+		"--registry-create", "k3d-kubefirst-registry",
+		"--k3s-arg", "--kubelet-arg=eviction-hard=imagefs.available<1%,nodefs.available<1%@agent:*",
+		"--k3s-arg", "--kubelet-arg=eviction-minimum-reclaim=imagefs.available=1%,nodefs.available=1%@agent:*",
+		"--volume", "/k1/minio-storage:/var/lib/rancher/k3s/storage@all",
+		"--port", "443:443@loadbalancer",
+	}, topology.CreateArgs("kubefirst", "/k1", "/k1/registries.yaml"))
+
+	topology.Agents = 0
+	topology.Volumes = []string{"/src:/src"}
+	topology.RegistryMirrors = []RegistryMirror{{Registry: "docker.io", Endpoints: []string{"https://mirror.gcr.io"}}}
+	require.Equal(t, []string{
+		"cluster", "create", "kubefirst",
+		"--image", DefaultK3sImage,
+		"--servers", "1",
+		"--agents", "0",
+		"--registry-create", "k3d-kubefirst-registry",
+		"--k3s-arg", "--kubelet-arg=eviction-hard=imagefs.available<1%,nodefs.available<1%@server:*",
+		"--k3s-arg", "--kubelet-arg=eviction-minimum-reclaim=imagefs.available=1%,nodefs.available=1%@server:*",
+		"--volume", "/k1/minio-storage:/var/lib/rancher/k3s/storage@all",
+		"--volume", "/src:/src",
+		"--port", "443:443@loadbalancer",
+		"--registry-config", "/k1/registries.yaml",
+	}, topology.CreateArgs("kubefirst", "/k1", "/k1/registries.yaml"))
+}
+
+func TestRegistriesConfig(t *testing.T) {
+	topology := DefaultTopology()
+	topology.RegistryMirrors = []RegistryMirror{{Registry: "docker.io", Endpoints: []string{"https://mirror.gcr.io"}}}
+
+	data, err := topology.registriesConfig("kubefirst")
+	require.NoError(t, err)
+	require.Equal(t, "mirrors:\n    docker.io:\n        endpoint:\n            - https://mirror.gcr.io\n", string(data))
+}
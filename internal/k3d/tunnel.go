@@ -0,0 +1,278 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Tunnel providers exposing the Atlantis webhook endpoint of a k3d cluster
+const (
+	// TunnelNgrok runs ngrok in the cluster with NGROK_AUTHTOKEN, set up by the gitops template
+	TunnelNgrok = "ngrok"
+	// TunnelCloudflared runs a cloudflared quick tunnel in the cluster, no account needed
+	TunnelCloudflared = "cloudflared"
+	// TunnelURL uses a public URL the user routes to Atlantis
+	TunnelURL = "url"
+	// TunnelDisabled creates no webhook, Atlantis is removed and Argo CD polls the repositories
+	TunnelDisabled = "disabled"
+)
+
+// TunnelProviders are the valid values of --tunnel
+var TunnelProviders = []string{TunnelNgrok, TunnelCloudflared, TunnelURL, TunnelDisabled}
+
+const (
+	// tunnelKey is where the tunnel of the cluster is kept in the kubefirst config
+	tunnelKey = "k3d-tunnel"
+
+	// CloudflaredNamespace is the namespace of the cloudflared quick tunnel
+	CloudflaredNamespace = "cloudflared"
+	// CloudflaredDeployment is the name of the cloudflared quick tunnel deployment
+	CloudflaredDeployment = "cloudflared"
+
+	cloudflaredImage = "cloudflare/cloudflared:2024.9.1"
+	atlantisService  = "http://atlantis.atlantis.svc.cluster.local:80"
+)
+
+var quickTunnelPattern = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+// Tunnel exposes the Atlantis webhook endpoint of a k3d cluster to the git provider
+type Tunnel struct {
+	Provider string `mapstructure:"provider" json:"provider"`
+	// URL is the public URL of Atlantis, set by the user or once the tunnel is up
+	URL string `mapstructure:"url" json:"url,omitempty"`
+}
+
+// AddTunnelFlags adds the tunnel flags of k3d create to cmd
+func AddTunnelFlags(cmd *cobra.Command) {
+	cmd.Flags().String("tunnel", "", fmt.Sprintf("the tunnel exposing the Atlantis webhook, one of %q - defaults to ngrok when NGROK_AUTHTOKEN is set, disabled otherwise", TunnelProviders))
+	cmd.Flags().String("tunnel-url", "", "the public https URL routed to Atlantis, implies --tunnel url")
+}
+
+// TunnelFromFlags returns the tunnel selected by the flags added by
+// AddTunnelFlags. It starts from the tunnel persisted by a previous run,
+// and defaults to ngrok when NGROK_AUTHTOKEN is set.
+func TunnelFromFlags(cmd *cobra.Command) (*Tunnel, error) {
+	tunnel, err := LoadTunnel()
+	if err != nil {
+		return nil, err
+	}
+	if !tunnelPersisted() && os.Getenv("NGROK_AUTHTOKEN") != "" {
+		tunnel = &Tunnel{Provider: TunnelNgrok}
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("tunnel") {
+		provider, err := flags.GetString("tunnel")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tunnel flag: %w", err)
+		}
+		if provider != tunnel.Provider {
+			tunnel = &Tunnel{Provider: provider}
+		}
+	}
+	if flags.Changed("tunnel-url") {
+		if tunnel.URL, err = flags.GetString("tunnel-url"); err != nil {
+			return nil, fmt.Errorf("failed to get tunnel-url flag: %w", err)
+		}
+		if !flags.Changed("tunnel") {
+			tunnel.Provider = TunnelURL
+		}
+	}
+
+	if err := tunnel.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid tunnel: %w", err)
+	}
+	return tunnel, nil
+}
+
+// Validate reports the invalid settings of the tunnel
+func (t *Tunnel) Validate() error {
+	if !slices.Contains(TunnelProviders, t.Provider) {
+		return fmt.Errorf("unknown tunnel provider %q - must be one of %q", t.Provider, TunnelProviders)
+	}
+
+	var errs []error
+	switch t.Provider {
+	case TunnelURL:
+		if t.URL == "" {
+			errs = append(errs, errors.New("the url tunnel requires --tunnel-url"))
+		} else if u, err := url.Parse(t.URL); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid tunnel url %q - must be an https URL", t.URL))
+		}
+	case TunnelDisabled:
+		if t.URL != "" {
+			errs = append(errs, errors.New("--tunnel-url can't be used with the disabled tunnel"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Atlantis reports whether Atlantis is installed, it needs a tunnel to
+// receive webhooks
+func (t *Tunnel) Atlantis() bool {
+	return t.Provider != TunnelDisabled
+}
+
+// ManagesWebhook reports whether kubefirst creates the Atlantis webhook
+// itself, the gitops template only knows about ngrok
+func (t *Tunnel) ManagesWebhook() bool {
+	return t.Provider == TunnelCloudflared || t.Provider == TunnelURL
+}
+
+// WebhookURL returns the Atlantis webhook URL, empty until the tunnel is up
+func (t *Tunnel) WebhookURL() string {
+	if t.URL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(t.URL, "/") + "/events"
+}
+
+func (t *Tunnel) String() string {
+	if t.URL == "" {
+		return t.Provider
+	}
+	return fmt.Sprintf("%s (%s)", t.Provider, t.URL)
+}
+
+// Save persists the tunnel in the kubefirst config
+func (t *Tunnel) Save() error {
+	viper.Set(tunnelKey, map[string]any{
+		"provider": t.Provider,
+		"url":      t.URL,
+	})
+	if err := viper.WriteConfig(); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
+
+func tunnelPersisted() bool {
+	settings, ok := viper.Get(tunnelKey).(map[string]any)
+	return ok && len(settings) > 0
+}
+
+// LoadTunnel returns the tunnel persisted in the kubefirst config. Clusters
+// created before the tunnel was configurable use ngrok when its authtoken
+// was saved, and have no tunnel otherwise.
+func LoadTunnel() (*Tunnel, error) {
+	if !tunnelPersisted() {
+		if viper.GetString("secrets.atlantis-ngrok-authtoken") != "" {
+			return &Tunnel{Provider: TunnelNgrok, URL: viper.GetString("ngrok.host")}, nil
+		}
+		return &Tunnel{Provider: TunnelDisabled}, nil
+	}
+
+	var tunnel Tunnel
+	if err := viper.UnmarshalKey(tunnelKey, &tunnel); err != nil {
+		return nil, fmt.Errorf("failed to read k3d tunnel from config: %w", err)
+	}
+	return &tunnel, nil
+}
+
+// StartCloudflared runs a cloudflared quick tunnel to Atlantis in the cluster
+// and returns its public URL. Quick tunnels get a new URL every time the
+// cloudflared pod restarts.
+func StartCloudflared(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: CloudflaredNamespace}}
+	_, err := clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("error creating namespace %q: %w", CloudflaredNamespace, err)
+	}
+
+	_, err = clientset.AppsV1().Deployments(CloudflaredNamespace).Create(ctx, cloudflaredDeployment(), metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", fmt.Errorf("error creating deployment %q: %w", CloudflaredDeployment, err)
+	}
+
+	log.Info().Msg("waiting for the cloudflared quick tunnel URL")
+	var tunnelURL string
+	err = wait.PollUntilContextTimeout(ctx, 5*time.Second, 5*time.Minute, true, func(ctx context.Context) (bool, error) {
+		tunnelURL, err = CloudflaredURL(ctx, clientset)
+		if err != nil {
+			log.Debug().Msgf("cloudflared tunnel is not ready: %v", err)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("the cloudflared quick tunnel did not come up: %w", err)
+	}
+	log.Info().Msgf("the cloudflared quick tunnel is %s", tunnelURL)
+	return tunnelURL, nil
+}
+
+// CloudflaredURL returns the URL of the running cloudflared quick tunnel
+func CloudflaredURL(ctx context.Context, clientset kubernetes.Interface) (string, error) {
+	pods, err := clientset.CoreV1().Pods(CloudflaredNamespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + CloudflaredDeployment})
+	if err != nil {
+		return "", fmt.Errorf("error listing cloudflared pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		logs, err := clientset.CoreV1().Pods(CloudflaredNamespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).DoRaw(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error reading the logs of pod %q: %w", pod.Name, err)
+		}
+		if tunnelURL := parseQuickTunnelURL(string(logs)); tunnelURL != "" {
+			return tunnelURL, nil
+		}
+	}
+	return "", errors.New("no running cloudflared pod has announced its URL")
+}
+
+// parseQuickTunnelURL returns the last quick tunnel URL announced in the
+// cloudflared logs
+func parseQuickTunnelURL(logs string) string {
+	urls := quickTunnelPattern.FindAllString(logs, -1)
+	if len(urls) == 0 {
+		return ""
+	}
+	return urls[len(urls)-1]
+}
+
+func cloudflaredDeployment() *appsv1.Deployment {
+	labels := map[string]string{"app": CloudflaredDeployment}
+	replicas := int32(1)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: CloudflaredDeployment, Namespace: CloudflaredNamespace, Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "cloudflared",
+						Image: cloudflaredImage,
+						Args:  []string{"tunnel", "--no-autoupdate", "--url", atlantisService},
+					}},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package k3d
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func newTunnelCommand(t *testing.T, args ...string) *cobra.Command {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	t.Setenv("NGROK_AUTHTOKEN", "")
+
+	cmd := &cobra.Command{Use: "create"}
+	AddTunnelFlags(cmd)
+	require.NoError(t, cmd.ParseFlags(args))
+	return cmd
+}
+
+func TestTunnelFromFlags(t *testing.T) {
+	tunnel, err := TunnelFromFlags(newTunnelCommand(t))
+	require.NoError(t, err)
+	require.Equal(t, &Tunnel{Provider: TunnelDisabled}, tunnel)
+
+	cmd := newTunnelCommand(t)
+	t.Setenv("NGROK_AUTHTOKEN", "token")
+	tunnel, err = TunnelFromFlags(cmd)
+	require.NoError(t, err)
+	require.Equal(t, &Tunnel{Provider: TunnelNgrok}, tunnel)
+
+	tunnel, err = TunnelFromFlags(newTunnelCommand(t, "--tunnel-url", "https://atlantis.example.com/"))
+	require.NoError(t, err)
+	require.Equal(t, &Tunnel{Provider: TunnelURL, URL: "https://atlantis.example.com/"}, tunnel)
+	require.Equal(t, "https://atlantis.example.com/events", tunnel.WebhookURL())
+	require.True(t, tunnel.ManagesWebhook())
+
+	tunnel, err = TunnelFromFlags(newTunnelCommand(t, "--tunnel", "cloudflared"))
+	require.NoError(t, err)
+	require.Equal(t, &Tunnel{Provider: TunnelCloudflared}, tunnel)
+	require.True(t, tunnel.Atlantis())
+	require.Empty(t, tunnel.WebhookURL())
+}
+
+func TestTunnelFromFlagsInvalid(t *testing.T) {
+	_, err := TunnelFromFlags(newTunnelCommand(t, "--tunnel", "localtunnel"))
+	require.ErrorContains(t, err, `unknown tunnel provider "localtunnel"`)
+
+	_, err = TunnelFromFlags(newTunnelCommand(t, "--tunnel", "url"))
+	require.ErrorContains(t, err, "the url tunnel requires --tunnel-url")
+
+	_, err = TunnelFromFlags(newTunnelCommand(t, "--tunnel-url", "http://atlantis.example.com"))
+	require.ErrorContains(t, err, "must be an https URL")
+
+	_, err = TunnelFromFlags(newTunnelCommand(t, "--tunnel", "disabled", "--tunnel-url", "https://atlantis.example.com"))
+	require.ErrorContains(t, err, "--tunnel-url can't be used with the disabled tunnel")
+}
+
+func TestTunnelSaveLoad(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	config := filepath.Join(t.TempDir(), "kubefirst.yaml")
+	require.NoError(t, os.WriteFile(config, nil, 0o644))
+	viper.SetConfigFile(config)
+
+	tunnel := &Tunnel{Provider: TunnelCloudflared, URL: "https://quick-brown-fox.trycloudflare.com"}
+	require.NoError(t, tunnel.Save())
+
+	// read the persisted config back as a new command would
+	viper.Reset()
+	viper.SetConfigFile(config)
+	require.NoError(t, viper.ReadInConfig())
+	loaded, err := LoadTunnel()
+	require.NoError(t, err)
+	require.Equal(t, tunnel, loaded)
+
+	// the persisted tunnel wins over NGROK_AUTHTOKEN
+	t.Setenv("NGROK_AUTHTOKEN", "token")
+	cmd := &cobra.Command{Use: "create"}
+	AddTunnelFlags(cmd)
+	loaded, err = TunnelFromFlags(cmd)
+	require.NoError(t, err)
+	require.Equal(t, tunnel, loaded)
+}
+
+func TestLoadTunnelLegacy(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	tunnel, err := LoadTunnel()
+	require.NoError(t, err)
+	require.Equal(t, &Tunnel{Provider: TunnelDisabled}, tunnel)
+
+	viper.Set("secrets.atlantis-ngrok-authtoken", "token")
+	viper.Set("ngrok.host", "https://abc.ngrok.io")
+	tunnel, err = LoadTunnel()
+	require.NoError(t, err)
+	require.Equal(t, &Tunnel{Provider: TunnelNgrok, URL: "https://abc.ngrok.io"}, tunnel)
+	require.Equal(t, "https://abc.ngrok.io/events", tunnel.WebhookURL())
+}
+
+func TestParseQuickTunnelURL(t *testing.T) {
+	logs := `2024-10-01T10:00:00Z INF Requesting new quick Tunnel on trycloudflare.com...
+2024-10-01T10:00:01Z INF +--------------------------------------------------------------------------------------------+
+2024-10-01T10:00:01Z INF |  Your quick Tunnel has been created! Visit it at (it may take some time to be reachable):  |
+2024-10-01T10:00:01Z INF |  https://quick-brown-fox.trycloudflare.com                                                 |
+2024-10-01T10:00:01Z INF +--------------------------------------------------------------------------------------------+
+`
+	require.Equal(t, "https://quick-brown-fox.trycloudflare.com", parseQuickTunnelURL(logs))
+	require.Empty(t, parseQuickTunnelURL("INF Requesting new quick Tunnel on trycloudflare.com..."))
+}
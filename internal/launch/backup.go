@@ -0,0 +1,243 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package launch
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/konstructio/kubefirst-api/pkg/configs"
+	apiTypes "github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/konstructio/kubefirst/internal/cluster"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// backupFormatVersion is bumped whenever the archive layout changes in a
+	// way older CLIs cannot read
+	backupFormatVersion = 1
+	backupManifestName  = "manifest.json"
+	backupClustersDir   = "clusters"
+)
+
+// BackupManifest describes the content of a console backup archive
+type BackupManifest struct {
+	Version          int       `json:"version"`
+	KubefirstVersion string    `json:"kubefirst_version"`
+	CreatedAt        time.Time `json:"created_at"`
+	Clusters         []string  `json:"clusters"`
+}
+
+// DefaultBackupPath returns a timestamped archive path outside of the console
+// cluster directory, so that it survives `launch down`
+func DefaultBackupPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting user's home directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.tar.gz", consoleClusterName, time.Now().UTC().Format("20060102-150405"))
+	return filepath.Join(homeDir, ".k1", "backups", name), nil
+}
+
+// Backup exports every cluster record known to the console API and writes
+// them to a versioned archive at outputPath
+func Backup(outputPath string) (int, error) {
+	clusters, err := cluster.GetClusters()
+	if err != nil {
+		return 0, fmt.Errorf("error listing clusters: %w", err)
+	}
+
+	exported := make([]apiTypes.Cluster, 0, len(clusters))
+	for _, c := range clusters {
+		log.Info().Msgf("exporting cluster %q", c.ClusterName)
+		record, err := cluster.ExportCluster(c.ClusterName)
+		if errors.Is(err, cluster.ErrNotFound) {
+			log.Info().Msgf("cluster %q was deleted while backing up, skipping", c.ClusterName)
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error exporting cluster %q: %w", c.ClusterName, err)
+		}
+		exported = append(exported, record)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o700); err != nil {
+		return 0, fmt.Errorf("error creating backup directory: %w", err)
+	}
+
+	// the archive contains git and cloud credentials
+	f, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("error creating backup file %q: %w", outputPath, err)
+	}
+	defer f.Close()
+
+	if err := writeBackupArchive(f, exported); err != nil {
+		return 0, fmt.Errorf("error writing backup archive %q: %w", outputPath, err)
+	}
+
+	log.Info().Msgf("backed up %d cluster(s) to %q", len(exported), outputPath)
+	return len(exported), nil
+}
+
+// Restore imports every cluster record found in the archive at archivePath
+// into the console API, skipping clusters that already exist
+func Restore(archivePath string) (int, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return 0, fmt.Errorf("error opening backup file %q: %w", archivePath, err)
+	}
+	defer f.Close()
+
+	_, clusters, err := readBackupArchive(f)
+	if err != nil {
+		return 0, fmt.Errorf("error reading backup archive %q: %w", archivePath, err)
+	}
+
+	restored := 0
+	for _, c := range clusters {
+		_, err := cluster.GetCluster(c.ClusterName)
+		if err == nil {
+			log.Info().Msgf("cluster %q already exists, skipping", c.ClusterName)
+			continue
+		}
+		if !errors.Is(err, cluster.ErrNotFound) {
+			return restored, fmt.Errorf("error checking for existing cluster %q: %w", c.ClusterName, err)
+		}
+
+		log.Info().Msgf("importing cluster %q", c.ClusterName)
+		if err := cluster.ImportCluster(c); err != nil {
+			return restored, fmt.Errorf("error importing cluster %q: %w", c.ClusterName, err)
+		}
+		restored++
+	}
+
+	return restored, nil
+}
+
+func writeBackupArchive(w io.Writer, clusters []apiTypes.Cluster) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	manifest := BackupManifest{
+		Version:          backupFormatVersion,
+		KubefirstVersion: configs.K1Version,
+		CreatedAt:        time.Now().UTC(),
+	}
+
+	for _, c := range clusters {
+		data, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling cluster %q: %w", c.ClusterName, err)
+		}
+		if err := writeTarFile(tw, fmt.Sprintf("%s/%s.json", backupClustersDir, c.ClusterName), data); err != nil {
+			return err
+		}
+		manifest.Clusters = append(manifest.Clusters, c.ClusterName)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling backup manifest: %w", err)
+	}
+	if err := writeTarFile(tw, backupManifestName, data); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("error closing tar writer: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("error closing gzip writer: %w", err)
+	}
+
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    int64(len(data)),
+		ModTime: time.Now().UTC(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("error writing header for %q: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("error writing %q: %w", name, err)
+	}
+	return nil
+}
+
+func readBackupArchive(r io.Reader) (*BackupManifest, []apiTypes.Cluster, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	defer gr.Close()
+
+	var manifest *BackupManifest
+	records := map[string]apiTypes.Cluster{}
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading archive entry: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading %q: %w", hdr.Name, err)
+		}
+
+		switch {
+		case hdr.Name == backupManifestName:
+			manifest = &BackupManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, nil, fmt.Errorf("error parsing backup manifest: %w", err)
+			}
+		case strings.HasPrefix(hdr.Name, backupClustersDir+"/"):
+			var c apiTypes.Cluster
+			if err := json.Unmarshal(data, &c); err != nil {
+				return nil, nil, fmt.Errorf("error parsing %q: %w", hdr.Name, err)
+			}
+			records[c.ClusterName] = c
+		}
+	}
+
+	if manifest == nil {
+		return nil, nil, errors.New("archive does not contain a backup manifest")
+	}
+	if manifest.Version > backupFormatVersion {
+		return nil, nil, fmt.Errorf("backup format version %d is newer than supported version %d - please upgrade kubefirst", manifest.Version, backupFormatVersion)
+	}
+
+	clusters := make([]apiTypes.Cluster, 0, len(manifest.Clusters))
+	for _, name := range manifest.Clusters {
+		c, ok := records[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("cluster %q is listed in the manifest but missing from the archive", name)
+		}
+		clusters = append(clusters, c)
+	}
+
+	return manifest, clusters, nil
+}
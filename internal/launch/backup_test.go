@@ -0,0 +1,81 @@
+package launch
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"testing"
+
+	apiTypes "github.com/konstructio/kubefirst-api/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupArchiveRoundTrip(t *testing.T) {
+	clusters := []apiTypes.Cluster{
+		{ClusterName: "mgmt", CloudProvider: "civo", GitAuth: apiTypes.GitAuth{Owner: "org", Token: "secret"}},
+		{ClusterName: "workload-1", CloudProvider: "aws", ClusterType: "workload"},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeBackupArchive(&buf, clusters))
+
+	manifest, restored, err := readBackupArchive(&buf)
+	require.NoError(t, err)
+	require.Equal(t, backupFormatVersion, manifest.Version)
+	require.Equal(t, []string{"mgmt", "workload-1"}, manifest.Clusters)
+	require.Equal(t, clusters, restored)
+}
+
+func TestReadBackupArchive(t *testing.T) {
+	archive := func(t *testing.T, files map[string]any) *bytes.Buffer {
+		t.Helper()
+
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for name, content := range files {
+			data, err := json.Marshal(content)
+			require.NoError(t, err)
+			require.NoError(t, writeTarFile(tw, name, data))
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		return &buf
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]any
+		wantErr string
+	}{
+		{
+			name: "missing manifest",
+			files: map[string]any{
+				"clusters/mgmt.json": apiTypes.Cluster{ClusterName: "mgmt"},
+			},
+			wantErr: "does not contain a backup manifest",
+		},
+		{
+			name: "newer format version",
+			files: map[string]any{
+				backupManifestName: BackupManifest{Version: backupFormatVersion + 1},
+			},
+			wantErr: "newer than supported version",
+		},
+		{
+			name: "cluster listed but missing",
+			files: map[string]any{
+				backupManifestName: BackupManifest{Version: backupFormatVersion, Clusters: []string{"mgmt"}},
+			},
+			wantErr: `cluster "mgmt" is listed in the manifest`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readBackupArchive(archive(t, tt.files))
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
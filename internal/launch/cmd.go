@@ -18,10 +18,11 @@ import (
 	shell "github.com/konstructio/kubefirst-api/pkg/shell"
 	pkg "github.com/konstructio/kubefirst-api/pkg/utils"
 
-	"github.com/konstructio/kubefirst-api/pkg/downloadManager"
 	"github.com/konstructio/kubefirst-api/pkg/k3d"
 	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	"github.com/konstructio/kubefirst/internal/bundle"
 	"github.com/konstructio/kubefirst/internal/helm"
+	"github.com/konstructio/kubefirst/internal/tools"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
@@ -32,8 +33,25 @@ import (
 // Describes the local kubefirst console cluster name
 var consoleClusterName = "kubefirst-console"
 
-// Up
-func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemetry bool) error {
+// Up creates or reuses a local cluster with the selected runtime and installs
+// the Kubefirst console and API into it
+func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemetry bool, runtimeOpts RuntimeOptions, bundlePath string) error {
+	rt, err := newRuntime(runtimeOpts)
+	if err != nil {
+		return err
+	}
+
+	var installBundle *bundle.Bundle
+	if bundlePath != "" {
+		if !rt.ownsCluster() {
+			return fmt.Errorf("--bundle is not supported with the %q runtime", rt.name())
+		}
+		installBundle, err = bundle.Open(bundlePath)
+		if err != nil {
+			return fmt.Errorf("error opening bundle: %w", err)
+		}
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return fmt.Errorf("error getting user's home directory: %w", err)
@@ -55,210 +73,60 @@ func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemet
 	}
 
 	log.Info().Msgf("%s/%s", k3d.LocalhostOS, k3d.LocalhostARCH)
-	// Download k3d
-	k3dClient := fmt.Sprintf("%s/k3d", toolsDir)
-	_, err = os.Stat(k3dClient)
+	toolManager, err := tools.NewManager()
 	if err != nil {
-		log.Info().Msg("Downloading k3d...")
-		k3dDownloadURL := fmt.Sprintf(
-			"https://github.com/k3d-io/k3d/releases/download/%s/k3d-%s-%s",
-			k3d.K3dVersion,
-			k3d.LocalhostOS,
-			k3d.LocalhostARCH,
-		)
-		err = downloadManager.DownloadFile(k3dClient, k3dDownloadURL)
-		if err != nil {
-			return fmt.Errorf("error while trying to download k3d: %w", err)
-		}
-		err = os.Chmod(k3dClient, 0o755)
-		if err != nil {
-			return fmt.Errorf("error changing permissions of k3d client: %w", err)
-		}
-	} else {
-		log.Info().Msg("k3d is already installed, continuing")
+		return fmt.Errorf("error creating tool manager: %w", err)
 	}
-
-	// Download helm
-	helmClient := fmt.Sprintf("%s/helm", toolsDir)
-	_, err = os.Stat(helmClient)
-	if err != nil {
-		log.Info().Msg("Downloading helm...")
-		helmVersion := "v3.12.0"
-		helmDownloadURL := fmt.Sprintf(
-			"https://get.helm.sh/helm-%s-%s-%s.tar.gz",
-			helmVersion,
-			k3d.LocalhostOS,
-			k3d.LocalhostARCH,
-		)
-		helmDownloadTarGzPath := fmt.Sprintf("%s/helm.tar.gz", toolsDir)
-		err = downloadManager.DownloadFile(helmDownloadTarGzPath, helmDownloadURL)
-		if err != nil {
-			return fmt.Errorf("error while trying to download helm: %w", err)
-		}
-		helmTarDownload, err := os.Open(helmDownloadTarGzPath)
-		if err != nil {
-			return fmt.Errorf("could not read helm download content: %w", err)
-		}
-		downloadManager.ExtractFileFromTarGz(
-			helmTarDownload,
-			fmt.Sprintf("%s-%s/helm", k3d.LocalhostOS, k3d.LocalhostARCH),
-			helmClient,
-		)
-		err = os.Chmod(helmClient, 0o755)
-		if err != nil {
-			return fmt.Errorf("error changing permissions of helm client: %w", err)
+	if installBundle != nil {
+		if _, err := toolManager.Import(installBundle.ToolsCacheDir()); err != nil {
+			return fmt.Errorf("error importing tools from bundle: %w", err)
 		}
-		os.Remove(helmDownloadTarGzPath)
-	} else {
-		log.Info().Msg("helm is already installed, continuing")
 	}
-
-	// Download mkcert
-	mkcertClient := fmt.Sprintf("%s/mkcert", toolsDir)
-	_, err = os.Stat(mkcertClient)
-	if err != nil {
-		log.Info().Msg("Downloading mkcert...")
-		mkcertDownloadURL := fmt.Sprintf(
-			"https://github.com/FiloSottile/mkcert/releases/download/%s/mkcert-%s-%s-%s",
-			"v1.4.4",
-			"v1.4.4",
-			k3d.LocalhostOS,
-			k3d.LocalhostARCH,
-		)
-		err = downloadManager.DownloadFile(mkcertClient, mkcertDownloadURL)
-		if err != nil {
-			return fmt.Errorf("error while trying to download mkcert: %w", err)
-		}
-		err = os.Chmod(mkcertClient, 0o755)
-		if err != nil {
-			return fmt.Errorf("error changing permissions of mkcert client: %w", err)
-		}
-	} else {
-		log.Info().Msg("mkcert is already installed, continuing")
+	requiredTools := append(rt.requiredTools(), tools.Helm, tools.Mkcert)
+	if err := toolManager.Install(ctx, toolsDir, requiredTools...); err != nil {
+		return fmt.Errorf("error installing tools: %w", err)
 	}
+	helmClient := fmt.Sprintf("%s/helm", toolsDir)
+	mkcertClient := fmt.Sprintf("%s/mkcert", toolsDir)
 
-	// Create k3d cluster
+	// Create or connect to the cluster
 	kubeconfigPath := fmt.Sprintf("%s/.k1/%s/kubeconfig", homeDir, consoleClusterName)
-	_, _, err = shell.ExecShellReturnStrings(
-		k3dClient,
-		"cluster",
-		"get",
-		consoleClusterName,
-	)
-	if err != nil {
-		log.Warn().Msg("k3d cluster does not exist and will be created")
-		log.Info().Msg("Creating k3d cluster for Kubefirst console and API...")
-		err = k3d.ClusterCreateConsoleAPI(
-			consoleClusterName,
-			fmt.Sprintf("%s/.k1", homeDir),
-			k3dClient,
-			fmt.Sprintf("%s/kubeconfig", dir),
-		)
-		if err != nil {
-			return fmt.Errorf("error creating k3d cluster: %w", err)
-		}
-
-		log.Info().Msg("k3d cluster for Kubefirst console and API created successfully")
-
-		// Wait for traefik
-		kcfg, err := k8s.CreateKubeConfig(false, kubeconfigPath)
-		if err != nil {
-			return fmt.Errorf("error creating kubernetes client: %w", err)
-		}
-
-		log.Info().Msg("Waiting for traefik...")
-		traefikDeployment, err := k8s.ReturnDeploymentObject(
-			kcfg.Clientset,
-			"app.kubernetes.io/name",
-			"traefik",
-			"kube-system",
-			240,
-		)
-		if err != nil {
-			return fmt.Errorf("error looking for traefik: %w", err)
-		}
-		_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, traefikDeployment, 120)
-		if err != nil {
-			return fmt.Errorf("error waiting for traefik: %w", err)
-		}
+	if err := rt.ensureCluster(dir, kubeconfigPath); err != nil {
+		return err
 	}
 
-	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
-		_, _, err := shell.ExecShellReturnStrings(
-			k3dClient,
-			"kubeconfig",
-			"write",
-			consoleClusterName,
-			"-o",
-			kubeconfigPath,
-		)
-		if err != nil {
-			return fmt.Errorf("error getting kubeconfig: %w", err)
+	if installBundle != nil && installBundle.ImagesArchive() != "" {
+		log.Info().Msg("Loading bundled images into the cluster...")
+		if err := rt.importImages(toolsDir, installBundle.ImagesArchive()); err != nil {
+			return err
 		}
 	}
 
+	viper.Set("launch.runtime", rt.name())
+	viper.Set("launch.kubeconfig", kubeconfigPath)
+	viper.WriteConfig()
+
 	// Establish Kubernetes client for console cluster
 	kcfg, err := k8s.CreateKubeConfig(false, kubeconfigPath)
 	if err != nil {
 		return fmt.Errorf("error creating kubernetes client: %w", err)
 	}
 
-	// Determine if helm chart repository has already been added
-	res, _, err := shell.ExecShellReturnStrings(
-		helmClient,
-		"repo",
-		"list",
-		"-o",
-		"yaml",
-	)
-	if err != nil {
-		return fmt.Errorf("error listing current helm repositories: %w", err)
-	}
-
-	var existingHelmRepositories []helm.Repo
-	repoExists := false
-
-	err = yaml.Unmarshal([]byte(res), &existingHelmRepositories)
-	if err != nil {
-		return fmt.Errorf("could not get existing helm repositories: %w", err)
-	}
-
-	for _, repo := range existingHelmRepositories {
-		if repo.Name == helmChartRepoName && repo.URL == helmChartRepoURL {
-			repoExists = true
-		}
-	}
-
-	if !repoExists {
-		// Add helm chart repository
-		_, _, err = shell.ExecShellReturnStrings(
-			helmClient,
-			"repo",
-			"add",
-			helmChartRepoName,
-			helmChartRepoURL,
-		)
+	chartRef := fmt.Sprintf("%s/%s", helmChartRepoName, helmChartName)
+	chartVersionFlags := []string{"--version", helmChartVersion}
+	if installBundle != nil {
+		// charts are installed from the bundle, without a chart repository
+		chartRef, err = installBundle.ChartPath(helmChartName)
 		if err != nil {
-			return fmt.Errorf("error adding helm chart repository: %w", err)
+			return fmt.Errorf("error reading console chart from bundle: %w", err)
 		}
-		log.Info().Msg("Added Kubefirst helm chart repository")
-	} else {
-		log.Info().Msg("Kubefirst helm chart repository already added")
-	}
-
-	// Update helm chart repository locally
-	_, _, err = shell.ExecShellReturnStrings(
-		helmClient,
-		"repo",
-		"update",
-	)
-	if err != nil {
-		return fmt.Errorf("error updating helm chart repository: %w", err)
+		chartVersionFlags = nil
+	} else if err := addHelmRepository(helmClient); err != nil {
+		return err
 	}
-	log.Info().Msg("Kubefirst helm chart repository updated")
 
 	// Determine if helm release has already been installed
-	res, _, err = shell.ExecShellReturnStrings(
+	res, _, err := shell.ExecShellReturnStrings(
 		helmClient,
 		"--kubeconfig",
 		kubeconfigPath,
@@ -295,11 +163,7 @@ func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemet
 			"--namespace",
 			namespace,
 			helmChartName,
-			"--version",
-			helmChartVersion,
-			"konstruct/kubefirst",
-			"--set",
-			"console.ingress.createTraefikRoute=true",
+			chartRef,
 			"--set",
 			fmt.Sprintf("global.kubefirstVersion=%s", configs.K1Version),
 			"--set",
@@ -331,6 +195,12 @@ func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemet
 			"--devel",
 		}
 
+		installFlags = append(installFlags, chartVersionFlags...)
+
+		for _, f := range rt.chartValues() {
+			installFlags = append(installFlags, "--set", f)
+		}
+
 		if len(additionalHelmFlags) > 0 {
 			for _, f := range additionalHelmFlags {
 				installFlags = append(installFlags, "--set")
@@ -346,6 +216,9 @@ func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemet
 			return fmt.Errorf("error installing helm chart: %w", err)
 		}
 
+		viper.Set("launch.chart-installed", true)
+		viper.WriteConfig()
+
 		log.Info().Msg("Kubefirst console helm chart installed successfully")
 	} else {
 		log.Info().Msg("Kubefirst console helm chart already installed")
@@ -436,7 +309,12 @@ func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemet
 		log.Info().Msg("Created Kubernetes Secret for certificate")
 	}
 
-	if !inCluster {
+	if !inCluster && rt.name() != RuntimeK3d {
+		log.Info().Msg("Kubefirst Console is installed, the cluster has no traefik ingress so reach it with a port-forward:")
+		log.Info().Msg(fmt.Sprintf("	kubectl --kubeconfig %q -n %s port-forward svc/kubefirst-console 8080:80", kubeconfigPath, namespace))
+		log.Info().Msg("To remove Kubefirst Console, please run the following command:")
+		log.Info().Msg("kubefirst launch down")
+	} else if !inCluster {
 		log.Info().Msg(fmt.Sprintf("Kubefirst Console is now available! %q", consoleURL))
 
 		log.Warn().Msg("Kubefirst has generated local certificates for use with the console using `mkcert`.")
@@ -459,28 +337,116 @@ func Up(ctx context.Context, additionalHelmFlags []string, inCluster, useTelemet
 	return nil
 }
 
-// Down destroys a k3d cluster for Kubefirst console and API
+// addHelmRepository adds and refreshes the Kubefirst helm chart repository
+func addHelmRepository(helmClient string) error {
+	res, _, err := shell.ExecShellReturnStrings(
+		helmClient,
+		"repo",
+		"list",
+		"-o",
+		"yaml",
+	)
+	if err != nil {
+		return fmt.Errorf("error listing current helm repositories: %w", err)
+	}
+
+	var existingHelmRepositories []helm.Repo
+	repoExists := false
+
+	err = yaml.Unmarshal([]byte(res), &existingHelmRepositories)
+	if err != nil {
+		return fmt.Errorf("could not get existing helm repositories: %w", err)
+	}
+
+	for _, repo := range existingHelmRepositories {
+		if repo.Name == helmChartRepoName && repo.URL == helmChartRepoURL {
+			repoExists = true
+		}
+	}
+
+	if !repoExists {
+		// Add helm chart repository
+		_, _, err = shell.ExecShellReturnStrings(
+			helmClient,
+			"repo",
+			"add",
+			helmChartRepoName,
+			helmChartRepoURL,
+		)
+		if err != nil {
+			return fmt.Errorf("error adding helm chart repository: %w", err)
+		}
+		log.Info().Msg("Added Kubefirst helm chart repository")
+	} else {
+		log.Info().Msg("Kubefirst helm chart repository already added")
+	}
+
+	// Update helm chart repository locally
+	_, _, err = shell.ExecShellReturnStrings(
+		helmClient,
+		"repo",
+		"update",
+	)
+	if err != nil {
+		return fmt.Errorf("error updating helm chart repository: %w", err)
+	}
+	log.Info().Msg("Kubefirst helm chart repository updated")
+
+	return nil
+}
+
+// Down removes the Kubefirst console and API. The cluster itself is only
+// deleted when it was created by `launch up`; for existing clusters the
+// console chart is uninstalled if `launch up` installed it.
 func Down(_ bool) error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return fmt.Errorf("error getting user's home directory: %w", err)
 	}
 
-	log.Info().Msg("Deleting k3d cluster for Kubefirst console and API")
-
 	dir := fmt.Sprintf("%s/.k1/%s", homeDir, consoleClusterName)
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return fmt.Errorf("cluster %q directory does not exist", dir)
 	}
 	toolsDir := fmt.Sprintf("%s/tools", dir)
-	k3dClient := fmt.Sprintf("%s/k3d", toolsDir)
 
-	_, _, err = shell.ExecShellReturnStrings(k3dClient, "cluster", "delete", consoleClusterName)
+	// installs made before runtimes were configurable are always k3d
+	rt, err := newRuntime(RuntimeOptions{
+		Name:       viper.GetString("launch.runtime"),
+		Kubeconfig: viper.GetString("launch.kubeconfig"),
+	})
 	if err != nil {
-		return fmt.Errorf("error deleting k3d cluster: %w", err)
+		return err
 	}
 
-	log.Info().Msg("k3d cluster for Kubefirst console and API deleted successfully")
+	if rt.ownsCluster() {
+		log.Info().Msgf("Deleting %s cluster for Kubefirst console and API", rt.name())
+
+		if err := rt.deleteCluster(toolsDir); err != nil {
+			return err
+		}
+
+		log.Info().Msgf("%s cluster for Kubefirst console and API deleted successfully", rt.name())
+	} else if viper.GetBool("launch.chart-installed") {
+		log.Info().Msg("Uninstalling Kubefirst console helm chart")
+
+		_, _, err := shell.ExecShellReturnStrings(
+			fmt.Sprintf("%s/helm", toolsDir),
+			"uninstall",
+			"--kubeconfig",
+			fmt.Sprintf("%s/kubeconfig", dir),
+			"--namespace",
+			namespace,
+			helmChartName,
+		)
+		if err != nil {
+			return fmt.Errorf("error uninstalling helm chart: %w", err)
+		}
+
+		log.Info().Msg("Kubefirst console helm chart uninstalled successfully")
+	} else {
+		log.Info().Msg("Kubefirst console helm chart was not installed by kubefirst, leaving it in place")
+	}
 
 	log.Info().Msg(fmt.Sprintf("Deleting cluster directory at %q", dir))
 	err = os.RemoveAll(dir)
@@ -6,6 +6,8 @@ See the LICENSE file for more details.
 */
 package launch
 
+import "github.com/konstructio/kubefirst/internal/bundle"
+
 const (
 	consoleURL        = "https://console.kubefirst.dev"
 	helmChartName     = "kubefirst"
@@ -15,3 +17,10 @@ const (
 	namespace         = "kubefirst"
 	secretName        = "kubefirst-initial-secrets"
 )
+
+// ConsoleChart is the console helm chart installed by launch up
+var ConsoleChart = bundle.Chart{
+	Name:    helmChartName,
+	Repo:    helmChartRepoURL,
+	Version: helmChartVersion,
+}
@@ -0,0 +1,304 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package launch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	"github.com/konstructio/kubefirst/internal/tools"
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	RuntimeK3d      = "k3d"
+	RuntimeKind     = "kind"
+	RuntimeExisting = "existing"
+)
+
+// SupportedRuntimes lists the local runtimes the console can be launched into
+var SupportedRuntimes = []string{RuntimeK3d, RuntimeKind, RuntimeExisting}
+
+// RuntimeOptions selects where the console is installed. Kubeconfig and
+// Context are only used by the existing runtime.
+type RuntimeOptions struct {
+	Name       string
+	Kubeconfig string
+	Context    string
+}
+
+// runtime is a local Kubernetes cluster the console chart is installed into
+type runtime interface {
+	// name returns the runtime identifier persisted in the config
+	name() string
+	// ownsCluster reports whether the cluster is created and deleted by kubefirst
+	ownsCluster() bool
+	// requiredTools returns the binaries the runtime needs in the tools directory
+	requiredTools() []tools.Tool
+	// ensureCluster makes the cluster available and writes its kubeconfig to kubeconfigPath
+	ensureCluster(dir, kubeconfigPath string) error
+	// deleteCluster removes the cluster, only called when ownsCluster is true
+	deleteCluster(toolsDir string) error
+	// importImages loads a `docker save` archive into the cluster nodes
+	importImages(toolsDir, archive string) error
+	// chartValues returns runtime specific `--set` values for the console chart
+	chartValues() []string
+}
+
+func newRuntime(opts RuntimeOptions) (runtime, error) {
+	switch opts.Name {
+	case "", RuntimeK3d:
+		return &k3dRuntime{}, nil
+	case RuntimeKind:
+		return &kindRuntime{}, nil
+	case RuntimeExisting:
+		if opts.Kubeconfig == "" && os.Getenv("KUBECONFIG") == "" {
+			return nil, errors.New("the existing runtime requires --kubeconfig or the KUBECONFIG environment variable")
+		}
+		return &existingRuntime{kubeconfig: opts.Kubeconfig, context: opts.Context}, nil
+	default:
+		return nil, fmt.Errorf("unsupported runtime %q - must be one of %q", opts.Name, SupportedRuntimes)
+	}
+}
+
+// k3dRuntime creates a dedicated k3d cluster, the original launch behavior
+type k3dRuntime struct{}
+
+func (r *k3dRuntime) name() string      { return RuntimeK3d }
+func (r *k3dRuntime) ownsCluster() bool { return true }
+
+func (r *k3dRuntime) chartValues() []string {
+	return []string{"console.ingress.createTraefikRoute=true"}
+}
+
+func (r *k3dRuntime) requiredTools() []tools.Tool {
+	return []tools.Tool{tools.K3d}
+}
+
+func (r *k3dRuntime) ensureCluster(dir, kubeconfigPath string) error {
+	k3dClient := fmt.Sprintf("%s/tools/k3d", dir)
+
+	_, _, err := shell.ExecShellReturnStrings(k3dClient, "cluster", "get", consoleClusterName)
+	if err != nil {
+		log.Warn().Msg("k3d cluster does not exist and will be created")
+		log.Info().Msg("Creating k3d cluster for Kubefirst console and API...")
+		err = k3d.ClusterCreateConsoleAPI(
+			consoleClusterName,
+			filepath.Dir(dir),
+			k3dClient,
+			kubeconfigPath,
+		)
+		if err != nil {
+			return fmt.Errorf("error creating k3d cluster: %w", err)
+		}
+
+		log.Info().Msg("k3d cluster for Kubefirst console and API created successfully")
+
+		// Wait for traefik
+		kcfg, err := k8s.CreateKubeConfig(false, kubeconfigPath)
+		if err != nil {
+			return fmt.Errorf("error creating kubernetes client: %w", err)
+		}
+
+		log.Info().Msg("Waiting for traefik...")
+		traefikDeployment, err := k8s.ReturnDeploymentObject(
+			kcfg.Clientset,
+			"app.kubernetes.io/name",
+			"traefik",
+			"kube-system",
+			240,
+		)
+		if err != nil {
+			return fmt.Errorf("error looking for traefik: %w", err)
+		}
+		_, err = k8s.WaitForDeploymentReady(kcfg.Clientset, traefikDeployment, 120)
+		if err != nil {
+			return fmt.Errorf("error waiting for traefik: %w", err)
+		}
+	}
+
+	if _, err := os.Stat(kubeconfigPath); os.IsNotExist(err) {
+		_, _, err := shell.ExecShellReturnStrings(
+			k3dClient,
+			"kubeconfig",
+			"write",
+			consoleClusterName,
+			"-o",
+			kubeconfigPath,
+		)
+		if err != nil {
+			return fmt.Errorf("error getting kubeconfig: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *k3dRuntime) deleteCluster(toolsDir string) error {
+	k3dClient := fmt.Sprintf("%s/k3d", toolsDir)
+
+	_, _, err := shell.ExecShellReturnStrings(k3dClient, "cluster", "delete", consoleClusterName)
+	if err != nil {
+		return fmt.Errorf("error deleting k3d cluster: %w", err)
+	}
+	return nil
+}
+
+func (r *k3dRuntime) importImages(toolsDir, archive string) error {
+	k3dClient := fmt.Sprintf("%s/k3d", toolsDir)
+
+	_, _, err := shell.ExecShellReturnStrings(k3dClient, "image", "import", archive, "--cluster", consoleClusterName)
+	if err != nil {
+		return fmt.Errorf("error importing images into k3d cluster: %w", err)
+	}
+	return nil
+}
+
+// kindRuntime creates a dedicated kind cluster
+type kindRuntime struct{}
+
+func (r *kindRuntime) name() string      { return RuntimeKind }
+func (r *kindRuntime) ownsCluster() bool { return true }
+
+// kind does not ship traefik, the console is reached through a port-forward
+func (r *kindRuntime) chartValues() []string {
+	return []string{"console.ingress.createTraefikRoute=false"}
+}
+
+func (r *kindRuntime) requiredTools() []tools.Tool {
+	return []tools.Tool{tools.Kind}
+}
+
+func (r *kindRuntime) ensureCluster(dir, kubeconfigPath string) error {
+	kindClient := fmt.Sprintf("%s/tools/kind", dir)
+
+	clusters, _, err := shell.ExecShellReturnStrings(kindClient, "get", "clusters")
+	if err != nil {
+		return fmt.Errorf("error listing kind clusters: %w", err)
+	}
+
+	if !slices.Contains(strings.Fields(clusters), consoleClusterName) {
+		log.Info().Msg("Creating kind cluster for Kubefirst console and API...")
+		_, _, err := shell.ExecShellReturnStrings(
+			kindClient,
+			"create",
+			"cluster",
+			"--name",
+			consoleClusterName,
+			"--kubeconfig",
+			kubeconfigPath,
+			"--wait",
+			"240s",
+		)
+		if err != nil {
+			return fmt.Errorf("error creating kind cluster: %w", err)
+		}
+		log.Info().Msg("kind cluster for Kubefirst console and API created successfully")
+		return nil
+	}
+
+	_, _, err = shell.ExecShellReturnStrings(
+		kindClient,
+		"export",
+		"kubeconfig",
+		"--name",
+		consoleClusterName,
+		"--kubeconfig",
+		kubeconfigPath,
+	)
+	if err != nil {
+		return fmt.Errorf("error getting kubeconfig: %w", err)
+	}
+	return nil
+}
+
+func (r *kindRuntime) deleteCluster(toolsDir string) error {
+	kindClient := fmt.Sprintf("%s/kind", toolsDir)
+
+	_, _, err := shell.ExecShellReturnStrings(kindClient, "delete", "cluster", "--name", consoleClusterName)
+	if err != nil {
+		return fmt.Errorf("error deleting kind cluster: %w", err)
+	}
+	return nil
+}
+
+func (r *kindRuntime) importImages(toolsDir, archive string) error {
+	kindClient := fmt.Sprintf("%s/kind", toolsDir)
+
+	_, _, err := shell.ExecShellReturnStrings(kindClient, "load", "image-archive", archive, "--name", consoleClusterName)
+	if err != nil {
+		return fmt.Errorf("error importing images into kind cluster: %w", err)
+	}
+	return nil
+}
+
+// existingRuntime installs the console into a cluster managed outside of
+// kubefirst, such as colima or Docker Desktop
+type existingRuntime struct {
+	kubeconfig string
+	context    string
+}
+
+func (r *existingRuntime) name() string                { return RuntimeExisting }
+func (r *existingRuntime) ownsCluster() bool           { return false }
+func (r *existingRuntime) requiredTools() []tools.Tool { return nil }
+
+func (r *existingRuntime) chartValues() []string {
+	return []string{"console.ingress.createTraefikRoute=false"}
+}
+
+// ensureCluster writes a self-contained kubeconfig for the selected context so
+// helm and the kubernetes client target the same cluster
+func (r *existingRuntime) ensureCluster(_, kubeconfigPath string) error {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if r.kubeconfig != "" {
+		rules.ExplicitPath = r.kubeconfig
+	}
+
+	config, err := rules.Load()
+	if err != nil {
+		return fmt.Errorf("error loading kubeconfig: %w", err)
+	}
+
+	if r.context != "" {
+		if _, ok := config.Contexts[r.context]; !ok {
+			return fmt.Errorf("context %q not found in kubeconfig", r.context)
+		}
+		config.CurrentContext = r.context
+	}
+
+	if err := clientcmdapi.MinifyConfig(config); err != nil {
+		return fmt.Errorf("error selecting kubeconfig context: %w", err)
+	}
+	if err := clientcmdapi.FlattenConfig(config); err != nil {
+		return fmt.Errorf("error flattening kubeconfig: %w", err)
+	}
+
+	if err := clientcmd.WriteToFile(*config, kubeconfigPath); err != nil {
+		return fmt.Errorf("error writing kubeconfig: %w", err)
+	}
+
+	log.Info().Msgf("using existing cluster from context %q", config.CurrentContext)
+	return nil
+}
+
+func (r *existingRuntime) deleteCluster(_ string) error {
+	return errors.New("refusing to delete a cluster that was not created by kubefirst")
+}
+
+func (r *existingRuntime) importImages(_, _ string) error {
+	return errors.New("images cannot be loaded into a cluster that was not created by kubefirst")
+}
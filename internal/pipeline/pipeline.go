@@ -0,0 +1,214 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// DefaultRetryDelay is the pause between two attempts of a failed phase
+const DefaultRetryDelay = 10 * time.Second
+
+// ErrUnknownPhase is returned when an option names a phase that does not exist
+var ErrUnknownPhase = errors.New("unknown phase")
+
+// Phase is a named unit of an installation
+type Phase struct {
+	Name        string
+	Description string
+	// Check is the kubefirst-checks key recording that the phase completed,
+	// phases without a check run every time
+	Check string
+	// Retries is the number of additional attempts made after a failure
+	Retries int
+	Run     func(ctx context.Context) error
+}
+
+// Checks records which phases completed
+type Checks interface {
+	Completed(check string) bool
+	SetCompleted(check string, completed bool)
+}
+
+// ViperChecks stores phase completion under kubefirst-checks in the kubefirst config
+type ViperChecks struct{}
+
+func (ViperChecks) Completed(check string) bool {
+	return viper.GetBool("kubefirst-checks." + check)
+}
+
+func (ViperChecks) SetCompleted(check string, completed bool) {
+	viper.Set("kubefirst-checks."+check, completed)
+	viper.WriteConfig()
+}
+
+// Options selects which phases a run executes
+type Options struct {
+	// FromPhase re-runs the named phase and every phase after it
+	FromPhase string
+	// OnlyPhase runs the named phase alone, even if it already completed
+	OnlyPhase string
+	// Retries overrides the retries of phases by name
+	Retries map[string]int
+}
+
+// Pipeline runs phases in order, skipping the ones that already completed
+type Pipeline struct {
+	Phases     []Phase
+	Checks     Checks
+	RetryDelay time.Duration
+	// Done is called after a phase completed or was skipped
+	Done func(Phase)
+}
+
+// New returns a pipeline recording completion in the kubefirst config
+func New(phases ...Phase) *Pipeline {
+	return &Pipeline{
+		Phases:     phases,
+		Checks:     ViperChecks{},
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// Selected validates opts and returns the phases a run executes
+func (p *Pipeline) Selected(opts Options) ([]Phase, error) {
+	if opts.FromPhase != "" && opts.OnlyPhase != "" {
+		return nil, errors.New("only one of --from-phase and --only-phase can be set")
+	}
+	for name := range opts.Retries {
+		if _, err := p.index(name); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case opts.OnlyPhase != "":
+		i, err := p.index(opts.OnlyPhase)
+		if err != nil {
+			return nil, err
+		}
+		return p.Phases[i : i+1], nil
+	case opts.FromPhase != "":
+		i, err := p.index(opts.FromPhase)
+		if err != nil {
+			return nil, err
+		}
+		for _, earlier := range p.Phases[:i] {
+			if earlier.Check != "" && !p.Checks.Completed(earlier.Check) {
+				return nil, fmt.Errorf("phase %q has not completed yet and must run before %q", earlier.Name, opts.FromPhase)
+			}
+		}
+		return p.Phases[i:], nil
+	default:
+		return p.Phases, nil
+	}
+}
+
+// Run executes the phases selected by opts. Phases named through FromPhase
+// or OnlyPhase run even if they completed before.
+func (p *Pipeline) Run(ctx context.Context, opts Options) error {
+	phases, err := p.Selected(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.FromPhase != "" || opts.OnlyPhase != "" {
+		for _, phase := range phases {
+			if phase.Check != "" {
+				p.Checks.SetCompleted(phase.Check, false)
+			}
+		}
+	}
+
+	for _, phase := range phases {
+		if phase.Check != "" && p.Checks.Completed(phase.Check) {
+			log.Info().Msgf("phase %q already completed - continuing", phase.Name)
+			p.done(phase)
+			continue
+		}
+
+		retries := phase.Retries
+		if r, ok := opts.Retries[phase.Name]; ok {
+			retries = r
+		}
+
+		if err := p.run(ctx, phase, retries); err != nil {
+			return err
+		}
+
+		if phase.Check != "" {
+			p.Checks.SetCompleted(phase.Check, true)
+		}
+		p.done(phase)
+	}
+
+	return nil
+}
+
+// List writes a table of the phases and whether they completed
+func (p *Pipeline) List(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PHASE\tSTATUS\tRETRIES\tDESCRIPTION")
+	for _, phase := range p.Phases {
+		status := "pending"
+		switch {
+		case phase.Check == "":
+			status = "always"
+		case p.Checks.Completed(phase.Check):
+			status = "completed"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", phase.Name, status, phase.Retries, phase.Description)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("error writing phases: %w", err)
+	}
+	return nil
+}
+
+func (p *Pipeline) run(ctx context.Context, phase Phase, retries int) error {
+	attempts := retries + 1
+	for attempt := 1; ; attempt++ {
+		log.Info().Msgf("running phase %q", phase.Name)
+		err := phase.Run(ctx)
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("phase %q failed after %d attempt(s): %w", phase.Name, attempt, err)
+		}
+
+		log.Warn().Msgf("phase %q failed (attempt %d of %d), retrying in %s: %v", phase.Name, attempt, attempts, p.RetryDelay, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("phase %q canceled: %w", phase.Name, ctx.Err())
+		case <-time.After(p.RetryDelay):
+		}
+	}
+}
+
+func (p *Pipeline) done(phase Phase) {
+	if p.Done != nil {
+		p.Done(phase)
+	}
+}
+
+func (p *Pipeline) index(name string) (int, error) {
+	for i, phase := range p.Phases {
+		if phase.Name == name {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%w %q", ErrUnknownPhase, name)
+}
@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeChecks map[string]bool
+
+func (f fakeChecks) Completed(check string) bool {
+	return f[check]
+}
+
+func (f fakeChecks) SetCompleted(check string, completed bool) {
+	f[check] = completed
+}
+
+type recorder struct {
+	ran      []string
+	failures map[string]int
+}
+
+func (r *recorder) phase(name, check string) Phase {
+	return Phase{
+		Name:        name,
+		Description: "phase " + name,
+		Check:       check,
+		Run: func(_ context.Context) error {
+			r.ran = append(r.ran, name)
+			if r.failures[name] > 0 {
+				r.failures[name]--
+				return errors.New(name + " failed")
+			}
+			return nil
+		},
+	}
+}
+
+func newTestPipeline(checks fakeChecks, r *recorder) *Pipeline {
+	return &Pipeline{
+		Phases: []Phase{
+			r.phase("one", "one-done"),
+			r.phase("two", "two-done"),
+			r.phase("wait", ""),
+			r.phase("three", "three-done"),
+		},
+		Checks: checks,
+	}
+}
+
+func TestRunSkipsCompletedPhases(t *testing.T) {
+	checks := fakeChecks{"one-done": true}
+	r := &recorder{}
+	var done []string
+	p := newTestPipeline(checks, r)
+	p.Done = func(phase Phase) { done = append(done, phase.Name) }
+
+	require.NoError(t, p.Run(context.Background(), Options{}))
+	require.Equal(t, []string{"two", "wait", "three"}, r.ran)
+	require.Equal(t, []string{"one", "two", "wait", "three"}, done)
+	require.Equal(t, fakeChecks{"one-done": true, "two-done": true, "three-done": true}, checks)
+
+	r.ran = nil
+	require.NoError(t, p.Run(context.Background(), Options{}))
+	require.Equal(t, []string{"wait"}, r.ran, "phases without a check always run")
+}
+
+func TestRunStopsAtFailure(t *testing.T) {
+	checks := fakeChecks{}
+	r := &recorder{failures: map[string]int{"two": 1}}
+	p := newTestPipeline(checks, r)
+
+	err := p.Run(context.Background(), Options{})
+	require.ErrorContains(t, err, `phase "two" failed after 1 attempt(s)`)
+	require.Equal(t, []string{"one", "two"}, r.ran)
+	require.True(t, checks["one-done"])
+	require.False(t, checks["two-done"])
+}
+
+func TestRunRetries(t *testing.T) {
+	r := &recorder{failures: map[string]int{"two": 2}}
+	p := newTestPipeline(fakeChecks{}, r)
+	p.Phases[1].Retries = 2
+
+	require.NoError(t, p.Run(context.Background(), Options{}))
+	require.Equal(t, []string{"one", "two", "two", "two", "wait", "three"}, r.ran)
+}
+
+func TestRunRetriesOverride(t *testing.T) {
+	r := &recorder{failures: map[string]int{"two": 2}}
+	p := newTestPipeline(fakeChecks{}, r)
+	p.Phases[1].Retries = 5
+
+	err := p.Run(context.Background(), Options{Retries: map[string]int{"two": 1}})
+	require.ErrorContains(t, err, `phase "two" failed after 2 attempt(s)`)
+}
+
+func TestRunRetryCanceled(t *testing.T) {
+	r := &recorder{failures: map[string]int{"one": 1}}
+	p := newTestPipeline(fakeChecks{}, r)
+	p.Phases[0].Retries = 1
+	p.RetryDelay = DefaultRetryDelay
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.Run(ctx, Options{})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRunFromPhase(t *testing.T) {
+	checks := fakeChecks{"one-done": true, "two-done": true, "three-done": true}
+	r := &recorder{}
+	p := newTestPipeline(checks, r)
+
+	require.NoError(t, p.Run(context.Background(), Options{FromPhase: "two"}))
+	require.Equal(t, []string{"two", "wait", "three"}, r.ran)
+}
+
+func TestRunFromPhaseRequiresEarlierPhases(t *testing.T) {
+	r := &recorder{}
+	p := newTestPipeline(fakeChecks{}, r)
+
+	err := p.Run(context.Background(), Options{FromPhase: "three"})
+	require.ErrorContains(t, err, `phase "one" has not completed yet`)
+	require.Empty(t, r.ran)
+}
+
+func TestRunOnlyPhase(t *testing.T) {
+	checks := fakeChecks{"one-done": true, "two-done": true}
+	r := &recorder{}
+	p := newTestPipeline(checks, r)
+
+	require.NoError(t, p.Run(context.Background(), Options{OnlyPhase: "two"}))
+	require.Equal(t, []string{"two"}, r.ran)
+	require.True(t, checks["two-done"])
+	require.False(t, checks["three-done"])
+}
+
+func TestRunInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		err  string
+	}{
+		{name: "unknown from phase", opts: Options{FromPhase: "nope"}, err: `unknown phase "nope"`},
+		{name: "unknown only phase", opts: Options{OnlyPhase: "nope"}, err: `unknown phase "nope"`},
+		{name: "unknown retries phase", opts: Options{Retries: map[string]int{"nope": 1}}, err: `unknown phase "nope"`},
+		{name: "from and only", opts: Options{FromPhase: "one", OnlyPhase: "two"}, err: "only one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{}
+			p := newTestPipeline(fakeChecks{}, r)
+
+			err := p.Run(context.Background(), tt.opts)
+			require.ErrorContains(t, err, tt.err)
+			require.Empty(t, r.ran)
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	r := &recorder{}
+	p := newTestPipeline(fakeChecks{"one-done": true}, r)
+
+	var buf bytes.Buffer
+	require.NoError(t, p.List(&buf))
+
+	require.Equal(t, `PHASE  STATUS     RETRIES  DESCRIPTION
+one    completed  0        phase one
+two    pending    0        phase two
+wait   always     0        phase wait
+three  pending    0        phase three
+`, buf.String())
+}
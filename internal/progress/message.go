@@ -102,6 +102,11 @@ func DisplaySuccessMessage(cluster types.Cluster) string {
 		cloudCliKubeconfig = "use the kubeconfig file outputted from terraform to access the cluster"
 	}
 
+	gitHost := cluster.GitHost
+	if gitHost == "" {
+		gitHost = fmt.Sprintf("%s.com", cluster.GitProvider)
+	}
+
 	var fullDomainName string
 	if cluster.SubdomainName != "" {
 		fullDomainName = fmt.Sprintf("%s.%s", cluster.SubdomainName, cluster.DomainName)
@@ -120,8 +125,8 @@ func DisplaySuccessMessage(cluster types.Cluster) string {
 
 ## ` + fmt.Sprintf("`%s `", gitProviderLabel) + `
 ### Git Owner   ` + fmt.Sprintf("`%s`", cluster.GitAuth.Owner) + `
-### Repos       ` + fmt.Sprintf("`https://%s.com/%s/gitops` \n\n", cluster.GitProvider, cluster.GitAuth.Owner) +
-		fmt.Sprintf("`            https://%s.com/%s/metaphor`", cluster.GitProvider, cluster.GitAuth.Owner) + `
+### Repos       ` + fmt.Sprintf("`https://%s/%s/gitops` \n\n", gitHost, cluster.GitAuth.Owner) +
+		fmt.Sprintf("`            https://%s/%s/metaphor`", gitHost, cluster.GitAuth.Owner) + `
 ## Kubefirst Console
 ### URL         ` + fmt.Sprintf("`https://kubefirst.%s`", fullDomainName) + `
 ## Argo CD
@@ -28,6 +28,22 @@ func InitializeProgressTerminal() {
 	Progress = tea.NewProgram(NewModel())
 }
 
+// WithTerminal runs fn with the terminal released by the progress program, if
+// any, so fn can read the answer to a prompt from the standard input
+func WithTerminal(fn func() error) error {
+	if Progress == nil {
+		return fn()
+	}
+	if err := Progress.ReleaseTerminal(); err != nil {
+		return fmt.Errorf("failed to release the terminal: %w", err)
+	}
+	err := fn()
+	if restoreErr := Progress.RestoreTerminal(); restoreErr != nil && err == nil {
+		return fmt.Errorf("failed to restore the terminal: %w", restoreErr)
+	}
+	return err
+}
+
 func (m progressModel) Init() tea.Cmd {
 	return nil
 }
@@ -85,7 +85,20 @@ func (p *Provisioner) ProvisionManagementCluster(ctx context.Context, cliFlags *
 
 	p.stepper.NewProgressStep("Validate Git Credentials")
 
-	gitAuth, err := gitShim.ValidateGitCredentials(cliFlags.GitProvider, cliFlags.GithubOrg, cliFlags.GitlabGroup)
+	if err := gitShim.CheckProvisioning(cliFlags.GitProvider); err != nil {
+		return err
+	}
+	gitHost, err := gitShim.NewHost(cliFlags.GitProvider, cliFlags.GitHost, cliFlags.GitAPIURL)
+	if err != nil {
+		return fmt.Errorf("invalid git host: %w", err)
+	}
+	// the cluster definition sent to kubefirst-api has no git host, the API
+	// would provision the repositories on the public host
+	if gitHost.SelfHosted() {
+		return fmt.Errorf("the self-hosted git server %s is only supported by k3d", gitHost.Name)
+	}
+
+	gitAuth, err := gitShim.ValidateGitCredentials(ctx, gitHost, cliFlags.GitOwner)
 	if err != nil {
 		return fmt.Errorf("failed to validate git credentials: %w", err)
 	}
@@ -93,18 +106,16 @@ func (p *Provisioner) ProvisionManagementCluster(ctx context.Context, cliFlags *
 	// Validate git
 	executionControl := viper.GetBool(fmt.Sprintf("kubefirst-checks.%s-credentials", cliFlags.GitProvider))
 	if !executionControl {
-		newRepositoryNames := []string{"gitops", "metaphor"}
-		newTeamNames := []string{"admins", "developers"}
-
 		initGitParameters := gitShim.GitInitParameters{
 			GitProvider:  cliFlags.GitProvider,
 			GitToken:     gitAuth.Token,
 			GitOwner:     gitAuth.Owner,
-			Repositories: newRepositoryNames,
-			Teams:        newTeamNames,
+			Repositories: gitShim.DefaultRepositoryNames,
+			Teams:        gitShim.DefaultTeamNames,
+			Host:         gitHost,
 		}
 
-		err = gitShim.InitializeGitProvider(&initGitParameters)
+		err = gitShim.InitializeGitProvider(ctx, &initGitParameters)
 		if err != nil {
 			return fmt.Errorf("failed to initialize Git provider: %w", err)
 		}
@@ -122,7 +133,7 @@ func (p *Provisioner) ProvisionManagementCluster(ctx context.Context, cliFlags *
 	isK1Debug := strings.ToLower(os.Getenv("K1_LOCAL_DEBUG")) == "true"
 
 	if !k3dClusterCreationComplete && !isK1Debug {
-		if err := launch.Up(ctx, nil, true, cliFlags.UseTelemetry); err != nil {
+		if err := launch.Up(ctx, nil, true, cliFlags.UseTelemetry, launch.RuntimeOptions{Name: launch.RuntimeK3d}, ""); err != nil {
 			return fmt.Errorf("failed to launch k3d cluster: %w", err)
 		}
 	}
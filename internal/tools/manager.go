@@ -0,0 +1,636 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package tools
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/konstructio/kubefirst/internal/httpclient"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	metadataFile  = "metadata.json"
+	partialSuffix = ".partial"
+
+	// MirrorEnv overrides the upstream release URLs with a mirror laid out as
+	// <mirror>/<tool>/<version>/<artifact>, with checksum files alongside. The
+	// artifact keeps its platform directories, i.e. kubectl/<version>/linux/amd64/kubectl
+	MirrorEnv = "KUBEFIRST_TOOLS_MIRROR"
+)
+
+// ErrChecksumMismatch is returned when a download does not match its published checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Metadata is recorded next to every cached binary
+type Metadata struct {
+	Name           string `json:"name"`
+	Version        string `json:"version"`
+	Platform       string `json:"platform"`
+	Source         string `json:"source"`
+	ArtifactSHA256 string `json:"artifact_sha256"`
+	BinarySHA256   string `json:"binary_sha256"`
+	// Verified is false when upstream publishes no checksums
+	Verified bool `json:"verified"`
+}
+
+// CachedTool is a binary present in the cache
+type CachedTool struct {
+	Metadata
+	Path string
+	Size int64
+}
+
+// Manager downloads tools into a version-keyed cache shared across clusters
+type Manager struct {
+	CacheDir   string
+	Mirror     string
+	HTTPClient *http.Client
+	GOOS       string
+	GOARCH     string
+}
+
+// NewManager returns a manager using the default cache directory in $HOME/.k1
+func NewManager() (*Manager, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("error getting user's home directory: %w", err)
+	}
+
+	return &Manager{
+		CacheDir:   filepath.Join(homeDir, ".k1", "tools-cache"),
+		Mirror:     strings.TrimSuffix(os.Getenv(MirrorEnv), "/"),
+		HTTPClient: httpclient.New(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+	}, nil
+}
+
+func (m *Manager) platform() string {
+	return fmt.Sprintf("%s_%s", m.GOOS, m.GOARCH)
+}
+
+func (m *Manager) entryDir(t Tool) string {
+	return filepath.Join(m.CacheDir, t.Name, t.Version, m.platform())
+}
+
+// Install makes sure each tool is cached and verified, then links it into
+// toolsDir under its bare name
+func (m *Manager) Install(ctx context.Context, toolsDir string, tools ...Tool) error {
+	if err := os.MkdirAll(toolsDir, 0o755); err != nil {
+		return fmt.Errorf("error creating tools directory %q: %w", toolsDir, err)
+	}
+
+	for _, t := range tools {
+		cached, err := m.Ensure(ctx, t)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(toolsDir, t.Name)
+		if err := linkOrCopy(cached, target); err != nil {
+			return fmt.Errorf("error installing %s to %q: %w", t.Name, target, err)
+		}
+	}
+
+	return nil
+}
+
+// Ensure returns the path of the cached binary for t, downloading and
+// verifying it first when the cache is missing or corrupt
+func (m *Manager) Ensure(ctx context.Context, t Tool) (string, error) {
+	dir := m.entryDir(t)
+	binary := filepath.Join(dir, t.Name)
+
+	if meta, err := readMetadata(dir); err == nil {
+		if err := verifyFile(binary, meta.BinarySHA256); err == nil {
+			log.Info().Msgf("%s %s is already cached, continuing", t.Name, t.Version)
+			return binary, nil
+		}
+		log.Warn().Msgf("cached %s %s failed verification and will be downloaded again", t.Name, t.Version)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating cache directory %q: %w", dir, err)
+	}
+
+	artifact := t.artifact(t.Version, m.GOOS, m.GOARCH)
+	artifactPath := filepath.Join(dir, path.Base(artifact))
+	source := m.resolveURL(t, t.downloadURL(t.Version, artifact), artifact)
+
+	log.Info().Msgf("Downloading %s %s from %q...", t.Name, t.Version, source)
+	if err := m.download(ctx, source, artifactPath); err != nil {
+		return "", fmt.Errorf("error while trying to download %s: %w", t.Name, err)
+	}
+	defer os.Remove(artifactPath)
+
+	artifactSum, err := fileSHA256(artifactPath)
+	if err != nil {
+		return "", err
+	}
+
+	verified := false
+	if t.checksumURL != nil {
+		expected, err := m.publishedChecksum(ctx, t, artifact)
+		if err != nil {
+			return "", fmt.Errorf("error retrieving checksum for %s: %w", t.Name, err)
+		}
+		if !strings.EqualFold(expected, artifactSum) {
+			return "", fmt.Errorf("%s %s: %w: expected %s, got %s", t.Name, t.Version, ErrChecksumMismatch, expected, artifactSum)
+		}
+		verified = true
+	} else {
+		log.Warn().Msgf("%s does not publish checksums, recording sha256 %s", t.Name, artifactSum)
+	}
+
+	if err := extract(t, artifactPath, binary, m.GOOS, m.GOARCH); err != nil {
+		return "", fmt.Errorf("error extracting %s: %w", t.Name, err)
+	}
+
+	binarySum, err := fileSHA256(binary)
+	if err != nil {
+		return "", err
+	}
+
+	meta := Metadata{
+		Name:           t.Name,
+		Version:        t.Version,
+		Platform:       m.platform(),
+		Source:         source,
+		ArtifactSHA256: artifactSum,
+		BinarySHA256:   binarySum,
+		Verified:       verified,
+	}
+	if err := writeMetadata(dir, meta); err != nil {
+		return "", err
+	}
+
+	return binary, nil
+}
+
+// List returns every tool present in the cache
+func (m *Manager) List() ([]CachedTool, error) {
+	matches, err := filepath.Glob(filepath.Join(m.CacheDir, "*", "*", "*", metadataFile))
+	if err != nil {
+		return nil, fmt.Errorf("error listing tools cache: %w", err)
+	}
+
+	cached := make([]CachedTool, 0, len(matches))
+	for _, match := range matches {
+		dir := filepath.Dir(match)
+		meta, err := readMetadata(dir)
+		if err != nil {
+			log.Warn().Msgf("skipping unreadable cache entry %q: %v", dir, err)
+			continue
+		}
+
+		binary := filepath.Join(dir, meta.Name)
+		var size int64
+		if info, err := os.Stat(binary); err == nil {
+			size = info.Size()
+		}
+
+		cached = append(cached, CachedTool{Metadata: *meta, Path: binary, Size: size})
+	}
+
+	return cached, nil
+}
+
+// Verify recomputes the checksum of every cached binary and returns the ones
+// that no longer match
+func (m *Manager) Verify() ([]CachedTool, error) {
+	cached, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []CachedTool
+	for _, c := range cached {
+		if err := verifyFile(c.Path, c.BinarySHA256); err != nil {
+			log.Warn().Msgf("%s %s (%s) failed verification: %v", c.Name, c.Version, c.Platform, err)
+			failed = append(failed, c)
+		}
+	}
+
+	return failed, nil
+}
+
+// Prune removes cached versions that are no longer in the registry, or every
+// cached tool when all is true
+func (m *Manager) Prune(all bool) ([]CachedTool, error) {
+	cached, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []CachedTool
+	for _, c := range cached {
+		if !all {
+			if t, ok := Lookup(c.Name); ok && t.Version == c.Version {
+				continue
+			}
+		}
+
+		if err := os.RemoveAll(filepath.Dir(c.Path)); err != nil {
+			return removed, fmt.Errorf("error removing %q: %w", filepath.Dir(c.Path), err)
+		}
+		removed = append(removed, c)
+	}
+
+	// tidy up version directories left empty
+	versionDirs, _ := filepath.Glob(filepath.Join(m.CacheDir, "*", "*"))
+	for _, dir := range versionDirs {
+		os.Remove(dir)
+	}
+
+	return removed, nil
+}
+
+// Export copies the cached entry of each tool into the cache layout rooted at
+// destCacheDir, downloading it first when needed
+func (m *Manager) Export(ctx context.Context, destCacheDir string, tools ...Tool) error {
+	for _, t := range tools {
+		if _, err := m.Ensure(ctx, t); err != nil {
+			return err
+		}
+
+		dest := filepath.Join(destCacheDir, t.Name, t.Version, m.platform())
+		if err := copyEntry(m.entryDir(t), dest); err != nil {
+			return fmt.Errorf("error exporting %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+// Import copies every valid entry of the cache rooted at srcCacheDir into the
+// manager's cache, skipping tools that are already cached
+func (m *Manager) Import(srcCacheDir string) (int, error) {
+	src := &Manager{CacheDir: srcCacheDir}
+	entries, err := src.List()
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, e := range entries {
+		if err := verifyFile(e.Path, e.BinarySHA256); err != nil {
+			return imported, fmt.Errorf("%s %s in %q: %w", e.Name, e.Version, srcCacheDir, err)
+		}
+
+		dest := filepath.Join(m.CacheDir, e.Name, e.Version, e.Platform)
+		if meta, err := readMetadata(dest); err == nil && meta.BinarySHA256 == e.BinarySHA256 {
+			continue
+		}
+
+		if err := copyEntry(filepath.Dir(e.Path), dest); err != nil {
+			return imported, fmt.Errorf("error importing %s: %w", e.Name, err)
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// resolveURL returns the mirror URL of upstream when a mirror is set. Files
+// named after artifact, like the artifact and its checksum file, keep the
+// artifact's path so platforms don't collide, shared files keep their name.
+func (m *Manager) resolveURL(t Tool, upstream, artifact string) string {
+	if m.Mirror == "" {
+		return upstream
+	}
+
+	name := path.Base(upstream)
+	if rest, ok := strings.CutPrefix(name, path.Base(artifact)); ok {
+		name = artifact + rest
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", m.Mirror, t.Name, t.Version, name)
+}
+
+func (m *Manager) publishedChecksum(ctx context.Context, t Tool, artifact string) (string, error) {
+	source := m.resolveURL(t, t.checksumURL(t.Version, artifact), artifact)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	res, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to download %q: unexpected status code %q", source, res.Status)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return parseChecksum(body, path.Base(artifact))
+}
+
+// download fetches source into dest, resuming from a previous partial
+// download when the server supports range requests
+func (m *Manager) download(ctx context.Context, source, dest string) error {
+	partial := dest + partialSuffix
+
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := m.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer res.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		log.Info().Msgf("resuming download of %q at byte %d", source, offset)
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file is already complete
+		return os.Rename(partial, dest)
+	default:
+		return fmt.Errorf("unable to download %q: unexpected status code %q", source, res.Status)
+	}
+
+	f, err := os.OpenFile(partial, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening %q: %w", partial, err)
+	}
+
+	if _, err := io.Copy(f, res.Body); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %q, re-run to resume the download: %w", partial, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing %q: %w", partial, err)
+	}
+
+	if err := os.Rename(partial, dest); err != nil {
+		return fmt.Errorf("error moving %q into place: %w", dest, err)
+	}
+	return nil
+}
+
+// parseChecksum finds the sha256 for name in a checksum file. Files holding a
+// single bare hash, like the kubectl ones, are accepted as is.
+func parseChecksum(data []byte, name string) (string, error) {
+	var lines [][]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+
+	for _, fields := range lines {
+		if len(fields) >= 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+
+	if len(lines) == 1 && len(lines[0]) == 1 {
+		return lines[0][0], nil
+	}
+
+	return "", fmt.Errorf("no checksum found for %q", name)
+}
+
+func extract(t Tool, artifactPath, binary, goos, goarch string) error {
+	tmp := binary + partialSuffix
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating %q: %w", tmp, err)
+	}
+	defer os.Remove(tmp)
+
+	switch t.archive {
+	case archiveNone:
+		err = copyFile(artifactPath, out)
+	case archiveTarGz:
+		err = extractTarGz(artifactPath, t.member(goos, goarch), out)
+	case archiveZip:
+		err = extractZip(artifactPath, t.member(goos, goarch), out)
+	default:
+		err = fmt.Errorf("unsupported archive format %q", t.archive)
+	}
+	if cerr := out.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("error closing %q: %w", tmp, cerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, binary); err != nil {
+		return fmt.Errorf("error moving %q into place: %w", binary, err)
+	}
+	return nil
+}
+
+func copyFile(src string, w io.Writer) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening %q: %w", src, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("error copying %q: %w", src, err)
+	}
+	return nil
+}
+
+func extractTarGz(src, member string, w io.Writer) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening %q: %w", src, err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("error opening gzip stream: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%q not found in %q", member, src)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %q: %w", src, err)
+		}
+		if hdr.Name == member {
+			if _, err := io.Copy(w, tr); err != nil {
+				return fmt.Errorf("error extracting %q: %w", member, err)
+			}
+			return nil
+		}
+	}
+}
+
+func extractZip(src, member string, w io.Writer) error {
+	zr, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("error opening %q: %w", src, err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if f.Name != member {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("error opening %q: %w", member, err)
+		}
+		defer rc.Close()
+
+		if _, err := io.Copy(w, rc); err != nil {
+			return fmt.Errorf("error extracting %q: %w", member, err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%q not found in %q", member, src)
+}
+
+func linkOrCopy(src, dest string) error {
+	if current, err := os.Readlink(dest); err == nil && current == src {
+		return nil
+	}
+
+	os.Remove(dest)
+	if err := os.Symlink(src, dest); err == nil {
+		return nil
+	}
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating %q: %w", dest, err)
+	}
+	if err := copyFile(src, out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error closing %q: %w", dest, err)
+	}
+	return nil
+}
+
+// copyEntry copies the binary and metadata of a cache entry
+func copyEntry(srcDir, destDir string) error {
+	meta, err := readMetadata(srcDir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return fmt.Errorf("error creating %q: %w", destDir, err)
+	}
+
+	binary := filepath.Join(destDir, meta.Name)
+	out, err := os.OpenFile(binary, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return fmt.Errorf("error creating %q: %w", binary, err)
+	}
+	if err := copyFile(filepath.Join(srcDir, meta.Name), out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error closing %q: %w", binary, err)
+	}
+
+	return writeMetadata(destDir, *meta)
+}
+
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("error opening %q: %w", name, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("error hashing %q: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func verifyFile(name, expected string) error {
+	actual, err := fileSHA256(name)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, expected, actual)
+	}
+	return nil
+}
+
+func readMetadata(dir string) (*Metadata, error) {
+	data, err := os.ReadFile(filepath.Join(dir, metadataFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache metadata: %w", err)
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("error parsing cache metadata: %w", err)
+	}
+	return &meta, nil
+}
+
+func writeMetadata(dir string, meta Metadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling cache metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, metadataFile), data, 0o644); err != nil {
+		return fmt.Errorf("error writing cache metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testTool(server string, withChecksum bool) Tool {
+	t := Tool{
+		Name:    "fake",
+		Version: "v1.0.0",
+		artifact: func(_, goos, goarch string) string {
+			return fmt.Sprintf("fake-%s-%s", goos, goarch)
+		},
+		downloadURL: func(_, artifact string) string {
+			return server + "/" + artifact
+		},
+	}
+	if withChecksum {
+		t.checksumURL = func(_, _ string) string {
+			return server + "/checksums.txt"
+		}
+	}
+	return t
+}
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	return &Manager{
+		CacheDir:   t.TempDir(),
+		HTTPClient: http.DefaultClient,
+		GOOS:       "linux",
+		GOARCH:     "amd64",
+	}
+}
+
+func TestManagerInstall(t *testing.T) {
+	payload := []byte("#!/bin/sh\necho fake\n")
+	sum := sha256.Sum256(payload)
+	checksum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name      string
+		checksums string
+		wantErr   error
+	}{
+		{name: "matching checksum", checksums: checksum + "  fake-linux-amd64\n"},
+		{name: "mismatched checksum", checksums: strings.Repeat("0", 64) + "  fake-linux-amd64\n", wantErr: ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/checksums.txt" {
+					fmt.Fprint(w, tt.checksums)
+					return
+				}
+				w.Write(payload)
+			}))
+			defer server.Close()
+
+			m := newTestManager(t)
+			toolsDir := t.TempDir()
+
+			err := m.Install(context.Background(), toolsDir, testTool(server.URL, true))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			installed, err := os.ReadFile(filepath.Join(toolsDir, "fake"))
+			require.NoError(t, err)
+			require.Equal(t, payload, installed)
+
+			cached, err := m.List()
+			require.NoError(t, err)
+			require.Len(t, cached, 1)
+			require.True(t, cached[0].Verified)
+
+			failed, err := m.Verify()
+			require.NoError(t, err)
+			require.Empty(t, failed)
+		})
+	}
+}
+
+func TestManagerResolveMirrorURL(t *testing.T) {
+	m := newTestManager(t)
+	m.Mirror = "https://mirror.example.com"
+
+	for _, platform := range []struct{ goos, goarch string }{{"linux", "amd64"}, {"darwin", "arm64"}} {
+		artifact := Kubectl.artifact(Kubectl.Version, platform.goos, platform.goarch)
+		base := fmt.Sprintf("https://mirror.example.com/kubectl/%s/%s/%s/kubectl", Kubectl.Version, platform.goos, platform.goarch)
+
+		require.Equal(t, base, m.resolveURL(Kubectl, Kubectl.downloadURL(Kubectl.Version, artifact), artifact))
+		require.Equal(t, base+".sha256", m.resolveURL(Kubectl, Kubectl.checksumURL(Kubectl.Version, artifact), artifact))
+	}
+
+	artifact := K3d.artifact(K3d.Version, "linux", "amd64")
+	require.Equal(t, fmt.Sprintf("https://mirror.example.com/k3d/%s/checksums.txt", K3d.Version), m.resolveURL(K3d, K3d.checksumURL(K3d.Version, artifact), artifact))
+}
+
+func TestManagerResumesPartialDownload(t *testing.T) {
+	payload := []byte("0123456789abcdefghij")
+
+	var gotRange string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRange = r.Header.Get("Range")
+		if gotRange == "" {
+			w.Write(payload)
+			return
+		}
+		start, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(gotRange, "bytes="), "-"))
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(payload[start:])
+	}))
+	defer server.Close()
+
+	m := newTestManager(t)
+	tool := testTool(server.URL, false)
+
+	dir := m.entryDir(tool)
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fake-linux-amd64"+partialSuffix), payload[:8], 0o644))
+
+	binary, err := m.Ensure(context.Background(), tool)
+	require.NoError(t, err)
+	require.Equal(t, "bytes=8-", gotRange)
+
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	require.Equal(t, payload, data)
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum, err := parseChecksum([]byte("abc123\n"), "kubectl")
+	require.NoError(t, err)
+	require.Equal(t, "abc123", sum)
+
+	sum, err = parseChecksum([]byte("aaa  terraform_1.3.8_darwin_arm64.zip\nbbb  terraform_1.3.8_linux_amd64.zip\n"), "terraform_1.3.8_linux_amd64.zip")
+	require.NoError(t, err)
+	require.Equal(t, "bbb", sum)
+
+	_, err = parseChecksum([]byte("aaa  other\nbbb  another\n"), "missing")
+	require.Error(t, err)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package tools
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	"github.com/konstructio/kubefirst-api/pkg/providerConfigs"
+)
+
+const (
+	archiveNone  = ""
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+)
+
+// Tool describes a versioned binary kubefirst downloads from its upstream release
+type Tool struct {
+	Name    string
+	Version string
+
+	// archive is the format of the release artifact, archiveNone for plain binaries
+	archive string
+	// artifact returns the release file name for a platform
+	artifact func(version, goos, goarch string) string
+	// downloadURL returns the upstream URL of an artifact
+	downloadURL func(version, artifact string) string
+	// checksumURL returns the upstream URL of the published checksums, nil
+	// when the project does not publish any
+	checksumURL func(version, artifact string) string
+	// member returns the path of the binary inside the archive
+	member func(goos, goarch string) string
+}
+
+var (
+	K3d = Tool{
+		Name:    "k3d",
+		Version: k3d.K3dVersion,
+		artifact: func(_, goos, goarch string) string {
+			return fmt.Sprintf("k3d-%s-%s", goos, goarch)
+		},
+		downloadURL: func(version, artifact string) string {
+			return fmt.Sprintf("https://github.com/k3d-io/k3d/releases/download/%s/%s", version, artifact)
+		},
+		checksumURL: func(version, _ string) string {
+			return fmt.Sprintf("https://github.com/k3d-io/k3d/releases/download/%s/checksums.txt", version)
+		},
+	}
+
+	Kind = Tool{
+		Name:    "kind",
+		Version: "v0.24.0",
+		artifact: func(_, goos, goarch string) string {
+			return fmt.Sprintf("kind-%s-%s", goos, goarch)
+		},
+		downloadURL: func(version, artifact string) string {
+			return fmt.Sprintf("https://github.com/kubernetes-sigs/kind/releases/download/%s/%s", version, artifact)
+		},
+		checksumURL: func(version, artifact string) string {
+			return fmt.Sprintf("https://github.com/kubernetes-sigs/kind/releases/download/%s/%s.sha256sum", version, artifact)
+		},
+	}
+
+	Kubectl = Tool{
+		Name:    "kubectl",
+		Version: providerConfigs.KubectlClientVersion,
+		artifact: func(_, goos, goarch string) string {
+			return path.Join(goos, goarch, "kubectl")
+		},
+		downloadURL: func(version, artifact string) string {
+			return fmt.Sprintf("https://dl.k8s.io/release/%s/bin/%s", version, artifact)
+		},
+		checksumURL: func(version, artifact string) string {
+			return fmt.Sprintf("https://dl.k8s.io/release/%s/bin/%s.sha256", version, artifact)
+		},
+	}
+
+	Helm = Tool{
+		Name:    "helm",
+		Version: "v3.12.0",
+		archive: archiveTarGz,
+		artifact: func(version, goos, goarch string) string {
+			return fmt.Sprintf("helm-%s-%s-%s.tar.gz", version, goos, goarch)
+		},
+		downloadURL: func(_, artifact string) string {
+			return fmt.Sprintf("https://get.helm.sh/%s", artifact)
+		},
+		checksumURL: func(_, artifact string) string {
+			return fmt.Sprintf("https://get.helm.sh/%s.sha256sum", artifact)
+		},
+		member: func(goos, goarch string) string {
+			return fmt.Sprintf("%s-%s/helm", goos, goarch)
+		},
+	}
+
+	// Mkcert does not publish checksums, its download is installed unverified
+	// and the recorded sha256 only guards the cached binary
+	Mkcert = Tool{
+		Name:    "mkcert",
+		Version: "v1.4.4",
+		artifact: func(version, goos, goarch string) string {
+			return fmt.Sprintf("mkcert-%s-%s-%s", version, goos, goarch)
+		},
+		downloadURL: func(version, artifact string) string {
+			return fmt.Sprintf("https://github.com/FiloSottile/mkcert/releases/download/%s/%s", version, artifact)
+		},
+	}
+
+	Terraform = Tool{
+		Name:    "terraform",
+		Version: providerConfigs.TerraformClientVersion,
+		archive: archiveZip,
+		artifact: func(version, goos, goarch string) string {
+			return fmt.Sprintf("terraform_%s_%s_%s.zip", version, goos, goarch)
+		},
+		downloadURL: func(version, artifact string) string {
+			return fmt.Sprintf("https://releases.hashicorp.com/terraform/%s/%s", version, artifact)
+		},
+		checksumURL: func(version, _ string) string {
+			return fmt.Sprintf("https://releases.hashicorp.com/terraform/%s/terraform_%s_SHA256SUMS", version, version)
+		},
+		member: func(_, _ string) string {
+			return "terraform"
+		},
+	}
+)
+
+// Registry lists every tool managed by kubefirst
+var Registry = []Tool{K3d, Kind, Kubectl, Helm, Mkcert, Terraform}
+
+// Lookup returns the registered tool with the given name
+func Lookup(name string) (Tool, bool) {
+	for _, t := range Registry {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tool{}, false
+}
@@ -19,6 +19,9 @@ type CliFlags struct {
 	SubDomainName        string
 	GitProvider          string
 	GitProtocol          string
+	GitHost              string
+	GitAPIURL            string
+	GitOwner             string
 	GithubOrg            string
 	GitlabGroup          string
 	GitopsTemplateBranch string
@@ -36,4 +39,6 @@ type CliFlags struct {
 	K3sServersArgs       []string
 	InstallKubefirstPro  bool
 	AMIType              string
+	Bundle               string
+	AdoptExisting        bool
 }
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/konstructio/kubefirst/internal/gitShim"
 	"github.com/konstructio/kubefirst/internal/types"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,6 +24,7 @@ func GetFlags(cmd *cobra.Command, cloudProvider string) (*types.CliFlags, error)
 		alertsEmailFlag, cloudRegionFlag, dnsProviderFlag, subdomainFlag, domainNameFlag      string
 		nodeTypeFlag, nodeCountFlag, installCatalogAppsFlag, gitProviderFlag, gitProtocolFlag string
 		gitopsTemplateURLFlag, gitopsTemplateBranchFlag, githubOrgFlag, gitlabGroupFlag       string
+		gitHostFlag, gitAPIURLFlag, gitOwnerFlag                                              string
 		installKubefirstProFlag                                                               bool
 	)
 
@@ -43,9 +45,41 @@ func GetFlags(cmd *cobra.Command, cloudProvider string) (*types.CliFlags, error)
 		}
 	}
 
+	// a self-hosted git server is only supported on k3d, where the CLI
+	// creates the repositories. The cluster definition kubefirst-api
+	// provisions the other clouds from has no git host.
+	if cloudProvider == "k3d" {
+		hostFlags := map[string]*string{
+			"git-host":    &gitHostFlag,
+			"git-api-url": &gitAPIURLFlag,
+			"git-owner":   &gitOwnerFlag,
+		}
+		for flag, target := range hostFlags {
+			if *target, err = cmd.Flags().GetString(flag); err != nil {
+				return &cliFlags, fmt.Errorf("failed to get %s flag: %w", flag, err)
+			}
+		}
+	}
+
 	githubOrgFlag = strings.ToLower(githubOrgFlag)
 	gitlabGroupFlag = strings.ToLower(gitlabGroupFlag)
 
+	// the owner of the repositories has a flag named after the provider on
+	// github and gitlab
+	switch gitProviderFlag {
+	case "github":
+		gitOwnerFlag = githubOrgFlag
+	case "gitlab":
+		gitOwnerFlag = gitlabGroupFlag
+	default:
+		gitOwnerFlag = strings.ToLower(gitOwnerFlag)
+	}
+
+	gitHost, err := gitShim.NewHost(gitProviderFlag, gitHostFlag, gitAPIURLFlag)
+	if err != nil {
+		return &cliFlags, fmt.Errorf("invalid git host: %w", err)
+	}
+
 	if cloudProvider != "k3d" {
 		cloudSpecificFlags := map[string]*string{
 			"alerts-email": &alertsEmailFlag,
@@ -78,6 +112,9 @@ func GetFlags(cmd *cobra.Command, cloudProvider string) (*types.CliFlags, error)
 		DomainName:           domainNameFlag,
 		GitProtocol:          gitProtocolFlag,
 		GitProvider:          gitProviderFlag,
+		GitHost:              gitHost.Name,
+		GitAPIURL:            gitHost.APIURL,
+		GitOwner:             gitOwnerFlag,
 		GithubOrg:            githubOrgFlag,
 		GitlabGroup:          gitlabGroupFlag,
 		GitopsTemplateBranch: gitopsTemplateBranchFlag,
@@ -106,6 +143,18 @@ func GetFlags(cmd *cobra.Command, cloudProvider string) (*types.CliFlags, error)
 		}
 		cliFlags.ClusterType = clusterTypeFlag
 
+		bundleFlag, err := cmd.Flags().GetString("bundle")
+		if err != nil {
+			return &cliFlags, fmt.Errorf("failed to get 'bundle' flag: %w", err)
+		}
+		cliFlags.Bundle = bundleFlag
+
+		adoptExistingFlag, err := cmd.Flags().GetBool("adopt-existing")
+		if err != nil {
+			return &cliFlags, fmt.Errorf("failed to get 'adopt-existing' flag: %w", err)
+		}
+		cliFlags.AdoptExisting = adoptExistingFlag
+
 	case "aws":
 		ecrFlag, err := cmd.Flags().GetBool("ecr")
 		if err != nil {
@@ -173,8 +222,11 @@ func GetFlags(cmd *cobra.Command, cloudProvider string) (*types.CliFlags, error)
 		"flags.cluster-name":       cliFlags.ClusterName,
 		"flags.dns-provider":       cliFlags.DNSProvider,
 		"flags.domain-name":        cliFlags.DomainName,
+		"flags.subdomain":          cliFlags.SubDomainName,
 		"flags.git-provider":       cliFlags.GitProvider,
 		"flags.git-protocol":       cliFlags.GitProtocol,
+		"flags.git-host":           cliFlags.GitHost,
+		"flags.git-api-url":        cliFlags.GitAPIURL,
 		"flags.cloud-region":       cliFlags.CloudRegion,
 		"kubefirst.cloud-provider": cloudProvider,
 	}
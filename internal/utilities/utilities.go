@@ -62,6 +62,11 @@ func CreateClusterRecordFromRaw(
 		kubefirstTeam = "false"
 	}
 
+	gitHost := viper.GetString("flags.git-host")
+	if gitHost == "" {
+		gitHost = fmt.Sprintf("%s.com", gitProvider)
+	}
+
 	cl := apiTypes.Cluster{
 		ID:                     primitive.NewObjectID(),
 		CreationTimestamp:      fmt.Sprintf("%v", time.Now().UTC()),
@@ -77,7 +82,7 @@ func CreateClusterRecordFromRaw(
 		GitopsTemplateURL:      gitopsTemplateURL,
 		GitopsTemplateBranch:   gitopsTemplateBranch,
 		GitProvider:            gitProvider,
-		GitHost:                fmt.Sprintf("%s.com", gitProvider),
+		GitHost:                gitHost,
 		GitProtocol:            viper.GetString("flags.git-protocol"),
 		DNSProvider:            viper.GetString("flags.dns-provider"),
 		GitlabOwnerGroupID:     gitlabOwnerGroupID,
@@ -0,0 +1,149 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package vault
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/konstructio/kubefirst-api/pkg/k3d"
+	"github.com/konstructio/kubefirst-api/pkg/providerConfigs"
+	shell "github.com/konstructio/kubefirst-api/pkg/shell"
+	"github.com/konstructio/kubefirst/internal/httpclient"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// Target is the Vault of the platform recorded in the kubefirst config
+type Target struct {
+	ClusterName   string
+	CloudProvider string
+	// URL is the address of the Vault ingress
+	URL string
+	// Kubeconfig gives access to the cluster running Vault
+	Kubeconfig string
+	// CACert is an extra certificate authority trusted for URL, the mkcert
+	// root for k3d clusters
+	CACert string
+}
+
+// URLForDomain returns the Vault ingress of a platform served on domainName
+func URLForDomain(domainName, subdomainName string) string {
+	if subdomainName != "" {
+		domainName = fmt.Sprintf("%s.%s", subdomainName, domainName)
+	}
+	return fmt.Sprintf("https://vault.%s", domainName)
+}
+
+// ResolveTarget returns the Vault of the current platform. vaultURL and
+// kubeconfig override the values derived from the kubefirst config. Without a
+// platform only vaultURL is required, Kubeconfig is then only set when passed.
+func ResolveTarget(vaultURL, kubeconfig string) (*Target, error) {
+	clusterName := viper.GetString("flags.cluster-name")
+	cloudProvider := viper.GetString("kubefirst.cloud-provider")
+	domainName := viper.GetString("flags.domain-name")
+	if clusterName == "" || cloudProvider == "" {
+		if vaultURL != "" {
+			return &Target{URL: vaultURL, Kubeconfig: kubeconfig}, nil
+		}
+		return nil, errors.New("there doesn't appear to be an active kubefirst platform - pass --vault-url to target a vault directly")
+	}
+
+	target := &Target{
+		ClusterName:   clusterName,
+		CloudProvider: cloudProvider,
+		URL:           vaultURL,
+		Kubeconfig:    kubeconfig,
+	}
+
+	gitProvider := viper.GetString("flags.git-provider")
+	config, err := providerConfigs.GetConfig(
+		clusterName,
+		domainName,
+		gitProvider,
+		viper.GetString(fmt.Sprintf("flags.%s-owner", gitProvider)),
+		viper.GetString("flags.git-protocol"),
+		os.Getenv("CF_API_TOKEN"),
+		os.Getenv("CF_ORIGIN_CA_ISSUER_API_TOKEN"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+	if target.Kubeconfig == "" {
+		target.Kubeconfig = config.Kubeconfig
+	}
+
+	if target.URL == "" {
+		if domainName == "" {
+			return nil, fmt.Errorf("no domain name recorded for cluster %q - pass --vault-url", clusterName)
+		}
+		target.URL = URLForDomain(domainName, viper.GetString("flags.subdomain"))
+	}
+
+	if cloudProvider == k3d.CloudProvider {
+		target.CACert = mkcertRootCA(filepath.Join(config.K1Dir, "tools", "mkcert"))
+	}
+
+	return target, nil
+}
+
+// mkcertRootCA returns the root certificate mkcert signs k3d certificates
+// with, or an empty string when it can't be found
+func mkcertRootCA(mkcertClient string) string {
+	stdout, _, err := shell.ExecShellReturnStrings(mkcertClient, "-CAROOT")
+	if err != nil {
+		log.Debug().Msgf("unable to locate the mkcert root certificate: %v", err)
+		return ""
+	}
+
+	rootCA := filepath.Join(strings.TrimSpace(stdout), "rootCA.pem")
+	if _, err := os.Stat(rootCA); err != nil {
+		log.Debug().Msgf("unable to locate the mkcert root certificate: %v", err)
+		return ""
+	}
+	return rootCA
+}
+
+// NewClient returns a client for the Vault at address. Certificates are
+// verified against the system pool, the configured CA bundle and caCert.
+func NewClient(address, caCert string) (*api.Client, error) {
+	transport := httpclient.NewTransport()
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate %q: %w", caCert, err)
+		}
+
+		var pool *x509.CertPool
+		if transport.TLSClientConfig.RootCAs != nil {
+			pool = transport.TLSClientConfig.RootCAs.Clone()
+		} else if pool, err = x509.SystemCertPool(); err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %q", caCert)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	config := api.DefaultConfig()
+	config.Address = address
+	config.Timeout = 10 * time.Second
+	config.HttpClient.Transport = transport
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+	return client, nil
+}
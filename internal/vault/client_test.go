@@ -0,0 +1,60 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLForDomain(t *testing.T) {
+	require.Equal(t, "https://vault.example.com", URLForDomain("example.com", ""))
+	require.Equal(t, "https://vault.kubefirst.example.com", URLForDomain("example.com", "kubefirst"))
+}
+
+func TestResolveTarget(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	t.Setenv("HOME", t.TempDir())
+
+	t.Run("no platform", func(t *testing.T) {
+		viper.Reset()
+		_, err := ResolveTarget("", "")
+		require.Error(t, err)
+
+		target, err := ResolveTarget("https://vault.example.com", "/tmp/kubeconfig")
+		require.NoError(t, err)
+		require.Equal(t, &Target{URL: "https://vault.example.com", Kubeconfig: "/tmp/kubeconfig"}, target)
+
+		target, err = ResolveTarget("https://vault.example.com", "")
+		require.NoError(t, err)
+		require.Empty(t, target.Kubeconfig)
+	})
+
+	t.Run("from config", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("flags.cluster-name", "kubefirst")
+		viper.Set("kubefirst.cloud-provider", "civo")
+		viper.Set("flags.domain-name", "example.com")
+		viper.Set("flags.subdomain", "platform")
+		viper.Set("flags.git-provider", "github")
+
+		target, err := ResolveTarget("", "")
+		require.NoError(t, err)
+		require.Equal(t, "https://vault.platform.example.com", target.URL)
+		require.Contains(t, target.Kubeconfig, "/.k1/kubefirst/kubeconfig")
+		require.Empty(t, target.CACert)
+
+		target, err = ResolveTarget("https://vault.internal", "")
+		require.NoError(t, err)
+		require.Equal(t, "https://vault.internal", target.URL)
+	})
+
+	t.Run("missing domain", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("flags.cluster-name", "kubefirst")
+		viper.Set("kubefirst.cloud-provider", "aws")
+
+		_, err := ResolveTarget("", "")
+		require.ErrorContains(t, err, "no domain name recorded")
+	})
+}
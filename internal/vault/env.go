@@ -0,0 +1,123 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// Formats of the environment written by `terraform set-env`
+const (
+	FormatExport = "export"
+	FormatDotenv = "dotenv"
+	FormatJSON   = "json"
+	FormatTfvars = "tfvars"
+	FormatEnvrc  = "envrc"
+)
+
+// EnvFormats lists every supported environment format
+var EnvFormats = []string{FormatExport, FormatDotenv, FormatJSON, FormatTfvars, FormatEnvrc}
+
+// DefaultEnvPaths are the secrets read when no path is selected
+var DefaultEnvPaths = []string{"atlantis"}
+
+// DefaultEnvFile returns the file written for format when none is given
+func DefaultEnvFile(format string) string {
+	switch format {
+	case FormatJSON:
+		return "secrets.json"
+	case FormatTfvars:
+		return "secrets.auto.tfvars"
+	case FormatEnvrc:
+		return ".envrc"
+	default:
+		return ".env"
+	}
+}
+
+// ReadEnv reads the secrets at paths of the KV version 2 mount as environment
+// variables. Later paths override variables of earlier ones, and VAULT_ADDR
+// is always set to vaultURL.
+func ReadEnv(ctx context.Context, client *api.Client, mount string, paths []string, vaultURL string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, path := range paths {
+		secret, err := client.KVv2(mount).Get(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("error getting secret %q: %w", path, err)
+		}
+
+		for key, value := range secret.Data {
+			if key == "VAULT_ADDR" {
+				value = vaultURL
+			}
+			env[key] = strings.TrimSuffix(fmt.Sprint(value), "\n")
+		}
+	}
+	return env, nil
+}
+
+// PrefixEnv returns env with prefix prepended to every variable name
+func PrefixEnv(env map[string]string, prefix string) map[string]string {
+	prefixed := make(map[string]string, len(env))
+	for key, value := range env {
+		prefixed[prefix+key] = value
+	}
+	return prefixed
+}
+
+// FormatEnv renders env in format, with variables sorted by name
+func FormatEnv(env map[string]string, format string) ([]byte, error) {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatExport:
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "export %s=%q\n", key, env[key])
+		}
+	case FormatEnvrc:
+		fmt.Fprintln(&buf, "# generated by `kubefirst terraform set-env`, run `direnv allow` to load it")
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "export %s=%q\n", key, env[key])
+		}
+	case FormatDotenv:
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "%s=%q\n", key, env[key])
+		}
+	case FormatTfvars:
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "%s = %q\n", key, escapeTemplate(env[key]))
+		}
+	case FormatJSON:
+		data, err := json.MarshalIndent(env, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal secrets: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteString("\n")
+	default:
+		return nil, fmt.Errorf("invalid format %q - must be one of %s", format, strings.Join(EnvFormats, ", "))
+	}
+	return buf.Bytes(), nil
+}
+
+// escapeTemplate escapes HCL template sequences so values are used literally
+func escapeTemplate(value string) string {
+	value = strings.ReplaceAll(value, "${", "$${")
+	return strings.ReplaceAll(value, "%{", "%%{")
+}
@@ -0,0 +1,78 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatEnv(t *testing.T) {
+	env := map[string]string{"B": "two \"quoted\"", "A": "${var.one}"}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{format: FormatExport, expected: "export A=\"${var.one}\"\nexport B=\"two \\\"quoted\\\"\"\n"},
+		{format: FormatDotenv, expected: "A=\"${var.one}\"\nB=\"two \\\"quoted\\\"\"\n"},
+		{format: FormatTfvars, expected: "A = \"$${var.one}\"\nB = \"two \\\"quoted\\\"\"\n"},
+		{format: FormatJSON, expected: "{\n  \"A\": \"${var.one}\",\n  \"B\": \"two \\\"quoted\\\"\"\n}\n"},
+		{format: FormatEnvrc, expected: "# generated by `kubefirst terraform set-env`, run `direnv allow` to load it\nexport A=\"${var.one}\"\nexport B=\"two \\\"quoted\\\"\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			content, err := FormatEnv(env, tt.format)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(content))
+		})
+	}
+
+	_, err := FormatEnv(env, "yaml")
+	require.ErrorContains(t, err, `invalid format "yaml"`)
+}
+
+func TestPrefixEnv(t *testing.T) {
+	require.Equal(t, map[string]string{"TF_VAR_token": "x"}, PrefixEnv(map[string]string{"token": "x"}, "TF_VAR_"))
+}
+
+func TestDefaultEnvFile(t *testing.T) {
+	require.Equal(t, ".env", DefaultEnvFile(FormatExport))
+	require.Equal(t, ".env", DefaultEnvFile(FormatDotenv))
+	require.Equal(t, ".envrc", DefaultEnvFile(FormatEnvrc))
+	require.Equal(t, "secrets.auto.tfvars", DefaultEnvFile(FormatTfvars))
+	require.Equal(t, "secrets.json", DefaultEnvFile(FormatJSON))
+}
+
+func TestReadEnv(t *testing.T) {
+	secrets := map[string]string{
+		"/v1/secret/data/atlantis": `{"data": {"data": {"VAULT_ADDR": "http://vault.vault.svc:8200", "TOKEN": "one\n"}, "metadata": {"version": 1}}}`,
+		"/v1/secret/data/extra":    `{"data": {"data": {"TOKEN": "two"}, "metadata": {"version": 3}}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := secrets[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "")
+	require.NoError(t, err)
+
+	env, err := ReadEnv(context.Background(), client, KVMount, []string{"atlantis"}, "https://vault.example.com")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"VAULT_ADDR": "https://vault.example.com", "TOKEN": "one"}, env)
+
+	env, err = ReadEnv(context.Background(), client, KVMount, []string{"atlantis", "extra"}, "https://vault.example.com")
+	require.NoError(t, err)
+	require.Equal(t, "two", env["TOKEN"])
+
+	_, err = ReadEnv(context.Background(), client, KVMount, []string{"missing"}, "https://vault.example.com")
+	require.ErrorContains(t, err, `error getting secret "missing"`)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	"github.com/konstructio/kubefirst/internal/cluster"
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KVMount is the KV version 2 secrets engine every platform stores its secrets in
+const KVMount = "secret"
+
+// GenerateRootClient is the subset of the Vault sys API used to generate a root token
+type GenerateRootClient interface {
+	GenerateRootInitWithContext(ctx context.Context, otp, pgpKey string) (*api.GenerateRootStatusResponse, error)
+	GenerateRootUpdateWithContext(ctx context.Context, shard, nonce string) (*api.GenerateRootStatusResponse, error)
+	GenerateRootCancelWithContext(ctx context.Context) error
+}
+
+// GenerateRoot generates a new root token with the unseal keys
+func GenerateRoot(ctx context.Context, sys GenerateRootClient, keys []string) (string, error) {
+	status, err := sys.GenerateRootInitWithContext(ctx, "", "")
+	if err != nil {
+		return "", fmt.Errorf("failed to start root token generation: %w", err)
+	}
+	// the one-time password is only returned when generation starts
+	otp := status.OTP
+	if otp == "" {
+		cancelGenerateRoot(sys)
+		return "", errors.New("vault did not return a one-time password, a vault version of 1.10 or later is required")
+	}
+	if len(keys) < status.Required {
+		cancelGenerateRoot(sys)
+		return "", fmt.Errorf("root token generation requires %d unseal keys but only %d are available", status.Required, len(keys))
+	}
+
+	for i, shard := range keys {
+		log.Info().Msgf("passing unseal shard %d to root token generation", i+1)
+		status, err = sys.GenerateRootUpdateWithContext(ctx, shard, status.Nonce)
+		if err != nil {
+			cancelGenerateRoot(sys)
+			return "", fmt.Errorf("error passing unseal shard %d to root token generation: %w", i+1, err)
+		}
+		if status.Complete {
+			return DecodeToken(status.EncodedToken, otp)
+		}
+	}
+
+	cancelGenerateRoot(sys)
+	return "", fmt.Errorf("root token generation is still incomplete after %d unseal keys", len(keys))
+}
+
+func cancelGenerateRoot(sys GenerateRootClient) {
+	if err := sys.GenerateRootCancelWithContext(context.Background()); err != nil {
+		log.Warn().Msgf("failed to cancel root token generation: %v", err)
+	}
+}
+
+// DecodeToken decodes a generated root token encoded with the one-time password otp
+func DecodeToken(encoded, otp string) (string, error) {
+	tokenBytes, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode root token: %w", err)
+	}
+	if len(tokenBytes) != len(otp) {
+		return "", fmt.Errorf("encoded root token is %d bytes but the one-time password is %d", len(tokenBytes), len(otp))
+	}
+
+	for i := range tokenBytes {
+		tokenBytes[i] ^= otp[i]
+	}
+	return string(tokenBytes), nil
+}
+
+// UpdateInitSecretRootToken stores token as the root token of the init secret,
+// keeping the unseal keys
+func UpdateInitSecretRootToken(clientset kubernetes.Interface, token string) error {
+	secret, err := k8s.ReadSecretV2(clientset, Namespace, InitSecretName)
+	if err != nil {
+		return fmt.Errorf("failed to read secret: %w", err)
+	}
+	if len(secret) == 0 {
+		return fmt.Errorf("secret %q not found in namespace %q", InitSecretName, Namespace)
+	}
+
+	data := make(map[string][]byte, len(secret))
+	for key, value := range secret {
+		data[key] = []byte(value)
+	}
+	data["root-token"] = []byte(token)
+
+	if err := k8s.UpdateSecretV2(clientset, Namespace, InitSecretName, data); err != nil {
+		return fmt.Errorf("failed to update secret: %w", err)
+	}
+	return nil
+}
+
+// RootToken returns the root token of target, as shown by `root-credentials`.
+// The cluster record is only updated at install time, so the init secret is
+// used instead when the recorded token was rotated.
+func RootToken(ctx context.Context, client *api.Client, target *Target, clientset kubernetes.Interface) (string, error) {
+	var candidates []string
+	if target.ClusterName != "" {
+		record, err := cluster.GetCluster(target.ClusterName)
+		if err != nil {
+			log.Debug().Msgf("unable to read the root token from the cluster record: %v", err)
+		} else if record.VaultAuth.RootToken != "" {
+			candidates = append(candidates, record.VaultAuth.RootToken)
+		}
+	}
+
+	if clientset != nil {
+		initResponse, err := ReadInitSecret(clientset)
+		if err != nil {
+			log.Debug().Msgf("unable to read the root token from the init secret: %v", err)
+		} else if initResponse.RootToken != "" {
+			candidates = append(candidates, initResponse.RootToken)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", errors.New("unable to find the vault root token - pass --vault-token")
+	}
+
+	var lookupErr error
+	for _, token := range candidates {
+		client.SetToken(token)
+		if _, lookupErr = client.Auth().Token().LookupSelfWithContext(ctx); lookupErr == nil {
+			return token, nil
+		}
+	}
+	client.ClearToken()
+
+	return "", fmt.Errorf("the recorded vault root tokens can't be used - pass --vault-token: %w", lookupErr)
+}
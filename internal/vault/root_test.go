@@ -0,0 +1,145 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func encodeToken(token, otp string) string {
+	encoded := []byte(token)
+	for i := range encoded {
+		encoded[i] ^= otp[i]
+	}
+	return base64.RawStdEncoding.EncodeToString(encoded)
+}
+
+// fakeGenerateRoot completes root token generation once threshold keys were passed
+type fakeGenerateRoot struct {
+	threshold int
+	token     string
+	otp       string
+	received  []string
+	canceled  bool
+	updateErr error
+}
+
+func (f *fakeGenerateRoot) GenerateRootInitWithContext(context.Context, string, string) (*api.GenerateRootStatusResponse, error) {
+	return &api.GenerateRootStatusResponse{Nonce: "nonce", Started: true, Required: f.threshold, OTP: f.otp, OTPLength: len(f.otp)}, nil
+}
+
+func (f *fakeGenerateRoot) GenerateRootUpdateWithContext(_ context.Context, shard, nonce string) (*api.GenerateRootStatusResponse, error) {
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	if nonce != "nonce" {
+		return nil, errors.New("invalid nonce")
+	}
+	f.received = append(f.received, shard)
+	status := &api.GenerateRootStatusResponse{Nonce: nonce, Progress: len(f.received), Required: f.threshold}
+	if len(f.received) >= f.threshold {
+		status.Complete = true
+		status.EncodedToken = encodeToken(f.token, f.otp)
+	}
+	return status, nil
+}
+
+func (f *fakeGenerateRoot) GenerateRootCancelWithContext(context.Context) error {
+	f.canceled = true
+	return nil
+}
+
+func TestDecodeToken(t *testing.T) {
+	otp := "abcdefghijklmnopqrstuvwxyz0123"
+	token := "hvs.0123456789abcdefghijklmnop"
+
+	decoded, err := DecodeToken(encodeToken(token, otp), otp)
+	require.NoError(t, err)
+	require.Equal(t, token, decoded)
+
+	_, err = DecodeToken(encodeToken(token, otp), otp[:10])
+	require.Error(t, err)
+}
+
+func TestGenerateRoot(t *testing.T) {
+	keys := []string{"k1", "k2", "k3", "k4", "k5"}
+	otp := "abcdefghijklmnopqrstuvwxyz0123"
+	token := "hvs.0123456789abcdefghijklmnop"
+
+	t.Run("complete", func(t *testing.T) {
+		sys := &fakeGenerateRoot{threshold: 3, token: token, otp: otp}
+		generated, err := GenerateRoot(context.Background(), sys, keys)
+		require.NoError(t, err)
+		require.Equal(t, token, generated)
+		require.Equal(t, []string{"k1", "k2", "k3"}, sys.received)
+		require.False(t, sys.canceled)
+	})
+
+	t.Run("not enough keys", func(t *testing.T) {
+		sys := &fakeGenerateRoot{threshold: 3, token: token, otp: otp}
+		_, err := GenerateRoot(context.Background(), sys, keys[:2])
+		require.EqualError(t, err, "root token generation requires 3 unseal keys but only 2 are available")
+		require.True(t, sys.canceled)
+	})
+
+	t.Run("update error", func(t *testing.T) {
+		sys := &fakeGenerateRoot{threshold: 3, token: token, otp: otp, updateErr: errors.New("boom")}
+		_, err := GenerateRoot(context.Background(), sys, keys)
+		require.ErrorContains(t, err, "error passing unseal shard 1 to root token generation: boom")
+		require.True(t, sys.canceled)
+	})
+
+	t.Run("no otp", func(t *testing.T) {
+		sys := &fakeGenerateRoot{threshold: 3, token: token}
+		_, err := GenerateRoot(context.Background(), sys, keys)
+		require.Error(t, err)
+		require.True(t, sys.canceled)
+	})
+}
+
+func TestUpdateInitSecretRootToken(t *testing.T) {
+	clientset := fake.NewSimpleClientset(initSecret())
+
+	require.NoError(t, UpdateInitSecretRootToken(clientset, "hvs.rotated"))
+
+	secret, err := k8s.ReadSecretV2(clientset, Namespace, InitSecretName)
+	require.NoError(t, err)
+	require.Equal(t, "hvs.rotated", secret["root-token"])
+	require.Equal(t, "k1", secret["root-unseal-key-1"])
+
+	require.Error(t, UpdateInitSecretRootToken(fake.NewSimpleClientset(), "hvs.rotated"))
+}
+
+func TestRootToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/lookup-self" || r.Header.Get("X-Vault-Token") != "hvs.root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data": {"policies": ["root"]}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "")
+	require.NoError(t, err)
+
+	token, err := RootToken(context.Background(), client, &Target{}, fake.NewSimpleClientset(initSecret()))
+	require.NoError(t, err)
+	require.Equal(t, "hvs.root", token)
+
+	rotated := initSecret()
+	rotated.Data["root-token"] = []byte("hvs.revoked")
+	_, err = RootToken(context.Background(), client, &Target{}, fake.NewSimpleClientset(rotated))
+	require.ErrorContains(t, err, "pass --vault-token")
+
+	_, err = RootToken(context.Background(), client, &Target{}, nil)
+	require.EqualError(t, err, "unable to find the vault root token - pass --vault-token")
+}
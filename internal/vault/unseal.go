@@ -0,0 +1,327 @@
+/*
+Copyright (C) 2021-2023, Kubefirst
+
+This program is licensed under MIT.
+See the LICENSE file for more details.
+*/
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/konstructio/kubefirst-api/pkg/k8s"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// Namespace that Vault runs in
+	Namespace = "vault"
+	// InitSecretName is the Secret holding the root token and unseal keys
+	InitSecretName = "vault-unseal-secret"
+	// PodSelector matches the Vault server pods of every replica
+	PodSelector = "app.kubernetes.io/name=vault,component=server"
+
+	serverContainer = "vault"
+	serverPort      = 8200
+
+	// resyncInterval is how often Watch checks every replica, in case a pod
+	// event was missed or a replica was not reachable yet
+	resyncInterval = 30 * time.Second
+)
+
+// SysClient is the subset of the Vault sys API used to unseal a replica
+type SysClient interface {
+	SealStatusWithContext(ctx context.Context) (*api.SealStatusResponse, error)
+	UnsealWithContext(ctx context.Context, shard string) (*api.SealStatusResponse, error)
+}
+
+// ReadInitSecret returns the root token and unseal keys stored in the cluster
+func ReadInitSecret(clientset kubernetes.Interface) (*api.InitResponse, error) {
+	secret, err := k8s.ReadSecretV2(clientset, Namespace, InitSecretName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	var rkSlice []string
+	for key, value := range secret {
+		if strings.Contains(key, "root-unseal-key-") {
+			rkSlice = append(rkSlice, value)
+		}
+	}
+	slices.Sort(rkSlice)
+
+	existingInitResponse := &api.InitResponse{
+		Keys:      rkSlice,
+		RootToken: secret["root-token"],
+	}
+	return existingInitResponse, nil
+}
+
+// Replicas returns the names of the running Vault server pods, in ordinal order
+func Replicas(ctx context.Context, clientset kubernetes.Interface) ([]string, error) {
+	pods, err := clientset.CoreV1().Pods(Namespace).List(ctx, metav1.ListOptions{LabelSelector: PodSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vault pods: %w", err)
+	}
+
+	var names []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == v1.PodRunning {
+			names = append(names, pod.Name)
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// errNotInitialized is returned by UnsealNode for a replica that is not initialized
+var errNotInitialized = errors.New("is not initialized")
+
+// UnsealNode passes unseal keys to a replica until it reports being unsealed.
+// It returns whether the replica was sealed.
+//
+// A Raft follower that has not joined the cluster yet reports being
+// uninitialized and uses the unseal keys to join the leader, so uninitialized
+// replicas are only given the keys when joinRaft is set.
+func UnsealNode(ctx context.Context, sys SysClient, node string, keys []string, joinRaft bool) (bool, error) {
+	status, err := sys.SealStatusWithContext(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error retrieving seal status of %q: %w", node, err)
+	}
+	if !status.Initialized && !joinRaft {
+		return false, fmt.Errorf("%q %w", node, errNotInitialized)
+	}
+	if !status.Sealed {
+		log.Info().Msgf("%q is already unsealed", node)
+		return false, nil
+	}
+	if status.Initialized && len(keys) < status.T {
+		return true, fmt.Errorf("%q requires %d unseal keys but only %d are available", node, status.T, len(keys))
+	}
+
+	for i, shard := range keys {
+		log.Info().Msgf("passing unseal shard %d to %q", i+1, node)
+		status, err = sys.UnsealWithContext(ctx, shard)
+		if err != nil {
+			return true, fmt.Errorf("error passing unseal shard %d to %q: %w", i+1, node, err)
+		}
+		if !status.Sealed {
+			log.Info().Msgf("%q unsealed", node)
+			return true, nil
+		}
+	}
+
+	if !status.Initialized {
+		// the follower joins the leader in the background and is unsealed once
+		// it has caught up, the next UnsealAll or Watch resync picks it up
+		log.Info().Msgf("%q is joining the raft cluster", node)
+		return true, nil
+	}
+
+	return true, fmt.Errorf("%q is still sealed after %d unseal keys", node, len(keys))
+}
+
+// Unsealer unseals every Vault replica of a cluster with the keys of the init secret
+type Unsealer struct {
+	Clientset  kubernetes.Interface
+	RestConfig *rest.Config
+	// Connect returns a sys client for a replica and a function releasing it
+	Connect func(node string) (SysClient, func(), error)
+}
+
+// NewUnsealer returns an unsealer reaching each replica through a port-forward
+func NewUnsealer(kcfg *k8s.KubernetesClient) *Unsealer {
+	u := &Unsealer{
+		Clientset:  kcfg.Clientset,
+		RestConfig: kcfg.RestConfig,
+	}
+	u.Connect = u.portForward
+	return u
+}
+
+// UnsealAll unseals every running replica and returns the ones that were sealed
+func (u *Unsealer) UnsealAll(ctx context.Context) ([]string, error) {
+	initResponse, err := ReadInitSecret(u.Clientset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse existing vault init secret: %w", err)
+	}
+
+	nodes, err := Replicas(ctx, u.Clientset)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, errors.New("no running vault pods found")
+	}
+
+	var unsealed, uninitialized []string
+	var errs []error
+	for _, node := range nodes {
+		wasSealed, err := u.unseal(ctx, node, initResponse.Keys, false)
+		switch {
+		case errors.Is(err, errNotInitialized):
+			uninitialized = append(uninitialized, node)
+		case err != nil:
+			errs = append(errs, err)
+		case wasSealed:
+			unsealed = append(unsealed, node)
+		}
+	}
+
+	// replicas of an HA cluster that are not initialized are raft followers
+	// waiting to join, as long as another replica holds the data
+	if len(uninitialized) > 0 && len(uninitialized) == len(nodes) {
+		errs = append(errs, fmt.Errorf("no vault replica is initialized: %s", strings.Join(uninitialized, ", ")))
+		uninitialized = nil
+	}
+	for _, node := range uninitialized {
+		if _, err := u.unseal(ctx, node, initResponse.Keys, true); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		unsealed = append(unsealed, node)
+	}
+
+	return unsealed, errors.Join(errs...)
+}
+
+// Watch unseals every replica, then unseals replicas again whenever their pod
+// restarts, until ctx is canceled
+func (u *Unsealer) Watch(ctx context.Context) error {
+	if _, err := u.UnsealAll(ctx); err != nil {
+		log.Warn().Msgf("failed to unseal vault: %v", err)
+	}
+
+	resync := time.NewTicker(resyncInterval)
+	defer resync.Stop()
+
+	for {
+		watcher, err := u.Clientset.CoreV1().Pods(Namespace).Watch(ctx, metav1.ListOptions{LabelSelector: PodSelector})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			log.Warn().Msgf("failed to watch vault pods, retrying: %v", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-resync.C:
+				continue
+			}
+		}
+
+		if done := u.watch(ctx, watcher, resync.C); done {
+			return nil
+		}
+	}
+}
+
+// watch handles pod events until the watch closes, returning true once ctx is canceled
+func (u *Unsealer) watch(ctx context.Context, watcher watch.Interface, resync <-chan time.Time) bool {
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-resync:
+			if unsealed, err := u.UnsealAll(ctx); err != nil {
+				log.Warn().Msgf("failed to unseal vault: %v", err)
+			} else if len(unsealed) > 0 {
+				log.Info().Msgf("unsealed %s", strings.Join(unsealed, ", "))
+			}
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false
+			}
+			pod, isPod := event.Object.(*v1.Pod)
+			if !isPod || !NeedsUnseal(pod) {
+				continue
+			}
+
+			initResponse, err := ReadInitSecret(u.Clientset)
+			if err != nil {
+				log.Warn().Msgf("failed to parse existing vault init secret: %v", err)
+				continue
+			}
+			// the init secret only exists once a replica was initialized, so a
+			// restarted replica that is not initialized is a raft follower
+			if _, err := u.unseal(ctx, pod.Name, initResponse.Keys, true); err != nil {
+				log.Warn().Msgf("failed to unseal %q, retrying later: %v", pod.Name, err)
+			}
+		}
+	}
+}
+
+// NeedsUnseal reports whether pod runs a Vault server that is not ready,
+// which is how a sealed replica shows up
+func NeedsUnseal(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != v1.PodRunning {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == serverContainer {
+			return status.State.Running != nil && !status.Ready
+		}
+	}
+	return false
+}
+
+func (u *Unsealer) unseal(ctx context.Context, node string, keys []string, joinRaft bool) (bool, error) {
+	sys, release, err := u.Connect(node)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to %q: %w", node, err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	return UnsealNode(ctx, sys, node, keys, joinRaft)
+}
+
+// portForward connects to node through a port-forward on a free local port
+func (u *Unsealer) portForward(node string) (SysClient, func(), error) {
+	localPort, err := freeLocalPort()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stopChannel := make(chan struct{}, 1)
+	release := func() { close(stopChannel) }
+	err = k8s.OpenPortForwardPodWrapper(u.Clientset, u.RestConfig, node, Namespace, serverPort, localPort, stopChannel)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to open port-forward: %w", err)
+	}
+
+	config := api.DefaultConfig()
+	config.Address = fmt.Sprintf("http://127.0.0.1:%d", localPort)
+	client, err := api.NewClient(config)
+	if err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+
+	return client.Sys(), release, nil
+}
+
+func freeLocalPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("failed to find a free local port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,235 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeSys is a replica needing threshold keys to unseal
+type fakeSys struct {
+	initialized bool
+	sealed      bool
+	threshold   int
+	progress    int
+	received    []string
+	unsealErr   error
+}
+
+func (f *fakeSys) status() *api.SealStatusResponse {
+	return &api.SealStatusResponse{Initialized: f.initialized, Sealed: f.sealed, T: f.threshold, Progress: f.progress}
+}
+
+func (f *fakeSys) SealStatusWithContext(context.Context) (*api.SealStatusResponse, error) {
+	return f.status(), nil
+}
+
+func (f *fakeSys) UnsealWithContext(_ context.Context, shard string) (*api.SealStatusResponse, error) {
+	if f.unsealErr != nil {
+		return nil, f.unsealErr
+	}
+	f.received = append(f.received, shard)
+	f.progress++
+	if f.progress >= f.threshold {
+		f.sealed = false
+		f.progress = 0
+	}
+	return f.status(), nil
+}
+
+func TestUnsealNode(t *testing.T) {
+	keys := []string{"k1", "k2", "k3", "k4", "k5"}
+
+	t.Run("sealed", func(t *testing.T) {
+		sys := &fakeSys{initialized: true, sealed: true, threshold: 3}
+		wasSealed, err := UnsealNode(context.Background(), sys, "vault-0", keys, false)
+		require.NoError(t, err)
+		require.True(t, wasSealed)
+		require.False(t, sys.sealed)
+		require.Equal(t, []string{"k1", "k2", "k3"}, sys.received)
+	})
+
+	t.Run("already unsealed", func(t *testing.T) {
+		sys := &fakeSys{initialized: true, threshold: 3}
+		wasSealed, err := UnsealNode(context.Background(), sys, "vault-0", keys, false)
+		require.NoError(t, err)
+		require.False(t, wasSealed)
+		require.Empty(t, sys.received)
+	})
+
+	t.Run("not initialized", func(t *testing.T) {
+		sys := &fakeSys{sealed: true, threshold: 3}
+		_, err := UnsealNode(context.Background(), sys, "vault-1", keys, false)
+		require.EqualError(t, err, `"vault-1" is not initialized`)
+	})
+
+	t.Run("raft follower", func(t *testing.T) {
+		sys := &fakeSys{sealed: true, threshold: 3}
+		wasSealed, err := UnsealNode(context.Background(), sys, "vault-1", keys, true)
+		require.NoError(t, err)
+		require.True(t, wasSealed)
+		require.False(t, sys.sealed)
+	})
+
+	t.Run("raft follower still joining", func(t *testing.T) {
+		sys := &fakeSys{sealed: true, threshold: 10}
+		wasSealed, err := UnsealNode(context.Background(), sys, "vault-1", keys, true)
+		require.NoError(t, err)
+		require.True(t, wasSealed)
+		require.Equal(t, keys, sys.received)
+	})
+
+	t.Run("not enough keys", func(t *testing.T) {
+		sys := &fakeSys{initialized: true, sealed: true, threshold: 3}
+		_, err := UnsealNode(context.Background(), sys, "vault-0", keys[:2], false)
+		require.EqualError(t, err, `"vault-0" requires 3 unseal keys but only 2 are available`)
+		require.Empty(t, sys.received)
+	})
+
+	t.Run("unseal error", func(t *testing.T) {
+		sys := &fakeSys{initialized: true, sealed: true, threshold: 3, unsealErr: errors.New("boom")}
+		_, err := UnsealNode(context.Background(), sys, "vault-0", keys, false)
+		require.ErrorContains(t, err, `error passing unseal shard 1 to "vault-0": boom`)
+	})
+}
+
+func vaultPod(name string, phase v1.PodPhase, ready bool) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: Namespace,
+			Labels:    map[string]string{"app.kubernetes.io/name": "vault", "component": "server"},
+		},
+		Status: v1.PodStatus{
+			Phase: phase,
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:  "vault",
+				Ready: ready,
+				State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+			}},
+		},
+	}
+}
+
+func initSecret() *v1.Secret {
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: InitSecretName, Namespace: Namespace},
+		Data: map[string][]byte{
+			"root-token":        []byte("hvs.root"),
+			"root-unseal-key-1": []byte("k1"),
+			"root-unseal-key-2": []byte("k2"),
+			"root-unseal-key-3": []byte("k3"),
+		},
+	}
+}
+
+func TestReadInitSecret(t *testing.T) {
+	clientset := fake.NewSimpleClientset(initSecret())
+
+	initResponse, err := ReadInitSecret(clientset)
+	require.NoError(t, err)
+	require.Equal(t, "hvs.root", initResponse.RootToken)
+	require.Equal(t, []string{"k1", "k2", "k3"}, initResponse.Keys)
+
+	_, err = ReadInitSecret(fake.NewSimpleClientset())
+	require.Error(t, err)
+}
+
+func TestReplicas(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		vaultPod("vault-2", v1.PodRunning, false),
+		vaultPod("vault-0", v1.PodRunning, true),
+		vaultPod("vault-1", v1.PodPending, false),
+	)
+
+	nodes, err := Replicas(context.Background(), clientset)
+	require.NoError(t, err)
+	require.Equal(t, []string{"vault-0", "vault-2"}, nodes)
+}
+
+func TestNeedsUnseal(t *testing.T) {
+	require.True(t, NeedsUnseal(vaultPod("vault-0", v1.PodRunning, false)))
+	require.False(t, NeedsUnseal(vaultPod("vault-0", v1.PodRunning, true)))
+	require.False(t, NeedsUnseal(vaultPod("vault-0", v1.PodPending, false)))
+
+	terminating := vaultPod("vault-0", v1.PodRunning, false)
+	terminating.DeletionTimestamp = &metav1.Time{}
+	require.False(t, NeedsUnseal(terminating))
+}
+
+func TestUnsealAll(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		initSecret(),
+		vaultPod("vault-0", v1.PodRunning, true),
+		vaultPod("vault-1", v1.PodRunning, false),
+		vaultPod("vault-2", v1.PodRunning, false),
+	)
+	replicas := map[string]*fakeSys{
+		"vault-0": {initialized: true, threshold: 3},
+		"vault-1": {initialized: true, sealed: true, threshold: 3},
+		"vault-2": {initialized: true, sealed: true, threshold: 3, unsealErr: errors.New("connection refused")},
+	}
+
+	var released []string
+	u := &Unsealer{
+		Clientset: clientset,
+		Connect: func(node string) (SysClient, func(), error) {
+			return replicas[node], func() { released = append(released, node) }, nil
+		},
+	}
+
+	unsealed, err := u.UnsealAll(context.Background())
+	require.ErrorContains(t, err, `error passing unseal shard 1 to "vault-2": connection refused`)
+	require.Equal(t, []string{"vault-1"}, unsealed)
+	require.False(t, replicas["vault-1"].sealed)
+	require.Equal(t, []string{"vault-0", "vault-1", "vault-2"}, released)
+}
+
+func TestUnsealAllRaftFollowers(t *testing.T) {
+	t.Run("joins followers", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			initSecret(),
+			vaultPod("vault-0", v1.PodRunning, false),
+			vaultPod("vault-1", v1.PodRunning, false),
+		)
+		replicas := map[string]*fakeSys{
+			"vault-0": {initialized: true, sealed: true, threshold: 3},
+			"vault-1": {sealed: true, threshold: 3},
+		}
+		u := &Unsealer{
+			Clientset: clientset,
+			Connect: func(node string) (SysClient, func(), error) {
+				return replicas[node], func() {}, nil
+			},
+		}
+
+		unsealed, err := u.UnsealAll(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, []string{"vault-0", "vault-1"}, unsealed)
+		require.False(t, replicas["vault-1"].sealed)
+	})
+
+	t.Run("no initialized replica", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(
+			initSecret(),
+			vaultPod("vault-0", v1.PodRunning, false),
+		)
+		sys := &fakeSys{sealed: true, threshold: 3}
+		u := &Unsealer{
+			Clientset: clientset,
+			Connect: func(string) (SysClient, func(), error) {
+				return sys, func() {}, nil
+			},
+		}
+
+		_, err := u.UnsealAll(context.Background())
+		require.EqualError(t, err, "no vault replica is initialized: vault-0")
+		require.Empty(t, sys.received)
+	})
+}